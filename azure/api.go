@@ -0,0 +1,23 @@
+package azure
+
+import "context"
+
+// API is the set of Azure operations needed to find what to exempt and to
+// create exemptions, as implemented by Client. Callers that embed azexempt
+// can depend on it to substitute another implementation, such as a fake in
+// tests. The other methods of Client serve the wizard and are not part of
+// this interface.
+type API interface {
+	EnsureLogin(context.Context) error
+	CurrentPrincipal(context.Context) (Principal, error)
+
+	ListSubscriptions(context.Context) ([]Subscription, error)
+	ListResourceGroups(context.Context, string) ([]ResourceGroup, error)
+	ListAssignments(context.Context, string) ([]PolicyAssignment, error)
+	ListAssignmentDefinitions(context.Context, PolicyAssignment) ([]PolicyDefinitionRef, error)
+
+	ListExemptions(context.Context, string) ([]Exemption, error)
+	CreateExemption(context.Context, ExemptionSpec) (Exemption, error)
+}
+
+var _ API = (*Client)(nil)
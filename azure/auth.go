@@ -0,0 +1,120 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AuthMode selects how EnsureLogin signs in to the Azure CLI.
+type AuthMode string
+
+const (
+	// AuthInteractive reuses the Azure CLI session or starts the browser
+	// login of 'az login'.
+	AuthInteractive AuthMode = "interactive"
+	// AuthDeviceCode reuses the Azure CLI session or signs in with a device
+	// code that is entered on another device.
+	AuthDeviceCode AuthMode = "device_code"
+	// AuthServicePrincipal signs in as a service principal with a client
+	// secret or certificate.
+	AuthServicePrincipal AuthMode = "service_principal"
+	// AuthManagedIdentity signs in with the managed identity of the host.
+	AuthManagedIdentity AuthMode = "managed_identity"
+)
+
+// AuthModes lists the supported sign-in modes.
+var AuthModes = []AuthMode{AuthInteractive, AuthDeviceCode, AuthServicePrincipal, AuthManagedIdentity}
+
+// Auth configures how the Azure CLI is signed in. An empty Mode is
+// AuthInteractive.
+type Auth struct {
+	Mode     AuthMode
+	TenantID string
+	// ClientID is the application ID of the service principal, or of a
+	// user-assigned managed identity.
+	ClientID        string
+	ClientSecret    string
+	CertificatePath string
+}
+
+// WithEnv fills the empty fields of a from the AZURE_TENANT_ID,
+// AZURE_CLIENT_ID, AZURE_CLIENT_SECRET and AZURE_CLIENT_CERTIFICATE_PATH
+// environment variables, as used by the Azure SDKs.
+func (a Auth) WithEnv() Auth {
+	fill := func(field *string, name string) {
+		if *field == "" {
+			*field = os.Getenv(name)
+		}
+	}
+	fill(&a.TenantID, "AZURE_TENANT_ID")
+	fill(&a.ClientID, "AZURE_CLIENT_ID")
+	fill(&a.ClientSecret, "AZURE_CLIENT_SECRET")
+	fill(&a.CertificatePath, "AZURE_CLIENT_CERTIFICATE_PATH")
+	return a
+}
+
+// Validate checks that the mode is known and has the settings it needs.
+func (a Auth) Validate() error {
+	switch a.Mode {
+	case "", AuthInteractive, AuthDeviceCode, AuthManagedIdentity:
+		return nil
+	case AuthServicePrincipal:
+		switch {
+		case a.TenantID == "" || a.ClientID == "":
+			return errors.New("service principal sign-in needs a tenant ID and client ID")
+		case a.ClientSecret == "" && a.CertificatePath == "":
+			return errors.New("service principal sign-in needs a client secret or certificate")
+		case a.ClientSecret != "" && a.CertificatePath != "":
+			return errors.New("service principal sign-in takes a client secret or a certificate, not both")
+		}
+		return nil
+	}
+	modes := make([]string, len(AuthModes))
+	for i, mode := range AuthModes {
+		modes[i] = string(mode)
+	}
+	return fmt.Errorf("unknown sign-in mode %q (use %s)", a.Mode, strings.Join(modes, ", "))
+}
+
+// Interactive reports whether signing in involves the user. Other modes
+// never prompt and never start a browser.
+func (a Auth) Interactive() bool {
+	return a.Mode == "" || a.Mode == AuthInteractive || a.Mode == AuthDeviceCode
+}
+
+// loginArgs returns the az arguments that sign in with this configuration.
+func (a Auth) loginArgs() []string {
+	args := []string{"login"}
+	switch a.Mode {
+	case AuthDeviceCode:
+		args = append(args, "--use-device-code")
+	case AuthServicePrincipal:
+		args = append(args, "--service-principal", "--username", a.ClientID)
+		if a.CertificatePath != "" {
+			args = append(args, "--certificate", a.CertificatePath)
+		} else {
+			args = append(args, "--password", a.ClientSecret)
+		}
+	case AuthManagedIdentity:
+		args = append(args, "--identity")
+		if a.ClientID != "" {
+			args = append(args, "--username", a.ClientID)
+		}
+	}
+	if a.TenantID != "" && a.Mode != AuthManagedIdentity {
+		args = append(args, "--tenant", a.TenantID)
+	}
+	return args
+}
+
+// redact hides the client secret in the arguments of a failed login.
+func (a Auth) redact(err error) error {
+	var cmdErr *CommandError
+	if a.ClientSecret == "" || !errors.As(err, &cmdErr) {
+		return err
+	}
+	cmdErr.Args = redactArgs(cmdErr.Args, []string{a.ClientSecret})
+	return err
+}
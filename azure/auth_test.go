@@ -0,0 +1,96 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuthValidate(t *testing.T) {
+	for _, tc := range []struct {
+		auth Auth
+		want string
+	}{
+		{Auth{}, ""},
+		{Auth{Mode: AuthDeviceCode}, ""},
+		{Auth{Mode: AuthManagedIdentity}, ""},
+		{Auth{Mode: AuthServicePrincipal, TenantID: "t", ClientID: "c", ClientSecret: "s"}, ""},
+		{Auth{Mode: AuthServicePrincipal, TenantID: "t", ClientID: "c", CertificatePath: "/cert.pem"}, ""},
+		{Auth{Mode: AuthServicePrincipal, ClientID: "c", ClientSecret: "s"}, "tenant ID"},
+		{Auth{Mode: AuthServicePrincipal, TenantID: "t", ClientID: "c"}, "client secret or certificate"},
+		{Auth{Mode: AuthServicePrincipal, TenantID: "t", ClientID: "c", ClientSecret: "s", CertificatePath: "/cert.pem"}, "not both"},
+		{Auth{Mode: "browser"}, `unknown sign-in mode "browser"`},
+	} {
+		err := tc.auth.Validate()
+		if (tc.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("%#v.Validate() = %v, want %q", tc.auth, err, tc.want)
+		}
+	}
+}
+
+func TestAuthLoginArgs(t *testing.T) {
+	for _, tc := range []struct {
+		auth Auth
+		want []string
+	}{
+		{Auth{}, []string{"login"}},
+		{Auth{Mode: AuthDeviceCode, TenantID: "t"}, []string{"login", "--use-device-code", "--tenant", "t"}},
+		{Auth{Mode: AuthServicePrincipal, TenantID: "t", ClientID: "c", ClientSecret: "s"}, []string{"login", "--service-principal", "--username", "c", "--password", "s", "--tenant", "t"}},
+		{Auth{Mode: AuthServicePrincipal, TenantID: "t", ClientID: "c", CertificatePath: "/cert.pem"}, []string{"login", "--service-principal", "--username", "c", "--certificate", "/cert.pem", "--tenant", "t"}},
+		{Auth{Mode: AuthManagedIdentity, TenantID: "t"}, []string{"login", "--identity"}},
+		{Auth{Mode: AuthManagedIdentity, ClientID: "c"}, []string{"login", "--identity", "--username", "c"}},
+	} {
+		if got := tc.auth.loginArgs(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%#v.loginArgs() = %v, want %v", tc.auth, got, tc.want)
+		}
+	}
+}
+
+func TestAuthWithEnv(t *testing.T) {
+	t.Setenv("AZURE_TENANT_ID", "env-tenant")
+	t.Setenv("AZURE_CLIENT_ID", "env-client")
+	t.Setenv("AZURE_CLIENT_SECRET", "env-secret")
+	t.Setenv("AZURE_CLIENT_CERTIFICATE_PATH", "")
+	got := Auth{Mode: AuthServicePrincipal, ClientID: "config-client"}.WithEnv()
+	want := Auth{Mode: AuthServicePrincipal, TenantID: "env-tenant", ClientID: "config-client", ClientSecret: "env-secret"}
+	if got != want {
+		t.Fatalf("WithEnv() = %#v, want %#v", got, want)
+	}
+}
+
+func TestEnsureLoginNonInteractive(t *testing.T) {
+	log := installFakeAz(t)
+	c := NewClient()
+	c.Auth = Auth{Mode: AuthServicePrincipal, TenantID: "t", ClientID: "app", ClientSecret: "s3cret"}
+	if err := c.EnsureLogin(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, "login --service-principal --username app --password s3cret --tenant t")
+
+	// A failed login does not fall back to the browser and hides the secret.
+	os.Remove(log)
+	t.Setenv("AZ_LOGIN_FAIL", "1")
+	err := c.EnsureLogin(context.Background())
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || strings.Contains(strings.Join(cmdErr.Args, " "), "s3cret") || strings.Contains(err.Error(), "s3cret") {
+		t.Fatalf("failed login error = %#v", err)
+	}
+	if n := countCalls(t, log, "login"); n != 1 {
+		t.Fatalf("az login called %d times", n)
+	}
+
+	c.Auth = Auth{Mode: AuthManagedIdentity}
+	t.Setenv("AZ_LOGIN_FAIL", "")
+	if err := c.EnsureLogin(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, "login --identity")
+
+	c.Auth = Auth{Mode: AuthServicePrincipal}
+	if err := c.EnsureLogin(context.Background()); err == nil || !strings.Contains(err.Error(), "tenant ID") {
+		t.Fatalf("invalid auth error = %v", err)
+	}
+}
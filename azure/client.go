@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"sort"
@@ -12,22 +14,69 @@ import (
 	"time"
 )
 
-type Client struct{}
+// Client runs Azure operations through the Azure CLI. The zero value runs
+// the az executable in PATH with the default retry policy.
+type Client struct {
+	// Cloud names the Azure cloud EnsureLogin makes the Azure CLI use,
+	// e.g. AzureUSGovernment. Empty keeps the active cloud.
+	Cloud string
+	// Auth configures how EnsureLogin signs in.
+	Auth Auth
+	// Retry controls retries and timeouts of az commands.
+	Retry RetryPolicy
 
-func NewClient() *Client {
-	return &Client{}
+	runner Runner
+	logger *slog.Logger
 }
 
+// NewClient returns a client with the default retry policy, changed by
+// opts.
+func NewClient(opts ...Option) *Client {
+	c := &Client{Retry: DefaultRetryPolicy()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// EnsureLogin switches the Azure CLI to Cloud, if set, and signs in as
+// configured by Auth. Service
+// principals and managed identities always sign in, so that the configured
+// identity is used rather than an existing session; the other modes reuse
+// an existing session. Without a session, a client with its own Runner
+// fails instead of launching the interactive 'az login'.
 func (c *Client) EnsureLogin(ctx context.Context) error {
-	if _, err := exec.LookPath("az"); err != nil {
-		return fmt.Errorf("azure CLI (az) not found in PATH: %w", err)
+	if c.runner == nil {
+		if _, err := exec.LookPath("az"); err != nil {
+			return fmt.Errorf("azure CLI (az) not found in PATH: %w", err)
+		}
+	}
+	if err := c.Auth.Validate(); err != nil {
+		return err
+	}
+	if c.Cloud != "" {
+		if err := c.useCloud(ctx, c.Cloud); err != nil {
+			return err
+		}
+	}
+	if !c.Auth.Interactive() {
+		if _, err := c.runAzCommand(ctx, c.Auth.loginArgs()...); err != nil {
+			return fmt.Errorf("az login with %s failed: %w", c.Auth.Mode, c.Auth.redact(err))
+		}
+		return nil
 	}
 	if _, err := c.runAzCommand(ctx, "account", "show"); err == nil {
 		return nil
+	} else if c.runner != nil {
+		return fmt.Errorf("no active Azure CLI session: %w", err)
 	}
 
-	fmt.Println("No active Azure CLI session detected. Launching 'az login'...")
-	cmd := exec.CommandContext(ctx, "az", "login")
+	if c.Auth.Mode == AuthDeviceCode {
+		fmt.Println("No active Azure CLI session detected. Starting device code login...")
+	} else {
+		fmt.Println("No active Azure CLI session detected. Launching 'az login'...")
+	}
+	cmd := exec.CommandContext(ctx, "az", c.Auth.loginArgs()...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
@@ -37,6 +86,8 @@ func (c *Client) EnsureLogin(ctx context.Context) error {
 	return nil
 }
 
+// ListSubscriptions returns the subscriptions of the tenant the Azure CLI
+// is signed in to, sorted by name.
 func (c *Client) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
 	tenantID, err := c.getActiveTenantID(ctx)
 	if err != nil {
@@ -56,6 +107,8 @@ func (c *Client) ListSubscriptions(ctx context.Context) ([]Subscription, error)
 	return subs, nil
 }
 
+// ListResourceGroups returns the resource groups of the subscription,
+// sorted by name. subscriptionID is the bare subscription ID.
 func (c *Client) ListResourceGroups(ctx context.Context, subscriptionID string) ([]ResourceGroup, error) {
 	data, err := c.runAzCommand(ctx, "group", "list", "--subscription", subscriptionID, "--query", "[].{name:name,id:id}", "-o", "json")
 	if err != nil {
@@ -71,22 +124,54 @@ func (c *Client) ListResourceGroups(ctx context.Context, subscriptionID string)
 	return rgs, nil
 }
 
+// ListAssignments returns the policy assignments that apply to the
+// subscription, including those inherited from management groups, sorted
+// by display label. subscriptionID is the bare subscription ID.
 func (c *Client) ListAssignments(ctx context.Context, subscriptionID string) ([]PolicyAssignment, error) {
-	var allAssignments []PolicyAssignment
 	uri := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/policyAssignments?api-version=2021-06-01", subscriptionID)
+	return c.listAssignments(ctx, uri, "--subscription", subscriptionID)
+}
 
+// ListAssignmentPages calls page with every page of the policy assignments
+// of the subscription as it arrives, so that callers can show the first
+// ones while the rest are loading. Pages are in the order of the API and
+// not sorted; empty pages are skipped.
+func (c *Client) ListAssignmentPages(ctx context.Context, subscriptionID string, page func([]PolicyAssignment)) error {
+	uri := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/policyAssignments?api-version=2021-06-01", subscriptionID)
+	return c.assignmentPages(ctx, uri, page, "--subscription", subscriptionID)
+}
+
+// listAssignments pages through the policy assignments listed by uri,
+// sorted by display label.
+func (c *Client) listAssignments(ctx context.Context, uri string, extraArgs ...string) ([]PolicyAssignment, error) {
+	var allAssignments []PolicyAssignment
+	err := c.assignmentPages(ctx, uri, func(page []PolicyAssignment) {
+		allAssignments = append(allAssignments, page...)
+	}, extraArgs...)
+	if err != nil {
+		return nil, err
+	}
+	SortAssignments(allAssignments)
+	return allAssignments, nil
+}
+
+// assignmentPages follows the nextLink of the policy assignments listed by
+// uri and calls page with every non-empty page.
+func (c *Client) assignmentPages(ctx context.Context, uri string, page func([]PolicyAssignment), extraArgs ...string) error {
 	for uri != "" {
 		args := []string{
 			"rest",
 			"--method", "get",
 			"--uri", uri,
-			"--subscription", subscriptionID,
-			"--query", "{value:value[].{id:id,name:name,displayName:properties.displayName,scope:properties.scope,policyDefinitionId:properties.policyDefinitionId},nextLink:nextLink}",
-			"-o", "json",
 		}
+		args = append(args, extraArgs...)
+		args = append(args,
+			"--query", "{value:value[].{id:id,name:name,displayName:properties.displayName,scope:properties.scope,policyDefinitionId:properties.policyDefinitionId,parameters:properties.parameters},nextLink:nextLink}",
+			"-o", "json",
+		)
 		data, err := c.runAzCommand(ctx, args...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list policy assignments: %w", err)
+			return fmt.Errorf("failed to list policy assignments: %w", err)
 		}
 
 		var result struct {
@@ -94,19 +179,28 @@ func (c *Client) ListAssignments(ctx context.Context, subscriptionID string) ([]
 			NextLink string             `json:"nextLink"`
 		}
 		if err := json.Unmarshal(data, &result); err != nil {
-			return nil, fmt.Errorf("unable to parse assignment data: %w", err)
+			return fmt.Errorf("unable to parse assignment data: %w", err)
 		}
 
-		allAssignments = append(allAssignments, result.Value...)
+		if len(result.Value) > 0 {
+			page(result.Value)
+		}
 		uri = result.NextLink
 	}
+	return nil
+}
 
-	sort.Slice(allAssignments, func(i, j int) bool {
-		return strings.ToLower(allAssignments[i].DisplayLabel()) < strings.ToLower(allAssignments[j].DisplayLabel())
+// SortAssignments sorts assignments by display label, ignoring case, the
+// order in which ListAssignments returns them.
+func SortAssignments(assignments []PolicyAssignment) {
+	sort.Slice(assignments, func(i, j int) bool {
+		return strings.ToLower(assignments[i].DisplayLabel()) < strings.ToLower(assignments[j].DisplayLabel())
 	})
-	return allAssignments, nil
 }
 
+// ListAssignmentDefinitions returns the members of the initiative the
+// assignment assigns, with their effects resolved. It returns nothing for
+// the assignment of a single policy definition.
 func (c *Client) ListAssignmentDefinitions(ctx context.Context, assignment PolicyAssignment) ([]PolicyDefinitionRef, error) {
 	if assignment.PolicyDefinitionID == "" {
 		return nil, nil
@@ -129,32 +223,55 @@ func (c *Client) ListAssignmentDefinitions(ctx context.Context, assignment Polic
 	} else if sub != "" {
 		args = append(args, "--subscription", sub)
 	}
-	args = append(args, "--query", "{policyDefinitions:policyDefinitions[].{policyDefinitionId:policyDefinitionId,policyDefinitionReferenceId:policyDefinitionReferenceId}}", "-o", "json")
+	args = append(args, "--query", "{parameters:parameters,policyDefinitionGroups:policyDefinitionGroups[].{name:name,displayName:displayName,category:category},policyDefinitions:policyDefinitions[].{policyDefinitionId:policyDefinitionId,policyDefinitionReferenceId:policyDefinitionReferenceId,parameters:parameters,groupNames:groupNames}}", "-o", "json")
 
 	data, err := c.runAzCommand(ctx, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load policy set definition (ID: '%s'): %w", assignment.PolicyDefinitionID, err)
 	}
 	var set struct {
+		Parameters        map[string]parameterDefinition `json:"parameters"`
+		Groups            []PolicyDefinitionGroup        `json:"policyDefinitionGroups"`
 		PolicyDefinitions []struct {
-			PolicyDefinitionID string `json:"policyDefinitionId"`
-			ReferenceID        string `json:"policyDefinitionReferenceId"`
+			PolicyDefinitionID string                    `json:"policyDefinitionId"`
+			ReferenceID        string                    `json:"policyDefinitionReferenceId"`
+			Parameters         map[string]ParameterValue `json:"parameters"`
+			GroupNames         []string                  `json:"groupNames"`
 		} `json:"policyDefinitions"`
 	}
 	if err := json.Unmarshal(data, &set); err != nil {
 		return nil, fmt.Errorf("unable to parse policy set definition: %w", err)
 	}
+	groups := make(map[string]PolicyDefinitionGroup, len(set.Groups))
+	for _, group := range set.Groups {
+		groups[strings.ToLower(group.Name)] = group
+	}
 	var refs []PolicyDefinitionRef
 	for _, def := range set.PolicyDefinitions {
-		display := def.PolicyDefinitionID
-		if name, err := c.policyDisplayName(ctx, def.PolicyDefinitionID); err == nil && name != "" {
-			display = name
-		}
-		refs = append(refs, PolicyDefinitionRef{
+		ref := PolicyDefinitionRef{
 			PolicyDefinitionID: def.PolicyDefinitionID,
 			ReferenceID:        def.ReferenceID,
-			DisplayName:        display,
-		})
+			DisplayName:        def.PolicyDefinitionID,
+		}
+		for _, name := range def.GroupNames {
+			group, ok := groups[strings.ToLower(name)]
+			if !ok {
+				group = PolicyDefinitionGroup{Name: name}
+			}
+			ref.Groups = append(ref.Groups, group)
+		}
+		if member, err := c.memberDefinition(ctx, def.PolicyDefinitionID); err == nil {
+			if member.DisplayName != "" {
+				ref.DisplayName = member.DisplayName
+			} else if member.Name != "" {
+				ref.DisplayName = member.Name
+			}
+			ref.Effect = resolveEffect(member.Effect, []parameterScope{
+				{values: def.Parameters, defaults: member.Parameters},
+				{values: assignment.Parameters, defaults: set.Parameters},
+			})
+		}
+		refs = append(refs, ref)
 	}
 	sort.Slice(refs, func(i, j int) bool {
 		return strings.ToLower(refs[i].DisplayName) < strings.ToLower(refs[j].DisplayName)
@@ -162,48 +279,218 @@ func (c *Client) ListAssignmentDefinitions(ctx context.Context, assignment Polic
 	return refs, nil
 }
 
-func (c *Client) CreateExemption(ctx context.Context, scope string, scopeName string, subscriptionName string, assignment PolicyAssignment, referenceIDs []string, ticket, users, expirationDate string) (string, error) {
-	description := fmt.Sprintf("Ticket %s raised by %s on %s", ticket, users, time.Now().Format(time.RFC3339))
+// CreateExemption creates the policy exemption for spec and returns it as
+// created by Azure.
+func (c *Client) CreateExemption(ctx context.Context, spec ExemptionSpec) (Exemption, error) {
+	exemption := spec.Exemption(time.Now())
+	args := []string{
+		"policy", "exemption", "create",
+		"--name", exemption.Name,
+		"--scope", exemption.Scope,
+		"--policy-assignment", exemption.PolicyAssignmentID,
+		"--display-name", exemption.DisplayName,
+		"--description", exemption.Description,
+		"--exemption-category", exemption.Category,
+		"-o", "json",
+	}
+	if exemption.ExpiresOn != "" {
+		args = append(args, "--expires-on", exemption.ExpiresOn)
+	}
+	if len(exemption.ReferenceIDs) > 0 {
+		args = append(args, "--policy-definition-reference-ids")
+		args = append(args, exemption.ReferenceIDs...)
+	}
+	if selectors := exemption.ResourceSelectors; selectors != nil {
+		data, err := json.Marshal(selectors)
+		if err != nil {
+			return Exemption{}, fmt.Errorf("unable to encode resource selectors: %w", err)
+		}
+		args = append(args, "--resource-selectors", string(data))
+	}
+	if metadata := spec.metadata(); len(metadata) > 0 {
+		args = append(args, "--metadata")
+		args = append(args, metadata...)
+	}
+	data, err := c.runAzCommand(ctx, args...)
+	if err != nil {
+		return Exemption{}, fmt.Errorf("failed to create policy exemption: %w", err)
+	}
+	var created Exemption
+	if err := json.Unmarshal(data, &created); err != nil {
+		return Exemption{}, fmt.Errorf("unable to parse created exemption: %w", err)
+	}
+	created.Scope = exemption.Scope
+	return created, nil
+}
+
+// CurrentPrincipal returns the identity the Azure CLI is signed in with.
+// The object ID is resolved through Microsoft Graph when possible; if that
+// lookup is not permitted the sign-in name is used as the ID instead.
+func (c *Client) CurrentPrincipal(ctx context.Context) (Principal, error) {
+	data, err := c.runAzCommand(ctx, "account", "show", "--query", "{name:user.name,type:user.type}", "-o", "json")
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to read signed-in account: %w", err)
+	}
+	var p Principal
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Principal{}, fmt.Errorf("unable to parse account data: %w", err)
+	}
+	if p.Name == "" {
+		return Principal{}, fmt.Errorf("signed-in account has no user name")
+	}
 
-	// Generate exemption name: <scope> - <policy name>
-	// If scoped to subscription, use subscription name
-	// If scoped to resource group, use subscription/resource-group
-	var exemptionScope string
-	if scopeName == "Entire Subscription" || scopeName == subscriptionName {
-		exemptionScope = subscriptionName
+	var lookup []string
+	if strings.EqualFold(p.Type, "servicePrincipal") {
+		lookup = []string{"ad", "sp", "show", "--id", p.Name, "--query", "id", "-o", "tsv"}
 	} else {
-		exemptionScope = fmt.Sprintf("%s/%s", subscriptionName, scopeName)
+		lookup = []string{"ad", "signed-in-user", "show", "--query", "id", "-o", "tsv"}
 	}
-	exemptionName := fmt.Sprintf("%s - %s", exemptionScope, assignment.DisplayLabel())
+	p.ID = p.Name
+	if data, err := c.runAzCommand(ctx, lookup...); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			p.ID = id
+		}
+	}
+	return p, nil
+}
+
+// ListResourceFacets returns the distinct locations and resource types of
+// the resources in a subscription or resource group scope.
+func (c *Client) ListResourceFacets(ctx context.Context, scope string) (ResourceFacets, error) {
+	args := []string{"resource", "list"}
+	args = append(args, scopeArgs(scope)...)
+	args = append(args, "--query", "[].{location:location,type:type}", "-o", "json")
+	data, err := c.runAzCommand(ctx, args...)
+	if err != nil {
+		return ResourceFacets{}, fmt.Errorf("failed to list resources: %w", err)
+	}
+	var resources []struct {
+		Location string `json:"location"`
+		Type     string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return ResourceFacets{}, fmt.Errorf("unable to parse resource data: %w", err)
+	}
+	locations := make(map[string]bool)
+	types := make(map[string]bool)
+	var facets ResourceFacets
+	for _, res := range resources {
+		if loc := strings.ToLower(res.Location); loc != "" && !locations[loc] {
+			locations[loc] = true
+			facets.Locations = append(facets.Locations, loc)
+		}
+		if typ := res.Type; typ != "" && !types[strings.ToLower(typ)] {
+			types[strings.ToLower(typ)] = true
+			facets.ResourceTypes = append(facets.ResourceTypes, typ)
+		}
+	}
+	sort.Strings(facets.Locations)
+	sort.Slice(facets.ResourceTypes, func(i, j int) bool {
+		return strings.ToLower(facets.ResourceTypes[i]) < strings.ToLower(facets.ResourceTypes[j])
+	})
+	return facets, nil
+}
 
-	// Sanitize the exemption name (Azure has restrictions on names)
-	// Azure policy exemption names can only contain alphanumeric characters, hyphens, and underscores
-	sanitizedName := sanitizeExemptionName(exemptionName)
+// SummarizeCompliance returns the non-compliant resource counts reported by
+// Azure Policy Insights for every policy assignment that applies to the subscription.
+func (c *Client) SummarizeCompliance(ctx context.Context, subscriptionID string) (ComplianceSummary, error) {
+	return c.summarizeCompliance(ctx, "--subscription", subscriptionID)
+}
 
-	args := []string{
-		"policy", "exemption", "create",
-		"--name", sanitizedName,
-		"--scope", scope,
-		"--policy-assignment", assignment.ID,
-		"--display-name", exemptionName,
-		"--description", description,
-		"--exemption-category", "Waiver",
+// summarizeCompliance summarizes compliance for the scope given by the
+// scope arguments.
+func (c *Client) summarizeCompliance(ctx context.Context, scopeArgs ...string) (ComplianceSummary, error) {
+	args := []string{"policy", "state", "summarize"}
+	args = append(args, scopeArgs...)
+	args = append(args,
+		"--query", "policyAssignments[].{id:policyAssignmentId,nonCompliant:results.nonCompliantResources,definitions:policyDefinitions[].{referenceId:policyDefinitionReferenceId,nonCompliant:results.nonCompliantResources}}",
 		"-o", "json",
+	)
+	data, err := c.runAzCommand(ctx, args...)
+	if err != nil {
+		return ComplianceSummary{}, fmt.Errorf("failed to summarize policy compliance: %w", err)
+	}
+	var assignments []struct {
+		ID           string `json:"id"`
+		NonCompliant int    `json:"nonCompliant"`
+		Definitions  []struct {
+			ReferenceID  string `json:"referenceId"`
+			NonCompliant int    `json:"nonCompliant"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &assignments); err != nil {
+		return ComplianceSummary{}, fmt.Errorf("unable to parse compliance summary: %w", err)
+	}
+	summary := ComplianceSummary{
+		Assignments: make(map[string]int, len(assignments)),
+		Definitions: make(map[string]map[string]int, len(assignments)),
+	}
+	for _, assign := range assignments {
+		id := strings.ToLower(assign.ID)
+		summary.Assignments[id] = assign.NonCompliant
+		for _, def := range assign.Definitions {
+			if def.ReferenceID == "" {
+				continue
+			}
+			if summary.Definitions[id] == nil {
+				summary.Definitions[id] = make(map[string]int)
+			}
+			summary.Definitions[id][strings.ToLower(def.ReferenceID)] = def.NonCompliant
+		}
 	}
-	if expirationDate != "" {
-		t, _ := time.Parse("2006-01-02", expirationDate)
-		t = t.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-		args = append(args, "--expires-on", t.Format(time.RFC3339))
-	}
+	return summary, nil
+}
+
+// CountNonCompliant returns the number of distinct resources below scope that
+// are non-compliant with the assignment. When referenceIDs are given only
+// those initiative members are considered.
+func (c *Client) CountNonCompliant(ctx context.Context, scope string, assignmentID string, referenceIDs []string) (int, error) {
+	filter := fmt.Sprintf("policyAssignmentId eq '%s'", strings.ToLower(assignmentID))
 	if len(referenceIDs) > 0 {
-		args = append(args, "--policy-definition-reference-ids")
-		args = append(args, referenceIDs...)
+		refs := make([]string, len(referenceIDs))
+		for i, ref := range referenceIDs {
+			refs[i] = fmt.Sprintf("policyDefinitionReferenceId eq '%s'", strings.ToLower(ref))
+		}
+		filter += " and (" + strings.Join(refs, " or ") + ")"
+	}
+
+	args := []string{"policy", "state", "summarize"}
+	if level, _ := ParseScope(scope); level == ScopeResource {
+		// scopeArgs stops at the resource group of a resource.
+		args = append(args, "--resource", scope)
+	} else {
+		args = append(args, scopeArgs(scope)...)
 	}
+	args = append(args, "--filter", filter, "--query", "results.nonCompliantResources", "-o", "json")
 	data, err := c.runAzCommand(ctx, args...)
 	if err != nil {
-		return "", fmt.Errorf("failed to create policy exemption: %w", err)
+		return 0, fmt.Errorf("failed to summarize policy compliance: %w", err)
+	}
+	var count int
+	if err := json.Unmarshal(data, &count); err != nil {
+		return 0, fmt.Errorf("unable to parse compliance summary: %w", err)
 	}
-	return string(data), nil
+	return count, nil
+}
+
+// scopeArgs converts a management group, subscription or resource group
+// scope into the --management-group/--subscription/--resource-group
+// arguments understood by the Azure CLI.
+func scopeArgs(scope string) []string {
+	var args []string
+	parts := strings.Split(scope, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "subscriptions") {
+			args = append(args, "--subscription", parts[i+1])
+		}
+		if strings.EqualFold(parts[i], "resourceGroups") {
+			args = append(args, "--resource-group", parts[i+1])
+		}
+		if strings.EqualFold(parts[i], "managementGroups") {
+			args = append(args, "--management-group", parts[i+1])
+		}
+	}
+	return args
 }
 
 // sanitizeExemptionName removes or replaces characters that are not allowed in Azure policy exemption names
@@ -228,42 +515,131 @@ func sanitizeExemptionName(name string) string {
 	return sanitized
 }
 
-func (c *Client) policyDisplayName(ctx context.Context, definitionID string) (string, error) {
+// memberDefinition is the part of an initiative member's policy definition
+// needed to list it: its name and its (possibly parameterised) effect.
+type memberDefinition struct {
+	DisplayName string                         `json:"displayName"`
+	Name        string                         `json:"name"`
+	Effect      string                         `json:"effect"`
+	Parameters  map[string]parameterDefinition `json:"parameters"`
+}
+
+func (c *Client) memberDefinition(ctx context.Context, definitionID string) (memberDefinition, error) {
 	if definitionID == "" {
-		return "", nil
+		return memberDefinition{}, nil
 	}
 
-	name, sub, mg := c.parsePolicyID(definitionID)
-	if name == "" {
-		return "", fmt.Errorf("could not parse policy definition name from ID: %s", definitionID)
+	args, err := c.definitionShowArgs(definitionID)
+	if err != nil {
+		return memberDefinition{}, err
 	}
+	args = append(args, "--query", "{displayName:displayName,name:name,effect:policyRule.then.effect,parameters:parameters}", "-o", "json")
 
+	data, err := c.runAzCommand(ctx, args...)
+	if err != nil {
+		return memberDefinition{}, err
+	}
+	var def memberDefinition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return memberDefinition{}, err
+	}
+	return def, nil
+}
+
+// GetAssignmentDetails loads the properties of a policy assignment that are
+// not part of the assignment list, such as parameters and identity.
+func (c *Client) GetAssignmentDetails(ctx context.Context, assignment PolicyAssignment) (AssignmentDetails, error) {
 	args := []string{
-		"policy", "definition", "show",
-		"--name", name,
+		"rest",
+		"--method", "get",
+		"--uri", assignment.ID + "?api-version=2021-06-01",
+		"--query", "{description:properties.description,enforcementMode:properties.enforcementMode,scope:properties.scope,notScopes:properties.notScopes,parameters:properties.parameters,nonComplianceMessages:properties.nonComplianceMessages,identity:identity}",
+		"-o", "json",
 	}
-	if mg != "" {
-		args = append(args, "--management-group", mg)
-	} else if sub != "" {
-		args = append(args, "--subscription", sub)
+	data, err := c.runAzCommand(ctx, args...)
+	if err != nil {
+		return AssignmentDetails{}, fmt.Errorf("failed to load policy assignment details: %w", err)
+	}
+	var details AssignmentDetails
+	if err := json.Unmarshal(data, &details); err != nil {
+		return AssignmentDetails{}, fmt.Errorf("unable to parse assignment details: %w", err)
+	}
+	// The effect is informational; a definition that cannot be loaded
+	// leaves it empty.
+	if id := assignment.PolicyDefinitionID; id != "" && !strings.Contains(strings.ToLower(id), "policysetdefinitions") {
+		if def, err := c.memberDefinition(ctx, id); err == nil {
+			details.Effect = resolveEffect(def.Effect, []parameterScope{{values: details.Parameters, defaults: def.Parameters}})
+		}
 	}
-	args = append(args, "--query", "{displayName:displayName,name:name}", "-o", "json")
+	return details, nil
+}
+
+// GetDefinitionDetails loads the description, category, effect and policy
+// rule of a policy definition.
+func (c *Client) GetDefinitionDetails(ctx context.Context, definitionID string) (DefinitionDetails, error) {
+	args, err := c.definitionShowArgs(definitionID)
+	if err != nil {
+		return DefinitionDetails{}, err
+	}
+	args = append(args, "--query", "{displayName:displayName,description:description,category:metadata.category,mode:mode,policyRule:policyRule}", "-o", "json")
 
 	data, err := c.runAzCommand(ctx, args...)
 	if err != nil {
-		return "", err
+		return DefinitionDetails{}, fmt.Errorf("failed to load policy definition details: %w", err)
 	}
 	var def struct {
-		DisplayName string `json:"displayName"`
-		Name        string `json:"name"`
+		DisplayName string          `json:"displayName"`
+		Description string          `json:"description"`
+		Category    string          `json:"category"`
+		Mode        string          `json:"mode"`
+		PolicyRule  json.RawMessage `json:"policyRule"`
 	}
 	if err := json.Unmarshal(data, &def); err != nil {
-		return "", err
+		return DefinitionDetails{}, fmt.Errorf("unable to parse policy definition details: %w", err)
+	}
+	details := DefinitionDetails{
+		DisplayName: def.DisplayName,
+		Description: def.Description,
+		Category:    def.Category,
+		Mode:        def.Mode,
+	}
+	if len(def.PolicyRule) > 0 {
+		var rule struct {
+			Then struct {
+				Effect string `json:"effect"`
+			} `json:"then"`
+		}
+		if err := json.Unmarshal(def.PolicyRule, &rule); err == nil {
+			details.Effect = rule.Then.Effect
+		}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, def.PolicyRule, "", "  "); err == nil {
+			details.PolicyRule = pretty.String()
+		} else {
+			details.PolicyRule = string(def.PolicyRule)
+		}
+	}
+	return details, nil
+}
+
+// definitionShowArgs returns the 'az policy definition show' arguments that
+// locate the given policy definition ID.
+func (c *Client) definitionShowArgs(definitionID string) ([]string, error) {
+	name, sub, mg := c.parsePolicyID(definitionID)
+	if name == "" {
+		return nil, fmt.Errorf("could not parse policy definition name from ID: %s", definitionID)
 	}
-	if def.DisplayName != "" {
-		return def.DisplayName, nil
+
+	args := []string{
+		"policy", "definition", "show",
+		"--name", name,
+	}
+	if mg != "" {
+		args = append(args, "--management-group", mg)
+	} else if sub != "" {
+		args = append(args, "--subscription", sub)
 	}
-	return def.Name, nil
+	return args, nil
 }
 
 func (c *Client) parsePolicyID(id string) (name, subscription, managementGroup string) {
@@ -294,17 +670,76 @@ func (c *Client) getActiveTenantID(ctx context.Context) (string, error) {
 	return tenantID, nil
 }
 
+// runAzCommand runs az with args, retrying retriable failures as set by
+// the retry policy of the client.
 func (c *Client) runAzCommand(ctx context.Context, args ...string) ([]byte, error) {
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd := exec.CommandContext(ctx, "az", args...)
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		if stderr.Len() > 0 {
-			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	policy := c.Retry.withDefaults()
+	for attempt := 1; ; attempt++ {
+		out, err := c.runAzOnce(ctx, policy.CallTimeout, args)
+		if err == nil || ctx.Err() != nil || !IsRetriable(err) {
+			return out, err
 		}
-		return nil, err
+		if attempt >= policy.MaxAttempts {
+			if attempt > 1 {
+				err = &ExhaustedError{Attempts: attempt, Err: err}
+			}
+			return nil, err
+		}
+		delay := policy.delay(attempt, err)
+		if c.logger != nil {
+			c.logger.InfoContext(ctx, "retrying az command", "args", redactArgs(args, []string{c.Auth.ClientSecret}), "attempt", attempt+1, "delay", delay, "failure", Classify(err))
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return nil, err
+		}
+	}
+}
+
+// runAzOnce runs az with args once, limited to timeout.
+func (c *Client) runAzOnce(ctx context.Context, timeout time.Duration, args []string) ([]byte, error) {
+	runner := c.runner
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	out, err := runner.Run(callCtx, args)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		timeoutErr := fmt.Errorf("%w after %s", ErrCallTimeout, timeout)
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) {
+			cmdErr.Err = timeoutErr
+		} else {
+			err = &CommandError{Args: args, Err: timeoutErr}
+		}
+	}
+	if c.logger != nil {
+		c.logCall(ctx, args, time.Since(start), err)
+	}
+	return out, err
+}
+
+// maxLoggedStderr is the length of error output kept in logs.
+const maxLoggedStderr = 500
+
+// logCall logs an attempt of an az command: successes at info level with
+// their duration, so that slow calls show up in any log, and failures at
+// warn level with the exit code and the start of the error output.
+func (c *Client) logCall(ctx context.Context, args []string, duration time.Duration, err error) {
+	attrs := []any{"args", redactArgs(args, []string{c.Auth.ClientSecret}), "duration", duration}
+	if err == nil {
+		c.logger.InfoContext(ctx, "az command", append(attrs, "exitCode", 0)...)
+		return
+	}
+	var stderr string
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		stderr = redactText(cmdErr.Stderr, []string{c.Auth.ClientSecret})
+		if len(stderr) > maxLoggedStderr {
+			stderr = stderr[:maxLoggedStderr] + "..."
+		}
+		err = cmdErr.Err
 	}
-	return stdout.Bytes(), nil
+	c.logger.WarnContext(ctx, "az command failed", append(attrs, "exitCode", exitCode(err), "stderr", stderr, "error", err)...)
 }
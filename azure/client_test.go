@@ -70,6 +70,19 @@ func TestListAssignmentsPaginationAndSorting(t *testing.T) {
 	assertLogContains(t, log, "--uri /subscriptions/sub-1/providers/Microsoft.Authorization/policyAssignments?api-version=2021-06-01")
 	assertLogContains(t, log, "--uri https://next/page")
 
+	// Pages are passed on as they arrive, in the order of the API.
+	var pages [][]string
+	err = NewClient().ListAssignmentPages(context.Background(), "sub-1", func(page []PolicyAssignment) {
+		var names []string
+		for _, a := range page {
+			names = append(names, a.Name)
+		}
+		pages = append(pages, names)
+	})
+	if err != nil || !reflect.DeepEqual(pages, [][]string{{"z"}, {"a"}}) {
+		t.Fatalf("ListAssignmentPages() = %v, %v", pages, err)
+	}
+
 	t.Setenv("AZ_REST_FIRST", "bad-json")
 	if _, err := NewClient().ListAssignments(context.Background(), "sub-1"); err == nil || !strings.Contains(err.Error(), "parse assignment") {
 		t.Fatalf("ListAssignments() parse error = %v", err)
@@ -86,10 +99,13 @@ func TestListAssignmentDefinitions(t *testing.T) {
 		t.Fatalf("single definition ID = %#v, %v", got, err)
 	}
 
-	t.Setenv("AZ_SET_SHOW", `{"policyDefinitions":[{"policyDefinitionId":"/subscriptions/s/providers/Microsoft.Authorization/policyDefinitions/z","policyDefinitionReferenceId":"ref-z"},{"policyDefinitionId":"/providers/Microsoft.Authorization/policyDefinitions/a","policyDefinitionReferenceId":"ref-a"}]}`)
-	t.Setenv("AZ_DEF_Z", `{"displayName":"Zulu","name":"z"}`)
-	t.Setenv("AZ_DEF_A", `{"displayName":"Alpha","name":"a"}`)
-	assignment := PolicyAssignment{PolicyDefinitionID: "/subscriptions/s/providers/Microsoft.Authorization/policySetDefinitions/set1"}
+	t.Setenv("AZ_SET_SHOW", `{"parameters":{"zEffect":{"defaultValue":"Audit"}},"policyDefinitionGroups":[{"name":"CIS_1.1","displayName":"Identity and Access","category":"IAM"}],"policyDefinitions":[{"policyDefinitionId":"/subscriptions/s/providers/Microsoft.Authorization/policyDefinitions/z","policyDefinitionReferenceId":"ref-z","parameters":{"effect":{"value":"[parameters('zEffect')]"}},"groupNames":["cis_1.1","undeclared"]},{"policyDefinitionId":"/providers/Microsoft.Authorization/policyDefinitions/a","policyDefinitionReferenceId":"ref-a"}]}`)
+	t.Setenv("AZ_DEF_Z", `{"displayName":"Zulu","name":"z","effect":"[parameters('effect')]"}`)
+	t.Setenv("AZ_DEF_A", `{"displayName":"Alpha","name":"a","effect":"deny"}`)
+	assignment := PolicyAssignment{
+		PolicyDefinitionID: "/subscriptions/s/providers/Microsoft.Authorization/policySetDefinitions/set1",
+		Parameters:         map[string]ParameterValue{"zEffect": {Value: []byte(`"DeployIfNotExists"`)}},
+	}
 	refs, err := c.ListAssignmentDefinitions(context.Background(), assignment)
 	if err != nil {
 		t.Fatal(err)
@@ -97,6 +113,13 @@ func TestListAssignmentDefinitions(t *testing.T) {
 	if names := []string{refs[0].DisplayName, refs[1].DisplayName}; !reflect.DeepEqual(names, []string{"Alpha", "Zulu"}) {
 		t.Fatalf("definition names = %#v", names)
 	}
+	if effects := []string{refs[0].Effect, refs[1].Effect}; !reflect.DeepEqual(effects, []string{"Deny", "DeployIfNotExists"}) {
+		t.Fatalf("definition effects = %#v", effects)
+	}
+	wantGroups := []PolicyDefinitionGroup{{Name: "CIS_1.1", DisplayName: "Identity and Access", Category: "IAM"}, {Name: "undeclared"}}
+	if !reflect.DeepEqual(refs[1].Groups, wantGroups) || refs[0].Groups != nil {
+		t.Fatalf("definition groups = %#v, %#v", refs[0].Groups, refs[1].Groups)
+	}
 	assertLogContains(t, log, "policy set-definition show --name set1 --subscription s")
 	assertLogContains(t, log, "policy definition show --name a")
 
@@ -108,11 +131,12 @@ func TestListAssignmentDefinitions(t *testing.T) {
 
 func TestCreateExemptionArguments(t *testing.T) {
 	log := installFakeAz(t)
-	t.Setenv("AZ_CREATE", `{"name":"created"}`)
+	t.Setenv("AZ_CREATE", `{"id":"/subscriptions/s/resourceGroups/rg/providers/Microsoft.Authorization/policyExemptions/created","name":"created","exemptionCategory":"Waiver","expiresOn":"2030-05-06T23:59:59+00:00","systemData":{"createdBy":"ada"}}`)
 	assignment := PolicyAssignment{ID: "/assignments/a", DisplayName: "Require TLS"}
-	out, err := NewClient().CreateExemption(context.Background(), "/subscriptions/s/resourceGroups/rg", "rg", "Production", assignment, []string{"ref-a", "ref-b"}, "INC123", "Ada", "2030-05-06")
-	if err != nil || out != `{"name":"created"}` {
-		t.Fatalf("CreateExemption() = %q, %v", out, err)
+	spec := ExemptionSpec{Scope: "/subscriptions/s/resourceGroups/rg", ScopeName: "rg", SubscriptionName: "Production", Assignment: assignment, ReferenceIDs: []string{"ref-a", "ref-b"}, Ticket: "INC123", Users: "Ada", ExpirationDate: "2030-05-06"}
+	created, err := NewClient().CreateExemption(context.Background(), spec)
+	if err != nil || created.Name != "created" || created.Scope != spec.Scope || created.ExpiresOn != "2030-05-06T23:59:59+00:00" || !strings.HasSuffix(created.ID, "/policyExemptions/created") {
+		t.Fatalf("CreateExemption() = %+v, %v", created, err)
 	}
 	assertLogContains(t, log, "policy exemption create --name Production-rg---Require-TLS")
 	assertLogContains(t, log, "--scope /subscriptions/s/resourceGroups/rg")
@@ -121,12 +145,163 @@ func TestCreateExemptionArguments(t *testing.T) {
 	assertLogContains(t, log, "--expires-on 2030-05-06T23:59:59Z")
 	assertLogContains(t, log, "--policy-definition-reference-ids ref-a ref-b")
 
+	spec.RequestedBy = &Principal{ID: "requester-id", Name: "ada@example.com"}
+	spec.ApprovedBy = &Principal{ID: "approver-id", Name: "linus@example.com"}
+	if _, err := NewClient().CreateExemption(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, "approved by linus@example.com (approver-id)")
+	assertLogContains(t, log, "--metadata requestedBy=requester-id approvedBy=approver-id")
+
+	spec.RequesterUnverified = true
+	if _, err := NewClient().CreateExemption(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, "approved by linus@example.com (approver-id) without verifying the requester")
+	assertLogContains(t, log, "--metadata requestedBy=requester-id approvedBy=approver-id requesterVerified=false")
+	spec.RequesterUnverified = false
+
+	spec.Selectors = ResourceSelectors{Locations: []string{"westeurope"}}
+	if _, err := NewClient().CreateExemption(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, `--resource-selectors [{"name":"azexempt","selectors":[{"kind":"resourceLocation","in":["westeurope"]}]}]`)
+
+	mg := ExemptionSpec{Scope: "/providers/Microsoft.Management/managementGroups/corp", ScopeName: "Corp", Assignment: assignment, Ticket: "T", Users: "U"}
+	if _, err := NewClient().CreateExemption(context.Background(), mg); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, "policy exemption create --name Corp---Require-TLS --scope /providers/Microsoft.Management/managementGroups/corp")
+
+	t.Setenv("AZ_CREATE", "not-json")
+	if _, err := NewClient().CreateExemption(context.Background(), mg); err == nil || !strings.Contains(err.Error(), "parse created exemption") {
+		t.Fatalf("CreateExemption() parse error = %v", err)
+	}
+
 	t.Setenv("AZ_FAIL_MATCH", "policy exemption create")
-	if _, err := NewClient().CreateExemption(context.Background(), "/s", "Entire Subscription", "Prod", assignment, nil, "T", "U", ""); err == nil || !strings.Contains(err.Error(), "failed to create") {
+	if _, err := NewClient().CreateExemption(context.Background(), ExemptionSpec{Scope: "/s", ScopeName: "Entire Subscription", SubscriptionName: "Prod", Assignment: assignment, Ticket: "T", Users: "U"}); err == nil || !strings.Contains(err.Error(), "failed to create") {
 		t.Fatalf("CreateExemption() error = %v", err)
 	}
 }
 
+func TestListResourceFacets(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_RESOURCE_LIST", `[{"location":"WestEurope","type":"Microsoft.Storage/storageAccounts"},{"location":"westeurope","type":"microsoft.storage/storageAccounts"},{"location":"global","type":"Microsoft.Network/dnsZones"},{"location":"","type":""}]`)
+	facets, err := NewClient().ListResourceFacets(context.Background(), "/subscriptions/sub-1/resourceGroups/rg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ResourceFacets{Locations: []string{"global", "westeurope"}, ResourceTypes: []string{"Microsoft.Network/dnsZones", "Microsoft.Storage/storageAccounts"}}
+	if !reflect.DeepEqual(facets, want) {
+		t.Fatalf("ListResourceFacets() = %#v, want %#v", facets, want)
+	}
+	assertLogContains(t, log, "resource list --subscription sub-1 --resource-group rg --query [].{location:location,type:type} -o json")
+
+	t.Setenv("AZ_FAIL_MATCH", "resource list")
+	if _, err := NewClient().ListResourceFacets(context.Background(), "/subscriptions/sub-1"); err == nil || !strings.Contains(err.Error(), "failed to list resources") {
+		t.Fatalf("ListResourceFacets() error = %v", err)
+	}
+}
+
+func TestComplianceSummaries(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_STATE_SUMMARIZE", `[{"id":"/Subs/A","nonCompliant":4,"definitions":[{"referenceId":"Ref-1","nonCompliant":3},{"referenceId":"","nonCompliant":1}]},{"id":"/subs/b","nonCompliant":0,"definitions":null}]`)
+	summary, err := NewClient().SummarizeCompliance(context.Background(), "sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := summary.AssignmentCount("/subs/a"); !ok || n != 4 {
+		t.Fatalf("AssignmentCount() = %d, %v", n, ok)
+	}
+	if n, ok := summary.DefinitionCount("/SUBS/A", "ref-1"); !ok || n != 3 {
+		t.Fatalf("DefinitionCount() = %d, %v", n, ok)
+	}
+	if _, ok := summary.DefinitionCount("/subs/b", "ref-1"); ok {
+		t.Fatal("unknown definition reported a count")
+	}
+	assertLogContains(t, log, "policy state summarize --subscription sub-1")
+
+	t.Setenv("AZ_STATE_SUMMARIZE", "12")
+	count, err := NewClient().CountNonCompliant(context.Background(), "/subscriptions/sub-1/resourceGroups/rg", "/Subs/A", []string{"Ref-1", "ref-2"})
+	if err != nil || count != 12 {
+		t.Fatalf("CountNonCompliant() = %d, %v", count, err)
+	}
+	assertLogContains(t, log, "--subscription sub-1 --resource-group rg --filter policyAssignmentId eq '/subs/a' and (policyDefinitionReferenceId eq 'ref-1' or policyDefinitionReferenceId eq 'ref-2')")
+	if _, err := NewClient().CountNonCompliant(context.Background(), "/providers/Microsoft.Management/managementGroups/corp", "/subs/a", nil); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, "policy state summarize --management-group corp --filter")
+	storage := "/subscriptions/sub-1/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/logs"
+	if _, err := NewClient().CountNonCompliant(context.Background(), storage, "/subs/a", nil); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, "policy state summarize --resource "+storage+" --filter")
+
+	t.Setenv("AZ_STATE_SUMMARIZE", "bad-json")
+	if _, err := NewClient().SummarizeCompliance(context.Background(), "sub-1"); err == nil || !strings.Contains(err.Error(), "parse compliance") {
+		t.Fatalf("SummarizeCompliance() parse error = %v", err)
+	}
+	if _, err := NewClient().CountNonCompliant(context.Background(), "/subscriptions/sub-1", "a", nil); err == nil || !strings.Contains(err.Error(), "parse compliance") {
+		t.Fatalf("CountNonCompliant() parse error = %v", err)
+	}
+	t.Setenv("AZ_FAIL_MATCH", "policy state summarize")
+	if _, err := NewClient().SummarizeCompliance(context.Background(), "sub-1"); err == nil || !strings.Contains(err.Error(), "failed to summarize") {
+		t.Fatalf("SummarizeCompliance() error = %v", err)
+	}
+}
+
+func TestGetAssignmentDetails(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_ASSIGNMENT_SHOW", `{"description":"Baseline","enforcementMode":"DoNotEnforce","scope":"/providers/Microsoft.Management/managementGroups/root","parameters":{"effect":{"value":"Audit"},"locations":{"value":["westeurope", "northeurope"]}},"nonComplianceMessages":[{"message":"Use TLS","policyDefinitionReferenceId":"tls"}],"identity":{"type":"SystemAssigned","principalId":"p-1"}}`)
+	details, err := NewClient().GetAssignmentDetails(context.Background(), PolicyAssignment{ID: "/subscriptions/s/providers/Microsoft.Authorization/policyAssignments/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Description != "Baseline" || details.EnforcementMode != "DoNotEnforce" || details.Identity == nil || details.Identity.PrincipalID != "p-1" || len(details.NonComplianceMessages) != 1 {
+		t.Fatalf("details = %#v", details)
+	}
+	if got := details.Parameters["locations"].String(); got != `["westeurope","northeurope"]` {
+		t.Fatalf("parameter value = %q", got)
+	}
+	assertLogContains(t, log, "--uri /subscriptions/s/providers/Microsoft.Authorization/policyAssignments/a?api-version=2021-06-01")
+	if details.Effect != "" {
+		t.Fatalf("effect of assignment without definition = %q", details.Effect)
+	}
+
+	// The effect of a single policy is resolved against the assignment.
+	t.Setenv("AZ_DEF_Z", `{"displayName":"Zulu","name":"z","effect":"[parameters('effect')]","parameters":{"effect":{"defaultValue":"Deny"}}}`)
+	details, err = NewClient().GetAssignmentDetails(context.Background(), PolicyAssignment{ID: "/a", PolicyDefinitionID: "/providers/Microsoft.Authorization/policyDefinitions/z"})
+	if err != nil || details.Effect != "Audit" {
+		t.Fatalf("single policy effect = %q, %v", details.Effect, err)
+	}
+
+	t.Setenv("AZ_ASSIGNMENT_SHOW", "bad-json")
+	if _, err := NewClient().GetAssignmentDetails(context.Background(), PolicyAssignment{ID: "/a"}); err == nil || !strings.Contains(err.Error(), "parse assignment details") {
+		t.Fatalf("parse error = %v", err)
+	}
+}
+
+func TestGetDefinitionDetails(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_DEF_DETAILS", `{"displayName":"Require TLS","description":"Denies HTTP","category":"Storage","mode":"Indexed","policyRule":{"if":{"field":"type","equals":"x"},"then":{"effect":"[parameters('effect')]"}}}`)
+	details, err := NewClient().GetDefinitionDetails(context.Background(), "/providers/Microsoft.Management/managementGroups/mg/providers/Microsoft.Authorization/policyDefinitions/tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Category != "Storage" || details.Effect != "[parameters('effect')]" || !strings.Contains(details.PolicyRule, "\n  \"then\": {") {
+		t.Fatalf("details = %#v", details)
+	}
+	assertLogContains(t, log, "policy definition show --name tls --management-group mg")
+
+	if _, err := NewClient().GetDefinitionDetails(context.Background(), "/invalid"); err == nil {
+		t.Fatal("unparsable definition ID should fail")
+	}
+	t.Setenv("AZ_DEF_DETAILS", "bad-json")
+	if _, err := NewClient().GetDefinitionDetails(context.Background(), "/policyDefinitions/tls"); err == nil || !strings.Contains(err.Error(), "parse policy definition") {
+		t.Fatalf("parse error = %v", err)
+	}
+}
+
 func TestSanitizeExemptionName(t *testing.T) {
 	tests := map[string]string{
 		"allowed-A_1.txt":       "allowed-A_1.txt",
@@ -159,6 +334,29 @@ func TestParsePolicyID(t *testing.T) {
 	}
 }
 
+func TestCurrentPrincipal(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_ACCOUNT_SHOW", `{"name":"ada@example.com","type":"user"}`)
+	t.Setenv("AZ_SIGNED_IN_USER_ID", "object-id")
+	p, err := NewClient().CurrentPrincipal(context.Background())
+	if err != nil || p != (Principal{ID: "object-id", Name: "ada@example.com", Type: "user"}) {
+		t.Fatalf("CurrentPrincipal() = %#v, %v", p, err)
+	}
+
+	t.Setenv("AZ_ACCOUNT_SHOW", `{"name":"app-id","type":"servicePrincipal"}`)
+	t.Setenv("AZ_FAIL_MATCH", "ad sp show")
+	p, err = NewClient().CurrentPrincipal(context.Background())
+	if err != nil || p.ID != "app-id" {
+		t.Fatalf("CurrentPrincipal() fallback = %#v, %v", p, err)
+	}
+	assertLogContains(t, log, "ad sp show --id app-id --query id -o tsv")
+
+	t.Setenv("AZ_ACCOUNT_SHOW", `{}`)
+	if _, err := NewClient().CurrentPrincipal(context.Background()); err == nil {
+		t.Fatal("CurrentPrincipal() without user name should fail")
+	}
+}
+
 func TestEnsureLogin(t *testing.T) {
 	installFakeAz(t)
 	t.Setenv("AZ_ACCOUNT_SHOW", `{}`)
@@ -184,18 +382,36 @@ func installFakeAz(t *testing.T) string {
 	script := `#!/bin/sh
 printf '%s\n' "$*" >> "$AZ_TEST_LOG"
 case "$*" in
-  *"$AZ_FAIL_MATCH"*) if [ -n "$AZ_FAIL_MATCH" ]; then printf '%s\n' "${AZ_FAIL_MESSAGE:-failed}" >&2; exit 1; fi ;;
+  *"$AZ_FAIL_MATCH"*) if [ -n "$AZ_FAIL_MATCH" ]; then
+    failed=$(cat "$AZ_TEST_LOG.failed" 2>/dev/null || echo 0)
+    if [ -z "$AZ_FAIL_TIMES" ] || [ "$failed" -lt "$AZ_FAIL_TIMES" ]; then
+      echo $((failed + 1)) > "$AZ_TEST_LOG.failed"
+      printf '%s\n' "${AZ_FAIL_MESSAGE:-failed}" >&2; exit 1
+    fi
+  fi ;;
+esac
+case "$*" in
+  *"$AZ_SLOW_MATCH"*) if [ -n "$AZ_SLOW_MATCH" ]; then exec sleep 10; fi ;;
 esac
 case "$*" in
   "account show"*"tenantId"*"tsv") printf '%s' "${AZ_ACCOUNT_SHOW_TENANT_ID}" ;;
-  "account show"*) printf '%s' "${AZ_ACCOUNT_SHOW:-{}}" ;;
-  "login") if [ -n "$AZ_LOGIN_FAIL" ]; then exit 1; fi; printf '%s' "{}" ;;
+  "account show"*) if [ -n "$AZ_ACCOUNT_SHOW" ]; then printf '%s' "$AZ_ACCOUNT_SHOW"; else printf '{}'; fi ;;
+  "ad signed-in-user show"*) printf '%s' "$AZ_SIGNED_IN_USER_ID" ;;
+  "login"*) if [ -n "$AZ_LOGIN_FAIL" ]; then printf '%s\n' "ERROR: login failed" >&2; exit 1; fi; printf '%s' "{}" ;;
   "account list"*) printf '%s' "$AZ_ACCOUNT_LIST" ;;
+  "cloud show"*) if [ -n "$AZ_CLOUD_SHOW" ]; then printf '%s' "$AZ_CLOUD_SHOW"; else printf '{"name":"AzureCloud","portal":"https://portal.azure.com"}'; fi ;;
   "group list"*) printf '%s' "$AZ_GROUP_LIST" ;;
-  "rest"*) case "$*" in *"https://next/page"*) printf '%s' "$AZ_REST_NEXT" ;; *) printf '%s' "$AZ_REST_FIRST" ;; esac ;;
+  "account management-group entities list"*) printf '%s' "$AZ_MG_ENTITIES" ;;
+  "rest"*"/providers/Microsoft.Authorization/permissions"*) case "$*" in
+    *"${AZ_READ_ONLY_SCOPE:-none}/providers"*) printf '{"value":[{"actions":["*/read"],"notActions":[]}]}' ;;
+    *) printf '%s' "$AZ_PERMISSIONS" ;;
+  esac ;;
+  "rest"*) case "$*" in *enforcementMode*) printf '%s' "$AZ_ASSIGNMENT_SHOW" ;; *"https://next/page"*) printf '%s' "$AZ_REST_NEXT" ;; *) printf '%s' "$AZ_REST_FIRST" ;; esac ;;
   "policy set-definition show"*) printf '%s' "$AZ_SET_SHOW" ;;
-  "policy definition show"*) case "$*" in *"--name z"*) printf '%s' "$AZ_DEF_Z" ;; *"--name a"*) printf '%s' "$AZ_DEF_A" ;; esac ;;
+  "policy definition show"*) case "$*" in *metadata.category*) printf '%s' "$AZ_DEF_DETAILS" ;; *"--name z"*) printf '%s' "$AZ_DEF_Z" ;; *"--name a"*) printf '%s' "$AZ_DEF_A" ;; esac ;;
   "policy exemption create"*) printf '%s' "$AZ_CREATE" ;;
+  "resource list"*) printf '%s' "$AZ_RESOURCE_LIST" ;;
+  "policy state summarize"*) printf '%s' "$AZ_STATE_SUMMARIZE" ;;
 esac
 `
 	path := filepath.Join(dir, "az")
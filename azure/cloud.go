@@ -0,0 +1,97 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Cloud is the Azure cloud the Azure CLI is connected to, such as
+// AzureCloud, AzureUSGovernment or AzureChinaCloud.
+type Cloud struct {
+	Name      string `json:"name"`
+	PortalURL string `json:"portal"`
+}
+
+// portalURLs are the portal endpoints of the built-in clouds by lowercased
+// name, used when the Azure CLI does not report one.
+var portalURLs = map[string]string{
+	"azurecloud":        "https://portal.azure.com",
+	"azureusgovernment": "https://portal.azure.us",
+	"azurechinacloud":   "https://portal.azure.cn",
+}
+
+// PortalLink returns the Azure portal link of the resource with the given
+// ID, or "" if the portal of the cloud or the ID is unknown.
+func (c Cloud) PortalLink(resourceID string) string {
+	if c.PortalURL == "" || resourceID == "" {
+		return ""
+	}
+	return c.PortalURL + "/#@/resource" + resourceID
+}
+
+// ActiveCloud returns the cloud the Azure CLI is connected to.
+func (c *Client) ActiveCloud(ctx context.Context) (Cloud, error) {
+	data, err := c.runAzCommand(ctx, "cloud", "show", "--query", "{name:name,portal:endpoints.portal}", "-o", "json")
+	if err != nil {
+		return Cloud{}, fmt.Errorf("failed to read the active cloud: %w", err)
+	}
+	var cloud Cloud
+	if err := json.Unmarshal(data, &cloud); err != nil {
+		return Cloud{}, fmt.Errorf("unable to parse cloud data: %w", err)
+	}
+	if cloud.PortalURL == "" {
+		cloud.PortalURL = portalURLs[strings.ToLower(cloud.Name)]
+	}
+	cloud.PortalURL = strings.TrimSuffix(cloud.PortalURL, "/")
+	return cloud, nil
+}
+
+// useCloud makes the Azure CLI use the named cloud unless it is active.
+// Rather than switching the cloud of the user's Azure CLI profile, which
+// every az command shares, the az commands of this process get a profile
+// of their own for the cloud: AZURE_CONFIG_DIR is set to cloudConfigDir.
+// Each cloud has its own sign-in, so this is done before signing in; the
+// sign-in is kept in that profile for the next run.
+func (c *Client) useCloud(ctx context.Context, name string) error {
+	if active, err := c.ActiveCloud(ctx); err == nil && strings.EqualFold(active.Name, name) {
+		return nil
+	}
+	dir, err := cloudConfigDir(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("unable to create the Azure CLI profile for cloud %s: %w", name, err)
+	}
+	previous, set := os.LookupEnv(azureConfigDirEnv)
+	os.Setenv(azureConfigDirEnv, dir)
+	if active, err := c.ActiveCloud(ctx); err == nil && strings.EqualFold(active.Name, name) {
+		return nil
+	}
+	if _, err := c.runAzCommand(ctx, "cloud", "set", "--name", name); err != nil {
+		if set {
+			os.Setenv(azureConfigDirEnv, previous)
+		} else {
+			os.Unsetenv(azureConfigDirEnv)
+		}
+		return fmt.Errorf("failed to switch the Azure CLI to cloud %s: %w", name, err)
+	}
+	return nil
+}
+
+// azureConfigDirEnv names the directory of the Azure CLI profile.
+const azureConfigDirEnv = "AZURE_CONFIG_DIR"
+
+// cloudConfigDir returns the directory of the Azure CLI profile azexempt
+// uses for the named cloud, ~/.azexempt/azure-<cloud>.
+func cloudConfigDir(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the home directory for the Azure CLI profile of cloud %s: %w", name, err)
+	}
+	return filepath.Join(home, ".azexempt", "azure-"+strings.ToLower(name)), nil
+}
@@ -0,0 +1,78 @@
+package azure
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestActiveCloud(t *testing.T) {
+	installFakeAz(t)
+	t.Setenv("AZ_CLOUD_SHOW", `{"name":"AzureUSGovernment","portal":null}`)
+	cloud, err := NewClient().ActiveCloud(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cloud != (Cloud{Name: "AzureUSGovernment", PortalURL: "https://portal.azure.us"}) {
+		t.Fatalf("ActiveCloud() = %#v", cloud)
+	}
+	link := cloud.PortalLink("/subscriptions/sub/providers/Microsoft.Authorization/policyExemptions/ex")
+	if link != "https://portal.azure.us/#@/resource/subscriptions/sub/providers/Microsoft.Authorization/policyExemptions/ex" {
+		t.Fatalf("PortalLink() = %q", link)
+	}
+	if (Cloud{Name: "Custom"}).PortalLink("/id") != "" || cloud.PortalLink("") != "" {
+		t.Fatal("link without portal or ID")
+	}
+
+	t.Setenv("AZ_CLOUD_SHOW", `{"name":"Custom","portal":"https://portal.example/"}`)
+	if cloud, err := NewClient().ActiveCloud(context.Background()); err != nil || cloud.PortalURL != "https://portal.example" {
+		t.Fatalf("ActiveCloud() with reported portal = %#v, %v", cloud, err)
+	}
+}
+
+func TestEnsureLoginSwitchesCloud(t *testing.T) {
+	log := installFakeAz(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(azureConfigDirEnv, "")
+	os.Unsetenv(azureConfigDirEnv)
+	c := NewClient()
+	c.Cloud = "AzureCloud"
+	if err := c.EnsureLogin(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCalls(t, log, "cloud set"); n != 0 {
+		t.Fatal("the active cloud was set again")
+	}
+	if _, set := os.LookupEnv(azureConfigDirEnv); set {
+		t.Fatal("the active cloud got a profile of its own")
+	}
+
+	// Another cloud is used with a profile of its own, leaving the cloud
+	// of the user's profile alone.
+	os.Remove(log)
+	c.Cloud = "AzureChinaCloud"
+	if err := c.EnsureLogin(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertLogContains(t, log, "cloud set --name AzureChinaCloud\naccount show")
+	dir := filepath.Join(home, ".azexempt", "azure-azurechinacloud")
+	if got := os.Getenv(azureConfigDirEnv); got != dir {
+		t.Fatalf("%s = %q, want %q", azureConfigDirEnv, got, dir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("profile directory: %v", err)
+	}
+
+	os.Unsetenv(azureConfigDirEnv)
+	t.Setenv("AZ_FAIL_MATCH", "cloud set")
+	t.Setenv("AZ_FAIL_MESSAGE", "ERROR: The cloud 'Mars' is not registered.")
+	c.Cloud = "Mars"
+	if err := c.EnsureLogin(context.Background()); err == nil {
+		t.Fatal("unknown cloud was accepted")
+	}
+	if _, set := os.LookupEnv(azureConfigDirEnv); set {
+		t.Fatal("the profile of an unknown cloud is used")
+	}
+}
@@ -0,0 +1,98 @@
+package azure
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// knownEffects lists the policy effects with their canonical spelling.
+var knownEffects = []string{
+	"Append",
+	"Audit",
+	"AuditIfNotExists",
+	"Deny",
+	"DenyAction",
+	"DeployIfNotExists",
+	"Disabled",
+	"Manual",
+	"Modify",
+}
+
+// parameterReference matches an ARM template expression that reads a single
+// parameter, e.g. "[parameters('effect')]".
+var parameterReference = regexp.MustCompile(`^\[\s*parameters\(\s*'([^']+)'\s*\)\s*\]$`)
+
+// parameterDefinition is a declared policy parameter. Only the default value
+// is needed to resolve effects.
+type parameterDefinition struct {
+	DefaultValue json.RawMessage `json:"defaultValue"`
+}
+
+// parameterScope is one level of parameter resolution: the values passed in
+// and the defaults declared by the definition that reads them.
+type parameterScope struct {
+	values   map[string]ParameterValue
+	defaults map[string]parameterDefinition
+}
+
+// resolveEffect evaluates a policy rule effect expression. Parameter
+// references are resolved through the given scopes in order: first the
+// member definition (values passed by the initiative, then the definition's
+// defaults), then the initiative (values passed by the assignment, then the
+// initiative's defaults). An empty string is returned if the effect cannot
+// be determined.
+func resolveEffect(expr string, scopes []parameterScope) string {
+	for _, scope := range scopes {
+		match := parameterReference.FindStringSubmatch(strings.TrimSpace(expr))
+		if match == nil {
+			break
+		}
+		raw, ok := lookupParameter(scope, match[1])
+		if !ok {
+			return ""
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return ""
+		}
+		expr = value
+	}
+	if parameterReference.MatchString(strings.TrimSpace(expr)) {
+		return ""
+	}
+	return NormalizeEffect(expr)
+}
+
+func lookupParameter(scope parameterScope, name string) (json.RawMessage, bool) {
+	for key, value := range scope.values {
+		if strings.EqualFold(key, name) && len(value.Value) > 0 {
+			return value.Value, true
+		}
+	}
+	for key, def := range scope.defaults {
+		if strings.EqualFold(key, name) && len(def.DefaultValue) > 0 {
+			return def.DefaultValue, true
+		}
+	}
+	return nil, false
+}
+
+// NormalizeEffect returns the canonical spelling of a policy effect, e.g.
+// "deployIfNotExists" becomes "DeployIfNotExists". Unknown effects are
+// returned unchanged.
+func NormalizeEffect(effect string) string {
+	effect = strings.TrimSpace(effect)
+	for _, known := range knownEffects {
+		if strings.EqualFold(known, effect) {
+			return known
+		}
+	}
+	return effect
+}
+
+// IsDenyEffect reports whether the effect blocks requests, so that exempting
+// it lets non-compliant resources be deployed.
+func IsDenyEffect(effect string) bool {
+	return strings.EqualFold(effect, "Deny") || strings.EqualFold(effect, "DenyAction")
+}
@@ -0,0 +1,48 @@
+package azure
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResolveEffect(t *testing.T) {
+	member := map[string]parameterDefinition{"effect": {DefaultValue: json.RawMessage(`"Audit"`)}}
+	initiative := map[string]parameterDefinition{"storageEffect": {DefaultValue: json.RawMessage(`"AuditIfNotExists"`)}}
+	tests := []struct {
+		name         string
+		expr         string
+		memberValues map[string]ParameterValue
+		assignValues map[string]ParameterValue
+		memberDefs   map[string]parameterDefinition
+		want         string
+	}{
+		{"literal", "deny", nil, nil, member, "Deny"},
+		{"member default", "[parameters('effect')]", nil, nil, member, "Audit"},
+		{"initiative literal", "[parameters('effect')]", map[string]ParameterValue{"effect": {Value: json.RawMessage(`"Disabled"`)}}, nil, member, "Disabled"},
+		{"initiative default", "[ parameters( 'Effect' ) ]", map[string]ParameterValue{"effect": {Value: json.RawMessage(`"[parameters('storageEffect')]"`)}}, nil, member, "AuditIfNotExists"},
+		{"assignment value", "[parameters('effect')]", map[string]ParameterValue{"effect": {Value: json.RawMessage(`"[parameters('storageEffect')]"`)}}, map[string]ParameterValue{"StorageEffect": {Value: json.RawMessage(`"denyAction"`)}}, member, "DenyAction"},
+		{"missing parameter", "[parameters('other')]", nil, nil, member, ""},
+		{"missing initiative parameter", "[parameters('effect')]", map[string]ParameterValue{"effect": {Value: json.RawMessage(`"[parameters('unknown')]"`)}}, nil, member, ""},
+		{"non-string value", "[parameters('effect')]", map[string]ParameterValue{"effect": {Value: json.RawMessage(`["Deny"]`)}}, nil, member, ""},
+		{"unknown effect", "customEffect", nil, nil, nil, "customEffect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveEffect(tt.expr, []parameterScope{
+				{values: tt.memberValues, defaults: tt.memberDefs},
+				{values: tt.assignValues, defaults: initiative},
+			})
+			if got != tt.want {
+				t.Fatalf("resolveEffect(%q) = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDenyEffect(t *testing.T) {
+	for effect, want := range map[string]bool{"Deny": true, "denyaction": true, "Audit": false, "": false} {
+		if got := IsDenyEffect(effect); got != want {
+			t.Errorf("IsDenyEffect(%q) = %v", effect, got)
+		}
+	}
+}
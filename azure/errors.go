@@ -0,0 +1,214 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCallTimeout is the cause of a CommandError for an attempt that took
+// longer than RetryPolicy.CallTimeout.
+var ErrCallTimeout = errors.New("az command timed out")
+
+// CommandError is returned when an az command fails. It keeps the standard
+// error output so that the failure can be classified, and the wait Azure
+// asked for before retrying, if any.
+type CommandError struct {
+	Args       []string
+	Stderr     string
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *CommandError) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Stderr
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Retriable reports whether the command may succeed when run again.
+func (e *CommandError) Retriable() bool {
+	return Classify(e).Retriable()
+}
+
+// PermissionError is returned when the signed-in account lacks Action on
+// Scope.
+type PermissionError struct {
+	Scope  string
+	Action string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("the signed-in account lacks permission %s on %s", e.Action, e.Scope)
+}
+
+// ExhaustedError is returned when a call still failed with a retriable
+// error after all attempts of the retry policy.
+type ExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetriable reports whether err is a failure of an az command that may
+// succeed when run again, such as throttling or a transient server error.
+// Other errors are terminal.
+func IsRetriable(err error) bool {
+	return Classify(err).Retriable()
+}
+
+// retryAfterPattern matches the wait requested by Azure in az error output,
+// e.g. "Retry-After: 20" or "Please retry after 20 seconds".
+var retryAfterPattern = regexp.MustCompile(`(?i)retry[- ]after\W+(\d+)`)
+
+// parseRetryAfter returns the requested wait from az error output, or 0.
+func parseRetryAfter(stderr string) time.Duration {
+	match := retryAfterPattern.FindStringSubmatch(stderr)
+	if match == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// retryAfter returns the wait requested for the command that caused err.
+func retryAfter(err error) time.Duration {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.RetryAfter
+	}
+	return 0
+}
+
+// FailureKind is a common cause of failed az commands.
+type FailureKind int
+
+const (
+	FailureUnknown FailureKind = iota
+	FailureLoginExpired
+	FailureUnauthorized
+	FailureThrottled
+	FailureNotFound
+	FailureTransient
+	FailureTimeout
+)
+
+// failurePatterns are lowercased fragments of az error output by kind, in
+// the order they are checked. An expired login is checked first as its
+// messages can also mention authorization.
+var failurePatterns = []struct {
+	kind     FailureKind
+	patterns []string
+}{
+	{FailureLoginExpired, []string{"aadsts700082", "aadsts70043", "aadsts50173", "token is expired", "token has expired", "interactive authentication is needed", "please run 'az login'", "please run az login"}},
+	{FailureUnauthorized, []string{"authorizationfailed", "does not have authorization", "forbidden"}},
+	{FailureThrottled, []string{"toomanyrequests", "too many requests", "throttled", "throttling"}},
+	{FailureTransient, []string{"internalservererror", "internal server error", "serviceunavailable", "service unavailable", "badgateway", "bad gateway", "gatewaytimeout", "gateway timeout", "temporarily unavailable", "connection reset", "connection aborted"}},
+	{FailureNotFound, []string{"notfound", "could not be found", "was not found", "does not exist"}},
+}
+
+// Classify returns the kind of failure from the error output of the az
+// command that caused err. Errors not caused by an az command are
+// FailureUnknown, except a PermissionError, which is FailureUnauthorized.
+func Classify(err error) FailureKind {
+	var permErr *PermissionError
+	if errors.As(err, &permErr) {
+		return FailureUnauthorized
+	}
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return FailureUnknown
+	}
+	if errors.Is(cmdErr.Err, ErrCallTimeout) {
+		return FailureTimeout
+	}
+	stderr := strings.ToLower(cmdErr.Stderr)
+	for _, p := range failurePatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(stderr, pattern) {
+				return p.kind
+			}
+		}
+	}
+	return FailureUnknown
+}
+
+// String returns a short description of the failure kind.
+func (k FailureKind) String() string {
+	switch k {
+	case FailureLoginExpired:
+		return "Azure CLI sign-in expired"
+	case FailureUnauthorized:
+		return "Not authorized"
+	case FailureThrottled:
+		return "Requests throttled"
+	case FailureNotFound:
+		return "Not found"
+	case FailureTransient:
+		return "Azure service error"
+	case FailureTimeout:
+		return "Timed out"
+	}
+	return "Unknown failure"
+}
+
+// Retriable reports whether failures of this kind may go away when the
+// command is run again.
+func (k FailureKind) Retriable() bool {
+	return k == FailureThrottled || k == FailureTransient || k == FailureTimeout
+}
+
+// Hint tells the user how to resolve a failure of this kind, or returns ""
+// for unknown failures.
+func (k FailureKind) Hint() string {
+	switch k {
+	case FailureLoginExpired:
+		return "Run 'az login' in another terminal, then retry."
+	case FailureUnauthorized:
+		return "The signed-in account lacks a role on this scope. Request access (e.g. Resource Policy Contributor to create exemptions) or go back and choose another scope."
+	case FailureThrottled:
+		return "Azure Resource Manager limits the request rate. Wait a moment, then retry."
+	case FailureNotFound:
+		return "The resource may have been deleted or moved, or belongs to another subscription. Go back and choose another one."
+	case FailureTransient:
+		return "Azure returned a temporary server error. Retry in a moment."
+	case FailureTimeout:
+		return "The Azure CLI did not answer in time. Retry, or raise retry.call_timeout in the config."
+	}
+	return ""
+}
+
+// exitCode returns the exit code of the az command that failed with err,
+// 0 for no error and -1 if it did not exit with a code.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	var replayed replayedExit
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	case errors.As(err, &replayed):
+		return int(replayed)
+	}
+	return -1
+}
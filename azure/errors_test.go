@@ -0,0 +1,70 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		stderr string
+		want   FailureKind
+	}{
+		{"ERROR: AADSTS700082: The refresh token has expired due to inactivity.", FailureLoginExpired},
+		{"ERROR: The token is expired. Please run 'az login' to setup account.", FailureLoginExpired},
+		{"ERROR: (AuthorizationFailed) The client 'ada@example.com' does not have authorization to perform action", FailureUnauthorized},
+		{"ERROR: Operation returned an invalid status 'Forbidden'", FailureUnauthorized},
+		{"ERROR: (TooManyRequests) Rate limit exceeded.", FailureThrottled},
+		{"ERROR: (ResourceCollectionRequestsThrottled) Operation was throttled.", FailureThrottled},
+		{"ERROR: (PolicyAssignmentNotFound) The policy assignment 'x' is not found.", FailureNotFound},
+		{"ERROR: (ResourceGroupNotFound) Resource group 'rg' could not be found.", FailureNotFound},
+		{"ERROR: (ServiceUnavailable) The service is temporarily unavailable.", FailureTransient},
+		{"ERROR: Operation returned an invalid status 'Bad Gateway'", FailureTransient},
+		{"ERROR: something else went wrong", FailureUnknown},
+		{"", FailureUnknown},
+	} {
+		err := fmt.Errorf("failed to list: %w", &CommandError{Stderr: tc.stderr, Err: errors.New("exit status 1")})
+		if got := Classify(err); got != tc.want {
+			t.Errorf("Classify(%q) = %v, want %v", tc.stderr, got, tc.want)
+		}
+	}
+
+	if got := Classify(fmt.Errorf("preflight: %w", &PermissionError{Scope: "/subscriptions/sub", Action: ExemptionWriteAction})); got != FailureUnauthorized {
+		t.Fatalf("Classify(PermissionError) = %v", got)
+	}
+	if got := Classify(errors.New("AuthorizationFailed")); got != FailureUnknown {
+		t.Fatalf("Classify(non-command error) = %v", got)
+	}
+	for kind := FailureLoginExpired; kind <= FailureTimeout; kind++ {
+		if kind.Hint() == "" || kind.String() == FailureUnknown.String() {
+			t.Errorf("%d has no hint or description", kind)
+		}
+	}
+	if FailureUnknown.Hint() != "" {
+		t.Fatal("unknown failures have a hint")
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	installFakeAz(t)
+	t.Setenv("AZ_ACCOUNT_SHOW_TENANT_ID", "test-tenant-id")
+	t.Setenv("AZ_FAIL_MATCH", "account list")
+	t.Setenv("AZ_FAIL_MESSAGE", "ERROR: (AuthorizationFailed) no access")
+	_, err := NewClient().ListSubscriptions(context.Background())
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("ListSubscriptions() error = %#v, want CommandError", err)
+	}
+	if cmdErr.Stderr != "ERROR: (AuthorizationFailed) no access" || !strings.Contains(strings.Join(cmdErr.Args, " "), "account list") {
+		t.Fatalf("CommandError = %#v", cmdErr)
+	}
+	if Classify(err) != FailureUnauthorized {
+		t.Fatalf("Classify() = %v", Classify(err))
+	}
+	if !strings.HasSuffix(err.Error(), ": ERROR: (AuthorizationFailed) no access") {
+		t.Fatalf("error message = %q", err.Error())
+	}
+}
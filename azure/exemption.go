@@ -0,0 +1,137 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExemptionCategory is the category of every exemption azexempt creates.
+const ExemptionCategory = "Waiver"
+
+// Exemption holds the properties of a Microsoft.Authorization/policyExemptions
+// resource.
+type Exemption struct {
+	// ID is the resource ID of an existing exemption, empty for one that
+	// is yet to be created.
+	ID                 string                `json:"id,omitempty"`
+	Name               string                `json:"name"`
+	Scope              string                `json:"scope"`
+	DisplayName        string                `json:"displayName"`
+	Description        string                `json:"description"`
+	PolicyAssignmentID string                `json:"policyAssignmentId"`
+	Category           string                `json:"exemptionCategory"`
+	ReferenceIDs       []string              `json:"policyDefinitionReferenceIds,omitempty"`
+	ResourceSelectors  []ARMResourceSelector `json:"resourceSelectors,omitempty"`
+	Metadata           map[string]any        `json:"metadata,omitempty"`
+	// ExpiresOn is the expiry in RFC 3339 format, empty if the exemption
+	// does not expire.
+	ExpiresOn string `json:"expiresOn,omitempty"`
+}
+
+// Label returns the display name, or the name if there is none.
+func (e Exemption) Label() string {
+	if e.DisplayName != "" {
+		return e.DisplayName
+	}
+	return e.Name
+}
+
+// Exemption returns the exemption resource for the spec, as created by
+// CreateExemption. now is recorded in the description.
+//
+// The name is "<scope> - <assignment>", where the scope is the subscription
+// name, "<subscription>/<resource group>" or the management group name.
+// An expiration date expires at the end of that day.
+func (s ExemptionSpec) Exemption(now time.Time) Exemption {
+	description := fmt.Sprintf("Ticket %s raised by %s on %s", s.Ticket, s.Users, now.Format(time.RFC3339))
+	if s.RequestedBy != nil && s.ApprovedBy != nil {
+		description += fmt.Sprintf("; requested by %s, approved by %s", s.RequestedBy.Label(), s.ApprovedBy.Label())
+		if s.RequesterUnverified {
+			description += " without verifying the requester"
+		}
+	}
+
+	var exemptionScope string
+	if s.SubscriptionName == "" {
+		exemptionScope = s.ScopeName
+	} else if s.ScopeName == "Entire Subscription" || s.ScopeName == s.SubscriptionName {
+		exemptionScope = s.SubscriptionName
+	} else {
+		exemptionScope = fmt.Sprintf("%s/%s", s.SubscriptionName, s.ScopeName)
+	}
+	displayName := fmt.Sprintf("%s - %s", exemptionScope, s.Assignment.DisplayLabel())
+
+	e := Exemption{
+		// Azure policy exemption names can only contain alphanumeric
+		// characters, hyphens, and underscores
+		Name:               sanitizeExemptionName(displayName),
+		Scope:              s.Scope,
+		DisplayName:        displayName,
+		Description:        description,
+		PolicyAssignmentID: s.Assignment.ID,
+		Category:           ExemptionCategory,
+		ReferenceIDs:       s.ReferenceIDs,
+		ResourceSelectors:  s.Selectors.ARM(),
+	}
+	if s.ExpirationDate != "" {
+		t, _ := time.Parse("2006-01-02", s.ExpirationDate)
+		t = t.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		e.ExpiresOn = t.Format(time.RFC3339)
+	}
+	for _, pair := range s.metadata() {
+		if e.Metadata == nil {
+			e.Metadata = make(map[string]any)
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		e.Metadata[key] = value
+	}
+	return e
+}
+
+// ListExemptions returns the policy exemptions on the subscription and on
+// the resource groups and resources within it, sorted by ID. Exemptions
+// inherited from management groups are left out.
+func (c *Client) ListExemptions(ctx context.Context, subscriptionID string) ([]Exemption, error) {
+	sub := Subscription{ID: subscriptionID}
+	uri := sub.Scope() + "/providers/Microsoft.Authorization/policyExemptions?api-version=2022-07-01-preview"
+	var exemptions []Exemption
+	for uri != "" {
+		data, err := c.runAzCommand(ctx, "rest", "--method", "get", "--uri", uri,
+			"--query", "{value:value[].{id:id,name:name,displayName:properties.displayName,description:properties.description,policyAssignmentId:properties.policyAssignmentId,exemptionCategory:properties.exemptionCategory,policyDefinitionReferenceIds:properties.policyDefinitionReferenceIds,resourceSelectors:properties.resourceSelectors,metadata:properties.metadata,expiresOn:properties.expiresOn},nextLink:nextLink}",
+			"-o", "json")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list policy exemptions: %w", err)
+		}
+		var result struct {
+			Value    []Exemption `json:"value"`
+			NextLink string      `json:"nextLink"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("unable to parse exemption data: %w", err)
+		}
+		for _, e := range result.Value {
+			e.Scope = exemptionScope(e.ID)
+			if ScopeContains(sub.Scope(), e.Scope) {
+				exemptions = append(exemptions, e)
+			}
+		}
+		uri = result.NextLink
+	}
+	sort.Slice(exemptions, func(i, j int) bool {
+		return strings.ToLower(exemptions[i].ID) < strings.ToLower(exemptions[j].ID)
+	})
+	return exemptions, nil
+}
+
+// exemptionScope returns the scope of an exemption from its resource ID.
+func exemptionScope(id string) string {
+	const marker = "/providers/microsoft.authorization/policyexemptions/"
+	if i := strings.LastIndex(strings.ToLower(id), marker); i >= 0 {
+		return id[:i]
+	}
+	return ""
+}
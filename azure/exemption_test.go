@@ -0,0 +1,73 @@
+package azure
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExemptionFromSpec(t *testing.T) {
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	spec := ExemptionSpec{
+		Scope:            "/subscriptions/s",
+		ScopeName:        "Entire Subscription",
+		SubscriptionName: "Production",
+		Assignment:       PolicyAssignment{ID: "/assignments/a", Name: "a", DisplayName: "Require TLS"},
+		ReferenceIDs:     []string{"ref-a"},
+		Ticket:           "INC1",
+		Users:            "Ada",
+		ExpirationDate:   "2030-05-06",
+		Selectors:        ResourceSelectors{Locations: []string{"westeurope"}},
+		RequestedBy:      &Principal{ID: "requester-id", Name: "ada@example.com"},
+		ApprovedBy:       &Principal{ID: "approver-id", Name: "linus@example.com"},
+	}
+	want := Exemption{
+		Name:               "Production---Require-TLS",
+		Scope:              "/subscriptions/s",
+		DisplayName:        "Production - Require TLS",
+		Description:        "Ticket INC1 raised by Ada on 2030-01-02T03:04:05Z; requested by ada@example.com (requester-id), approved by linus@example.com (approver-id)",
+		PolicyAssignmentID: "/assignments/a",
+		Category:           "Waiver",
+		ReferenceIDs:       []string{"ref-a"},
+		ResourceSelectors:  spec.Selectors.ARM(),
+		Metadata:           map[string]any{"requestedBy": "requester-id", "approvedBy": "approver-id"},
+		ExpiresOn:          "2030-05-06T23:59:59Z",
+	}
+	if got := spec.Exemption(now); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Exemption() = %#v\nwant %#v", got, want)
+	}
+
+	spec = ExemptionSpec{Scope: "/subscriptions/s", ScopeName: "Entire Subscription", SubscriptionName: "Production", Assignment: spec.Assignment}
+	if got := spec.Exemption(now); got.ExpiresOn != "" || got.Metadata != nil || got.ResourceSelectors != nil {
+		t.Fatalf("Exemption() = %#v", got)
+	}
+}
+
+func TestListExemptions(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_REST_FIRST", `{"value":[
+		{"id":"/subscriptions/s/resourceGroups/rg/providers/Microsoft.Authorization/policyExemptions/rg-ex","name":"rg-ex","policyAssignmentId":"/assignments/a","exemptionCategory":"Waiver","policyDefinitionReferenceIds":["ref-a"],"metadata":{"requestedBy":"r","createdOn":"2030-01-01"}},
+		{"id":"/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyExemptions/inherited","name":"inherited"}
+	],"nextLink":"https://next/page"}`)
+	t.Setenv("AZ_REST_NEXT", `{"value":[{"id":"/subscriptions/s/providers/Microsoft.Authorization/policyExemptions/sub-ex","name":"sub-ex","displayName":"Sub","expiresOn":"2030-05-06T23:59:59Z"}]}`)
+
+	got, err := NewClient().ListExemptions(context.Background(), "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "sub-ex" || got[1].Name != "rg-ex" {
+		t.Fatalf("ListExemptions() = %#v", got)
+	}
+	if got[0].Scope != "/subscriptions/s" || got[1].Scope != "/subscriptions/s/resourceGroups/rg" || got[0].ExpiresOn != "2030-05-06T23:59:59Z" || got[1].Metadata["requestedBy"] != "r" || got[1].ReferenceIDs[0] != "ref-a" {
+		t.Fatalf("ListExemptions() = %#v", got)
+	}
+	assertLogContains(t, log, "--uri /subscriptions/s/providers/Microsoft.Authorization/policyExemptions?api-version=2022-07-01-preview")
+	assertLogContains(t, log, "--uri https://next/page")
+
+	t.Setenv("AZ_REST_FIRST", "bad-json")
+	if _, err := NewClient().ListExemptions(context.Background(), "s"); err == nil || !strings.Contains(err.Error(), "parse exemption") {
+		t.Fatalf("parse error = %v", err)
+	}
+}
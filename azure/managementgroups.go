@@ -0,0 +1,63 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ManagementEntity is a management group or subscription in the management
+// group hierarchy of the tenant.
+type ManagementEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Type        string `json:"type"`
+	// ParentID is the ID of the parent management group, empty for the
+	// tenant root group.
+	ParentID string `json:"parentId"`
+}
+
+// IsSubscription reports whether the entity is a subscription rather than
+// a management group.
+func (e ManagementEntity) IsSubscription() bool {
+	return strings.EqualFold(e.Type, "/subscriptions") || strings.EqualFold(e.Type, "Microsoft.Resources/subscriptions")
+}
+
+// Label returns the display name, or the name if there is none.
+func (e ManagementEntity) Label() string {
+	if e.DisplayName != "" {
+		return e.DisplayName
+	}
+	return e.Name
+}
+
+// ListManagementEntities returns the management groups and subscriptions
+// the signed-in account can see in the management group hierarchy.
+func (c *Client) ListManagementEntities(ctx context.Context) ([]ManagementEntity, error) {
+	data, err := c.runAzCommand(ctx, "account", "management-group", "entities", "list",
+		"--query", "[].{id:id,name:name,displayName:displayName,type:type,parentId:parent.id}", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list management groups: %w", err)
+	}
+	var entities []ManagementEntity
+	if err := json.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("unable to parse management group data: %w", err)
+	}
+	return entities, nil
+}
+
+// ListManagementGroupAssignments returns the policy assignments that apply
+// to the named management group, including those of its parents.
+func (c *Client) ListManagementGroupAssignments(ctx context.Context, groupName string) ([]PolicyAssignment, error) {
+	uri := fmt.Sprintf("/providers/Microsoft.Management/managementGroups/%s/providers/Microsoft.Authorization/policyAssignments?api-version=2021-06-01", groupName)
+	return c.listAssignments(ctx, uri)
+}
+
+// SummarizeManagementGroupCompliance returns the non-compliant resource
+// counts for every policy assignment that applies to the named management
+// group, like SummarizeCompliance does for a subscription.
+func (c *Client) SummarizeManagementGroupCompliance(ctx context.Context, groupName string) (ComplianceSummary, error) {
+	return c.summarizeCompliance(ctx, "--management-group", groupName)
+}
@@ -0,0 +1,57 @@
+package azure
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestListManagementEntities(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_MG_ENTITIES", `[
+		{"id":"/providers/Microsoft.Management/managementGroups/root","name":"root","displayName":"Tenant Root Group","type":"Microsoft.Management/managementGroups","parentId":null},
+		{"id":"/subscriptions/sub-1","name":"sub-1","displayName":"Production","type":"/subscriptions","parentId":"/providers/Microsoft.Management/managementGroups/root"}
+	]`)
+	entities, err := NewClient().ListManagementEntities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 2 || entities[0].IsSubscription() || !entities[1].IsSubscription() || entities[1].ParentID != entities[0].ID {
+		t.Fatalf("ListManagementEntities() = %#v", entities)
+	}
+	if entities[0].Label() != "Tenant Root Group" || (ManagementEntity{Name: "mg"}).Label() != "mg" {
+		t.Fatalf("labels = %q", entities[0].Label())
+	}
+	assertLogContains(t, log, "account management-group entities list")
+
+	t.Setenv("AZ_MG_ENTITIES", "bad-json")
+	if _, err := NewClient().ListManagementEntities(context.Background()); err == nil || !strings.Contains(err.Error(), "parse management group") {
+		t.Fatalf("parse error = %v", err)
+	}
+}
+
+func TestListManagementGroupAssignments(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_REST_FIRST", `{"value":[{"id":"/a/z","name":"z","displayName":"Zulu","scope":"/providers/Microsoft.Management/managementGroups/corp"}],"nextLink":""}`)
+	got, err := NewClient().ListManagementGroupAssignments(context.Background(), "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Scope != "/providers/Microsoft.Management/managementGroups/corp" {
+		t.Fatalf("ListManagementGroupAssignments() = %#v", got)
+	}
+	assertLogContains(t, log, "rest --method get --uri /providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyAssignments?api-version=2021-06-01 --query")
+}
+
+func TestSummarizeManagementGroupCompliance(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_STATE_SUMMARIZE", `[{"id":"/A","nonCompliant":4}]`)
+	summary, err := NewClient().SummarizeManagementGroupCompliance(context.Background(), "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := summary.AssignmentCount("/a"); !ok || n != 4 {
+		t.Fatalf("AssignmentCount() = %d, %v", n, ok)
+	}
+	assertLogContains(t, log, "policy state summarize --management-group corp --query")
+}
@@ -0,0 +1,43 @@
+package azure
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option configures a Client created by NewClient.
+type Option func(*Client)
+
+// WithRunner runs the az commands of the client with r instead of the az
+// executable, e.g. to run them remotely or to fake Azure in tests.
+func WithRunner(r Runner) Option {
+	return func(c *Client) { c.runner = r }
+}
+
+// WithLogger logs every az command of the client with its duration to l:
+// completed commands and retries at info level and failed ones, with their
+// error, at warn level.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) { c.logger = l }
+}
+
+// WithCloud sets the Azure cloud EnsureLogin switches the Azure CLI to.
+func WithCloud(name string) Option {
+	return func(c *Client) { c.Cloud = name }
+}
+
+// WithAuth sets how EnsureLogin signs in.
+func WithAuth(auth Auth) Option {
+	return func(c *Client) { c.Auth = auth }
+}
+
+// WithRetry sets the retry policy of az commands.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) { c.Retry = policy }
+}
+
+// WithCallTimeout limits a single attempt of an az command, keeping the
+// rest of the retry policy.
+func WithCallTimeout(timeout time.Duration) Option {
+	return func(c *Client) { c.Retry.CallTimeout = timeout }
+}
@@ -0,0 +1,109 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ExemptionWriteAction is the permission needed to create policy exemptions.
+const ExemptionWriteAction = "Microsoft.Authorization/policyExemptions/write"
+
+// permissionCheckWorkers limits how many scopes CheckPermissions checks at once.
+const permissionCheckWorkers = 4
+
+// Permission is an entry of the ARM permissions API: the actions the
+// signed-in account may perform on a scope, minus NotActions.
+type Permission struct {
+	Actions    []string `json:"actions"`
+	NotActions []string `json:"notActions"`
+}
+
+// Allows reports whether the permission grants action. Actions may contain
+// * wildcards and are compared case-insensitively.
+func (p Permission) Allows(action string) bool {
+	return matchesAny(p.Actions, action) && !matchesAny(p.NotActions, action)
+}
+
+func matchesAny(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		expr := "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		if ok, _ := regexp.MatchString(expr, action); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the signed-in account may perform action
+// on scope, as reported by the ARM permissions API. Deny assignments are
+// not taken into account.
+func (c *Client) HasPermission(ctx context.Context, scope, action string) (bool, error) {
+	uri := strings.TrimSuffix(scope, "/") + "/providers/Microsoft.Authorization/permissions?api-version=2022-04-01"
+	for uri != "" {
+		data, err := c.runAzCommand(ctx,
+			"rest",
+			"--method", "get",
+			"--uri", uri,
+			"--query", "{value:value[].{actions:actions,notActions:notActions},nextLink:nextLink}",
+			"-o", "json",
+		)
+		if err != nil {
+			return false, fmt.Errorf("failed to check permissions on %s: %w", scope, err)
+		}
+		var result struct {
+			Value    []Permission `json:"value"`
+			NextLink string       `json:"nextLink"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return false, fmt.Errorf("unable to parse permissions: %w", err)
+		}
+		for _, p := range result.Value {
+			if p.Allows(action) {
+				return true, nil
+			}
+		}
+		uri = result.NextLink
+	}
+	return false, nil
+}
+
+// CheckPermissions checks action on each of scopes, a few at a time. The
+// result holds the scopes that could be checked; the first error is
+// returned along with it.
+func (c *Client) CheckPermissions(ctx context.Context, scopes []string, action string) (map[string]bool, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	allowed := make(map[string]bool, len(scopes))
+	queue := make(chan string)
+	for range min(permissionCheckWorkers, len(scopes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for scope := range queue {
+				ok, err := c.HasPermission(ctx, scope, action)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					allowed[scope] = ok
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, scope := range scopes {
+		queue <- scope
+	}
+	close(queue)
+	wg.Wait()
+	return allowed, firstErr
+}
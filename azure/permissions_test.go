@@ -0,0 +1,50 @@
+package azure
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPermissionAllows(t *testing.T) {
+	for _, tc := range []struct {
+		permission Permission
+		want       bool
+	}{
+		{Permission{Actions: []string{"*"}}, true},
+		{Permission{Actions: []string{"microsoft.authorization/policyexemptions/*"}}, true},
+		{Permission{Actions: []string{"Microsoft.Authorization/*/write"}}, true},
+		{Permission{Actions: []string{"*"}, NotActions: []string{"Microsoft.Authorization/*/Write"}}, false},
+		{Permission{Actions: []string{"*/read"}}, false},
+		{Permission{Actions: []string{"Microsoft.Authorization/policyExemptions/write.extra"}}, false},
+		{Permission{}, false},
+	} {
+		if got := tc.permission.Allows(ExemptionWriteAction); got != tc.want {
+			t.Errorf("%#v.Allows() = %v, want %v", tc.permission, got, tc.want)
+		}
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_PERMISSIONS", `{"value":[{"actions":["*/read"],"notActions":[]},{"actions":["Microsoft.Authorization/policyExemptions/*"],"notActions":[]}]}`)
+	t.Setenv("AZ_READ_ONLY_SCOPE", "/subscriptions/sub/resourceGroups/locked")
+
+	scopes := []string{"/subscriptions/sub", "/subscriptions/sub/resourceGroups/app", "/subscriptions/sub/resourceGroups/locked"}
+	got, err := NewClient().CheckPermissions(context.Background(), scopes, ExemptionWriteAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{scopes[0]: true, scopes[1]: true, scopes[2]: false}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("CheckPermissions() = %#v, want %#v", got, want)
+	}
+	assertLogContains(t, log, "rest --method get --uri /subscriptions/sub/resourceGroups/app/providers/Microsoft.Authorization/permissions?api-version=2022-04-01")
+
+	t.Setenv("AZ_FAIL_MATCH", "resourceGroups/app/providers")
+	t.Setenv("AZ_FAIL_MESSAGE", "ERROR: (AuthorizationFailed) no access")
+	got, err = NewClient().CheckPermissions(context.Background(), scopes, ExemptionWriteAction)
+	if err == nil || len(got) != 2 || got[scopes[0]] != true {
+		t.Fatalf("CheckPermissions() with a failed scope = %#v, %v", got, err)
+	}
+}
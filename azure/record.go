@@ -0,0 +1,260 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interaction is a recorded az command: its arguments and outcome.
+type Interaction struct {
+	Args     []string `json:"args"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr,omitempty"`
+	ExitCode int      `json:"exitCode"`
+	// Error describes a failure without an exit code, such as az missing
+	// from PATH.
+	Error    string `json:"error,omitempty"`
+	TimedOut bool   `json:"timedOut,omitempty"`
+	// DurationMS is how long the command took, in milliseconds.
+	DurationMS int64 `json:"durationMs"`
+}
+
+// secretFlags are the az flags whose value is a secret.
+var secretFlags = map[string]bool{"--password": true, "-p": true, "--client-secret": true}
+
+// secretPattern matches JSON properties holding secrets, such as tokens.
+var secretPattern = regexp.MustCompile(`(?i)("[A-Za-z_]*(?:token|secret|password)[A-Za-z_]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+const redacted = "<redacted>"
+
+// redactArgs hides the values of secret flags and the given secrets.
+func redactArgs(args []string, secrets []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if i > 0 && secretFlags[args[i-1]] {
+			arg = redacted
+		}
+		out[i] = redactText(arg, secrets)
+	}
+	return out
+}
+
+// redactText hides the given secrets and secret JSON properties in text.
+func redactText(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	return secretPattern.ReplaceAllString(text, `$1"`+redacted+`"`)
+}
+
+// Recorder is a Runner that runs commands with another Runner and writes
+// each of them as an Interaction to a directory, one numbered JSON file
+// per call. Secrets are redacted before writing.
+type Recorder struct {
+	runner  Runner
+	dir     string
+	secrets []string
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewRecorder returns a recorder that runs commands with runner and writes
+// them to dir, which is created if needed. secrets, such as the client
+// secret of the sign-in, are redacted wherever they appear.
+func NewRecorder(runner Runner, dir string, secrets ...string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create recording directory: %w", err)
+	}
+	return &Recorder{runner: runner, dir: dir, secrets: secrets, next: 1}, nil
+}
+
+func (r *Recorder) Run(ctx context.Context, args []string) ([]byte, error) {
+	r.mu.Lock()
+	seq := r.next
+	r.next++
+	r.mu.Unlock()
+
+	start := time.Now()
+	out, err := r.runner.Run(ctx, args)
+	rec := Interaction{
+		Args:       redactArgs(args, r.secrets),
+		Stdout:     redactText(string(out), r.secrets),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) {
+			rec.Stderr = redactText(cmdErr.Stderr, r.secrets)
+		}
+		if rec.ExitCode = exitCode(err); rec.ExitCode < 0 {
+			rec.Error = redactText(err.Error(), r.secrets)
+		}
+		rec.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	}
+
+	data, jsonErr := json.MarshalIndent(rec, "", "  ")
+	if jsonErr == nil {
+		jsonErr = os.WriteFile(filepath.Join(r.dir, fmt.Sprintf("%04d.json", seq)), append(data, '\n'), 0o600)
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("unable to record az call: %w", jsonErr)
+	}
+	return out, err
+}
+
+// ErrNotRecorded is returned by a Replayer for a call the recording has no
+// answer to.
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Replayer is a Runner that answers commands from a recording instead of
+// running them. Calls are matched to the recording on their arguments as
+// returned by matchArgs, so that values that change from run to run, such
+// as the creation time in the description of an exemption, do not matter.
+// Matching calls are answered in recorded order; once the recorded answers
+// are used up, the last one is repeated. Any other call fails with
+// ErrNotRecorded rather than getting the answer to a different call.
+type Replayer struct {
+	mu   sync.Mutex
+	recs []Interaction
+	keys [][]string
+	used []bool
+}
+
+// NewReplayer loads the recording in dir written by a Recorder.
+func NewReplayer(dir string) (*Replayer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no recorded az calls in %s", dir)
+	}
+	sort.Strings(paths)
+	r := &Replayer{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read recording: %w", err)
+		}
+		var rec Interaction
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("unable to parse recording %s: %w", path, err)
+		}
+		r.recs = append(r.recs, rec)
+		r.keys = append(r.keys, matchArgs(rec.Args))
+	}
+	r.used = make([]bool, len(r.recs))
+	return r, nil
+}
+
+func (r *Replayer) Run(_ context.Context, args []string) ([]byte, error) {
+	args = redactArgs(args, nil)
+	rec, ok := r.answer(args)
+	switch {
+	case !ok:
+		return nil, &CommandError{Args: args, Err: fmt.Errorf("%w for az %s", ErrNotRecorded, strings.Join(args, " "))}
+	case rec.TimedOut:
+		return nil, &CommandError{Args: args, Stderr: rec.Stderr, Err: ErrCallTimeout}
+	case rec.Error != "":
+		return nil, &CommandError{Args: args, Stderr: rec.Stderr, Err: errors.New(rec.Error)}
+	case rec.ExitCode != 0:
+		return nil, &CommandError{Args: args, Stderr: rec.Stderr, Err: replayedExit(rec.ExitCode), RetryAfter: parseRetryAfter(rec.Stderr)}
+	}
+	return []byte(rec.Stdout), nil
+}
+
+// answer picks the recorded answer to args: the next unused one that
+// matches, else the last one that matches.
+func (r *Replayer) answer(args []string) (Interaction, bool) {
+	key := matchArgs(args)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := -1
+	for i, rec := range r.recs {
+		if !slices.Equal(r.keys[i], key) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return rec, true
+		}
+		last = i
+	}
+	if last >= 0 {
+		return r.recs[last], true
+	}
+	return Interaction{}, false
+}
+
+// volatileFlags are the az flags whose value changes from run to run, such
+// as the description of a created exemption, which holds the time.
+var volatileFlags = map[string]bool{"--description": true, "--from": true, "--to": true}
+
+// volatileParams are the query parameters of 'az rest' URIs whose value
+// changes from run to run.
+var volatileParams = []string{"$from", "$to"}
+
+// matchArgs returns args as a call is matched to the recording: without
+// the values of volatile flags, and for 'az rest' with the method in lower
+// case and the URI reduced by restURI.
+func matchArgs(args []string) []string {
+	rest := len(args) > 0 && args[0] == "rest"
+	key := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		key = append(key, args[i])
+		if i+1 == len(args) {
+			break
+		}
+		switch flag := args[i]; {
+		case volatileFlags[flag]:
+			i++
+		case rest && (flag == "--method" || flag == "-m"):
+			i++
+			key = append(key, strings.ToLower(args[i]))
+		case rest && (flag == "--uri" || flag == "--url" || flag == "-u"):
+			i++
+			key = append(key, restURI(args[i]))
+		}
+	}
+	return key
+}
+
+// restURI returns the lowercased path of uri with its query parameters
+// sorted and the volatile ones left out. The host is dropped, as the
+// Azure CLI takes ARM paths without one.
+func restURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	query := u.Query()
+	for _, param := range volatileParams {
+		query.Del(param)
+	}
+	path := strings.ToLower(u.Path)
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
+// replayedExit is the error of a replayed command that exited with code.
+type replayedExit int
+
+func (e replayedExit) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
@@ -0,0 +1,143 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	installFakeAz(t)
+	t.Setenv("AZ_ACCOUNT_SHOW_TENANT_ID", "tenant")
+	t.Setenv("AZ_ACCOUNT_LIST", `[{"name":"Prod","id":"1"}]`)
+	t.Setenv("AZ_ACCOUNT_SHOW", `{"name":"app-id","type":"servicePrincipal","accessToken":"eyJ0eXAi"}`)
+	t.Setenv("AZ_FAIL_MATCH", "group list")
+	t.Setenv("AZ_FAIL_MESSAGE", "ERROR: (AuthorizationFailed) no access for s3cret")
+	dir := filepath.Join(t.TempDir(), "recording")
+
+	recorder, err := NewRecorder(ExecRunner{}, dir, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(WithRunner(recorder), WithRetry(RetryPolicy{MaxAttempts: 1}))
+	subs, err := c.ListSubscriptions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, groupErr := c.ListResourceGroups(context.Background(), "1")
+	if Classify(groupErr) != FailureUnauthorized {
+		t.Fatalf("recorded failure = %v", groupErr)
+	}
+	if _, err := recorder.Run(context.Background(), []string{"login", "--service-principal", "--username", "app-id", "--password", "other-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.Run(context.Background(), []string{"account", "show"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 5 || filepath.Base(files[0]) != "0001.json" {
+		t.Fatalf("recording files = %v", files)
+	}
+	var all strings.Builder
+	for _, file := range files {
+		data, _ := os.ReadFile(file)
+		all.Write(data)
+	}
+	for _, secret := range []string{"s3cret", "other-secret", "eyJ0eXAi"} {
+		if strings.Contains(all.String(), secret) {
+			t.Fatalf("recording contains %q:\n%s", secret, all.String())
+		}
+	}
+	var failure Interaction
+	data, _ := os.ReadFile(files[2])
+	if err := json.Unmarshal(data, &failure); err != nil {
+		t.Fatal(err)
+	}
+	if failure.ExitCode != 1 || !strings.Contains(failure.Stderr, "AuthorizationFailed") || failure.Args[0] != "group" {
+		t.Fatalf("recorded failure = %+v", failure)
+	}
+
+	// The replay answers without running az.
+	t.Setenv("PATH", t.TempDir())
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := NewClient(WithRunner(replayer), WithRetry(RetryPolicy{MaxAttempts: 1}))
+	replayed, err := replay.ListSubscriptions(context.Background())
+	if err != nil || !reflect.DeepEqual(replayed, subs) {
+		t.Fatalf("replayed subscriptions = %v, %v", replayed, err)
+	}
+	if _, err := replay.ListResourceGroups(context.Background(), "1"); Classify(err) != FailureUnauthorized || !strings.Contains(err.Error(), "exit status 1") {
+		t.Fatalf("replayed failure = %v", err)
+	}
+	// The last answer is repeated, and secrets in the arguments still match.
+	for range 2 {
+		if _, err := replay.ListSubscriptions(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := replayer.Run(context.Background(), []string{"login", "--service-principal", "--username", "app-id", "--password", "another-secret"}); err != nil {
+		t.Fatalf("replayed login = %v", err)
+	}
+	// A call with other arguments is not answered by a call of the same
+	// command.
+	if out, err := replayer.Run(context.Background(), []string{"account", "show", "--query", "other"}); !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("replayed command = %s, %v", out, err)
+	}
+	if _, err := replay.ListAssignments(context.Background(), "1"); !errors.Is(err, ErrNotRecorded) || !strings.Contains(err.Error(), "no recorded response") {
+		t.Fatalf("unrecorded call = %v", err)
+	}
+
+	if _, err := NewReplayer(t.TempDir()); err == nil {
+		t.Fatal("empty recording was loaded")
+	}
+}
+
+func TestReplayMatchesVolatileArguments(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := NewRecorder(RunnerFunc(func(_ context.Context, args []string) ([]byte, error) {
+		return []byte(args[len(args)-1]), nil
+	}), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"policy", "exemption", "create", "--name", "ex", "--description", "Ticket INC1 raised by Ada on 2026-01-01T10:00:00Z", "created"},
+		{"rest", "--method", "get", "--uri", "https://management.azure.com/subscriptions/1/providers/P?api-version=1&$from=2026-01-01", "page 1"},
+		{"rest", "--method", "get", "--uri", "https://management.azure.com/subscriptions/1/providers/P?api-version=1&$skiptoken=2", "page 2"},
+	} {
+		if _, err := recorder.Run(context.Background(), args); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The time in the description, the host, the case of the method and
+	// path, the order of the query parameters and volatile parameters do
+	// not matter.
+	for _, args := range [][]string{
+		{"policy", "exemption", "create", "--name", "ex", "--description", "Ticket INC1 raised by Ada on 2026-02-02T08:30:00Z", "created"},
+		{"rest", "--method", "GET", "--uri", "/subscriptions/1/providers/p?$from=2026-02-02&api-version=1", "page 1"},
+		{"rest", "--method", "get", "--uri", "/subscriptions/1/providers/P?$skiptoken=2&api-version=1", "page 2"},
+	} {
+		if out, err := replayer.Run(context.Background(), args); err != nil || string(out) != args[len(args)-1] {
+			t.Fatalf("replayed %q = %q, %v", args, out, err)
+		}
+	}
+	if _, err := replayer.Run(context.Background(), []string{"policy", "exemption", "create", "--name", "other", "--description", "x", "created"}); !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("exemption with another name = %v", err)
+	}
+	if _, err := replayer.Run(context.Background(), []string{"rest", "--method", "get", "--uri", "/subscriptions/1/providers/P?api-version=1&$skiptoken=3", "page 2"}); !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("another page = %v", err)
+	}
+}
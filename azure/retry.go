@@ -0,0 +1,75 @@
+package azure
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how az commands are retried after retriable
+// failures. Zero fields use the values of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts per call including the first;
+	// 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry. It doubles for every
+	// further retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// CallTimeout limits a single attempt.
+	CallTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used unless configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		CallTimeout: 2 * time.Minute,
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	def := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = def.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = def.MaxDelay
+	}
+	if p.CallTimeout <= 0 {
+		p.CallTimeout = def.CallTimeout
+	}
+	return p
+}
+
+// delay returns the wait before the given retry (1 for the first). A
+// Retry-After reported by Azure is honored up to MaxDelay; otherwise the
+// exponential delay is jittered between half and all of it so that
+// concurrent calls spread.
+func (p RetryPolicy) delay(retry int, err error) time.Duration {
+	if after := retryAfter(err); after > 0 {
+		return min(after, p.MaxDelay)
+	}
+	d := p.MaxDelay
+	if shift := retry - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		d = p.BaseDelay << shift
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for _, tc := range []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{4, 2500 * time.Millisecond, 5 * time.Second},
+		{40, 2500 * time.Millisecond, 5 * time.Second},
+	} {
+		for range 20 {
+			if d := p.delay(tc.retry, errors.New("failed")); d < tc.min || d > tc.max {
+				t.Fatalf("delay(%d) = %s, want between %s and %s", tc.retry, d, tc.min, tc.max)
+			}
+		}
+	}
+
+	throttled := &CommandError{Stderr: "ERROR: (TooManyRequests) Please retry after 20 seconds.", Err: errors.New("exit status 1")}
+	throttled.RetryAfter = parseRetryAfter(throttled.Stderr)
+	if d := p.delay(1, throttled); d != 5*time.Second {
+		t.Fatalf("delay with Retry-After beyond MaxDelay = %s", d)
+	}
+	throttled.RetryAfter = 3 * time.Second
+	if d := p.delay(1, throttled); d != 3*time.Second {
+		t.Fatalf("delay with Retry-After = %s", d)
+	}
+	if d := parseRetryAfter("Retry-After: 7"); d != 7*time.Second {
+		t.Fatalf("parseRetryAfter(header) = %s", d)
+	}
+	if d := parseRetryAfter("ERROR: throttled"); d != 0 {
+		t.Fatalf("parseRetryAfter(no wait) = %s", d)
+	}
+
+	if got := (RetryPolicy{}).withDefaults(); got != DefaultRetryPolicy() {
+		t.Fatalf("zero policy = %#v", got)
+	}
+}
+
+func TestRetriable(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&CommandError{Stderr: "ERROR: (TooManyRequests) Rate limit exceeded.", Err: errors.New("exit status 1")}, true},
+		{&CommandError{Stderr: "ERROR: (ServiceUnavailable) Try again later.", Err: errors.New("exit status 1")}, true},
+		{&CommandError{Err: ErrCallTimeout}, true},
+		{&CommandError{Stderr: "ERROR: (AuthorizationFailed) no access", Err: errors.New("exit status 1")}, false},
+		{&CommandError{Stderr: "ERROR: (InvalidRequestContent) bad", Err: errors.New("exit status 1")}, false},
+		{context.Canceled, false},
+	} {
+		if got := IsRetriable(tc.err); got != tc.want {
+			t.Errorf("IsRetriable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func testClient(attempts int) *Client {
+	return &Client{Retry: RetryPolicy{MaxAttempts: attempts, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}}
+}
+
+func TestRunAzCommandRetries(t *testing.T) {
+	log := installFakeAz(t)
+	t.Setenv("AZ_GROUP_LIST", `[{"name":"rg","id":"/rg"}]`)
+	t.Setenv("AZ_FAIL_MATCH", "group list")
+	t.Setenv("AZ_FAIL_MESSAGE", "ERROR: (TooManyRequests) Rate limit exceeded.")
+	t.Setenv("AZ_FAIL_TIMES", "2")
+	rgs, err := testClient(3).ListResourceGroups(context.Background(), "sub")
+	if err != nil || len(rgs) != 1 {
+		t.Fatalf("ListResourceGroups() = %v, %v", rgs, err)
+	}
+	if n := countCalls(t, log, "group list"); n != 3 {
+		t.Fatalf("az called %d times, want 3", n)
+	}
+
+	// Retries are exhausted.
+	os.Remove(log + ".failed")
+	t.Setenv("AZ_FAIL_TIMES", "")
+	_, err = testClient(2).ListResourceGroups(context.Background(), "sub")
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 2 || Classify(err) != FailureThrottled {
+		t.Fatalf("exhausted error = %v", err)
+	}
+
+	// Terminal errors are not retried.
+	os.Remove(log)
+	t.Setenv("AZ_FAIL_MESSAGE", "ERROR: (AuthorizationFailed) no access")
+	_, err = testClient(3).ListResourceGroups(context.Background(), "sub")
+	if errors.As(err, &exhausted) || Classify(err) != FailureUnauthorized {
+		t.Fatalf("terminal error = %v", err)
+	}
+	if n := countCalls(t, log, "group list"); n != 1 {
+		t.Fatalf("az called %d times for a terminal error", n)
+	}
+}
+
+func TestRunAzCommandTimeout(t *testing.T) {
+	installFakeAz(t)
+	t.Setenv("AZ_SLOW_MATCH", "group list")
+	c := &Client{Retry: RetryPolicy{MaxAttempts: 1, CallTimeout: 50 * time.Millisecond}}
+	_, err := c.ListResourceGroups(context.Background(), "sub")
+	if !errors.Is(err, ErrCallTimeout) || Classify(err) != FailureTimeout {
+		t.Fatalf("timeout error = %v", err)
+	}
+
+	// Cancelling the caller is not reported as a timeout or retried.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c.Retry.MaxAttempts = 3
+	c.Retry.CallTimeout = time.Minute
+	_, err = c.ListResourceGroups(ctx, "sub")
+	if err == nil || errors.Is(err, ErrCallTimeout) || IsRetriable(err) {
+		t.Fatalf("cancelled error = %v", err)
+	}
+}
+
+func countCalls(t *testing.T, log, args string) int {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), args)
+}
@@ -0,0 +1,39 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// Runner runs an az command and returns its standard output. A failure
+// should be returned as a *CommandError with the standard error output, so
+// that it is classified and retried like a failure of the az executable.
+type Runner interface {
+	Run(ctx context.Context, args []string) ([]byte, error)
+}
+
+// RunnerFunc adapts a function to a Runner.
+type RunnerFunc func(ctx context.Context, args []string) ([]byte, error)
+
+func (f RunnerFunc) Run(ctx context.Context, args []string) ([]byte, error) {
+	return f(ctx, args)
+}
+
+// ExecRunner runs the az executable found in PATH. It is the Runner of a
+// Client unless WithRunner sets another.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, args []string) ([]byte, error) {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "az", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stderr.String())
+		return nil, &CommandError{Args: args, Stderr: output, Err: err, RetryAfter: parseRetryAfter(output)}
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,64 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithRunner(t *testing.T) {
+	var calls [][]string
+	runner := RunnerFunc(func(_ context.Context, args []string) ([]byte, error) {
+		calls = append(calls, args)
+		if args[0] == "account" {
+			return nil, &CommandError{Args: args, Err: errors.New("exit status 1"), Stderr: "Please run 'az login' to setup account."}
+		}
+		return []byte(`[{"name":"app","id":"/subscriptions/s/resourceGroups/app"}]`), nil
+	})
+	var logs bytes.Buffer
+	auth := Auth{Mode: AuthServicePrincipal, ClientID: "app-id", ClientSecret: "s3cret", TenantID: "tenant"}
+	c := NewClient(WithRunner(runner), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))), WithRetry(RetryPolicy{MaxAttempts: 1}), WithCallTimeout(time.Second))
+
+	rgs, err := c.ListResourceGroups(context.Background(), "s")
+	if err != nil || len(rgs) != 1 || rgs[0].Name != "app" {
+		t.Fatalf("ListResourceGroups() = %v, %v", rgs, err)
+	}
+	if len(calls) != 1 || strings.Join(calls[0][:4], " ") != "group list --subscription s" {
+		t.Fatalf("runner calls = %v", calls)
+	}
+	// Completed calls are logged at the info level of a plain --log-file.
+	if !strings.Contains(logs.String(), `level=INFO msg="az command"`) || !strings.Contains(logs.String(), "group list") {
+		t.Fatalf("logs = %s", logs.String())
+	}
+
+	// A client with its own runner does not fall back to an interactive login.
+	if err := c.EnsureLogin(context.Background()); err == nil || !strings.Contains(err.Error(), "no active Azure CLI session") {
+		t.Fatalf("EnsureLogin() = %v", err)
+	}
+	if !strings.Contains(logs.String(), `level=WARN msg="az command failed"`) || !strings.Contains(logs.String(), `stderr="Please run 'az login' to setup account."`) {
+		t.Fatalf("failure logs = %s", logs.String())
+	}
+
+	// Secrets are not logged.
+	logs.Reset()
+	WithAuth(auth)(c)
+	_ = c.EnsureLogin(context.Background())
+	if !strings.Contains(logs.String(), "login --service-principal") || strings.Contains(logs.String(), "s3cret") {
+		t.Fatalf("login logs = %s", logs.String())
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	runner := RunnerFunc(func(ctx context.Context, _ []string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	c := NewClient(WithRunner(runner), WithRetry(RetryPolicy{MaxAttempts: 1}), WithCallTimeout(20*time.Millisecond))
+	if _, err := c.ListResourceGroups(context.Background(), "s"); !errors.Is(err, ErrCallTimeout) || Classify(err) != FailureTimeout {
+		t.Fatalf("timeout error = %v", err)
+	}
+}
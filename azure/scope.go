@@ -0,0 +1,93 @@
+package azure
+
+import "strings"
+
+// ScopeLevel is the level of a scope in the Azure resource hierarchy.
+type ScopeLevel int
+
+const (
+	ScopeUnknown ScopeLevel = iota
+	ScopeManagementGroup
+	ScopeSubscription
+	ScopeResourceGroup
+	ScopeResource
+)
+
+// ScopeLevels lists the known levels from the top of the hierarchy down.
+var ScopeLevels = []ScopeLevel{ScopeManagementGroup, ScopeSubscription, ScopeResourceGroup, ScopeResource}
+
+// String returns the name of the level.
+func (l ScopeLevel) String() string {
+	switch l {
+	case ScopeManagementGroup:
+		return "Management group"
+	case ScopeSubscription:
+		return "Subscription"
+	case ScopeResourceGroup:
+		return "Resource group"
+	case ScopeResource:
+		return "Resource"
+	}
+	return "Unknown scope"
+}
+
+// ParseScope returns the level of a scope ID and the name of the
+// management group, subscription, resource group or resource it identifies.
+func ParseScope(scope string) (ScopeLevel, string) {
+	parts := strings.Split(strings.Trim(scope, "/"), "/")
+	switch {
+	case len(parts) == 4 && strings.EqualFold(parts[0], "providers") && strings.EqualFold(parts[1], "Microsoft.Management") && strings.EqualFold(parts[2], "managementGroups"):
+		return ScopeManagementGroup, parts[3]
+	case len(parts) < 2 || !strings.EqualFold(parts[0], "subscriptions"):
+		return ScopeUnknown, ""
+	case len(parts) == 2:
+		return ScopeSubscription, parts[1]
+	case len(parts) == 4 && strings.EqualFold(parts[2], "resourceGroups"):
+		return ScopeResourceGroup, parts[3]
+	case len(parts) > 4 && strings.EqualFold(parts[2], "resourceGroups") && strings.EqualFold(parts[4], "providers"):
+		return ScopeResource, parts[len(parts)-1]
+	}
+	return ScopeUnknown, ""
+}
+
+// ScopeContains reports whether inner is scope itself or lies beneath it.
+// Management group nesting is not known from the IDs alone, so a
+// management group only contains itself.
+func ScopeContains(scope, inner string) bool {
+	scope = strings.ToLower(strings.TrimSuffix(scope, "/"))
+	inner = strings.ToLower(strings.TrimSuffix(inner, "/"))
+	return inner == scope || strings.HasPrefix(inner, scope+"/")
+}
+
+// Origin returns the level and name of the scope the assignment is
+// assigned on.
+func (p PolicyAssignment) Origin() (ScopeLevel, string) {
+	return ParseScope(p.Scope)
+}
+
+// ScopeLimit returns the scope exemptions of the assignment must lie
+// within: the assignment scope for an assignment on a resource group or
+// resource, empty for one on a subscription or management group.
+func (p PolicyAssignment) ScopeLimit() string {
+	if level, _ := p.Origin(); level != ScopeResourceGroup && level != ScopeResource {
+		return ""
+	}
+	return p.Scope
+}
+
+// ScopesWithin returns the scope options on or beneath limit. When none is,
+// as for an assignment on a single resource, limit itself is the only
+// option.
+func ScopesWithin(options []ResourceGroup, limit string) []ResourceGroup {
+	var within []ResourceGroup
+	for _, opt := range options {
+		if ScopeContains(limit, opt.ID) {
+			within = append(within, opt)
+		}
+	}
+	if len(within) == 0 {
+		_, name := ParseScope(limit)
+		within = append(within, ResourceGroup{Name: name, ID: limit})
+	}
+	return within
+}
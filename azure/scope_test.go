@@ -0,0 +1,43 @@
+package azure
+
+import "testing"
+
+func TestParseScope(t *testing.T) {
+	for _, tc := range []struct {
+		scope string
+		level ScopeLevel
+		name  string
+	}{
+		{"/providers/Microsoft.Management/managementGroups/contoso", ScopeManagementGroup, "contoso"},
+		{"/subscriptions/sub-1", ScopeSubscription, "sub-1"},
+		{"/subscriptions/sub-1/resourceGroups/app", ScopeResourceGroup, "app"},
+		{"/subscriptions/sub-1/resourcegroups/app/providers/Microsoft.Storage/storageAccounts/logs", ScopeResource, "logs"},
+		{"/subscriptions/sub-1/providers/Microsoft.Authorization/policyAssignments/a", ScopeUnknown, ""},
+		{"", ScopeUnknown, ""},
+	} {
+		level, name := ParseScope(tc.scope)
+		if level != tc.level || name != tc.name {
+			t.Errorf("ParseScope(%q) = %v, %q; want %v, %q", tc.scope, level, name, tc.level, tc.name)
+		}
+	}
+	if level, name := (PolicyAssignment{Scope: "/subscriptions/s/resourceGroups/rg"}).Origin(); level != ScopeResourceGroup || name != "rg" {
+		t.Fatalf("Origin() = %v, %q", level, name)
+	}
+}
+
+func TestScopeContains(t *testing.T) {
+	for _, tc := range []struct {
+		scope, inner string
+		want         bool
+	}{
+		{"/subscriptions/s", "/subscriptions/s", true},
+		{"/subscriptions/s", "/subscriptions/s/resourceGroups/rg", true},
+		{"/subscriptions/s/resourceGroups/RG", "/subscriptions/s/resourcegroups/rg/providers/x/y/z", true},
+		{"/subscriptions/s/resourceGroups/rg", "/subscriptions/s", false},
+		{"/subscriptions/s/resourceGroups/rg", "/subscriptions/s/resourceGroups/rg2", false},
+	} {
+		if got := ScopeContains(tc.scope, tc.inner); got != tc.want {
+			t.Errorf("ScopeContains(%q, %q) = %v, want %v", tc.scope, tc.inner, got, tc.want)
+		}
+	}
+}
@@ -1,13 +1,29 @@
-// Package azure is for interacting with Azure resources
+// Package azure is for interacting with Azure resources through the Azure
+// CLI. It can be embedded in other tools:
+//
+//	client := azure.NewClient(azure.WithCloud("AzureCloud"), azure.WithCallTimeout(time.Minute))
+//	if err := client.EnsureLogin(ctx); err != nil { ... }
+//	exemption, err := client.CreateExemption(ctx, azure.ExemptionSpec{...})
+//
+// Code that only needs to list and create exemptions should depend on the
+// API interface, which Client implements.
 package azure
 
-import "strings"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
 
+// Subscription is an Azure subscription of the signed-in tenant.
 type Subscription struct {
+	// ID is the subscription ID, either bare or as /subscriptions/<id>.
 	ID   string `json:"id"`
 	Name string `json:"name"`
 }
 
+// Scope returns the scope ID of the subscription, /subscriptions/<id>.
 func (s Subscription) Scope() string {
 	if strings.HasPrefix(s.ID, "/") {
 		return s.ID
@@ -15,6 +31,8 @@ func (s Subscription) Scope() string {
 	return "/subscriptions/" + s.ID
 }
 
+// ShortID returns the bare subscription ID, as the Azure CLI takes it in
+// --subscription.
 func (s Subscription) ShortID() string {
 	if !strings.HasPrefix(s.ID, "/subscriptions/") {
 		return s.ID
@@ -23,19 +41,37 @@ func (s Subscription) ShortID() string {
 	return parts[len(parts)-1]
 }
 
+// Matches reports whether query is the subscription's ID or name,
+// ignoring case.
+func (s Subscription) Matches(query string) bool {
+	return strings.EqualFold(s.ShortID(), query) || strings.EqualFold(s.ID, query) || strings.EqualFold(s.Name, query)
+}
+
+// ResourceGroup is a resource group of a subscription. ID is its full
+// resource ID, which is also its scope.
 type ResourceGroup struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 }
 
+// PolicyAssignment is a policy or initiative assigned to a scope.
 type PolicyAssignment struct {
-	ID                 string `json:"id"`
-	Name               string `json:"name"`
-	DisplayName        string `json:"displayName"`
-	Scope              string `json:"scope"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	// Scope is the scope the assignment is assigned at, which may lie above
+	// the subscription it was listed for.
+	Scope string `json:"scope"`
+	// PolicyDefinitionID is the ID of the assigned policy definition or,
+	// for an initiative, policy set definition.
 	PolicyDefinitionID string `json:"policyDefinitionId"`
+
+	// Parameters are the values the assignment passes to its definition.
+	Parameters map[string]ParameterValue `json:"parameters,omitempty"`
 }
 
+// DisplayLabel returns the assignment's display name, falling back to its
+// name.
 func (p PolicyAssignment) DisplayLabel() string {
 	if p.DisplayName != "" {
 		return p.DisplayName
@@ -43,6 +79,13 @@ func (p PolicyAssignment) DisplayLabel() string {
 	return p.Name
 }
 
+// Matches reports whether query is the assignment's ID, name or display
+// name, ignoring case.
+func (p PolicyAssignment) Matches(query string) bool {
+	return strings.EqualFold(p.ID, query) || strings.EqualFold(p.Name, query) || strings.EqualFold(p.DisplayName, query)
+}
+
+// ShortID returns the last segment of the assignment ID, its name.
 func (p PolicyAssignment) ShortID() string {
 	if p.ID == "" {
 		return ""
@@ -51,8 +94,265 @@ func (p PolicyAssignment) ShortID() string {
 	return parts[len(parts)-1]
 }
 
+// AssignmentDetails holds the properties of a policy assignment shown in the
+// detail pane.
+type AssignmentDetails struct {
+	Description           string                    `json:"description"`
+	EnforcementMode       string                    `json:"enforcementMode"`
+	Scope                 string                    `json:"scope"`
+	NotScopes             []string                  `json:"notScopes"`
+	Parameters            map[string]ParameterValue `json:"parameters"`
+	NonComplianceMessages []NonComplianceMessage    `json:"nonComplianceMessages"`
+	Identity              *AssignmentIdentity       `json:"identity"`
+
+	// Effect is the effect of an assignment of a single policy definition,
+	// resolved against its parameters. It is empty for initiatives and when
+	// it could not be determined.
+	Effect string `json:"-"`
+}
+
+// ParameterValue is the value assigned to a policy parameter.
+type ParameterValue struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// String returns the parameter value as compact JSON.
+func (p ParameterValue) String() string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, p.Value); err != nil {
+		return string(p.Value)
+	}
+	return compact.String()
+}
+
+// NonComplianceMessage is shown to users when a resource is denied or
+// evaluated as non-compliant. An empty reference ID applies to the whole assignment.
+type NonComplianceMessage struct {
+	Message     string `json:"message"`
+	ReferenceID string `json:"policyDefinitionReferenceId"`
+}
+
+// AssignmentIdentity is the managed identity used by an assignment for
+// DeployIfNotExists and Modify remediation.
+type AssignmentIdentity struct {
+	Type                   string                     `json:"type"`
+	PrincipalID            string                     `json:"principalId"`
+	UserAssignedIdentities map[string]json.RawMessage `json:"userAssignedIdentities"`
+}
+
+// DefinitionDetails holds the properties of a policy definition shown in the
+// detail pane. PolicyRule is indented JSON.
+type DefinitionDetails struct {
+	DisplayName string
+	Description string
+	Category    string
+	Mode        string
+	Effect      string
+	PolicyRule  string
+}
+
+// PolicyDefinitionRef is a member of an initiative, as exempted by
+// ExemptionSpec.DefinitionReferenceIDs.
 type PolicyDefinitionRef struct {
 	PolicyDefinitionID string `json:"policyDefinitionId"`
-	ReferenceID        string `json:"policyDefinitionReferenceId"`
-	DisplayName        string
+	// ReferenceID identifies the member within the initiative.
+	ReferenceID string `json:"policyDefinitionReferenceId"`
+	DisplayName string `json:"displayName,omitempty"`
+
+	// Effect is the member's effect with parameters resolved against the
+	// initiative and the assignment. It is empty if it could not be determined.
+	Effect string `json:"effect,omitempty"`
+
+	// Groups are the initiative's policy definition groups (typically
+	// compliance controls) the member belongs to.
+	Groups []PolicyDefinitionGroup `json:"groups,omitempty"`
+}
+
+// PolicyDefinitionGroup is a group of initiative members, such as a
+// compliance control of a regulatory initiative.
+type PolicyDefinitionGroup struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	Category    string `json:"category,omitempty"`
+}
+
+// Label returns the group's display name, falling back to its name.
+func (g PolicyDefinitionGroup) Label() string {
+	if g.DisplayName != "" {
+		return g.DisplayName
+	}
+	return g.Name
+}
+
+// ComplianceSummary holds non-compliant resource counts from Azure Policy Insights.
+// Assignment IDs and reference IDs are stored lowercased.
+type ComplianceSummary struct {
+	// Assignments maps policy assignment IDs to their non-compliant resource count.
+	Assignments map[string]int
+	// Definitions maps policy assignment IDs to the non-compliant resource
+	// count of each policy definition reference ID in the initiative.
+	Definitions map[string]map[string]int
+}
+
+// AssignmentCount returns the non-compliant resource count for the assignment,
+// and whether Policy Insights reported one.
+func (s ComplianceSummary) AssignmentCount(assignmentID string) (int, bool) {
+	count, ok := s.Assignments[strings.ToLower(assignmentID)]
+	return count, ok
+}
+
+// DefinitionCount returns the non-compliant resource count for an initiative
+// member of the assignment, and whether Policy Insights reported one.
+func (s ComplianceSummary) DefinitionCount(assignmentID, referenceID string) (int, bool) {
+	count, ok := s.Definitions[strings.ToLower(assignmentID)][strings.ToLower(referenceID)]
+	return count, ok
+}
+
+// Principal identifies a signed-in Azure user or service principal.
+type Principal struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Label returns a human readable representation of the principal.
+func (p Principal) Label() string {
+	if p.ID == "" || p.ID == p.Name {
+		return p.Name
+	}
+	return fmt.Sprintf("%s (%s)", p.Name, p.ID)
+}
+
+// Kind describes the type of the principal: a user, a service principal
+// or a managed identity.
+func (p Principal) Kind() string {
+	switch {
+	case strings.EqualFold(p.Name, "systemAssignedIdentity") || strings.EqualFold(p.Name, "userAssignedIdentity"):
+		return "managed identity"
+	case strings.EqualFold(p.Type, "servicePrincipal"):
+		return "service principal"
+	case p.Type != "":
+		return "user"
+	}
+	return ""
+}
+
+// Same reports whether both principals refer to the same identity.
+// IDs and names are compared case-insensitively.
+func (p Principal) Same(other Principal) bool {
+	if p.ID != "" && strings.EqualFold(p.ID, other.ID) {
+		return true
+	}
+	return p.Name != "" && strings.EqualFold(p.Name, other.Name)
+}
+
+// ExemptionSpec holds everything needed to create a policy exemption.
+type ExemptionSpec struct {
+	// Scope is the ID of the management group, subscription or resource
+	// group to exempt, and ScopeName its display name. SubscriptionName is
+	// empty for a management group scope; for the subscription itself
+	// ScopeName is its name or "Entire Subscription".
+	Scope            string `json:"scope"`
+	ScopeName        string `json:"scopeName"`
+	SubscriptionName string `json:"subscriptionName"`
+	// Assignment is the exempted policy assignment. ReferenceIDs limits the
+	// exemption to these members of an initiative; empty exempts it all.
+	Assignment   PolicyAssignment `json:"assignment"`
+	ReferenceIDs []string         `json:"referenceIds,omitempty"`
+	// Ticket and Users are recorded in the description.
+	Ticket string `json:"ticket"`
+	Users  string `json:"users"`
+	// ExpirationDate is the last day of the exemption as YYYY-MM-DD, empty
+	// for an exemption that does not expire.
+	ExpirationDate string `json:"expirationDate,omitempty"`
+
+	// Selectors optionally limits the exemption to resources in certain
+	// locations or of certain types within the scope.
+	Selectors ResourceSelectors `json:"resourceSelectors,omitzero"`
+
+	// RequestedBy and ApprovedBy are set when the exemption was created
+	// through the two-person approval workflow.
+	RequestedBy *Principal `json:"requestedBy,omitempty"`
+	ApprovedBy  *Principal `json:"approvedBy,omitempty"`
+	// RequesterUnverified is set when the approver did not check
+	// RequestedBy against the digest the requester published. It is
+	// recorded in the metadata as requesterVerified=false.
+	RequesterUnverified bool `json:"-"`
+}
+
+// ResourceSelectors restricts an exemption to resources in the listed
+// locations and of the listed resource types. An empty list does not restrict.
+type ResourceSelectors struct {
+	Locations     []string `json:"locations,omitempty"`
+	ResourceTypes []string `json:"resourceTypes,omitempty"`
+}
+
+// IsEmpty reports whether no restriction is configured.
+func (s ResourceSelectors) IsEmpty() bool {
+	return len(s.Locations) == 0 && len(s.ResourceTypes) == 0
+}
+
+// String describes the selectors for display.
+func (s ResourceSelectors) String() string {
+	if s.IsEmpty() {
+		return "All resources in scope"
+	}
+	var parts []string
+	if len(s.Locations) > 0 {
+		parts = append(parts, "locations: "+strings.Join(s.Locations, ", "))
+	}
+	if len(s.ResourceTypes) > 0 {
+		parts = append(parts, "resource types: "+strings.Join(s.ResourceTypes, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ARM returns the selectors in the resourceSelectors format of the
+// Microsoft.Authorization/policyExemptions resource.
+func (s ResourceSelectors) ARM() []ARMResourceSelector {
+	if s.IsEmpty() {
+		return nil
+	}
+	selector := ARMResourceSelector{Name: "azexempt"}
+	if len(s.Locations) > 0 {
+		selector.Selectors = append(selector.Selectors, ARMSelector{Kind: "resourceLocation", In: s.Locations})
+	}
+	if len(s.ResourceTypes) > 0 {
+		selector.Selectors = append(selector.Selectors, ARMSelector{Kind: "resourceType", In: s.ResourceTypes})
+	}
+	return []ARMResourceSelector{selector}
+}
+
+// ARMResourceSelector is a named set of selectors as used by the Azure Policy API.
+type ARMResourceSelector struct {
+	Name      string        `json:"name"`
+	Selectors []ARMSelector `json:"selectors"`
+}
+
+// ARMSelector matches resources whose property of the given kind is in the list.
+type ARMSelector struct {
+	Kind string   `json:"kind"`
+	In   []string `json:"in"`
+}
+
+// ResourceFacets are the distinct locations and resource types of the
+// resources within a scope.
+type ResourceFacets struct {
+	Locations     []string
+	ResourceTypes []string
+}
+
+// metadata returns the key=value pairs recorded on the exemption.
+func (s ExemptionSpec) metadata() []string {
+	var pairs []string
+	if s.RequestedBy != nil {
+		pairs = append(pairs, "requestedBy="+s.RequestedBy.ID)
+	}
+	if s.ApprovedBy != nil {
+		pairs = append(pairs, "approvedBy="+s.ApprovedBy.ID)
+	}
+	if s.RequesterUnverified {
+		pairs = append(pairs, "requesterVerified=false")
+	}
+	return pairs
 }
@@ -43,3 +43,56 @@ func TestPolicyAssignmentHelpers(t *testing.T) {
 		t.Fatalf("empty ShortID() = %q", got)
 	}
 }
+
+func TestPrincipalHelpers(t *testing.T) {
+	p := Principal{ID: "object-id", Name: "ada@example.com"}
+	if got := p.Label(); got != "ada@example.com (object-id)" {
+		t.Fatalf("Label() = %q", got)
+	}
+	if got := (Principal{ID: "app", Name: "app"}).Label(); got != "app" {
+		t.Fatalf("Label() without distinct ID = %q", got)
+	}
+	if !p.Same(Principal{ID: "OBJECT-ID"}) || !p.Same(Principal{Name: "Ada@Example.com"}) || p.Same(Principal{ID: "other", Name: "other"}) {
+		t.Fatal("Same() comparison is wrong")
+	}
+	if (Principal{}).Same(Principal{}) {
+		t.Fatal("empty principals must not match")
+	}
+	for _, tc := range []struct {
+		p    Principal
+		want string
+	}{
+		{Principal{Name: "ada@example.com", Type: "user"}, "user"},
+		{Principal{Name: "app-id", Type: "servicePrincipal"}, "service principal"},
+		{Principal{Name: "systemAssignedIdentity", Type: "servicePrincipal"}, "managed identity"},
+		{Principal{}, ""},
+	} {
+		if got := tc.p.Kind(); got != tc.want {
+			t.Errorf("%#v.Kind() = %q, want %q", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestPolicyDefinitionGroupLabel(t *testing.T) {
+	if got := (PolicyDefinitionGroup{Name: "CIS_1.1", DisplayName: "Identity"}).Label(); got != "Identity" {
+		t.Fatalf("Label() = %q", got)
+	}
+	if got := (PolicyDefinitionGroup{Name: "CIS_1.1"}).Label(); got != "CIS_1.1" {
+		t.Fatalf("Label() fallback = %q", got)
+	}
+}
+
+func TestResourceSelectors(t *testing.T) {
+	var empty ResourceSelectors
+	if !empty.IsEmpty() || empty.ARM() != nil || empty.String() != "All resources in scope" {
+		t.Fatalf("empty selectors = %v, %#v", empty, empty.ARM())
+	}
+	s := ResourceSelectors{Locations: []string{"westeurope", "northeurope"}, ResourceTypes: []string{"Microsoft.Storage/storageAccounts"}}
+	if got := s.String(); got != "locations: westeurope, northeurope; resource types: Microsoft.Storage/storageAccounts" {
+		t.Fatalf("String() = %q", got)
+	}
+	arm := s.ARM()
+	if len(arm) != 1 || len(arm[0].Selectors) != 2 || arm[0].Selectors[0].Kind != "resourceLocation" || arm[0].Selectors[1].Kind != "resourceType" {
+		t.Fatalf("ARM() = %#v", arm)
+	}
+}
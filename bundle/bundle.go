@@ -0,0 +1,203 @@
+// Package bundle reads and writes exemption request files for the
+// two-person approval workflow. A request file is self-contained: it carries
+// everything needed to create the exemption plus the identity of the requester.
+//
+// A request file is unsigned, so whoever hands it over can edit it, the
+// requester field included. The approver must learn from an authenticated
+// channel who raised the request: the requester posts the Digest of the
+// file from their own account, for example in the ticket, and the approver
+// checks it with ApproveDigest. ApproveUnverified skips the check and marks
+// the exemption as such.
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+// Version is the current request file format version.
+const Version = 1
+
+// ErrSelfApproval is returned when the approver is the same principal that
+// raised the request.
+var ErrSelfApproval = errors.New("the approver must not be the requester")
+
+// ErrDigestMismatch is returned when a request file does not match the
+// digest its requester published.
+var ErrDigestMismatch = errors.New("the request file does not match the published digest")
+
+// Request is an exemption request waiting for approval.
+type Request struct {
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Requester azure.Principal     `json:"requester"`
+	Exemption azure.ExemptionSpec `json:"exemption"`
+
+	// Definitions lists the selected initiative members so the approver can
+	// see their display names. It is informational only.
+	Definitions []azure.PolicyDefinitionRef `json:"definitions,omitempty"`
+}
+
+// New creates a request for the given exemption raised by requester.
+func New(spec azure.ExemptionSpec, requester azure.Principal, definitions []azure.PolicyDefinitionRef) *Request {
+	return &Request{
+		Version:     Version,
+		CreatedAt:   time.Now().UTC(),
+		Requester:   requester,
+		Exemption:   spec,
+		Definitions: definitions,
+	}
+}
+
+// Validate checks that the request contains everything needed to create the exemption.
+func (r *Request) Validate() error {
+	if r.Version != Version {
+		return fmt.Errorf("unsupported request file version %d", r.Version)
+	}
+	if r.Requester.ID == "" && r.Requester.Name == "" {
+		return errors.New("request has no requester identity")
+	}
+	spec := r.Exemption
+	switch {
+	case spec.Scope == "":
+		return errors.New("request has no scope")
+	case spec.Assignment.ID == "":
+		return errors.New("request has no policy assignment")
+	case strings.TrimSpace(spec.Ticket) == "":
+		return errors.New("request has no ticket")
+	case strings.TrimSpace(spec.Users) == "":
+		return errors.New("request has no requester names")
+	}
+	if spec.ExpirationDate != "" {
+		if _, err := time.Parse("2006-01-02", spec.ExpirationDate); err != nil {
+			return fmt.Errorf("invalid expiration date %q: %w", spec.ExpirationDate, err)
+		}
+	}
+	return nil
+}
+
+// Digest returns the SHA-256 of the request, in hex. It covers the
+// requester, the time of the request and the exemption, so that it changes
+// with any edit of the file that matters for the approval.
+func (r *Request) Digest() string {
+	data, err := json.Marshal(struct {
+		Version   int                 `json:"version"`
+		CreatedAt time.Time           `json:"createdAt"`
+		Requester azure.Principal     `json:"requester"`
+		Exemption azure.ExemptionSpec `json:"exemption"`
+	}{r.Version, r.CreatedAt, r.Requester, r.Exemption})
+	if err != nil {
+		return "" // Matches no published digest
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ApproveDigest is Approve for a request whose requester published digest
+// from their own account. It fails with ErrDigestMismatch if the file was
+// changed since.
+func (r *Request) ApproveDigest(approver azure.Principal, digest string) (azure.ExemptionSpec, error) {
+	want := r.Digest()
+	if want == "" || !strings.EqualFold(strings.TrimSpace(digest), want) {
+		return azure.ExemptionSpec{}, ErrDigestMismatch
+	}
+	return r.Approve(approver)
+}
+
+// ApproveUnverified is Approve without checking the requester against a
+// published digest. The returned exemption records that the requester was
+// not verified.
+func (r *Request) ApproveUnverified(approver azure.Principal) (azure.ExemptionSpec, error) {
+	spec, err := r.Approve(approver)
+	spec.RequesterUnverified = err == nil
+	return spec, err
+}
+
+// Approve returns the exemption to create once approver has signed off.
+// It fails with ErrSelfApproval if approver is the requester. The requester
+// is taken from the file as is; see the package documentation for how the
+// approver can trust it.
+func (r *Request) Approve(approver azure.Principal) (azure.ExemptionSpec, error) {
+	if r.Requester.Same(approver) {
+		return azure.ExemptionSpec{}, ErrSelfApproval
+	}
+	spec := r.Exemption
+	requester := r.Requester
+	spec.RequestedBy = &requester
+	spec.ApprovedBy = &approver
+	return spec, nil
+}
+
+// Summary renders the request in a human readable form for review.
+func (r *Request) Summary() string {
+	spec := r.Exemption
+	var b strings.Builder
+	fmt.Fprintf(&b, "Requested by: %s on %s\n", r.Requester.Label(), r.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Digest:       %s\n", r.Digest())
+	if spec.SubscriptionName != "" {
+		fmt.Fprintf(&b, "Subscription: %s\n", spec.SubscriptionName)
+	}
+	fmt.Fprintf(&b, "Scope:        %s (%s)\n", spec.ScopeName, spec.Scope)
+	fmt.Fprintf(&b, "Assignment:   %s (%s)\n", spec.Assignment.DisplayLabel(), spec.Assignment.ID)
+	fmt.Fprintf(&b, "Resources:    %s\n", spec.Selectors)
+	if len(spec.ReferenceIDs) == 0 {
+		b.WriteString("Definitions:  Entire assignment\n")
+	} else {
+		b.WriteString("Definitions:\n")
+		names := make(map[string]string, len(r.Definitions))
+		for _, ref := range r.Definitions {
+			names[ref.ReferenceID] = ref.DisplayName
+		}
+		for _, id := range spec.ReferenceIDs {
+			if name := names[id]; name != "" {
+				fmt.Fprintf(&b, "  • %s (%s)\n", name, id)
+			} else {
+				fmt.Fprintf(&b, "  • %s\n", id)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "Ticket:       %s\n", spec.Ticket)
+	fmt.Fprintf(&b, "Requesters:   %s\n", spec.Users)
+	if spec.ExpirationDate != "" {
+		fmt.Fprintf(&b, "Expires on:   %s\n", spec.ExpirationDate)
+	} else {
+		b.WriteString("Expires on:   Unlimited\n")
+	}
+	return b.String()
+}
+
+// Write stores the request as JSON at path.
+func Write(path string, r *Request) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode request: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("unable to write request file: %w", err)
+	}
+	return nil
+}
+
+// Read loads and validates a request file.
+func Read(path string) (*Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read request file: %w", err)
+	}
+	var r Request
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("unable to parse request file: %w", err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
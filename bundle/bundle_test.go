@@ -0,0 +1,155 @@
+package bundle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+func validRequest() *Request {
+	spec := azure.ExemptionSpec{
+		Scope:            "/subscriptions/sub",
+		ScopeName:        "Entire Subscription",
+		SubscriptionName: "Production",
+		Assignment:       azure.PolicyAssignment{ID: "/assignments/a", DisplayName: "Security baseline"},
+		ReferenceIDs:     []string{"ref-a"},
+		Ticket:           "INC1",
+		Users:            "Ada",
+		ExpirationDate:   "2030-01-02",
+		Selectors:        azure.ResourceSelectors{ResourceTypes: []string{"Microsoft.Storage/storageAccounts"}},
+	}
+	defs := []azure.PolicyDefinitionRef{{ReferenceID: "ref-a", DisplayName: "Require TLS"}}
+	return New(spec, azure.Principal{ID: "requester-id", Name: "ada@example.com", Type: "user"}, defs)
+}
+
+func TestWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "request.json")
+	req := validRequest()
+	if err := Write(path, req); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Exemption, req.Exemption) || got.Requester != req.Requester || !got.CreatedAt.Equal(req.CreatedAt) {
+		t.Fatalf("Read() = %#v, want %#v", got, req)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("request file mode = %v, %v", info.Mode(), err)
+	}
+
+	if _, err := Read(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("Read() of missing file should fail")
+	}
+	if err := os.WriteFile(path, []byte("not-json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil || !strings.Contains(err.Error(), "parse request") {
+		t.Fatalf("Read() parse error = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Request)
+		err    string
+	}{
+		{"valid", func(*Request) {}, ""},
+		{"version", func(r *Request) { r.Version = 99 }, "version"},
+		{"requester", func(r *Request) { r.Requester = azure.Principal{} }, "requester identity"},
+		{"scope", func(r *Request) { r.Exemption.Scope = "" }, "scope"},
+		{"assignment", func(r *Request) { r.Exemption.Assignment.ID = "" }, "assignment"},
+		{"ticket", func(r *Request) { r.Exemption.Ticket = " " }, "ticket"},
+		{"users", func(r *Request) { r.Exemption.Users = "" }, "requester names"},
+		{"expiry", func(r *Request) { r.Exemption.ExpirationDate = "soon" }, "expiration date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validRequest()
+			tt.modify(req)
+			err := req.Validate()
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("Validate() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApprove(t *testing.T) {
+	req := validRequest()
+	for _, approver := range []azure.Principal{{ID: "REQUESTER-ID", Name: "other"}, {ID: "other", Name: "ADA@example.com"}} {
+		if _, err := req.Approve(approver); !errors.Is(err, ErrSelfApproval) {
+			t.Fatalf("Approve(%#v) error = %v, want ErrSelfApproval", approver, err)
+		}
+	}
+
+	approver := azure.Principal{ID: "approver-id", Name: "linus@example.com"}
+	spec, err := req.Approve(approver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.ApprovedBy == nil || *spec.ApprovedBy != approver || spec.RequestedBy == nil || *spec.RequestedBy != req.Requester {
+		t.Fatalf("approved spec = %#v", spec)
+	}
+	if req.Exemption.ApprovedBy != nil {
+		t.Fatal("Approve() must not modify the request")
+	}
+}
+
+func TestApproveDigest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "request.json")
+	req := validRequest()
+	digest := req.Digest()
+	if err := Write(path, req); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approver := azure.Principal{ID: "approver-id", Name: "linus@example.com"}
+	if _, err := read.ApproveDigest(approver, strings.ToUpper(digest)); err != nil {
+		t.Fatalf("ApproveDigest() of unchanged file = %v", err)
+	}
+
+	// A requester who names someone else in the file no longer matches.
+	read.Requester = azure.Principal{ID: "someone-else"}
+	if _, err := read.ApproveDigest(approver, digest); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("ApproveDigest() of edited file = %v", err)
+	}
+	if _, err := read.ApproveDigest(approver, ""); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("ApproveDigest() without digest = %v", err)
+	}
+
+	// Skipping the check is recorded on the exemption.
+	if spec, err := read.ApproveUnverified(approver); err != nil || !spec.RequesterUnverified {
+		t.Fatalf("ApproveUnverified() = %+v, %v", spec, err)
+	}
+	if spec, err := read.ApproveDigest(approver, read.Digest()); err != nil || spec.RequesterUnverified {
+		t.Fatalf("verified approval = %+v, %v", spec, err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	req := validRequest()
+	got := req.Summary()
+	for _, want := range []string{"ada@example.com (requester-id)", "Production", "Security baseline", "Require TLS (ref-a)", "resource types: Microsoft.Storage/storageAccounts", "INC1", "2030-01-02"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Summary() does not contain %q:\n%s", want, got)
+		}
+	}
+
+	req.Exemption.ReferenceIDs = nil
+	req.Exemption.ExpirationDate = ""
+	got = req.Summary()
+	if !strings.Contains(got, "Entire assignment") || !strings.Contains(got, "Unlimited") {
+		t.Fatalf("Summary() = %s", got)
+	}
+}
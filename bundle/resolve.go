@@ -0,0 +1,172 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+// Resolver is the subset of the Azure client needed to turn a Selection into
+// an exemption.
+type Resolver interface {
+	ListSubscriptions(context.Context) ([]azure.Subscription, error)
+	ListAssignments(context.Context, string) ([]azure.PolicyAssignment, error)
+	ListAssignmentDefinitions(context.Context, azure.PolicyAssignment) ([]azure.PolicyDefinitionRef, error)
+	ListResourceGroups(context.Context, string) ([]azure.ResourceGroup, error)
+}
+
+// Selection describes an exemption by name, as given on the command line.
+type Selection struct {
+	// Subscription is a subscription ID or name.
+	Subscription string
+	// Assignment is a policy assignment ID, name or display name.
+	Assignment string
+	// Definitions are policy definition reference IDs. Empty exempts the entire assignment.
+	Definitions []string
+	// ResourceGroup is a resource group name. Empty exempts the entire subscription.
+	ResourceGroup string
+	// Locations and ResourceTypes optionally limit the exemption to matching
+	// resources within the scope.
+	Locations     []string
+	ResourceTypes []string
+
+	Ticket         string
+	Users          string
+	ExpirationDate string
+}
+
+// Resolve looks up the Azure objects named by sel and returns the exemption
+// to create together with the selected initiative members. Definitions listed
+// in blocked (lowercased policy definition IDs) cannot be exempted.
+func Resolve(ctx context.Context, client Resolver, sel Selection, blocked map[string]bool) (azure.ExemptionSpec, []azure.PolicyDefinitionRef, error) {
+	var spec azure.ExemptionSpec
+	switch {
+	case sel.Subscription == "":
+		return spec, nil, errors.New("a subscription is required")
+	case sel.Assignment == "":
+		return spec, nil, errors.New("a policy assignment is required")
+	case strings.TrimSpace(sel.Ticket) == "":
+		return spec, nil, errors.New("a ticket number is required")
+	case strings.TrimSpace(sel.Users) == "":
+		return spec, nil, errors.New("at least one requester name is required")
+	}
+	if sel.ExpirationDate != "" {
+		if _, err := time.Parse("2006-01-02", sel.ExpirationDate); err != nil {
+			return spec, nil, fmt.Errorf("invalid expiration date %q, use YYYY-MM-DD", sel.ExpirationDate)
+		}
+	}
+
+	subs, err := client.ListSubscriptions(ctx)
+	if err != nil {
+		return spec, nil, err
+	}
+	sub, ok := findSubscription(subs, sel.Subscription)
+	if !ok {
+		return spec, nil, fmt.Errorf("subscription %q not found", sel.Subscription)
+	}
+
+	assignments, err := client.ListAssignments(ctx, sub.ShortID())
+	if err != nil {
+		return spec, nil, err
+	}
+	assign, ok := findAssignment(assignments, sel.Assignment)
+	if !ok {
+		return spec, nil, fmt.Errorf("policy assignment %q not found in subscription %s", sel.Assignment, sub.Name)
+	}
+	if blocked[strings.ToLower(assign.PolicyDefinitionID)] {
+		return spec, nil, fmt.Errorf("policy assignment %q is blocked and cannot be exempted", assign.DisplayLabel())
+	}
+
+	var selected []azure.PolicyDefinitionRef
+	if len(sel.Definitions) > 0 {
+		refs, err := client.ListAssignmentDefinitions(ctx, assign)
+		if err != nil {
+			return spec, nil, err
+		}
+		for _, id := range sel.Definitions {
+			ref, ok := findDefinition(refs, id)
+			if !ok {
+				return spec, nil, fmt.Errorf("policy definition reference %q not found in assignment %s", id, assign.DisplayLabel())
+			}
+			if blocked[strings.ToLower(ref.PolicyDefinitionID)] {
+				return spec, nil, fmt.Errorf("policy definition %q is blocked and cannot be exempted", ref.DisplayName)
+			}
+			selected = append(selected, ref)
+			spec.ReferenceIDs = append(spec.ReferenceIDs, ref.ReferenceID)
+		}
+	}
+
+	spec.Scope = sub.Scope()
+	spec.ScopeName = "Entire Subscription"
+	if sel.ResourceGroup != "" {
+		rgs, err := client.ListResourceGroups(ctx, sub.ShortID())
+		if err != nil {
+			return spec, nil, err
+		}
+		rg, ok := findResourceGroup(rgs, sel.ResourceGroup)
+		if !ok {
+			return spec, nil, fmt.Errorf("resource group %q not found in subscription %s", sel.ResourceGroup, sub.Name)
+		}
+		spec.Scope = rg.ID
+		spec.ScopeName = rg.Name
+	}
+	// An exemption must lie within the scope of its assignment. An
+	// assignment on a resource group or resource defaults to its own scope.
+	if level, name := assign.Origin(); level == azure.ScopeResourceGroup || level == azure.ScopeResource {
+		switch {
+		case sel.ResourceGroup == "":
+			spec.Scope = assign.Scope
+			spec.ScopeName = name
+		case !azure.ScopeContains(assign.Scope, spec.Scope):
+			return spec, nil, fmt.Errorf("resource group %q is outside the scope of policy assignment %s (%s)", sel.ResourceGroup, assign.DisplayLabel(), assign.Scope)
+		}
+	}
+
+	spec.SubscriptionName = sub.Name
+	spec.Assignment = assign
+	spec.Ticket = strings.TrimSpace(sel.Ticket)
+	spec.Users = strings.TrimSpace(sel.Users)
+	spec.ExpirationDate = sel.ExpirationDate
+	spec.Selectors = azure.ResourceSelectors{Locations: sel.Locations, ResourceTypes: sel.ResourceTypes}
+	return spec, selected, nil
+}
+
+func findSubscription(subs []azure.Subscription, query string) (azure.Subscription, bool) {
+	for _, sub := range subs {
+		if sub.Matches(query) {
+			return sub, true
+		}
+	}
+	return azure.Subscription{}, false
+}
+
+func findAssignment(assignments []azure.PolicyAssignment, query string) (azure.PolicyAssignment, bool) {
+	for _, assign := range assignments {
+		if assign.Matches(query) {
+			return assign, true
+		}
+	}
+	return azure.PolicyAssignment{}, false
+}
+
+func findDefinition(refs []azure.PolicyDefinitionRef, query string) (azure.PolicyDefinitionRef, bool) {
+	for _, ref := range refs {
+		if strings.EqualFold(ref.ReferenceID, query) {
+			return ref, true
+		}
+	}
+	return azure.PolicyDefinitionRef{}, false
+}
+
+func findResourceGroup(rgs []azure.ResourceGroup, query string) (azure.ResourceGroup, bool) {
+	for _, rg := range rgs {
+		if strings.EqualFold(rg.Name, query) || strings.EqualFold(rg.ID, query) {
+			return rg, true
+		}
+	}
+	return azure.ResourceGroup{}, false
+}
@@ -0,0 +1,105 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+type fakeResolver struct {
+	err error
+}
+
+func (f fakeResolver) ListSubscriptions(context.Context) ([]azure.Subscription, error) {
+	return []azure.Subscription{{ID: "/subscriptions/sub-1", Name: "Production"}}, f.err
+}
+
+func (f fakeResolver) ListAssignments(context.Context, string) ([]azure.PolicyAssignment, error) {
+	return []azure.PolicyAssignment{
+		{ID: "/subscriptions/sub-1/providers/Microsoft.Authorization/policyAssignments/baseline", Name: "baseline", DisplayName: "Security baseline", PolicyDefinitionID: "/policySetDefinitions/set"},
+		{ID: "/subscriptions/sub-1/providers/Microsoft.Authorization/policyAssignments/locked", Name: "locked", PolicyDefinitionID: "/policyDefinitions/locked"},
+		{ID: "/subscriptions/sub-1/resourceGroups/data/providers/Microsoft.Authorization/policyAssignments/audit", Name: "audit", Scope: "/subscriptions/sub-1/resourceGroups/data", PolicyDefinitionID: "/policyDefinitions/audit"},
+	}, nil
+}
+
+func (f fakeResolver) ListAssignmentDefinitions(context.Context, azure.PolicyAssignment) ([]azure.PolicyDefinitionRef, error) {
+	return []azure.PolicyDefinitionRef{
+		{PolicyDefinitionID: "/policyDefinitions/tls", ReferenceID: "tls", DisplayName: "Require TLS"},
+		{PolicyDefinitionID: "/policyDefinitions/locked", ReferenceID: "locked", DisplayName: "Locked"},
+	}, nil
+}
+
+func (f fakeResolver) ListResourceGroups(context.Context, string) ([]azure.ResourceGroup, error) {
+	return []azure.ResourceGroup{{ID: "/subscriptions/sub-1/resourceGroups/app", Name: "app"}, {ID: "/subscriptions/sub-1/resourceGroups/data", Name: "data"}}, nil
+}
+
+func TestResolve(t *testing.T) {
+	sel := Selection{Subscription: "production", Assignment: "Security Baseline", Definitions: []string{"TLS"}, ResourceGroup: "app", Locations: []string{"westeurope"}, Ticket: " INC1 ", Users: "Ada", ExpirationDate: "2030-01-01"}
+	spec, refs, err := Resolve(context.Background(), fakeResolver{}, sel, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := azure.ExemptionSpec{
+		Scope:            "/subscriptions/sub-1/resourceGroups/app",
+		ScopeName:        "app",
+		SubscriptionName: "Production",
+		Assignment:       azure.PolicyAssignment{ID: "/subscriptions/sub-1/providers/Microsoft.Authorization/policyAssignments/baseline", Name: "baseline", DisplayName: "Security baseline", PolicyDefinitionID: "/policySetDefinitions/set"},
+		ReferenceIDs:     []string{"tls"},
+		Ticket:           "INC1",
+		Users:            "Ada",
+		ExpirationDate:   "2030-01-01",
+		Selectors:        azure.ResourceSelectors{Locations: []string{"westeurope"}},
+	}
+	if !reflect.DeepEqual(spec, want) || len(refs) != 1 || refs[0].DisplayName != "Require TLS" {
+		t.Fatalf("Resolve() = %#v, %#v", spec, refs)
+	}
+
+	spec, _, err = Resolve(context.Background(), fakeResolver{}, Selection{Subscription: "sub-1", Assignment: "baseline", Ticket: "T", Users: "U"}, nil)
+	if err != nil || spec.Scope != "/subscriptions/sub-1" || spec.ScopeName != "Entire Subscription" || spec.ReferenceIDs != nil {
+		t.Fatalf("subscription scope = %#v, %v", spec, err)
+	}
+
+	// An assignment on a resource group defaults to its own scope.
+	spec, _, err = Resolve(context.Background(), fakeResolver{}, Selection{Subscription: "sub-1", Assignment: "audit", Ticket: "T", Users: "U"}, nil)
+	if err != nil || spec.Scope != "/subscriptions/sub-1/resourceGroups/data" || spec.ScopeName != "data" {
+		t.Fatalf("assignment scope = %#v, %v", spec, err)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	base := Selection{Subscription: "sub-1", Assignment: "baseline", Ticket: "T", Users: "U"}
+	blocked := map[string]bool{"/policydefinitions/locked": true}
+	tests := []struct {
+		name   string
+		modify func(*Selection)
+		client fakeResolver
+		err    string
+	}{
+		{"missing subscription", func(s *Selection) { s.Subscription = "" }, fakeResolver{}, "subscription is required"},
+		{"missing assignment", func(s *Selection) { s.Assignment = "" }, fakeResolver{}, "assignment is required"},
+		{"missing ticket", func(s *Selection) { s.Ticket = "" }, fakeResolver{}, "ticket"},
+		{"missing users", func(s *Selection) { s.Users = " " }, fakeResolver{}, "requester"},
+		{"bad expiry", func(s *Selection) { s.ExpirationDate = "2030/01/01" }, fakeResolver{}, "YYYY-MM-DD"},
+		{"client error", func(*Selection) {}, fakeResolver{err: errors.New("az failed")}, "az failed"},
+		{"unknown subscription", func(s *Selection) { s.Subscription = "other" }, fakeResolver{}, `subscription "other" not found`},
+		{"unknown assignment", func(s *Selection) { s.Assignment = "other" }, fakeResolver{}, `assignment "other" not found`},
+		{"blocked assignment", func(s *Selection) { s.Assignment = "locked" }, fakeResolver{}, "blocked"},
+		{"unknown definition", func(s *Selection) { s.Definitions = []string{"other"} }, fakeResolver{}, `reference "other" not found`},
+		{"blocked definition", func(s *Selection) { s.Definitions = []string{"locked"} }, fakeResolver{}, "blocked"},
+		{"unknown resource group", func(s *Selection) { s.ResourceGroup = "other" }, fakeResolver{}, `resource group "other" not found`},
+		{"outside assignment scope", func(s *Selection) { s.Assignment, s.ResourceGroup = "audit", "app" }, fakeResolver{}, "outside the scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel := base
+			tt.modify(&sel)
+			if _, _, err := Resolve(context.Background(), tt.client, sel, blocked); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Resolve() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
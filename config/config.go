@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,6 +15,51 @@ type Config struct {
 	// BlockedPolicyDefinitionIDs is a list of policy definition IDs that cannot be exempted.
 	// These definitions will appear greyed out and be non-selectable in the UI.
 	BlockedPolicyDefinitionIDs []string `yaml:"blocked_policy_definition_ids"`
+
+	// KeyBindings replaces the keys of wizard actions, keyed by action name
+	// (e.g. "select_all"). Actions that are not listed keep their defaults.
+	KeyBindings map[string][]string `yaml:"key_bindings"`
+
+	// Retry controls retries and timeouts of Azure CLI calls.
+	Retry RetryConfig `yaml:"retry"`
+
+	// Auth selects how the Azure CLI is signed in.
+	Auth AuthConfig `yaml:"auth"`
+
+	// Cloud is the Azure cloud to use, e.g. AzureUSGovernment or
+	// AzureChinaCloud. Empty keeps the active cloud of the Azure CLI. The
+	// --cloud flag overrides it.
+	Cloud string `yaml:"cloud"`
+
+	// Path is the file the configuration was loaded from; empty when no
+	// config file was found.
+	Path string `yaml:"-"`
+}
+
+// AuthConfig holds the sign-in settings. Empty credentials are read from
+// the AZURE_TENANT_ID, AZURE_CLIENT_ID, AZURE_CLIENT_SECRET and
+// AZURE_CLIENT_CERTIFICATE_PATH environment variables.
+type AuthConfig struct {
+	// Mode is interactive (default), device_code, service_principal or
+	// managed_identity. The --auth flag overrides it.
+	Mode            string `yaml:"mode"`
+	TenantID        string `yaml:"tenant_id"`
+	ClientID        string `yaml:"client_id"`
+	ClientSecret    string `yaml:"client_secret"`
+	CertificatePath string `yaml:"certificate_path"`
+}
+
+// RetryConfig holds the retry settings of Azure CLI calls. Unset fields
+// keep the defaults of the azure package.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts per call including the first.
+	MaxAttempts int `yaml:"max_attempts"`
+	// BaseDelay is the wait before the first retry; it doubles for every
+	// further retry up to MaxDelay.
+	BaseDelay time.Duration `yaml:"base_delay"`
+	MaxDelay  time.Duration `yaml:"max_delay"`
+	// CallTimeout limits a single Azure CLI call.
+	CallTimeout time.Duration `yaml:"call_timeout"`
 }
 
 // DefaultConfigPaths returns the list of paths to search for the config file.
@@ -89,6 +135,7 @@ func LoadFromFile(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	cfg.Path = path
 
 	return &cfg, nil
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestLoadFromFile(t *testing.T) {
@@ -20,6 +21,46 @@ func TestLoadFromFile(t *testing.T) {
 		}
 	})
 
+	t.Run("key bindings", func(t *testing.T) {
+		cfg, err := LoadFromFile(writeConfig(t, "key_bindings:\n  quit: [ctrl+q]\n  select_all: [a, ctrl+a]\n"))
+		if err != nil {
+			t.Fatalf("LoadFromFile() error = %v", err)
+		}
+		want := map[string][]string{"quit": {"ctrl+q"}, "select_all": {"a", "ctrl+a"}}
+		if !reflect.DeepEqual(cfg.KeyBindings, want) {
+			t.Fatalf("key bindings = %#v, want %#v", cfg.KeyBindings, want)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		cfg, err := LoadFromFile(writeConfig(t, "retry:\n  max_attempts: 6\n  base_delay: 500ms\n  max_delay: 1m\n  call_timeout: 90s\n"))
+		if err != nil {
+			t.Fatalf("LoadFromFile() error = %v", err)
+		}
+		want := RetryConfig{MaxAttempts: 6, BaseDelay: 500 * time.Millisecond, MaxDelay: time.Minute, CallTimeout: 90 * time.Second}
+		if cfg.Retry != want {
+			t.Fatalf("retry = %#v, want %#v", cfg.Retry, want)
+		}
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		cfg, err := LoadFromFile(writeConfig(t, "auth:\n  mode: service_principal\n  tenant_id: tenant\n  client_id: app\n  certificate_path: /certs/app.pem\n"))
+		if err != nil {
+			t.Fatalf("LoadFromFile() error = %v", err)
+		}
+		want := AuthConfig{Mode: "service_principal", TenantID: "tenant", ClientID: "app", CertificatePath: "/certs/app.pem"}
+		if cfg.Auth != want {
+			t.Fatalf("auth = %#v, want %#v", cfg.Auth, want)
+		}
+	})
+
+	t.Run("cloud", func(t *testing.T) {
+		cfg, err := LoadFromFile(writeConfig(t, "cloud: AzureUSGovernment\n"))
+		if err != nil || cfg.Cloud != "AzureUSGovernment" {
+			t.Fatalf("LoadFromFile() = %#v, %v", cfg, err)
+		}
+	})
+
 	t.Run("empty", func(t *testing.T) {
 		cfg, err := LoadFromFile(writeConfig(t, ""))
 		if err != nil || len(cfg.BlockedPolicyDefinitionIDs) != 0 {
@@ -55,6 +96,9 @@ func TestLoadFromPaths(t *testing.T) {
 	if got := cfg.BlockedPolicyDefinitionIDs; !reflect.DeepEqual(got, []string{"second"}) {
 		t.Fatalf("blocked IDs = %#v", got)
 	}
+	if cfg.Path != second {
+		t.Fatalf("Path = %q, want %q", cfg.Path, second)
+	}
 
 	if err := os.WriteFile(first, []byte("blocked_policy_definition_ids: [first]\n"), 0o600); err != nil {
 		t.Fatal(err)
@@ -65,7 +109,7 @@ func TestLoadFromPaths(t *testing.T) {
 	}
 
 	empty, err := LoadFromPaths([]string{filepath.Join(dir, "missing-a"), filepath.Join(dir, "missing-b")})
-	if err != nil || empty == nil || len(empty.BlockedPolicyDefinitionIDs) != 0 {
+	if err != nil || empty == nil || len(empty.BlockedPolicyDefinitionIDs) != 0 || empty.Path != "" {
 		t.Fatalf("all missing = %#v, %v", empty, err)
 	}
 
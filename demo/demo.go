@@ -0,0 +1,407 @@
+// Package demo implements the Azure operations in memory from a fixture,
+// so that azexempt can be explored and issues reproduced without Azure
+// access. The built-in fixture describes a small fictitious tenant; custom
+// fixtures are JSON files of the same shape.
+package demo
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+//go:embed fixture.json
+var builtinFixture []byte
+
+// Fixture is the content of the demo tenant.
+type Fixture struct {
+	Cloud     azure.Cloud     `json:"cloud"`
+	Principal azure.Principal `json:"principal"`
+
+	// ManagementEntities is the management group hierarchy, including the
+	// subscriptions in it.
+	ManagementEntities []azure.ManagementEntity `json:"managementEntities"`
+	Subscriptions      []azure.Subscription     `json:"subscriptions"`
+	// ResourceGroups and Resources belong to the subscription of their ID.
+	ResourceGroups []azure.ResourceGroup `json:"resourceGroups"`
+	Resources      []Resource            `json:"resources"`
+
+	// Assignments apply to their scope, everything beneath it and, for a
+	// management group, its descendants.
+	Assignments       []azure.PolicyAssignment           `json:"assignments"`
+	AssignmentDetails map[string]azure.AssignmentDetails `json:"assignmentDetails,omitempty"`
+	// Initiatives maps policy set definition IDs to their members.
+	Initiatives map[string][]azure.PolicyDefinitionRef `json:"initiatives"`
+	// Definitions maps policy definition IDs to their details.
+	Definitions map[string]azure.DefinitionDetails `json:"definitions"`
+
+	NonCompliant []NonCompliance   `json:"nonCompliant,omitempty"`
+	Exemptions   []azure.Exemption `json:"exemptions,omitempty"`
+	// Denied lists the scopes, with everything beneath them, on which the
+	// principal may not create exemptions.
+	Denied []string `json:"denied,omitempty"`
+}
+
+// Resource is a resource of the demo tenant.
+type Resource struct {
+	ID       string `json:"id"`
+	Location string `json:"location"`
+	Type     string `json:"type"`
+}
+
+// NonCompliance marks a resource as non-compliant with an assignment, or
+// with one member of an initiative assignment.
+type NonCompliance struct {
+	ResourceID   string `json:"resourceId"`
+	AssignmentID string `json:"assignmentId"`
+	ReferenceID  string `json:"referenceId,omitempty"`
+}
+
+// Builtin returns the built-in fixture.
+func Builtin() *Fixture {
+	f, err := parse(builtinFixture)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in demo fixture: %v", err))
+	}
+	return f
+}
+
+// Load reads a fixture file.
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read fixture: %w", err)
+	}
+	f, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse fixture %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func parse(data []byte) (*Fixture, error) {
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Client serves the Azure operations from a fixture. Created exemptions are
+// kept in memory.
+type Client struct {
+	mu      sync.Mutex
+	fixture *Fixture
+}
+
+var _ azure.API = (*Client)(nil)
+
+// NewClient returns a client for the fixture.
+func NewClient(f *Fixture) *Client {
+	return &Client{fixture: f}
+}
+
+func (c *Client) EnsureLogin(context.Context) error {
+	return nil
+}
+
+func (c *Client) ActiveCloud(context.Context) (azure.Cloud, error) {
+	return c.fixture.Cloud, nil
+}
+
+func (c *Client) CurrentPrincipal(context.Context) (azure.Principal, error) {
+	return c.fixture.Principal, nil
+}
+
+func (c *Client) ListSubscriptions(context.Context) ([]azure.Subscription, error) {
+	subs := append([]azure.Subscription(nil), c.fixture.Subscriptions...)
+	sort.Slice(subs, func(i, j int) bool {
+		return strings.ToLower(subs[i].Name) < strings.ToLower(subs[j].Name)
+	})
+	return subs, nil
+}
+
+func (c *Client) ListResourceGroups(_ context.Context, subscriptionID string) ([]azure.ResourceGroup, error) {
+	sub := azure.Subscription{ID: subscriptionID}
+	var rgs []azure.ResourceGroup
+	for _, rg := range c.fixture.ResourceGroups {
+		if azure.ScopeContains(sub.Scope(), rg.ID) {
+			rgs = append(rgs, rg)
+		}
+	}
+	sort.Slice(rgs, func(i, j int) bool {
+		return strings.ToLower(rgs[i].Name) < strings.ToLower(rgs[j].Name)
+	})
+	return rgs, nil
+}
+
+func (c *Client) ListResourceFacets(_ context.Context, scope string) (azure.ResourceFacets, error) {
+	locations := make(map[string]bool)
+	types := make(map[string]bool)
+	var facets azure.ResourceFacets
+	for _, res := range c.fixture.Resources {
+		if !azure.ScopeContains(scope, res.ID) {
+			continue
+		}
+		if loc := strings.ToLower(res.Location); loc != "" && !locations[loc] {
+			locations[loc] = true
+			facets.Locations = append(facets.Locations, loc)
+		}
+		if typ := res.Type; typ != "" && !types[strings.ToLower(typ)] {
+			types[strings.ToLower(typ)] = true
+			facets.ResourceTypes = append(facets.ResourceTypes, typ)
+		}
+	}
+	sort.Strings(facets.Locations)
+	sort.Slice(facets.ResourceTypes, func(i, j int) bool {
+		return strings.ToLower(facets.ResourceTypes[i]) < strings.ToLower(facets.ResourceTypes[j])
+	})
+	return facets, nil
+}
+
+func (c *Client) ListManagementEntities(context.Context) ([]azure.ManagementEntity, error) {
+	return c.fixture.ManagementEntities, nil
+}
+
+func (c *Client) ListAssignments(_ context.Context, subscriptionID string) ([]azure.PolicyAssignment, error) {
+	return c.assignments(azure.Subscription{ID: subscriptionID}.Scope()), nil
+}
+
+// ListAssignmentPages returns the assignments of the subscription as a
+// single page.
+func (c *Client) ListAssignmentPages(_ context.Context, subscriptionID string, page func([]azure.PolicyAssignment)) error {
+	if assignments := c.assignments(azure.Subscription{ID: subscriptionID}.Scope()); len(assignments) > 0 {
+		page(assignments)
+	}
+	return nil
+}
+
+func (c *Client) ListManagementGroupAssignments(_ context.Context, groupName string) ([]azure.PolicyAssignment, error) {
+	return c.assignments(groupScope(groupName)), nil
+}
+
+// assignments returns the assignments that apply to scope, as Azure lists
+// them: those on the scope and its ancestors and, below a management
+// group, those beneath the scope.
+func (c *Client) assignments(scope string) []azure.PolicyAssignment {
+	level, _ := azure.ParseScope(scope)
+	var assignments []azure.PolicyAssignment
+	for _, assign := range c.fixture.Assignments {
+		if c.contains(assign.Scope, scope) || (level != azure.ScopeManagementGroup && azure.ScopeContains(scope, assign.Scope)) {
+			assignments = append(assignments, assign)
+		}
+	}
+	azure.SortAssignments(assignments)
+	return assignments
+}
+
+func (c *Client) ListAssignmentDefinitions(_ context.Context, assignment azure.PolicyAssignment) ([]azure.PolicyDefinitionRef, error) {
+	if !strings.Contains(strings.ToLower(assignment.PolicyDefinitionID), "policysetdefinitions") {
+		return nil, nil
+	}
+	for id, members := range c.fixture.Initiatives {
+		if strings.EqualFold(id, assignment.PolicyDefinitionID) {
+			refs := append([]azure.PolicyDefinitionRef(nil), members...)
+			sort.Slice(refs, func(i, j int) bool {
+				return strings.ToLower(refs[i].DisplayName) < strings.ToLower(refs[j].DisplayName)
+			})
+			return refs, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to load policy set definition (ID: '%s'): not in the demo fixture", assignment.PolicyDefinitionID)
+}
+
+func (c *Client) GetAssignmentDetails(_ context.Context, assignment azure.PolicyAssignment) (azure.AssignmentDetails, error) {
+	details := azure.AssignmentDetails{EnforcementMode: "Default", Scope: assignment.Scope, Parameters: assignment.Parameters}
+	for id, d := range c.fixture.AssignmentDetails {
+		if strings.EqualFold(id, assignment.ID) {
+			details = d
+		}
+	}
+	// The fixture holds effects already resolved.
+	for id, def := range c.fixture.Definitions {
+		if strings.EqualFold(id, assignment.PolicyDefinitionID) {
+			details.Effect = def.Effect
+		}
+	}
+	return details, nil
+}
+
+func (c *Client) GetDefinitionDetails(_ context.Context, definitionID string) (azure.DefinitionDetails, error) {
+	for id, details := range c.fixture.Definitions {
+		if strings.EqualFold(id, definitionID) {
+			return details, nil
+		}
+	}
+	return azure.DefinitionDetails{}, fmt.Errorf("failed to load policy definition %s: not in the demo fixture", definitionID)
+}
+
+func (c *Client) SummarizeCompliance(_ context.Context, subscriptionID string) (azure.ComplianceSummary, error) {
+	return c.summarize(azure.Subscription{ID: subscriptionID}.Scope()), nil
+}
+
+func (c *Client) SummarizeManagementGroupCompliance(_ context.Context, groupName string) (azure.ComplianceSummary, error) {
+	return c.summarize(groupScope(groupName)), nil
+}
+
+// summarize counts the distinct non-compliant resources beneath scope per
+// assignment and initiative member.
+func (c *Client) summarize(scope string) azure.ComplianceSummary {
+	summary := azure.ComplianceSummary{
+		Assignments: make(map[string]int),
+		Definitions: make(map[string]map[string]int),
+	}
+	resources := make(map[string]map[string]bool)
+	for _, state := range c.fixture.NonCompliant {
+		if !c.contains(scope, state.ResourceID) {
+			continue
+		}
+		id := strings.ToLower(state.AssignmentID)
+		if resources[id] == nil {
+			resources[id] = make(map[string]bool)
+		}
+		resources[id][strings.ToLower(state.ResourceID)] = true
+		if state.ReferenceID != "" {
+			if summary.Definitions[id] == nil {
+				summary.Definitions[id] = make(map[string]int)
+			}
+			summary.Definitions[id][strings.ToLower(state.ReferenceID)]++
+		}
+	}
+	for _, assign := range c.assignments(scope) {
+		id := strings.ToLower(assign.ID)
+		summary.Assignments[id] = len(resources[id])
+	}
+	return summary
+}
+
+func (c *Client) CountNonCompliant(_ context.Context, scope string, assignmentID string, referenceIDs []string) (int, error) {
+	resources := make(map[string]bool)
+	for _, state := range c.fixture.NonCompliant {
+		if !strings.EqualFold(state.AssignmentID, assignmentID) || !c.contains(scope, state.ResourceID) {
+			continue
+		}
+		if len(referenceIDs) > 0 && !containsFold(referenceIDs, state.ReferenceID) {
+			continue
+		}
+		resources[strings.ToLower(state.ResourceID)] = true
+	}
+	return len(resources), nil
+}
+
+func (c *Client) CheckPermissions(_ context.Context, scopes []string, _ string) (map[string]bool, error) {
+	allowed := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		allowed[scope] = true
+		for _, denied := range c.fixture.Denied {
+			if c.contains(denied, scope) {
+				allowed[scope] = false
+			}
+		}
+	}
+	return allowed, nil
+}
+
+func (c *Client) ListExemptions(_ context.Context, subscriptionID string) ([]azure.Exemption, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	scope := azure.Subscription{ID: subscriptionID}.Scope()
+	var exemptions []azure.Exemption
+	for _, e := range c.fixture.Exemptions {
+		if azure.ScopeContains(scope, e.Scope) {
+			exemptions = append(exemptions, e)
+		}
+	}
+	sort.Slice(exemptions, func(i, j int) bool {
+		return strings.ToLower(exemptions[i].ID) < strings.ToLower(exemptions[j].ID)
+	})
+	return exemptions, nil
+}
+
+// CreateExemption adds the exemption to the fixture, replacing one of the
+// same ID as Azure does.
+func (c *Client) CreateExemption(_ context.Context, spec azure.ExemptionSpec) (azure.Exemption, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := spec.Exemption(time.Now())
+	e.ID = e.Scope + "/providers/Microsoft.Authorization/policyExemptions/" + e.Name
+	for i, existing := range c.fixture.Exemptions {
+		if strings.EqualFold(existing.ID, e.ID) {
+			c.fixture.Exemptions[i] = e
+			return e, nil
+		}
+	}
+	c.fixture.Exemptions = append(c.fixture.Exemptions, e)
+	return e, nil
+}
+
+// contains reports whether inner is scope itself or lies beneath it,
+// following the management group hierarchy of the fixture.
+func (c *Client) contains(scope, inner string) bool {
+	if azure.ScopeContains(scope, inner) {
+		return true
+	}
+	if level, _ := azure.ParseScope(scope); level != azure.ScopeManagementGroup {
+		return false
+	}
+	for _, ancestor := range c.ancestors(inner) {
+		if strings.EqualFold(ancestor, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// ancestors returns the management groups above the subscription or
+// management group of scope, nearest first.
+func (c *Client) ancestors(scope string) []string {
+	id := scope
+	switch level, _ := azure.ParseScope(scope); level {
+	case azure.ScopeUnknown:
+		return nil
+	case azure.ScopeManagementGroup:
+	default:
+		id = azure.Subscription{ID: subscriptionOf(scope)}.Scope()
+	}
+	parents := make(map[string]string, len(c.fixture.ManagementEntities))
+	for _, e := range c.fixture.ManagementEntities {
+		parents[strings.ToLower(e.ID)] = e.ParentID
+	}
+	var ancestors []string
+	// The length bound stops at a cycle in a broken fixture.
+	for parent := parents[strings.ToLower(id)]; parent != "" && len(ancestors) < len(parents); parent = parents[strings.ToLower(parent)] {
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// subscriptionOf returns the subscription ID of a scope beneath a
+// subscription.
+func subscriptionOf(scope string) string {
+	parts := strings.Split(strings.Trim(scope, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func groupScope(groupName string) string {
+	return "/providers/Microsoft.Management/managementGroups/" + groupName
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package demo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+const (
+	production   = "5a1e0c3e-1b7f-4d2a-9c6e-000000000001"
+	development  = "5a1e0c3e-1b7f-4d2a-9c6e-000000000002"
+	connectivity = "5a1e0c3e-1b7f-4d2a-9c6e-000000000003"
+)
+
+func names(assignments []azure.PolicyAssignment) []string {
+	var list []string
+	for _, a := range assignments {
+		list = append(list, a.Name)
+	}
+	return list
+}
+
+func TestBuiltinFixture(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(Builtin())
+
+	subs, _ := c.ListSubscriptions(ctx)
+	if len(subs) != 3 || subs[0].Name != "Contoso Connectivity" {
+		t.Fatalf("subscriptions = %v", subs)
+	}
+	// Every assignment of an initiative lists its members, and every
+	// member has details.
+	for _, sub := range subs {
+		assignments, _ := c.ListAssignments(ctx, sub.ID)
+		for _, assign := range assignments {
+			refs, err := c.ListAssignmentDefinitions(ctx, assign)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, ref := range refs {
+				if _, err := c.GetDefinitionDetails(ctx, ref.PolicyDefinitionID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(refs) == 0 {
+				if _, err := c.GetDefinitionDetails(ctx, assign.PolicyDefinitionID); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	refs, _ := c.ListAssignmentDefinitions(ctx, azure.PolicyAssignment{PolicyDefinitionID: "/providers/Microsoft.Authorization/policySetDefinitions/0000d3e0-0000-4000-8000-0000000003e8"})
+	if len(refs) < 30 || len(refs[0].Groups) != 1 || refs[0].Effect == "" {
+		t.Fatalf("benchmark members = %d %+v", len(refs), refs)
+	}
+}
+
+func TestAssignmentsFollowTheHierarchy(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(Builtin())
+
+	prod, _ := c.ListAssignments(ctx, production)
+	if got := strings.Join(names(prod), ","); got != "allowed-locations,contoso-tagging,deny-public-ip,security-benchmark" {
+		t.Fatalf("production assignments = %s", got)
+	}
+	details, _ := c.GetAssignmentDetails(ctx, prod[2])
+	if details.Effect != "Deny" {
+		t.Fatalf("deny-public-ip effect = %q", details.Effect)
+	}
+	conn, _ := c.ListAssignments(ctx, connectivity)
+	if got := strings.Join(names(conn), ","); got != "security-benchmark" {
+		t.Fatalf("connectivity assignments = %s", got)
+	}
+	group, _ := c.ListManagementGroupAssignments(ctx, "landingzones")
+	if got := strings.Join(names(group), ","); got != "allowed-locations,security-benchmark" {
+		t.Fatalf("landing zone assignments = %s", got)
+	}
+
+	rgs, _ := c.ListResourceGroups(ctx, production)
+	if len(rgs) != 3 || rgs[0].Name != "app-data" {
+		t.Fatalf("resource groups = %v", rgs)
+	}
+	facets, _ := c.ListResourceFacets(ctx, "/subscriptions/"+production+"/resourceGroups/app-data")
+	if strings.Join(facets.Locations, ",") != "northeurope,westeurope" || len(facets.ResourceTypes) != 3 {
+		t.Fatalf("facets = %+v", facets)
+	}
+}
+
+func TestCompliance(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(Builtin())
+	benchmark := "/providers/Microsoft.Management/managementGroups/contoso/providers/Microsoft.Authorization/policyAssignments/security-benchmark"
+
+	summary, _ := c.SummarizeCompliance(ctx, production)
+	if n, ok := summary.AssignmentCount(benchmark); !ok || n != 4 {
+		t.Fatalf("benchmark non-compliant = %d, %v", n, ok)
+	}
+	if n, ok := summary.DefinitionCount(benchmark, "storageAccountsShouldRestrictNetworkAccess"); !ok || n != 1 {
+		t.Fatalf("member non-compliant = %d, %v", n, ok)
+	}
+	group, _ := c.SummarizeManagementGroupCompliance(ctx, "contoso")
+	if n, _ := group.AssignmentCount(benchmark); n != 8 {
+		t.Fatalf("tenant non-compliant = %d", n)
+	}
+	n, _ := c.CountNonCompliant(ctx, "/subscriptions/"+production+"/resourceGroups/app-data", benchmark, []string{"storageAccountsShouldRestrictNetworkAccess"})
+	if n != 1 {
+		t.Fatalf("scope non-compliant = %d", n)
+	}
+}
+
+func TestCreateExemption(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(Builtin())
+
+	scope := "/subscriptions/" + development + "/resourceGroups/dev-app"
+	allowed, _ := c.CheckPermissions(ctx, []string{scope, "/subscriptions/" + connectivity + "/resourceGroups/hub-network"}, azure.ExemptionWriteAction)
+	if !allowed[scope] || allowed["/subscriptions/"+connectivity+"/resourceGroups/hub-network"] {
+		t.Fatalf("permissions = %v", allowed)
+	}
+
+	before, _ := c.ListExemptions(ctx, development)
+	spec := azure.ExemptionSpec{Scope: scope, ScopeName: "dev-app", SubscriptionName: "Contoso Development", Assignment: azure.PolicyAssignment{ID: "/assignments/a", DisplayName: "Audit"}, Ticket: "INC1", Users: "Ada"}
+	created, err := c.CreateExemption(ctx, spec)
+	if err != nil || created.ID != scope+"/providers/Microsoft.Authorization/policyExemptions/Contoso-Development-dev-app---Audit" {
+		t.Fatalf("CreateExemption() = %+v, %v", created, err)
+	}
+	// Creating it again replaces it.
+	if _, err := c.CreateExemption(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := c.ListExemptions(ctx, development)
+	if len(after) != len(before)+1 {
+		t.Fatalf("exemptions = %d, want %d", len(after), len(before)+1)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fixture.json")
+	if err := os.WriteFile(path, []byte(`{"subscriptions":[{"name":"Repro","id":"s"}],"resourceGroups":[{"name":"rg","id":"/subscriptions/s/resourceGroups/rg"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgs, _ := NewClient(f).ListResourceGroups(context.Background(), "s")
+	if len(f.Subscriptions) != 1 || len(rgs) != 1 {
+		t.Fatalf("fixture = %+v", f)
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("missing fixture was loaded")
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "unable to parse fixture") {
+		t.Fatalf("Load(invalid) = %v", err)
+	}
+}
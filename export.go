@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/iac"
+)
+
+// runExportIaC implements 'azexempt export-iac'. The live exemptions of
+// each subscription are written as code to bring them under
+// infrastructure as code.
+func runExportIaC(ctx context.Context, client azure.API, args []string) int {
+	fs := flag.NewFlagSet("export-iac", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: azexempt export-iac --format terraform|bicep [flags]")
+		fmt.Fprintln(fs.Output(), "\nWrites the existing policy exemptions of each subscription as code, with Terraform import blocks.")
+		fs.PrintDefaults()
+	}
+	formatName := fs.String("format", "terraform", "code format: terraform or bicep")
+	subscriptions := fs.String("subscription", "", "comma-separated subscription IDs or names (default: all subscriptions)")
+	out := fs.String("out", ".", "directory to write the files to")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	format, err := iac.ParseFormat(*formatName)
+	if err == nil && format != iac.Terraform && format != iac.Bicep {
+		err = fmt.Errorf("exporting to %s is not supported, use terraform or bicep", format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	if err := client.EnsureLogin(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Azure login failed: %v\n", err)
+		return 1
+	}
+	subs, err := client.ListSubscriptions(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if queries := splitList(*subscriptions); len(queries) > 0 {
+		var selected []azure.Subscription
+		for _, query := range queries {
+			found := false
+			for _, sub := range subs {
+				if sub.Matches(query) {
+					selected = append(selected, sub)
+					found = true
+					break
+				}
+			}
+			if !found {
+				fmt.Fprintf(os.Stderr, "Subscription %q not found\n", query)
+				return 1
+			}
+		}
+		subs = selected
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to create %s: %v\n", *out, err)
+		return 1
+	}
+
+	// The files are named after the subscription, with its ID added when
+	// another subscription would get the same file name.
+	bases := make(map[string]int)
+	for _, sub := range subs {
+		bases[strings.ToLower(iac.FileName(sub.Name))]++
+	}
+	exporter := iac.NewExporter()
+	failed := false
+	for _, sub := range subs {
+		base := sub.Name
+		if bases[strings.ToLower(iac.FileName(sub.Name))] > 1 {
+			base += "-" + sub.ShortID()
+		}
+		exemptions, err := client.ListExemptions(ctx, sub.ShortID())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", sub.Name, err)
+			failed = true
+			continue
+		}
+		files, skipped, err := exporter.Export(format, base, exemptions)
+		if errors.Is(err, iac.ErrFileNameTaken) {
+			fmt.Fprintf(os.Stderr, "%s: %v; export it to another directory\n", sub.Name, err)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+		if len(exemptions) == 0 {
+			fmt.Printf("%s: no exemptions\n", sub.Name)
+		}
+		for _, file := range files {
+			path := filepath.Join(*out, file.Name)
+			if err := os.WriteFile(path, []byte(file.Content), 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to write %s: %v\n", path, err)
+				return 1
+			}
+			fmt.Printf("%s: %d exemptions written to %s\n", sub.Name, file.Exemptions, path)
+		}
+		for _, s := range skipped {
+			fmt.Fprintf(os.Stderr, "%s: skipped %s: %v\n", sub.Name, s.Exemption.ID, s.Err)
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
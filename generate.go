@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/bundle"
+	"github.com/Lukas-Klein/azexempt/config"
+	"github.com/Lukas-Klein/azexempt/iac"
+)
+
+// runGenerate implements 'azexempt generate'. The exemption is resolved
+// from the flags like 'azexempt request' does and written as Bicep, ARM
+// template or Terraform code instead of being created.
+func runGenerate(ctx context.Context, client azure.API, cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: azexempt generate --format bicep|arm|terraform --subscription <sub> --assignment <assignment> [flags]")
+		fmt.Fprintln(fs.Output(), "\nWrites the exemption as infrastructure code instead of creating it.")
+		fs.PrintDefaults()
+	}
+	formatName := fs.String("format", "bicep", "code format: bicep, arm or terraform")
+	out := fs.String("out", "-", "path of the file to write, - for standard output")
+	selection := selectionFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	sel := selection()
+	format, err := iac.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	if sel.Subscription == "" || sel.Assignment == "" {
+		fs.Usage()
+		return 2
+	}
+
+	if err := client.EnsureLogin(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Azure login failed: %v\n", err)
+		return 1
+	}
+	spec, _, err := bundle.Resolve(ctx, client, sel, cfg.BlockedDefinitionsMap())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid exemption: %v\n", err)
+		return 1
+	}
+	code, err := iac.Render(format, spec.Exemption(time.Now()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to generate %s: %v\n", format, err)
+		return 1
+	}
+	if *out == "-" {
+		fmt.Print(code)
+		return 0
+	}
+	if err := os.WriteFile(*out, []byte(code), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write %s: %v\n", *out, err)
+		return 1
+	}
+	fmt.Printf("%s code written to %s.\n", format, *out)
+	return 0
+}
@@ -0,0 +1,197 @@
+package iac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+// File is a generated code file.
+type File struct {
+	Name    string
+	Content string
+	// Exemptions is the number of exemptions in the file.
+	Exemptions int
+}
+
+// Skipped is an exemption that could not be exported, and why.
+type Skipped struct {
+	Exemption azure.Exemption
+	Err       error
+}
+
+// systemMetadata are the metadata keys Azure maintains on policy
+// resources. They are left out of exported code.
+var systemMetadata = []string{"createdBy", "createdOn", "updatedBy", "updatedOn"}
+
+// Exporter exports the exemptions of several subscriptions into one
+// directory. Terraform loads all files of a directory as one module, so
+// the Terraform resource labels are unique across the exports of an
+// Exporter. Use a new Exporter for each directory.
+type Exporter struct {
+	labels map[string]int
+	// files holds the lowercased names of the exported files.
+	files map[string]bool
+}
+
+// NewExporter returns an exporter that has not exported anything yet.
+func NewExporter() *Exporter {
+	return &Exporter{labels: make(map[string]int), files: make(map[string]bool)}
+}
+
+// Export renders the existing exemptions of a subscription so that they
+// can be brought under infrastructure as code. The files are named after
+// name, usually the subscription name.
+//
+// Terraform code is a single file with a resource and an import block,
+// keyed by the exemption ID, per exemption. Bicep has no import: deploying
+// a resource with the name of an existing exemption adopts it. There is a
+// Bicep file per deployment scope, "<name>.bicep" for the subscription and
+// "<name>-<resource group>.bicep" for each resource group.
+//
+// A file name an earlier export of x already used, for example for another
+// subscription with the same name, fails with ErrFileNameTaken, as the
+// file would be overwritten.
+func (x *Exporter) Export(f Format, name string, exemptions []azure.Exemption) ([]File, []Skipped, error) {
+	var files []File
+	var skipped []Skipped
+	switch f {
+	case Bicep:
+		files, skipped = exportBicep(FileName(name), exemptions)
+	case Terraform:
+		files, skipped = exportTerraform(FileName(name), exemptions, x.labels)
+	default:
+		return nil, nil, fmt.Errorf("exporting to %s is not supported, use bicep or terraform", f)
+	}
+	for _, file := range files {
+		if x.files[strings.ToLower(file.Name)] {
+			return nil, nil, fmt.Errorf("%w: %s", ErrFileNameTaken, file.Name)
+		}
+	}
+	for _, file := range files {
+		x.files[strings.ToLower(file.Name)] = true
+	}
+	return files, skipped, nil
+}
+
+// ErrFileNameTaken is returned by Exporter.Export for a file name that was
+// already exported.
+var ErrFileNameTaken = errors.New("file name already exported")
+
+// Export exports the exemptions of a single subscription, as
+// Exporter.Export does.
+func Export(f Format, name string, exemptions []azure.Exemption) ([]File, []Skipped, error) {
+	return NewExporter().Export(f, name, exemptions)
+}
+
+func exportBicep(name string, exemptions []azure.Exemption) ([]File, []Skipped) {
+	type scopeFile struct {
+		b       strings.Builder
+		symbols map[string]int
+		count   int
+	}
+	var files []File
+	var skipped []Skipped
+	byName := make(map[string]*scopeFile)
+	var names []string
+	for _, e := range exemptions {
+		target, err := bicepTarget(e)
+		if err != nil {
+			skipped = append(skipped, Skipped{Exemption: e, Err: err})
+			continue
+		}
+		file := name + ".bicep"
+		if level, group := azure.ParseScope(e.Scope); level == azure.ScopeResourceGroup {
+			file = name + "-" + FileName(group) + ".bicep"
+		}
+		sf, ok := byName[file]
+		if !ok {
+			sf = &scopeFile{symbols: make(map[string]int)}
+			fmt.Fprintf(&sf.b, "// Existing policy exemptions at %s\n", e.Scope)
+			fmt.Fprintf(&sf.b, "targetScope = '%s'\n", target)
+			byName[file] = sf
+			names = append(names, file)
+		}
+		var resource strings.Builder
+		if err := writeBicepResource(&resource, unique(sf.symbols, identifier(e.Name)), withoutSystemMetadata(e)); err != nil {
+			skipped = append(skipped, Skipped{Exemption: e, Err: err})
+			continue
+		}
+		sf.b.WriteString("\n" + resource.String())
+		sf.count++
+	}
+	for _, file := range names {
+		files = append(files, File{Name: file, Content: byName[file].b.String(), Exemptions: byName[file].count})
+	}
+	return files, skipped
+}
+
+// exportTerraform renders the exemptions with resource labels not yet in
+// labels, and adds them.
+func exportTerraform(name string, exemptions []azure.Exemption, labels map[string]int) ([]File, []Skipped) {
+	var b strings.Builder
+	var skipped []Skipped
+	count := 0
+	for _, e := range exemptions {
+		var resource strings.Builder
+		label := unique(labels, identifier(e.Name))
+		kind, err := writeTerraformResource(&resource, label, withoutSystemMetadata(e))
+		if err != nil {
+			skipped = append(skipped, Skipped{Exemption: e, Err: err})
+			continue
+		}
+		if count > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(resource.String())
+		fmt.Fprintf(&b, "\nimport {\n  to = %s.%s\n  id = %s\n}\n", kind, label, hclString(e.ID))
+		count++
+	}
+	if count == 0 {
+		return nil, skipped
+	}
+	return []File{{Name: name + ".tf", Content: b.String(), Exemptions: count}}, skipped
+}
+
+// withoutSystemMetadata returns the exemption without the metadata Azure
+// maintains.
+func withoutSystemMetadata(e azure.Exemption) azure.Exemption {
+	metadata := make(map[string]any)
+	for k, v := range e.Metadata {
+		metadata[k] = v
+	}
+	for _, k := range systemMetadata {
+		delete(metadata, k)
+	}
+	e.Metadata = nil
+	if len(metadata) > 0 {
+		e.Metadata = metadata
+	}
+	return e
+}
+
+// unique returns name, or name with a number appended if it was returned
+// before for the same seen map.
+func unique(seen map[string]int, name string) string {
+	seen[name]++
+	if n := seen[name]; n > 1 {
+		return fmt.Sprintf("%s_%d", name, n)
+	}
+	return name
+}
+
+// FileName returns name with the characters that are not safe in file
+// names replaced by hyphens, as Export names its files.
+func FileName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
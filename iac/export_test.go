@@ -0,0 +1,111 @@
+package iac
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+func liveExemptions() []azure.Exemption {
+	sub := testExemption("/subscriptions/s")
+	sub.ID = "/subscriptions/s/providers/Microsoft.Authorization/policyExemptions/" + sub.Name
+	sub.Metadata = map[string]any{"requestedBy": "r", "createdBy": "x", "createdOn": "2030-01-01"}
+	rg := testExemption("/subscriptions/s/resourceGroups/app")
+	rg.ID = "/subscriptions/s/resourceGroups/app/providers/Microsoft.Authorization/policyExemptions/" + rg.Name
+	rg.Metadata = nil
+	resource := testExemption("/subscriptions/s/resourceGroups/app/providers/Microsoft.Storage/storageAccounts/logs")
+	resource.ID = resource.Scope + "/providers/Microsoft.Authorization/policyExemptions/" + resource.Name
+	resource.Metadata = nil
+	selectors := testExemption("/subscriptions/s/resourceGroups/app")
+	selectors.Name, selectors.DisplayName = "regional", ""
+	selectors.ID = "/subscriptions/s/resourceGroups/app/providers/Microsoft.Authorization/policyExemptions/regional"
+	selectors.ResourceSelectors = azure.ResourceSelectors{Locations: []string{"westeurope"}}.ARM()
+	selectors.Metadata = nil
+	return []azure.Exemption{sub, rg, resource, selectors}
+}
+
+func TestExportTerraform(t *testing.T) {
+	files, skipped, err := Export(Terraform, "Production (EU)", liveExemptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "Production--EU-.tf" || files[0].Exemptions != 3 {
+		t.Fatalf("files = %+v", files)
+	}
+	if len(skipped) != 1 || skipped[0].Exemption.Name != "regional" {
+		t.Fatalf("skipped = %+v", skipped)
+	}
+	code := files[0].Content
+	for _, want := range []string{
+		`resource "azurerm_subscription_policy_exemption" "production___require_tls" {`,
+		`resource "azurerm_resource_group_policy_exemption" "production___require_tls_2" {`,
+		`resource "azurerm_resource_policy_exemption" "production___require_tls_3" {`,
+		"import {\n  to = azurerm_resource_group_policy_exemption.production___require_tls_2\n  id = \"/subscriptions/s/resourceGroups/app/providers/Microsoft.Authorization/policyExemptions/Production---Require-TLS\"\n}\n",
+		`jsonencode({ "requestedBy" = "r" })`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("code is missing %q:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "createdBy") {
+		t.Fatalf("system metadata exported:\n%s", code)
+	}
+}
+
+func TestExporterLabelsAcrossSubscriptions(t *testing.T) {
+	// The files of both subscriptions end up in one Terraform module.
+	exporter := NewExporter()
+	prod, _, err := exporter.Export(Terraform, "Production", liveExemptions()[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	staging, _, err := exporter.Export(Terraform, "Staging", liveExemptions()[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prod[0].Content, `"production___require_tls" {`) || !strings.Contains(staging[0].Content, `"production___require_tls_2" {`) {
+		t.Fatalf("labels are not unique across files:\n%s\n%s", prod[0].Content, staging[0].Content)
+	}
+}
+
+func TestExporterFileNameTaken(t *testing.T) {
+	exporter := NewExporter()
+	if _, _, err := exporter.Export(Terraform, "Production", liveExemptions()[:1]); err != nil {
+		t.Fatal(err)
+	}
+	// Production.tf and production.tf are the same file on many systems.
+	if _, _, err := exporter.Export(Terraform, "production", liveExemptions()[:1]); !errors.Is(err, ErrFileNameTaken) {
+		t.Fatalf("err = %v, want ErrFileNameTaken", err)
+	}
+	if _, _, err := exporter.Export(Terraform, "Production-11111111", liveExemptions()[:1]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportBicep(t *testing.T) {
+	files, skipped, err := Export(Bicep, "Production", liveExemptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "Production.bicep" || files[1].Name != "Production-app.bicep" || files[1].Exemptions != 2 {
+		t.Fatalf("files = %+v", files)
+	}
+	if len(skipped) != 1 || !strings.Contains(skipped[0].Exemption.Scope, "storageAccounts") {
+		t.Fatalf("skipped = %+v", skipped)
+	}
+	if code := files[0].Content; !strings.Contains(code, "targetScope = 'subscription'") || strings.Contains(code, "createdOn") {
+		t.Fatalf("subscription file:\n%s", code)
+	}
+	code := files[1].Content
+	for _, want := range []string{"targetScope = 'resourceGroup'", "// Policy exemption regional\nresource regional '", "resource production___require_tls '"} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("resource group file is missing %q:\n%s", want, code)
+		}
+	}
+
+	if _, _, err := Export(ARM, "Production", liveExemptions()); err == nil {
+		t.Fatal("ARM export accepted")
+	}
+}
@@ -0,0 +1,417 @@
+// Package iac renders policy exemptions as infrastructure as code: Bicep,
+// ARM templates and Terraform.
+package iac
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+// APIVersion is the Microsoft.Authorization/policyExemptions API version
+// of generated Bicep and ARM templates. It is the first to support
+// resource selectors.
+const APIVersion = "2022-07-01-preview"
+
+const resourceType = "Microsoft.Authorization/policyExemptions"
+
+// Format is an infrastructure as code language.
+type Format string
+
+const (
+	Bicep     Format = "bicep"
+	ARM       Format = "arm"
+	Terraform Format = "terraform"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{Bicep, ARM, Terraform}
+
+// ParseFormat returns the format with the given name, ignoring case.
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(name, string(f)) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, expected bicep, arm or terraform", name)
+}
+
+// String returns the name of the format for display.
+func (f Format) String() string {
+	switch f {
+	case Bicep:
+		return "Bicep"
+	case ARM:
+		return "ARM template"
+	case Terraform:
+		return "Terraform"
+	}
+	return string(f)
+}
+
+// Extension returns the file name extension of the format.
+func (f Format) Extension() string {
+	switch f {
+	case Bicep:
+		return ".bicep"
+	case ARM:
+		return ".json"
+	case Terraform:
+		return ".tf"
+	}
+	return ""
+}
+
+// Render returns the exemption in the given format. Bicep and ARM
+// templates are deployed at the scope of the exemption: the management
+// group, subscription or resource group, which also holds an exempted
+// resource.
+func Render(f Format, e azure.Exemption) (string, error) {
+	switch f {
+	case Bicep:
+		return renderBicep(e)
+	case ARM:
+		return renderARM(e)
+	case Terraform:
+		return renderTerraform(e)
+	}
+	return "", fmt.Errorf("unknown format %q", f)
+}
+
+// properties are the properties of the exemption resource in the order
+// they are rendered.
+type properties struct {
+	PolicyAssignmentID string                      `json:"policyAssignmentId"`
+	ExemptionCategory  string                      `json:"exemptionCategory"`
+	DisplayName        string                      `json:"displayName,omitempty"`
+	Description        string                      `json:"description,omitempty"`
+	ExpiresOn          string                      `json:"expiresOn,omitempty"`
+	ReferenceIDs       []string                    `json:"policyDefinitionReferenceIds,omitempty"`
+	ResourceSelectors  []azure.ARMResourceSelector `json:"resourceSelectors,omitempty"`
+	Metadata           map[string]any              `json:"metadata,omitempty"`
+}
+
+func exemptionProperties(e azure.Exemption) properties {
+	return properties{
+		PolicyAssignmentID: e.PolicyAssignmentID,
+		ExemptionCategory:  e.Category,
+		DisplayName:        e.DisplayName,
+		Description:        e.Description,
+		ExpiresOn:          e.ExpiresOn,
+		ReferenceIDs:       e.ReferenceIDs,
+		ResourceSelectors:  e.ResourceSelectors,
+		Metadata:           e.Metadata,
+	}
+}
+
+// deploymentScope returns the target scope of a Bicep file deploying the
+// exemption, and for an exempted resource its type and name relative to
+// the resource group, e.g. "Microsoft.Storage/storageAccounts/logs".
+func deploymentScope(scope string) (target, resource string, err error) {
+	level, _ := azure.ParseScope(scope)
+	switch level {
+	case azure.ScopeManagementGroup:
+		return "managementGroup", "", nil
+	case azure.ScopeSubscription:
+		return "subscription", "", nil
+	case azure.ScopeResourceGroup:
+		return "resourceGroup", "", nil
+	case azure.ScopeResource:
+		parts := strings.Split(strings.Trim(scope, "/"), "/")
+		return "resourceGroup", strings.Join(parts[5:], "/"), nil
+	}
+	return "", "", fmt.Errorf("unsupported exemption scope %q", scope)
+}
+
+func renderBicep(e azure.Exemption) (string, error) {
+	target, err := bicepTarget(e)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Deploy at %s\n", e.Scope)
+	fmt.Fprintf(&b, "targetScope = '%s'\n\n", target)
+	if err := writeBicepResource(&b, "exemption", e); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// bicepTarget returns the target scope of a Bicep file deploying the
+// exemption.
+func bicepTarget(e azure.Exemption) (string, error) {
+	target, resource, err := deploymentScope(e.Scope)
+	if err != nil {
+		return "", err
+	}
+	if resource != "" {
+		// Bicep can only reference the resource as an existing resource,
+		// which needs the API version of its type.
+		return "", fmt.Errorf("bicep cannot target the resource %s; use the ARM or Terraform format", resource)
+	}
+	return target, nil
+}
+
+// writeBicepResource writes the exemption as a resource with the given
+// symbolic name.
+func writeBicepResource(b *strings.Builder, symbol string, e azure.Exemption) error {
+	data, err := json.Marshal(exemptionProperties(e))
+	if err != nil {
+		return fmt.Errorf("unable to encode exemption: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var props strings.Builder
+	if err := writeBicepValue(&props, dec, "  "); err != nil {
+		return fmt.Errorf("unable to encode exemption: %w", err)
+	}
+	fmt.Fprintf(b, "// Policy exemption %s\n", e.Label())
+	fmt.Fprintf(b, "resource %s '%s@%s' = {\n", symbol, resourceType, APIVersion)
+	fmt.Fprintf(b, "  name: %s\n", bicepString(e.Name))
+	fmt.Fprintf(b, "  properties: %s\n", props.String())
+	b.WriteString("}\n")
+	return nil
+}
+
+// writeBicepValue writes the next JSON value of dec as a Bicep value,
+// keeping the order of object properties. Nested lines are indented by
+// indent plus two spaces.
+func writeBicepValue(b *strings.Builder, dec *json.Decoder, indent string) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		closing := "]"
+		if token == '{' {
+			closing = "}"
+		}
+		b.WriteString(string(token))
+		if dec.More() {
+			b.WriteString("\n")
+		}
+		empty := true
+		for dec.More() {
+			empty = false
+			b.WriteString(indent + "  ")
+			if token == '{' {
+				name, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				b.WriteString(bicepKey(name.(string)) + ": ")
+			}
+			if err := writeBicepValue(b, dec, indent+"  "); err != nil {
+				return err
+			}
+			b.WriteString("\n")
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		if !empty {
+			b.WriteString(indent)
+		}
+		b.WriteString(closing)
+	case string:
+		b.WriteString(bicepString(token))
+	case nil:
+		b.WriteString("null")
+	default:
+		fmt.Fprint(b, token)
+	}
+	return nil
+}
+
+var bicepIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func bicepKey(name string) string {
+	if bicepIdentifier.MatchString(name) {
+		return name
+	}
+	return bicepString(name)
+}
+
+func bicepString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", `\${`).Replace(s)
+	return "'" + s + "'"
+}
+
+// armSchemas are the deployment template schemas by target scope.
+var armSchemas = map[string]string{
+	"managementGroup": "https://schema.management.azure.com/schemas/2019-08-01/managementGroupDeploymentTemplate.json#",
+	"subscription":    "https://schema.management.azure.com/schemas/2018-05-01/subscriptionDeploymentTemplate.json#",
+	"resourceGroup":   "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+}
+
+type armTemplate struct {
+	Schema         string        `json:"$schema"`
+	ContentVersion string        `json:"contentVersion"`
+	Resources      []armResource `json:"resources"`
+}
+
+type armResource struct {
+	Type       string     `json:"type"`
+	APIVersion string     `json:"apiVersion"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope,omitempty"`
+	Properties properties `json:"properties"`
+}
+
+func renderARM(e azure.Exemption) (string, error) {
+	target, resource, err := deploymentScope(e.Scope)
+	if err != nil {
+		return "", err
+	}
+	props := exemptionProperties(e)
+	props.DisplayName = armString(props.DisplayName)
+	props.Description = armString(props.Description)
+	template := armTemplate{
+		Schema:         armSchemas[target],
+		ContentVersion: "1.0.0.0",
+		Resources: []armResource{{
+			Type:       resourceType,
+			APIVersion: APIVersion,
+			Name:       armString(e.Name),
+			Scope:      resource,
+			Properties: props,
+		}},
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(template); err != nil {
+		return "", fmt.Errorf("unable to encode exemption: %w", err)
+	}
+	return b.String(), nil
+}
+
+// armString escapes a literal string that ARM would evaluate as a
+// template expression.
+func armString(s string) string {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		return "[" + s
+	}
+	return s
+}
+
+// terraformTypes are the azurerm resource types and their scope argument
+// by scope level.
+var terraformTypes = map[azure.ScopeLevel][2]string{
+	azure.ScopeManagementGroup: {"azurerm_management_group_policy_exemption", "management_group_id"},
+	azure.ScopeSubscription:    {"azurerm_subscription_policy_exemption", "subscription_id"},
+	azure.ScopeResourceGroup:   {"azurerm_resource_group_policy_exemption", "resource_group_id"},
+	azure.ScopeResource:        {"azurerm_resource_policy_exemption", "resource_id"},
+}
+
+func renderTerraform(e azure.Exemption) (string, error) {
+	var b strings.Builder
+	if _, err := writeTerraformResource(&b, identifier(e.Name), e); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeTerraformResource writes the exemption as a resource with the given
+// name and returns the resource type.
+func writeTerraformResource(b *strings.Builder, label string, e azure.Exemption) (string, error) {
+	level, _ := azure.ParseScope(e.Scope)
+	kind, ok := terraformTypes[level]
+	if !ok {
+		return "", fmt.Errorf("unsupported exemption scope %q", e.Scope)
+	}
+	if len(e.ResourceSelectors) > 0 {
+		// Dropping them would exempt every resource in the scope.
+		return "", fmt.Errorf("the azurerm policy exemption resources do not support resource selectors; use the Bicep or ARM format")
+	}
+
+	type attribute struct{ name, value string }
+	attrs := []attribute{
+		{"name", hclString(e.Name)},
+		{kind[1], hclString(e.Scope)},
+		{"policy_assignment_id", hclString(e.PolicyAssignmentID)},
+		{"exemption_category", hclString(e.Category)},
+	}
+	if e.DisplayName != "" {
+		attrs = append(attrs, attribute{"display_name", hclString(e.DisplayName)})
+	}
+	if e.Description != "" {
+		attrs = append(attrs, attribute{"description", hclString(e.Description)})
+	}
+	if e.ExpiresOn != "" {
+		attrs = append(attrs, attribute{"expires_on", hclString(e.ExpiresOn)})
+	}
+	if len(e.ReferenceIDs) > 0 {
+		ids := make([]string, len(e.ReferenceIDs))
+		for i, id := range e.ReferenceIDs {
+			ids[i] = hclString(id)
+		}
+		attrs = append(attrs, attribute{"policy_definition_reference_ids", "[" + strings.Join(ids, ", ") + "]"})
+	}
+	if len(e.Metadata) > 0 {
+		keys := make([]string, 0, len(e.Metadata))
+		for k := range e.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields := make([]string, len(keys))
+		for i, k := range keys {
+			value, err := json.Marshal(e.Metadata[k])
+			if err != nil {
+				return "", fmt.Errorf("unable to encode exemption metadata: %w", err)
+			}
+			// A JSON value is a valid HCL expression apart from
+			// template sequences.
+			fields[i] = fmt.Sprintf("%s = %s", hclString(k), hclTemplateEscape(string(value)))
+		}
+		attrs = append(attrs, attribute{"metadata", "jsonencode({ " + strings.Join(fields, ", ") + " })"})
+	}
+
+	width := 0
+	for _, a := range attrs {
+		width = max(width, len(a.name))
+	}
+	fmt.Fprintf(b, "# Policy exemption %s\n", e.Label())
+	fmt.Fprintf(b, "resource %q %q {\n", kind[0], label)
+	for _, a := range attrs {
+		fmt.Fprintf(b, "  %-*s = %s\n", width, a.name, a.value)
+	}
+	b.WriteString("}\n")
+	return kind[0], nil
+}
+
+func hclString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s)
+	return `"` + hclTemplateEscape(s) + `"`
+}
+
+// hclTemplateEscape escapes the template sequences of HCL strings.
+func hclTemplateEscape(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(s)
+}
+
+// identifier returns a Bicep symbolic name or Terraform resource name
+// derived from the exemption name.
+func identifier(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	label := b.String()
+	if label == "" || (label[0] >= '0' && label[0] <= '9') {
+		label = "exemption_" + label
+	}
+	return label
+}
@@ -0,0 +1,173 @@
+package iac
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+func testExemption(scope string) azure.Exemption {
+	return azure.Exemption{
+		Name:               "Production---Require-TLS",
+		Scope:              scope,
+		DisplayName:        "Production - Require TLS",
+		Description:        "Ticket INC1 raised by O'Brien on 2030-01-02T03:04:05Z",
+		PolicyAssignmentID: "/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyAssignments/tls",
+		Category:           "Waiver",
+		ReferenceIDs:       []string{"ref-a", "ref-b"},
+		Metadata:           map[string]any{"requestedBy": "requester-id", "approvedBy": "approver-id"},
+		ExpiresOn:          "2030-05-06T23:59:59Z",
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"bicep", "ARM", "Terraform"} {
+		if _, err := ParseFormat(name); err != nil {
+			t.Fatalf("ParseFormat(%q) = %v", name, err)
+		}
+	}
+	if _, err := ParseFormat("pulumi"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
+
+func TestRenderBicep(t *testing.T) {
+	e := testExemption("/subscriptions/s")
+	e.ResourceSelectors = azure.ResourceSelectors{Locations: []string{"westeurope"}}.ARM()
+	got, err := Render(Bicep, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Deploy at /subscriptions/s
+targetScope = 'subscription'
+
+// Policy exemption Production - Require TLS
+resource exemption 'Microsoft.Authorization/policyExemptions@2022-07-01-preview' = {
+  name: 'Production---Require-TLS'
+  properties: {
+    policyAssignmentId: '/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyAssignments/tls'
+    exemptionCategory: 'Waiver'
+    displayName: 'Production - Require TLS'
+    description: 'Ticket INC1 raised by O\'Brien on 2030-01-02T03:04:05Z'
+    expiresOn: '2030-05-06T23:59:59Z'
+    policyDefinitionReferenceIds: [
+      'ref-a'
+      'ref-b'
+    ]
+    resourceSelectors: [
+      {
+        name: 'azexempt'
+        selectors: [
+          {
+            kind: 'resourceLocation'
+            in: [
+              'westeurope'
+            ]
+          }
+        ]
+      }
+    ]
+    metadata: {
+      approvedBy: 'approver-id'
+      requestedBy: 'requester-id'
+    }
+  }
+}
+`
+	if got != want {
+		t.Fatalf("Render(Bicep) =\n%s\nwant\n%s", got, want)
+	}
+
+	for scope, target := range map[string]string{
+		"/providers/Microsoft.Management/managementGroups/corp": "managementGroup",
+		"/subscriptions/s/resourceGroups/rg":                    "resourceGroup",
+	} {
+		got, err := Render(Bicep, testExemption(scope))
+		if err != nil || !strings.Contains(got, "targetScope = '"+target+"'") {
+			t.Fatalf("Render(Bicep) at %s = %v\n%s", scope, err, got)
+		}
+	}
+	if _, err := Render(Bicep, testExemption("/subscriptions/s/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/logs")); err == nil {
+		t.Fatal("resource scope accepted for Bicep")
+	}
+}
+
+func TestRenderARM(t *testing.T) {
+	e := testExemption("/subscriptions/s/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/logs")
+	e.DisplayName = "[not an expression]"
+	got, err := Render(ARM, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var template struct {
+		Schema    string `json:"$schema"`
+		Resources []struct {
+			Type       string
+			APIVersion string
+			Name       string
+			Scope      string
+			Properties map[string]any
+		}
+	}
+	if err := json.Unmarshal([]byte(got), &template); err != nil {
+		t.Fatalf("invalid template: %v\n%s", err, got)
+	}
+	r := template.Resources[0]
+	if !strings.Contains(template.Schema, "/deploymentTemplate.json") || r.Type != "Microsoft.Authorization/policyExemptions" || r.Name != e.Name || r.Scope != "Microsoft.Storage/storageAccounts/logs" {
+		t.Fatalf("template = %+v", template)
+	}
+	if r.Properties["displayName"] != "[[not an expression]" || r.Properties["expiresOn"] != e.ExpiresOn || r.Properties["policyAssignmentId"] != e.PolicyAssignmentID {
+		t.Fatalf("properties = %v", r.Properties)
+	}
+
+	got, err = Render(ARM, testExemption("/providers/Microsoft.Management/managementGroups/corp"))
+	if err != nil || !strings.Contains(got, "managementGroupDeploymentTemplate.json") || strings.Contains(got, `"scope"`) {
+		t.Fatalf("Render(ARM) = %v\n%s", err, got)
+	}
+}
+
+func TestRenderTerraform(t *testing.T) {
+	got, err := Render(Terraform, testExemption("/subscriptions/s/resourceGroups/rg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Policy exemption Production - Require TLS
+resource "azurerm_resource_group_policy_exemption" "production___require_tls" {
+  name                            = "Production---Require-TLS"
+  resource_group_id               = "/subscriptions/s/resourceGroups/rg"
+  policy_assignment_id            = "/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyAssignments/tls"
+  exemption_category              = "Waiver"
+  display_name                    = "Production - Require TLS"
+  description                     = "Ticket INC1 raised by O'Brien on 2030-01-02T03:04:05Z"
+  expires_on                      = "2030-05-06T23:59:59Z"
+  policy_definition_reference_ids = ["ref-a", "ref-b"]
+  metadata                        = jsonencode({ "approvedBy" = "approver-id", "requestedBy" = "requester-id" })
+}
+`
+	if got != want {
+		t.Fatalf("Render(Terraform) =\n%s\nwant\n%s", got, want)
+	}
+
+	for scope, kind := range map[string]string{
+		"/providers/Microsoft.Management/managementGroups/corp": `"azurerm_management_group_policy_exemption"`,
+		"/subscriptions/s": `"azurerm_subscription_policy_exemption"`,
+		"/subscriptions/s/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/x": `"azurerm_resource_policy_exemption"`,
+	} {
+		got, err := Render(Terraform, testExemption(scope))
+		if err != nil || !strings.Contains(got, "resource "+kind) {
+			t.Fatalf("Render(Terraform) at %s = %v\n%s", scope, err, got)
+		}
+	}
+
+	e := testExemption("/subscriptions/s")
+	e.Description = "Uses ${var} and \"quotes\""
+	if got, _ := Render(Terraform, e); !strings.Contains(got, `"Uses $${var} and \"quotes\""`) {
+		t.Fatalf("escaped description:\n%s", got)
+	}
+	e.ResourceSelectors = azure.ResourceSelectors{Locations: []string{"westeurope"}}.ARM()
+	if _, err := Render(Terraform, e); err == nil {
+		t.Fatal("resource selectors accepted for Terraform")
+	}
+}
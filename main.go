@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 
 	"github.com/Lukas-Klein/azexempt/azure"
 	"github.com/Lukas-Klein/azexempt/config"
+	"github.com/Lukas-Klein/azexempt/demo"
 	"github.com/Lukas-Klein/azexempt/tui"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -18,31 +21,202 @@ var (
 	date    = "unknown"
 )
 
+// logger receives the logs of --debug and --log-file; it discards them
+// when neither is given.
+var logger = slog.New(slog.DiscardHandler)
+
+// defaultDebugLog is the log file of --debug without --log-file. Logs never
+// go to the terminal, where they would disturb the wizard.
+const defaultDebugLog = "azexempt-debug.log"
+
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "--version" {
+	fs := flag.NewFlagSet("azexempt", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: azexempt [flags] [request|approve|generate|export-iac|serve] [command flags]")
+		fmt.Fprintln(fs.Output(), "\nWithout a command the wizard is started. Flags go before the command.")
+		fs.PrintDefaults()
+	}
+	showVersion := fs.Bool("version", false, "print the version and exit")
+	cloud := fs.String("cloud", "", "Azure cloud to use, e.g. AzureCloud, AzureUSGovernment or AzureChinaCloud (default from config, else the active cloud of the Azure CLI)")
+	demoMode := fs.Bool("demo", false, "explore azexempt with a fictitious tenant instead of Azure; nothing is created in Azure")
+	fixture := fs.String("fixture", "", "demo `file` with the tenant to serve instead of the built-in one (implies --demo)")
+	record := fs.String("record", "", "write every Azure CLI call with its output to `dir`, secrets redacted, for a bug report")
+	replay := fs.String("replay", "", "answer Azure CLI calls from the recording in `dir` instead of running them")
+	debug := fs.Bool("debug", false, "also log every wizard step to the log file (default file azexempt-debug.log)")
+	logFile := fs.String("log-file", "", "write logs of config resolution, Azure CLI calls, failures and retries to `file`")
+	authMode := fs.String("auth", "", "sign-in mode: interactive, device_code, service_principal or managed_identity (default from config, else interactive)")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if *showVersion {
 		fmt.Printf("azexempt %s (commit: %s, built: %s)\n", version, commit, date)
 		os.Exit(0)
 	}
 
 	ctx := context.Background()
-	client := azure.NewClient()
+
+	var err error
+	if logger, err = newLogger(*logFile, *debug); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	logger.Info("starting azexempt", "version", version, "commit", commit, "args", fs.Args())
 
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
+		logger.Error("failed to load config", "error", err)
 		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
 		os.Exit(1)
 	}
+	if cfg.Path != "" {
+		logger.Info("loaded config", "path", cfg.Path)
+	} else {
+		logger.Info("no config file found", "searched", config.DefaultConfigPaths())
+	}
+	auth := azure.Auth{
+		Mode:            azure.AuthMode(cfg.Auth.Mode),
+		TenantID:        cfg.Auth.TenantID,
+		ClientID:        cfg.Auth.ClientID,
+		ClientSecret:    cfg.Auth.ClientSecret,
+		CertificatePath: cfg.Auth.CertificatePath,
+	}.WithEnv()
+	if *authMode != "" {
+		auth.Mode = azure.AuthMode(*authMode)
+	}
+	cloudName := cfg.Cloud
+	if *cloud != "" {
+		cloudName = *cloud
+	}
+	logger.Info("resolved settings", "auth", auth.Mode, "cloud", cloudName)
+	opts := []azure.Option{
+		azure.WithLogger(logger),
+		azure.WithAuth(auth),
+		azure.WithCloud(cloudName),
+		azure.WithRetry(azure.RetryPolicy{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			BaseDelay:   cfg.Retry.BaseDelay,
+			MaxDelay:    cfg.Retry.MaxDelay,
+			CallTimeout: cfg.Retry.CallTimeout,
+		}),
+	}
+	var runner azure.Runner
+	switch {
+	case *record != "" && *replay != "":
+		err = fmt.Errorf("--record and --replay cannot be combined")
+	case *record != "":
+		runner, err = azure.NewRecorder(azure.ExecRunner{}, *record, auth.ClientSecret)
+	case *replay != "":
+		runner, err = azure.NewReplayer(*replay)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if runner != nil {
+		opts = append(opts, azure.WithRunner(runner))
+	}
+	var client azureClient = azure.NewClient(opts...)
+	switch {
+	case *fixture != "":
+		f, err := demo.Load(*fixture)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		client = demo.NewClient(f)
+		logger.Info("demo mode", "fixture", *fixture)
+	case *demoMode:
+		logger.Info("demo mode", "fixture", "built-in")
+		client = demo.NewClient(demo.Builtin())
+	}
+
+	os.Exit(run(ctx, client, cfg, fs))
+}
+
+// azureClient is implemented by azure.Client and the demo client. Besides
+// azure.API, it has the operations the wizard and 'approve' use.
+type azureClient interface {
+	azure.API
+	ActiveCloud(context.Context) (azure.Cloud, error)
+	ListResourceFacets(context.Context, string) (azure.ResourceFacets, error)
+	ListManagementEntities(context.Context) ([]azure.ManagementEntity, error)
+	ListAssignmentPages(context.Context, string, func([]azure.PolicyAssignment)) error
+	ListManagementGroupAssignments(context.Context, string) ([]azure.PolicyAssignment, error)
+	GetAssignmentDetails(context.Context, azure.PolicyAssignment) (azure.AssignmentDetails, error)
+	GetDefinitionDetails(context.Context, string) (azure.DefinitionDetails, error)
+	SummarizeCompliance(context.Context, string) (azure.ComplianceSummary, error)
+	SummarizeManagementGroupCompliance(context.Context, string) (azure.ComplianceSummary, error)
+	CountNonCompliant(context.Context, string, string, []string) (int, error)
+	CheckPermissions(context.Context, []string, string) (map[string]bool, error)
+}
+
+// run runs the command named by the arguments left in fs, or the wizard,
+// and returns the exit code.
+func run(ctx context.Context, client azureClient, cfg *config.Config, fs *flag.FlagSet) int {
+	if fs.NArg() > 0 {
+		switch fs.Arg(0) {
+		case "request":
+			return runRequest(ctx, client, cfg, fs.Args()[1:])
+		case "approve":
+			return runApprove(ctx, client, fs.Args()[1:])
+		case "generate":
+			return runGenerate(ctx, client, cfg, fs.Args()[1:])
+		case "export-iac":
+			return runExportIaC(ctx, client, fs.Args()[1:])
+		case "serve":
+			return runServe(ctx, client, cfg, fs.Args()[1:])
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n", fs.Arg(0))
+			fs.Usage()
+			return 2
+		}
+	}
 
 	if err := client.EnsureLogin(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Azure login failed: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
+	if err := runTUI(ctx, client, cfg, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
+		return 1
+	}
+	return 0
+}
 
+// runTUI starts the interactive wizard. When requestPath is set the wizard
+// saves an approval request there instead of creating the exemption.
+func runTUI(ctx context.Context, client azureClient, cfg *config.Config, requestPath string) error {
+	keys, err := tui.NewKeyMap(cfg.KeyBindings)
+	if err != nil {
+		return fmt.Errorf("invalid key_bindings in config: %w", err)
+	}
 	blockedDefs := cfg.BlockedDefinitionsMap()
-	p := tea.NewProgram(tui.NewModel(ctx, client, blockedDefs))
-	if _, err := p.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
-		os.Exit(1)
+	m := tui.NewModel(ctx, client, blockedDefs)
+	m.Keys = keys
+	m.RequestPath = requestPath
+	m.Logger = logger
+	p := tea.NewProgram(m)
+	_, err = p.Run()
+	return err
+}
+
+// newLogger returns the logger writing to path, at debug level when debug is
+// set and at info level otherwise. Without either it discards everything.
+func newLogger(path string, debug bool) (*slog.Logger, error) {
+	if path == "" && !debug {
+		return slog.New(slog.DiscardHandler), nil
+	}
+	if path == "" {
+		path = defaultDebugLog
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open log file: %w", err)
+	}
+	level := slog.LevelInfo
+	if debug {
+		level = slog.LevelDebug
 	}
+	return slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: level})), nil
 }
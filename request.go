@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/bundle"
+	"github.com/Lukas-Klein/azexempt/config"
+)
+
+// runRequest implements 'azexempt request'. Without selection flags it runs
+// the wizard; otherwise the exemption is resolved from the flags directly.
+// Either way the result is written to a request file for a second person to approve.
+func runRequest(ctx context.Context, client azureClient, cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("request", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: azexempt request [flags]")
+		fmt.Fprintln(fs.Output(), "\nWrites an exemption request file for approval. Without --subscription and --assignment the wizard is started.")
+		fs.PrintDefaults()
+	}
+	out := fs.String("out", "exemption-request.json", "path of the request file to write")
+	selection := selectionFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	sel := selection()
+
+	if err := client.EnsureLogin(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Azure login failed: %v\n", err)
+		return 1
+	}
+
+	if sel.Subscription == "" && sel.Assignment == "" {
+		if err := runTUI(ctx, client, cfg, *out); err != nil {
+			fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	spec, refs, err := bundle.Resolve(ctx, client, sel, cfg.BlockedDefinitionsMap())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid request: %v\n", err)
+		return 1
+	}
+	requester, err := client.CurrentPrincipal(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to determine requester: %v\n", err)
+		return 1
+	}
+	req := bundle.New(spec, requester, refs)
+	if err := bundle.Write(*out, req); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Print(req.Summary())
+	fmt.Printf("\nRequest written to %s. A different person must run 'azexempt approve %s' to create the exemption.\n", *out, *out)
+	fmt.Printf("Post the digest in ticket %s from your own account, so that the approver can check who raised the request with 'azexempt approve --digest'.\n", spec.Ticket)
+	return 0
+}
+
+// selectionFlags defines the flags describing an exemption on fs. The
+// returned function builds the selection once fs is parsed.
+func selectionFlags(fs *flag.FlagSet) func() bundle.Selection {
+	var sel bundle.Selection
+	var definitions, locations, resourceTypes string
+	fs.StringVar(&sel.Subscription, "subscription", "", "subscription ID or name")
+	fs.StringVar(&sel.Assignment, "assignment", "", "policy assignment ID, name or display name")
+	fs.StringVar(&definitions, "definitions", "", "comma-separated policy definition reference IDs (default: entire assignment)")
+	fs.StringVar(&sel.ResourceGroup, "resource-group", "", "resource group name (default: entire subscription)")
+	fs.StringVar(&locations, "locations", "", "comma-separated locations the exemption is limited to (default: all)")
+	fs.StringVar(&resourceTypes, "resource-types", "", "comma-separated resource types the exemption is limited to (default: all)")
+	fs.StringVar(&sel.Ticket, "ticket", "", "tracking ticket number")
+	fs.StringVar(&sel.Users, "users", "", "comma-separated requester names")
+	fs.StringVar(&sel.ExpirationDate, "expires", "", "expiration date as YYYY-MM-DD (default: unlimited)")
+	return func() bundle.Selection {
+		sel.Definitions = splitList(definitions)
+		sel.Locations = splitList(locations)
+		sel.ResourceTypes = splitList(resourceTypes)
+		return sel
+	}
+}
+
+// runApprove implements 'azexempt approve <file>'.
+func runApprove(ctx context.Context, client azureClient, args []string) int {
+	fs := flag.NewFlagSet("approve", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: azexempt approve [--yes] (--digest hex | --no-digest) <request-file>")
+		fs.PrintDefaults()
+	}
+	yes := fs.Bool("yes", false, "create the exemption without asking for confirmation")
+	digest := fs.String("digest", "", "digest the requester published from their own account; the request file must match it")
+	noDigest := fs.Bool("no-digest", false, "approve without checking the requester; recorded on the exemption as requesterVerified=false")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	switch {
+	case *digest != "" && *noDigest:
+		fmt.Fprintln(os.Stderr, "--digest and --no-digest cannot be combined")
+		return 2
+	case *digest == "" && !*noDigest:
+		fmt.Fprintln(os.Stderr, "The requester is taken from the request file, which anyone who handled it can edit. Pass the digest the requester published with --digest, or --no-digest to approve without verifying the requester.")
+		return 2
+	}
+
+	req, err := bundle.Read(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Print(req.Summary())
+
+	if err := client.EnsureLogin(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Azure login failed: %v\n", err)
+		return 1
+	}
+	approver, err := client.CurrentPrincipal(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to determine approver: %v\n", err)
+		return 1
+	}
+	var spec azure.ExemptionSpec
+	if *noDigest {
+		fmt.Fprintln(os.Stderr, "\nWarning: the requester is not verified; the exemption records this.")
+		spec, err = req.ApproveUnverified(approver)
+	} else {
+		spec, err = req.ApproveDigest(approver, *digest)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Refusing to approve as %s: %v\n", approver.Label(), err)
+		return 1
+	}
+
+	if !*yes && !confirm(ctx, fmt.Sprintf("\nApprove as %s and create this exemption? [y/N]: ", approver.Label())) {
+		fmt.Println("Aborted.")
+		return 1
+	}
+	created, err := client.CreateExemption(ctx, spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Println("Exemption created successfully!")
+	fmt.Printf("Name: %s\nID: %s\n", created.Label(), created.ID)
+	if cloud, err := client.ActiveCloud(ctx); err == nil {
+		if link := cloud.PortalLink(created.ID); link != "" {
+			fmt.Printf("\nAzure portal: %s\n", link)
+		}
+	}
+	return 0
+}
+
+// confirm asks a yes/no question on stdin and reports whether the answer
+// was yes. Cancelling ctx answers no rather than waiting for the line.
+func confirm(ctx context.Context, prompt string) bool {
+	fmt.Print(prompt)
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answers <- answer
+	}()
+	select {
+	case answer := <-answers:
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	case <-ctx.Done():
+		fmt.Println()
+		return false
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/config"
+	"github.com/Lukas-Klein/azexempt/server"
+)
+
+// runServe implements 'azexempt serve'.
+func runServe(ctx context.Context, client azure.API, cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: azexempt serve [flags]")
+		fmt.Fprintln(fs.Output(), "\nServes the wizard as a web form and JSON API, using the Azure CLI session of the server.")
+		fmt.Fprintln(fs.Output(), "It only lists unless --create or --request-dir is given.")
+		fs.PrintDefaults()
+	}
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	create := fs.Bool("create", false, "create submitted exemptions with the Azure CLI session of the server (needs --requester-header)")
+	requestDir := fs.String("request-dir", "", "write approval request files to this directory (needs --requester-header)")
+	requesterHeader := fs.String("requester-header", "", "`header` in which an authenticating proxy passes the signed-in user, recorded as the requester, e.g. X-Forwarded-User")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	// Without --create or --request-dir the server only lists.
+	opts := server.Options{
+		Mode:                 server.ModeReadOnly,
+		RequestDir:           *requestDir,
+		RequesterHeader:      *requesterHeader,
+		BlockedDefinitionIDs: cfg.BlockedDefinitionsMap(),
+	}
+	switch {
+	case *create && *requestDir != "":
+		fmt.Fprintln(os.Stderr, "--create and --request-dir cannot be combined")
+		return 2
+	case *create:
+		opts.Mode = server.ModeCreate
+	case *requestDir != "":
+		opts.Mode = server.ModeRequest
+	}
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	if err := client.EnsureLogin(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Azure login failed: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	fmt.Printf("Serving azexempt in %s mode on http://%s\n", opts.Mode, *addr)
+	if err := server.ListenAndServe(ctx, *addr, server.New(client, opts)); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
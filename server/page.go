@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+// page is the data of the HTML form. Each step is shown once the choices
+// of the steps before it are made, as query parameters of the page.
+type page struct {
+	Mode         string
+	ReadOnly     bool
+	Error        string
+	Subscription string
+	Assignment   string
+
+	Subscriptions []subscriptionOption
+	Assignments   []Assignment
+	Definitions   []Definition
+	Scopes        []Scope
+
+	Result *Result
+	// Back links to the form after a failed submission.
+	Back string
+}
+
+type subscriptionOption struct {
+	Name, ID string
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>azexempt</title>
+<style>
+body { font-family: sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; }
+label { display: block; margin-top: 1rem; font-weight: bold; }
+select, input[type=text], input[type=date] { width: 100%; padding: .3rem; }
+.dim { color: #666; }
+.error { color: #b00; }
+fieldset { margin-top: 1rem; }
+</style>
+</head>
+<body>
+<h1>Azure Policy Exemption</h1>
+<p class="dim">Mode: {{.Mode}}</p>
+{{if .Error}}<p class="error">Error: {{.Error}}</p>{{end}}
+
+{{if .Back}}
+  <p><a href="{{.Back}}">Back to the form</a></p>
+{{else if .Result}}
+  {{if .Result.RequestFile}}
+  <h2>Exemption request saved</h2>
+  <p>Request file: <code>{{.Result.RequestFile}}</code></p>
+  <p>Digest: <code>{{.Result.Digest}}</code></p>
+  <p class="dim">Post the digest in the ticket from your own account. A different person must check it there and run <code>azexempt approve --digest {{.Result.Digest}} {{.Result.RequestFile}}</code> to create the exemption.</p>
+  {{else}}
+  <h2>Exemption created</h2>
+  <p><code>{{.Result.ID}}</code></p>
+  {{end}}
+  <p><a href="/">Create another exemption</a></p>
+{{else}}
+
+<form method="get" action="/">
+<label for="subscription">1. Subscription</label>
+<select id="subscription" name="subscription" onchange="this.form.submit()">
+<option value="">Choose a subscription</option>
+{{range .Subscriptions}}<option value="{{.ID}}"{{if eq .ID $.Subscription}} selected{{end}}>{{.Name}} ({{.ID}})</option>
+{{end}}</select>
+{{if .Assignments}}
+<label for="assignment">2. Policy assignment</label>
+<select id="assignment" name="assignment" onchange="this.form.submit()">
+<option value="">Choose an assignment</option>
+{{range .Assignments}}<option value="{{.ID}}"{{if eq .ID $.Assignment}} selected{{end}}{{if .Blocked}} disabled{{end}}>{{.DisplayLabel}}{{if .Blocked}} (blocked){{end}}</option>
+{{end}}</select>
+{{else if .Subscription}}
+<p class="dim">No policy assignments apply to this subscription.</p>
+{{end}}
+<noscript><p><button type="submit">Next</button></p></noscript>
+</form>
+
+{{if .Scopes}}
+<form method="post" action="/exemptions">
+<input type="hidden" name="subscription" value="{{.Subscription}}">
+<input type="hidden" name="assignment" value="{{.Assignment}}">
+{{if .Definitions}}
+<fieldset>
+<legend>3. Definitions (none selected exempts the entire assignment)</legend>
+{{range .Definitions}}<div><label style="font-weight: normal"><input type="checkbox" name="definitions" value="{{.ReferenceID}}"{{if .Blocked}} disabled{{end}}> {{.DisplayName}}{{if .Effect}} <span class="dim">[{{.Effect}}]</span>{{end}}{{if .Blocked}} (blocked){{end}}</label></div>
+{{end}}</fieldset>
+{{end}}
+<label for="resourceGroup">Scope</label>
+<select id="resourceGroup" name="resourceGroup">
+{{range .Scopes}}<option value="{{.ResourceGroup}}">{{.Name}}</option>
+{{end}}</select>
+<label for="locations">Locations <span class="dim">(optional, comma-separated)</span></label>
+<input type="text" id="locations" name="locations">
+<label for="resourceTypes">Resource types <span class="dim">(optional, comma-separated)</span></label>
+<input type="text" id="resourceTypes" name="resourceTypes">
+<label for="ticket">Ticket</label>
+<input type="text" id="ticket" name="ticket" required>
+<label for="users">Requesters <span class="dim">(comma-separated)</span></label>
+<input type="text" id="users" name="users" required>
+<label for="expirationDate">Expires on <span class="dim">(empty for unlimited)</span></label>
+<input type="date" id="expirationDate" name="expirationDate">
+{{if .ReadOnly}}
+<p class="dim">The server is read-only; exemptions cannot be submitted.</p>
+{{else}}
+<p><button type="submit">{{if eq .Mode "request"}}Save request for approval{{else}}Create exemption{{end}}</button></p>
+{{end}}
+</form>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func (s *Server) render(w http.ResponseWriter, code int, p page) {
+	p.Mode = s.opts.Mode.String()
+	p.ReadOnly = s.opts.Mode == ModeReadOnly
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	_ = pageTemplate.Execute(w, p)
+}
+
+// handlePage renders the form up to the first step without a choice.
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p := page{Subscription: q.Get("subscription"), Assignment: q.Get("assignment")}
+	if err := s.loadPage(r.Context(), &p); err != nil {
+		p.Error = err.Error()
+		s.render(w, status(err), p)
+		return
+	}
+	s.render(w, http.StatusOK, p)
+}
+
+// loadPage lists the options of the steps up to the first without a choice.
+func (s *Server) loadPage(ctx context.Context, p *page) error {
+	subs, err := s.client.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	var sub *azure.Subscription
+	for i := range subs {
+		p.Subscriptions = append(p.Subscriptions, subscriptionOption{Name: subs[i].Name, ID: subs[i].ShortID()})
+		if p.Subscription != "" && subs[i].Matches(p.Subscription) {
+			sub = &subs[i]
+		}
+	}
+	if p.Subscription == "" {
+		return nil
+	}
+	if sub == nil {
+		return &httpError{status: http.StatusNotFound, err: fmt.Errorf("subscription %q not found", p.Subscription)}
+	}
+	if p.Assignments, err = s.assignments(ctx, *sub); err != nil || p.Assignment == "" {
+		return err
+	}
+	for _, assign := range p.Assignments {
+		if !assign.Matches(p.Assignment) {
+			continue
+		}
+		if assign.Blocked {
+			return badRequest("policy assignment %q is blocked and cannot be exempted", assign.DisplayLabel())
+		}
+		if p.Definitions, err = s.definitions(ctx, assign.PolicyAssignment); err != nil {
+			return err
+		}
+		p.Scopes, err = s.scopes(ctx, *sub, assign.PolicyAssignment)
+		return err
+	}
+	return &httpError{status: http.StatusNotFound, err: fmt.Errorf("policy assignment %q not found in subscription %s", p.Assignment, sub.Name)}
+}
+
+// handleForm submits the exemption of the HTML form.
+func (s *Server) handleForm(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		s.render(w, http.StatusBadRequest, page{Error: err.Error()})
+		return
+	}
+	req := ExemptionRequest{
+		Subscription:   r.PostForm.Get("subscription"),
+		Assignment:     r.PostForm.Get("assignment"),
+		Definitions:    r.PostForm["definitions"],
+		ResourceGroup:  r.PostForm.Get("resourceGroup"),
+		Locations:      splitList(r.PostForm.Get("locations")),
+		ResourceTypes:  splitList(r.PostForm.Get("resourceTypes")),
+		Ticket:         r.PostForm.Get("ticket"),
+		Users:          r.PostForm.Get("users"),
+		ExpirationDate: r.PostForm.Get("expirationDate"),
+	}
+	result, err := s.submit(r, req)
+	if err != nil {
+		back := url.Values{"subscription": {req.Subscription}, "assignment": {req.Assignment}}
+		s.render(w, status(err), page{Error: err.Error(), Back: "/?" + back.Encode()})
+		return
+	}
+	s.render(w, http.StatusCreated, page{Result: &result})
+}
+
+// splitList splits a comma-separated form value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,476 @@
+// Package server serves the exemption wizard over HTTP: a JSON API and a
+// minimal HTML form that walk through the same steps as the terminal UI.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/bundle"
+)
+
+// Client is the subset of the Azure client the server needs.
+type Client interface {
+	bundle.Resolver
+	CreateExemption(context.Context, azure.ExemptionSpec) (azure.Exemption, error)
+}
+
+// Mode controls what the server does with a submitted exemption. The zero
+// value is ModeReadOnly, so that creating exemptions has to be chosen.
+type Mode int
+
+const (
+	// ModeReadOnly only lists; submitting an exemption is refused.
+	ModeReadOnly Mode = iota
+	// ModeRequest writes an approval request file, as 'azexempt request'
+	// does, for a second person to approve.
+	ModeRequest
+	// ModeCreate creates the exemption.
+	ModeCreate
+)
+
+// String returns the name of the mode.
+func (m Mode) String() string {
+	switch m {
+	case ModeRequest:
+		return "request"
+	case ModeCreate:
+		return "create"
+	}
+	return "read-only"
+}
+
+// Options configure the server.
+type Options struct {
+	Mode Mode
+	// RequestDir is the directory request files are written to in
+	// ModeRequest.
+	RequestDir string
+	// RequesterHeader names the header carrying the signed-in user of an
+	// authenticating reverse proxy, such as X-Forwarded-User. It is
+	// recorded as the requester of every submitted exemption, so the modes
+	// that submit require it; the proxy must overwrite the header sent by
+	// clients.
+	RequesterHeader string
+	// BlockedDefinitionIDs are lowercased policy definition IDs that cannot
+	// be exempted, as in config.Config.BlockedDefinitionsMap.
+	BlockedDefinitionIDs map[string]bool
+}
+
+// Validate reports options the server cannot run with.
+func (o Options) Validate() error {
+	if o.Mode == ModeRequest && o.RequestDir == "" {
+		return errors.New("request mode needs a request directory")
+	}
+	if o.Mode != ModeReadOnly && o.RequesterHeader == "" {
+		return fmt.Errorf("%s mode needs the header of an authenticating proxy to identify the requester", o.Mode)
+	}
+	return nil
+}
+
+// Server handles the HTTP requests.
+type Server struct {
+	client  Client
+	opts    Options
+	mux     *http.ServeMux
+	handler http.Handler
+}
+
+// New returns a server using client for all Azure calls. Browsers are
+// refused cross-origin POST requests, so that another site cannot submit
+// exemptions through the browser of someone who can reach the server.
+func New(client Client, opts Options) *Server {
+	s := &Server{client: client, opts: opts, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /api/subscriptions", s.handleSubscriptions)
+	s.mux.HandleFunc("GET /api/assignments", s.handleAssignments)
+	s.mux.HandleFunc("GET /api/definitions", s.handleDefinitions)
+	s.mux.HandleFunc("GET /api/scopes", s.handleScopes)
+	s.mux.HandleFunc("POST /api/exemptions", s.handleCreate)
+	s.mux.HandleFunc("GET /{$}", s.handlePage)
+	s.mux.HandleFunc("POST /exemptions", s.handleForm)
+	s.handler = http.NewCrossOriginProtection().Handler(s.mux)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// maxBodyBytes limits the size of a submitted exemption.
+const maxBodyBytes = 1 << 20
+
+// httpError is an error with the HTTP status to respond with.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+
+func (e *httpError) Unwrap() error { return e.err }
+
+func badRequest(format string, args ...any) error {
+	return &httpError{status: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+// status returns the HTTP status for err: the status of an httpError, or
+// 502 for a failed Azure CLI call.
+func status(err error) int {
+	var herr *httpError
+	if errors.As(err, &herr) {
+		return herr.status
+	}
+	return http.StatusBadGateway
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, status(err), map[string]string{"error": err.Error()})
+}
+
+// Assignment is a policy assignment as listed by the API.
+type Assignment struct {
+	azure.PolicyAssignment
+	// Blocked is set when the assigned definition cannot be exempted.
+	Blocked bool `json:"blocked"`
+}
+
+// Definition is an initiative member as listed by the API.
+type Definition struct {
+	azure.PolicyDefinitionRef
+	// Blocked is set when the definition cannot be exempted.
+	Blocked bool `json:"blocked"`
+}
+
+// Scope is a scope the exemption can be created on.
+type Scope struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	// ResourceGroup is the resourceGroup value of an ExemptionRequest
+	// that exempts the scope.
+	ResourceGroup string `json:"resourceGroup"`
+}
+
+// ExemptionRequest describes the exemption to create, like the flags of
+// 'azexempt request'.
+type ExemptionRequest struct {
+	Subscription   string   `json:"subscription"`
+	Assignment     string   `json:"assignment"`
+	Definitions    []string `json:"definitions,omitempty"`
+	ResourceGroup  string   `json:"resourceGroup,omitempty"`
+	Locations      []string `json:"locations,omitempty"`
+	ResourceTypes  []string `json:"resourceTypes,omitempty"`
+	Ticket         string   `json:"ticket"`
+	Users          string   `json:"users"`
+	ExpirationDate string   `json:"expirationDate,omitempty"`
+}
+
+// Result is the outcome of a submitted exemption.
+type Result struct {
+	Mode string `json:"mode"`
+	// ID and Exemption are the exemption ID and the exemption as created
+	// by Azure.
+	ID        string           `json:"id,omitempty"`
+	Exemption *azure.Exemption `json:"exemption,omitempty"`
+	// RequestFile is the path of the written request file, and Digest
+	// its digest for the requester to post in the ticket, as printed by
+	// 'azexempt request'.
+	RequestFile string `json:"requestFile,omitempty"`
+	Digest      string `json:"digest,omitempty"`
+}
+
+func (s *Server) blocked(policyDefinitionID string) bool {
+	return s.opts.BlockedDefinitionIDs[strings.ToLower(policyDefinitionID)]
+}
+
+func (s *Server) subscription(ctx context.Context, query string) (azure.Subscription, error) {
+	if query == "" {
+		return azure.Subscription{}, badRequest("a subscription is required")
+	}
+	subs, err := s.client.ListSubscriptions(ctx)
+	if err != nil {
+		return azure.Subscription{}, err
+	}
+	for _, sub := range subs {
+		if sub.Matches(query) {
+			return sub, nil
+		}
+	}
+	return azure.Subscription{}, &httpError{status: http.StatusNotFound, err: fmt.Errorf("subscription %q not found", query)}
+}
+
+func (s *Server) assignment(ctx context.Context, sub azure.Subscription, query string) (azure.PolicyAssignment, error) {
+	if query == "" {
+		return azure.PolicyAssignment{}, badRequest("a policy assignment is required")
+	}
+	assignments, err := s.client.ListAssignments(ctx, sub.ShortID())
+	if err != nil {
+		return azure.PolicyAssignment{}, err
+	}
+	for _, assign := range assignments {
+		if assign.Matches(query) {
+			return assign, nil
+		}
+	}
+	return azure.PolicyAssignment{}, &httpError{status: http.StatusNotFound, err: fmt.Errorf("policy assignment %q not found in subscription %s", query, sub.Name)}
+}
+
+func (s *Server) assignments(ctx context.Context, sub azure.Subscription) ([]Assignment, error) {
+	list, err := s.client.ListAssignments(ctx, sub.ShortID())
+	if err != nil {
+		return nil, err
+	}
+	assignments := make([]Assignment, len(list))
+	for i, assign := range list {
+		assignments[i] = Assignment{PolicyAssignment: assign, Blocked: s.blocked(assign.PolicyDefinitionID)}
+	}
+	return assignments, nil
+}
+
+// definitions returns the members of an initiative assignment; a single
+// policy has none and is exempted as a whole.
+func (s *Server) definitions(ctx context.Context, assign azure.PolicyAssignment) ([]Definition, error) {
+	refs, err := s.client.ListAssignmentDefinitions(ctx, assign)
+	if err != nil {
+		return nil, err
+	}
+	definitions := make([]Definition, len(refs))
+	for i, ref := range refs {
+		definitions[i] = Definition{PolicyDefinitionRef: ref, Blocked: s.blocked(ref.PolicyDefinitionID)}
+	}
+	return definitions, nil
+}
+
+// scopes returns the entire subscription and its resource groups, limited
+// to those within the scope of an assignment on a resource group or
+// resource.
+func (s *Server) scopes(ctx context.Context, sub azure.Subscription, assign azure.PolicyAssignment) ([]Scope, error) {
+	rgs, err := s.client.ListResourceGroups(ctx, sub.ShortID())
+	if err != nil {
+		return nil, err
+	}
+	options := append([]azure.ResourceGroup{{Name: "Entire Subscription", ID: sub.Scope()}}, rgs...)
+	limit := assign.ScopeLimit()
+	if limit != "" {
+		options = azure.ScopesWithin(options, limit)
+	}
+	scopes := make([]Scope, len(options))
+	for i, opt := range options {
+		scopes[i] = Scope{Name: opt.Name, ID: opt.ID}
+		// The entire subscription and the assignment's own scope are
+		// the default of an empty resource group.
+		if opt.ID != sub.Scope() && !strings.EqualFold(opt.ID, limit) {
+			scopes[i].ResourceGroup = opt.Name
+		}
+	}
+	return scopes, nil
+}
+
+// requester returns the user signed in at the authenticating proxy, from
+// the configured header. The header must hold the user principal name,
+// the sign-in name the Azure CLI reports, so that 'azexempt approve' can
+// tell the requester from the approver; other names, such as a bare user
+// name, are refused. The name also serves as the ID, as the Azure CLI
+// does when the object ID cannot be looked up.
+func (s *Server) requester(r *http.Request) (azure.Principal, error) {
+	if s.opts.RequesterHeader == "" {
+		return azure.Principal{}, &httpError{status: http.StatusInternalServerError, err: errors.New("no requester header is configured")}
+	}
+	name := strings.TrimSpace(r.Header.Get(s.opts.RequesterHeader))
+	if name == "" {
+		return azure.Principal{}, &httpError{status: http.StatusUnauthorized, err: fmt.Errorf("the request has no %s header identifying the requester", s.opts.RequesterHeader)}
+	}
+	if !isUPN(name) {
+		return azure.Principal{}, &httpError{status: http.StatusUnauthorized, err: fmt.Errorf("the %s header %q is not a user principal name such as user@contoso.com", s.opts.RequesterHeader, name)}
+	}
+	return azure.Principal{ID: name, Name: name, Type: "user"}, nil
+}
+
+// isUPN reports whether name has the form of a user principal name: a
+// user and a domain with a dot, separated by a single @.
+func isUPN(name string) bool {
+	user, domain, ok := strings.Cut(name, "@")
+	if !ok || user == "" || strings.ContainsAny(name, " \t") || strings.Contains(domain, "@") {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// submit resolves the exemption with the rules of 'azexempt request' and
+// creates it or writes a request file, depending on the mode. Both record
+// the requester identified by the proxy, not the server.
+func (s *Server) submit(r *http.Request, req ExemptionRequest) (Result, error) {
+	ctx := r.Context()
+	if s.opts.Mode == ModeReadOnly {
+		return Result{}, &httpError{status: http.StatusForbidden, err: errors.New("the server is read-only")}
+	}
+	requester, err := s.requester(r)
+	if err != nil {
+		return Result{}, err
+	}
+	sel := bundle.Selection{
+		Subscription:   req.Subscription,
+		Assignment:     req.Assignment,
+		Definitions:    req.Definitions,
+		ResourceGroup:  req.ResourceGroup,
+		Locations:      req.Locations,
+		ResourceTypes:  req.ResourceTypes,
+		Ticket:         req.Ticket,
+		Users:          req.Users,
+		ExpirationDate: req.ExpirationDate,
+	}
+	spec, refs, err := bundle.Resolve(ctx, s.client, sel, s.opts.BlockedDefinitionIDs)
+	if err != nil {
+		return Result{}, badRequest("invalid exemption: %w", err)
+	}
+	spec.RequestedBy = &requester
+
+	if s.opts.Mode == ModeRequest {
+		r := bundle.New(spec, requester, refs)
+		path := filepath.Join(s.opts.RequestDir, requestFileName(r))
+		if err := os.MkdirAll(s.opts.RequestDir, 0o700); err != nil {
+			return Result{}, &httpError{status: http.StatusInternalServerError, err: fmt.Errorf("unable to create request directory: %w", err)}
+		}
+		if err := bundle.Write(path, r); err != nil {
+			return Result{}, &httpError{status: http.StatusInternalServerError, err: err}
+		}
+		return Result{Mode: s.opts.Mode.String(), RequestFile: path, Digest: r.Digest()}, nil
+	}
+
+	created, err := s.client.CreateExemption(ctx, spec)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Mode: s.opts.Mode.String(), ID: created.ID, Exemption: &created}, nil
+}
+
+// requestFileName names a request file after its creation time and ticket.
+func requestFileName(r *bundle.Request) string {
+	ticket := strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
+			return c
+		}
+		return '-'
+	}, r.Exemption.Ticket)
+	return fmt.Sprintf("%s-%s.json", r.CreatedAt.UTC().Format("20060102T150405.000000000"), ticket)
+}
+
+func (s *Server) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := s.client.ListSubscriptions(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (s *Server) handleAssignments(w http.ResponseWriter, r *http.Request) {
+	sub, err := s.subscription(r.Context(), r.URL.Query().Get("subscription"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	assignments, err := s.assignments(r.Context(), sub)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, assignments)
+}
+
+// selected resolves the subscription and assignment query parameters.
+func (s *Server) selected(r *http.Request) (azure.Subscription, azure.PolicyAssignment, error) {
+	q := r.URL.Query()
+	sub, err := s.subscription(r.Context(), q.Get("subscription"))
+	if err != nil {
+		return sub, azure.PolicyAssignment{}, err
+	}
+	assign, err := s.assignment(r.Context(), sub, q.Get("assignment"))
+	return sub, assign, err
+}
+
+func (s *Server) handleDefinitions(w http.ResponseWriter, r *http.Request) {
+	_, assign, err := s.selected(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	definitions, err := s.definitions(r.Context(), assign)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, definitions)
+}
+
+func (s *Server) handleScopes(w http.ResponseWriter, r *http.Request) {
+	sub, assign, err := s.selected(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	scopes, err := s.scopes(r.Context(), sub, assign)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, scopes)
+}
+
+// handleCreate accepts only JSON bodies, which a cross-origin HTML form
+// cannot send.
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, &httpError{status: http.StatusUnsupportedMediaType, err: errors.New("the request body must be application/json")})
+		return
+	}
+	var req ExemptionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+		writeError(w, badRequest("invalid request body: %w", err))
+		return
+	}
+	result, err := s.submit(r, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// ListenAndServe serves handler on addr until ctx is done.
+func ListenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
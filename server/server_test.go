@@ -0,0 +1,366 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/bundle"
+)
+
+type fakeClient struct {
+	assignments []azure.PolicyAssignment
+	definitions []azure.PolicyDefinitionRef
+	created     *azure.ExemptionSpec
+	listErr     error
+}
+
+func (c *fakeClient) ListSubscriptions(context.Context) ([]azure.Subscription, error) {
+	if c.listErr != nil {
+		return nil, c.listErr
+	}
+	return []azure.Subscription{{ID: "/subscriptions/sub-1", Name: "Production"}}, nil
+}
+
+func (c *fakeClient) ListAssignments(context.Context, string) ([]azure.PolicyAssignment, error) {
+	return c.assignments, nil
+}
+
+func (c *fakeClient) ListAssignmentDefinitions(context.Context, azure.PolicyAssignment) ([]azure.PolicyDefinitionRef, error) {
+	return c.definitions, nil
+}
+
+func (c *fakeClient) ListResourceGroups(context.Context, string) ([]azure.ResourceGroup, error) {
+	return []azure.ResourceGroup{
+		{ID: "/subscriptions/sub-1/resourceGroups/app", Name: "app"},
+		{ID: "/subscriptions/sub-1/resourceGroups/data", Name: "data"},
+	}, nil
+}
+
+func (c *fakeClient) CreateExemption(_ context.Context, spec azure.ExemptionSpec) (azure.Exemption, error) {
+	c.created = &spec
+	return azure.Exemption{ID: "/subscriptions/sub-1/providers/Microsoft.Authorization/policyExemptions/ex", Name: "ex"}, nil
+}
+
+func newTestServer(opts Options) (*httptest.Server, *fakeClient) {
+	client := &fakeClient{
+		assignments: []azure.PolicyAssignment{
+			{ID: "/assignments/baseline", Name: "baseline", DisplayName: "Security baseline", Scope: "/subscriptions/sub-1", PolicyDefinitionID: "/policySetDefinitions/set"},
+			{ID: "/assignments/data", Name: "data", DisplayName: "Data rules", Scope: "/subscriptions/sub-1/resourceGroups/data", PolicyDefinitionID: "/policyDefinitions/data"},
+			{ID: "/assignments/locked", Name: "locked", DisplayName: "Locked", Scope: "/subscriptions/sub-1", PolicyDefinitionID: "/policyDefinitions/locked"},
+		},
+		definitions: []azure.PolicyDefinitionRef{
+			{PolicyDefinitionID: "/policyDefinitions/tls", ReferenceID: "tls", DisplayName: "Require TLS", Effect: "Deny"},
+			{PolicyDefinitionID: "/policyDefinitions/blocked", ReferenceID: "blocked", DisplayName: "Blocked"},
+		},
+	}
+	if opts.Mode != ModeReadOnly && opts.RequesterHeader == "" {
+		opts.RequesterHeader = "X-Forwarded-User"
+	}
+	opts.BlockedDefinitionIDs = map[string]bool{"/policydefinitions/locked": true, "/policydefinitions/blocked": true}
+	return httptest.NewServer(New(client, opts)), client
+}
+
+func getJSON(t *testing.T, srv *httptest.Server, path string, v any) int {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+func postJSON(t *testing.T, srv *httptest.Server, req ExemptionRequest, v any) int {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	post, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/exemptions", strings.NewReader(string(body)))
+	post.Header.Set("Content-Type", "application/json")
+	post.Header.Set("X-Forwarded-User", "ada@example.com")
+	resp, err := http.DefaultClient.Do(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestListSteps(t *testing.T) {
+	srv, _ := newTestServer(Options{})
+	defer srv.Close()
+
+	var subs []azure.Subscription
+	if code := getJSON(t, srv, "/api/subscriptions", &subs); code != http.StatusOK || len(subs) != 1 {
+		t.Fatalf("subscriptions = %d %v", code, subs)
+	}
+
+	var assignments []Assignment
+	if code := getJSON(t, srv, "/api/assignments?subscription=Production", &assignments); code != http.StatusOK || len(assignments) != 3 {
+		t.Fatalf("assignments = %d %v", code, assignments)
+	}
+	if assignments[0].Blocked || !assignments[2].Blocked {
+		t.Fatalf("blocked assignments = %+v", assignments)
+	}
+
+	var definitions []Definition
+	getJSON(t, srv, "/api/definitions?subscription=sub-1&assignment=baseline", &definitions)
+	if len(definitions) != 2 || definitions[0].Blocked || !definitions[1].Blocked || definitions[0].Effect != "Deny" {
+		t.Fatalf("definitions = %+v", definitions)
+	}
+
+	var scopes []Scope
+	getJSON(t, srv, "/api/scopes?subscription=sub-1&assignment=baseline", &scopes)
+	if len(scopes) != 3 || scopes[0].ResourceGroup != "" || scopes[1].ResourceGroup != "app" {
+		t.Fatalf("scopes = %+v", scopes)
+	}
+	// An assignment on a resource group limits the scopes to it.
+	getJSON(t, srv, "/api/scopes?subscription=sub-1&assignment=data", &scopes)
+	if len(scopes) != 1 || scopes[0].Name != "data" || scopes[0].ResourceGroup != "" {
+		t.Fatalf("limited scopes = %+v", scopes)
+	}
+
+	var apiErr map[string]string
+	if code := getJSON(t, srv, "/api/assignments?subscription=missing", &apiErr); code != http.StatusNotFound || !strings.Contains(apiErr["error"], "not found") {
+		t.Fatalf("missing subscription = %d %v", code, apiErr)
+	}
+	if code := getJSON(t, srv, "/api/definitions?subscription=sub-1", &apiErr); code != http.StatusBadRequest {
+		t.Fatalf("missing assignment = %d %v", code, apiErr)
+	}
+}
+
+func TestCreateExemption(t *testing.T) {
+	srv, client := newTestServer(Options{Mode: ModeCreate})
+	defer srv.Close()
+
+	req := ExemptionRequest{Subscription: "Production", Assignment: "baseline", Definitions: []string{"tls"}, ResourceGroup: "app", Ticket: "INC1", Users: "Ada"}
+	var result Result
+	if code := postJSON(t, srv, req, &result); code != http.StatusCreated {
+		t.Fatalf("create = %d %+v", code, result)
+	}
+	if result.Mode != "create" || result.ID != "/subscriptions/sub-1/providers/Microsoft.Authorization/policyExemptions/ex" || result.Exemption == nil || result.Exemption.Name != "ex" {
+		t.Fatalf("result = %+v", result)
+	}
+	if client.created == nil || client.created.Scope != "/subscriptions/sub-1/resourceGroups/app" || client.created.ReferenceIDs[0] != "tls" {
+		t.Fatalf("created = %+v", client.created)
+	}
+	// The user signed in at the proxy is recorded as the requester.
+	if by := client.created.RequestedBy; by == nil || by.Name != "ada@example.com" {
+		t.Fatalf("requested by = %+v", by)
+	}
+	if err := (Options{Mode: ModeCreate}).Validate(); err == nil {
+		t.Fatal("create mode without a requester header was accepted")
+	}
+
+	// Oversized bodies are refused.
+	big := `{"ticket":"` + strings.Repeat("x", 2<<20) + `"}`
+	post, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/exemptions", strings.NewReader(big))
+	post.Header.Set("Content-Type", "application/json")
+	post.Header.Set("X-Forwarded-User", "ada@example.com")
+	resp, err := http.DefaultClient.Do(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("oversized body = %d", resp.StatusCode)
+	}
+
+	// The rules of the config apply.
+	client.created = nil
+	req.Definitions = []string{"blocked"}
+	var apiErr map[string]string
+	if code := postJSON(t, srv, req, &apiErr); code != http.StatusBadRequest || !strings.Contains(apiErr["error"], "blocked") || client.created != nil {
+		t.Fatalf("blocked definition = %d %v", code, apiErr)
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	// The zero Options are read-only.
+	srv, client := newTestServer(Options{})
+	defer srv.Close()
+
+	var apiErr map[string]string
+	req := ExemptionRequest{Subscription: "sub-1", Assignment: "baseline", Ticket: "INC1", Users: "Ada"}
+	if code := postJSON(t, srv, req, &apiErr); code != http.StatusForbidden || client.created != nil {
+		t.Fatalf("read-only create = %d %v", code, apiErr)
+	}
+	resp, err := http.Get(srv.URL + "/?subscription=sub-1&assignment=baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	page := readBody(t, resp)
+	if !strings.Contains(page, "The server is read-only") || strings.Contains(page, "Create exemption</button>") {
+		t.Fatalf("read-only page:\n%s", page)
+	}
+}
+
+func TestCrossSiteRequestsRefused(t *testing.T) {
+	srv, client := newTestServer(Options{Mode: ModeCreate})
+	defer srv.Close()
+
+	// A form posted by another site is refused.
+	form := url.Values{"subscription": {"sub-1"}, "assignment": {"baseline"}, "ticket": {"INC1"}, "users": {"Ada"}}
+	post, _ := http.NewRequest(http.MethodPost, srv.URL+"/exemptions", strings.NewReader(form.Encode()))
+	post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	post.Header.Set("Origin", "https://attacker.example")
+	resp, err := http.DefaultClient.Do(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || client.created != nil {
+		t.Fatalf("cross-origin form = %d", resp.StatusCode)
+	}
+
+	// The API takes JSON only, which a form cannot send.
+	resp, err = http.Post(srv.URL+"/api/exemptions", "text/plain", strings.NewReader(`{"subscription":"sub-1","assignment":"baseline","ticket":"INC1","users":"Ada"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType || client.created != nil {
+		t.Fatalf("text/plain create = %d", resp.StatusCode)
+	}
+}
+
+func TestRequestMode(t *testing.T) {
+	dir := t.TempDir()
+	if err := (Options{Mode: ModeRequest, RequestDir: dir}).Validate(); err == nil {
+		t.Fatal("request mode without a requester header was accepted")
+	}
+	srv, client := newTestServer(Options{Mode: ModeRequest, RequestDir: dir, RequesterHeader: "X-Forwarded-User"})
+	defer srv.Close()
+
+	form := url.Values{"subscription": {"sub-1"}, "assignment": {"/assignments/baseline"}, "definitions": {"tls"}, "ticket": {"INC 1"}, "users": {"Ada"}, "expirationDate": {"2030-01-31"}}
+	postForm := func(user string) (*http.Response, string) {
+		t.Helper()
+		post, _ := http.NewRequest(http.MethodPost, srv.URL+"/exemptions", strings.NewReader(form.Encode()))
+		post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if user != "" {
+			post.Header.Set("X-Forwarded-User", user)
+		}
+		resp, err := http.DefaultClient.Do(post)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp, readBody(t, resp)
+	}
+
+	// Without the proxy's header the requester is unknown.
+	if resp, page := postForm(""); resp.StatusCode != http.StatusUnauthorized || !strings.Contains(page, "X-Forwarded-User") {
+		t.Fatalf("request without requester = %d\n%s", resp.StatusCode, page)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("request files = %v", files)
+	}
+
+	// A bare user name could not be told from the approver's sign-in name.
+	if resp, page := postForm("ada"); resp.StatusCode != http.StatusUnauthorized || !strings.Contains(page, "user principal name") {
+		t.Fatalf("request by user name = %d\n%s", resp.StatusCode, page)
+	}
+
+	resp, page := postForm("ada@example.com")
+	if resp.StatusCode != http.StatusCreated || !strings.Contains(page, "Exemption request saved") || client.created != nil {
+		t.Fatalf("request page = %d\n%s", resp.StatusCode, page)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), "-INC-1.json") {
+		t.Fatalf("request files = %v", files)
+	}
+	req, err := bundle.Read(dir + "/" + files[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Requester.Name != "ada@example.com" || req.Exemption.ExpirationDate != "2030-01-31" || req.Exemption.ReferenceIDs[0] != "tls" {
+		t.Fatalf("request = %+v", req)
+	}
+	if !strings.Contains(page, "Digest: <code>"+req.Digest()+"</code>") || !strings.Contains(page, "approve --digest "+req.Digest()) {
+		t.Fatalf("request page does not show the digest %s:\n%s", req.Digest(), page)
+	}
+
+	// The requester cannot approve the request with their Azure sign-in,
+	// which has an object ID and may differ in case.
+	if _, err := req.Approve(azure.Principal{ID: "00000000-0000-0000-0000-00000000ada0", Name: "Ada@Example.com"}); !errors.Is(err, bundle.ErrSelfApproval) {
+		t.Fatalf("self-approval = %v", err)
+	}
+	if _, err := req.Approve(azure.Principal{ID: "00000000-0000-0000-0000-0000000000b0", Name: "bob@example.com"}); err != nil {
+		t.Fatalf("approval by another user = %v", err)
+	}
+}
+
+func TestIsUPN(t *testing.T) {
+	for name, want := range map[string]bool{
+		"ada@example.com":     true,
+		"ada.l@sub.contoso.a": true,
+		"ada":                 false,
+		"ada@example":         false,
+		"@example.com":        false,
+		"ada@example..com":    false,
+		"ada@b@example.com":   false,
+		"ada l@example.com":   false,
+	} {
+		if got := isUPN(name); got != want {
+			t.Errorf("isUPN(%q) = %v", name, got)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	srv, client := newTestServer(Options{Mode: ModeCreate})
+	defer srv.Close()
+
+	for path, want := range map[string][]string{
+		"/":                    {"Choose a subscription", "Production (sub-1)"},
+		"/?subscription=sub-1": {"Security baseline", `disabled>Locked (blocked)`},
+		"/?subscription=sub-1&assignment=baseline":            {"Require TLS", "[Deny]", `name="resourceGroup"`, `<option value="app">app</option>`, "Create exemption"},
+		"/?subscription=sub-1&assignment=/assignments/locked": {"is blocked and cannot be exempted"},
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := readBody(t, resp)
+		resp.Body.Close()
+		for _, w := range want {
+			if !strings.Contains(page, w) {
+				t.Fatalf("page %s is missing %q:\n%s", path, w, page)
+			}
+		}
+	}
+
+	client.listErr = errors.New("az login required")
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status on Azure error = %d", resp.StatusCode)
+	}
+}
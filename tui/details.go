@@ -0,0 +1,201 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	detailWidth  = 100
+	detailHeight = 15
+)
+
+// openDetails shows the detail pane for the highlighted assignment or
+// initiative member, loading its details if they are not cached yet.
+func (m *Model) openDetails() tea.Cmd {
+	switch m.Step {
+	case StepSelectAssignment:
+		if m.Cursor >= len(m.Assignments) {
+			return nil
+		}
+		assign := m.Assignments[m.Cursor]
+		m.DetailKey = strings.ToLower(assign.ID)
+		m.DetailOpen = true
+		m.refreshDetails()
+		if _, ok := m.AssignmentDetails[m.DetailKey]; ok || m.detailErrs[m.DetailKey] != nil {
+			return nil
+		}
+		return fetchAssignmentDetailsCmd(m.ctx, m.azureClient, assign)
+	case StepSelectDefinitions:
+		if m.Cursor >= len(m.AssignmentDefinitions) {
+			return nil
+		}
+		ref := m.AssignmentDefinitions[m.Cursor]
+		m.DetailKey = strings.ToLower(ref.PolicyDefinitionID)
+		m.DetailOpen = true
+		m.refreshDetails()
+		if _, ok := m.DefinitionDetails[m.DetailKey]; ok || m.detailErrs[m.DetailKey] != nil {
+			return nil
+		}
+		return fetchDefinitionDetailsCmd(m.ctx, m.azureClient, ref.PolicyDefinitionID)
+	}
+	return nil
+}
+
+// closeDetails hides the detail pane.
+func (m *Model) closeDetails() {
+	m.DetailOpen = false
+	m.DetailKey = ""
+}
+
+// handleDetailKey handles key presses while the detail pane has focus.
+func (m *Model) handleDetailKey(msg tea.KeyMsg) tea.Cmd {
+	if key.Matches(msg, m.Keys.Details, m.Keys.ClearSearch, m.Keys.Back, m.Keys.Select) {
+		m.closeDetails()
+		return nil
+	}
+	var cmd tea.Cmd
+	m.DetailView, cmd = m.DetailView.Update(msg)
+	return cmd
+}
+
+// refreshDetails renders the cached details of the open item into the viewport.
+func (m *Model) refreshDetails() {
+	if !m.DetailOpen {
+		return
+	}
+	var content string
+	switch m.Step {
+	case StepSelectAssignment:
+		assign := m.Assignments[m.Cursor]
+		details, ok := m.AssignmentDetails[m.DetailKey]
+		content = renderAssignmentDetails(assign, details, ok, m.detailErrs[m.DetailKey])
+	case StepSelectDefinitions:
+		ref := m.AssignmentDefinitions[m.Cursor]
+		details, ok := m.DefinitionDetails[m.DetailKey]
+		content = renderDefinitionDetails(ref, details, ok, m.detailErrs[m.DetailKey])
+	}
+	m.DetailView.SetContent(content)
+	m.DetailView.GotoTop()
+}
+
+func newDetailView() viewport.Model {
+	return viewport.New(detailWidth, detailHeight)
+}
+
+func renderAssignmentDetails(assign azure.PolicyAssignment, details azure.AssignmentDetails, loaded bool, err error) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(assign.DisplayLabel()) + "\n")
+	b.WriteString(dimStyle.Render(assign.ID) + "\n\n")
+	if err != nil {
+		b.WriteString(errorStyle.Render("Unable to load details: ") + err.Error() + "\n")
+		return b.String()
+	}
+	if !loaded {
+		b.WriteString(loadingStyle.Render("Loading assignment details...") + "\n")
+		return b.String()
+	}
+
+	writeField(&b, "Description", details.Description)
+	enforcement := details.EnforcementMode
+	if enforcement == "" {
+		enforcement = "Default"
+	}
+	writeField(&b, "Enforcement mode", enforcement)
+	writeField(&b, "Assigned at", details.Scope)
+	if len(details.NotScopes) > 0 {
+		writeField(&b, "Excluded scopes", strings.Join(details.NotScopes, ", "))
+	}
+	writeField(&b, "Definition", assign.PolicyDefinitionID)
+	if details.Effect != "" {
+		writeField(&b, "Effect", details.Effect)
+	}
+
+	identity := "None"
+	if details.Identity != nil && details.Identity.Type != "" && !strings.EqualFold(details.Identity.Type, "None") {
+		identity = details.Identity.Type
+		if details.Identity.PrincipalID != "" {
+			identity += " (principal " + details.Identity.PrincipalID + ")"
+		}
+		for id := range details.Identity.UserAssignedIdentities {
+			identity += "\n    " + id
+		}
+	}
+	writeField(&b, "Identity", identity)
+
+	b.WriteString("\n" + labelStyle.Render("Parameters:") + "\n")
+	if len(details.Parameters) == 0 {
+		b.WriteString(dimStyle.Render("  none") + "\n")
+	} else {
+		names := make([]string, 0, len(details.Parameters))
+		for name := range details.Parameters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "  %s = %s\n", name, details.Parameters[name])
+		}
+	}
+
+	b.WriteString("\n" + labelStyle.Render("Non-compliance messages:") + "\n")
+	if len(details.NonComplianceMessages) == 0 {
+		b.WriteString(dimStyle.Render("  none") + "\n")
+	}
+	for _, msg := range details.NonComplianceMessages {
+		if msg.ReferenceID != "" {
+			fmt.Fprintf(&b, "  [%s] %s\n", msg.ReferenceID, msg.Message)
+		} else {
+			fmt.Fprintf(&b, "  %s\n", msg.Message)
+		}
+	}
+	return b.String()
+}
+
+func renderDefinitionDetails(ref azure.PolicyDefinitionRef, details azure.DefinitionDetails, loaded bool, err error) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(ref.DisplayName) + "\n")
+	b.WriteString(dimStyle.Render(ref.PolicyDefinitionID) + "\n\n")
+	if err != nil {
+		b.WriteString(errorStyle.Render("Unable to load details: ") + err.Error() + "\n")
+		return b.String()
+	}
+	if !loaded {
+		b.WriteString(loadingStyle.Render("Loading policy definition...") + "\n")
+		return b.String()
+	}
+
+	writeField(&b, "Reference ID", ref.ReferenceID)
+	writeField(&b, "Description", details.Description)
+	writeField(&b, "Category", details.Category)
+	writeField(&b, "Mode", details.Mode)
+	writeField(&b, "Effect", details.Effect)
+	b.WriteString("\n" + labelStyle.Render("Policy rule:") + "\n")
+	if details.PolicyRule == "" {
+		b.WriteString(dimStyle.Render("  not available") + "\n")
+	} else {
+		b.WriteString(details.PolicyRule + "\n")
+	}
+	return b.String()
+}
+
+func writeField(b *strings.Builder, label, value string) {
+	if value == "" {
+		value = dimStyle.Render("-")
+	}
+	b.WriteString(labelStyle.Render(label+": ") + value + "\n")
+}
+
+// detailsView renders the detail pane with its scroll hints.
+func (m *Model) detailsView() string {
+	var b strings.Builder
+	b.WriteString(m.DetailView.View() + "\n")
+	b.WriteString("\n" + dimStyle.Render(fmt.Sprintf("%3.0f%%", m.DetailView.ScrollPercent()*100)) + " ")
+	b.WriteString(formatHint("↑/↓/PgUp/PgDn", "scroll") + ", " + formatHint(keyLabel(m.Keys.Details.Keys()[0])+"/"+keyLabel(m.Keys.ClearSearch.Keys()[0]), "close details") + "\n")
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestAssignmentDetailPane(t *testing.T) {
+	m := populatedModel()
+	client := m.azureClient.(*fakeAzureClient)
+	client.assignDetails = azure.AssignmentDetails{
+		Description:     "Company baseline",
+		EnforcementMode: "DoNotEnforce",
+		Parameters:      map[string]azure.ParameterValue{"effect": {Value: json.RawMessage(`"Deny"`)}},
+		Identity:        &azure.AssignmentIdentity{Type: "SystemAssigned", PrincipalID: "p-1"},
+	}
+	m.Step = StepSelectAssignment
+	m.Cursor = 0
+
+	cmd := press(t, m, tea.KeyTab)
+	if !m.DetailOpen || cmd == nil {
+		t.Fatal("Tab should open the detail pane and load details")
+	}
+	if !strings.Contains(m.View(), "Loading assignment details") {
+		t.Fatalf("pending detail view = %q", m.View())
+	}
+	updateWith(t, m, cmd())
+	view := m.View()
+	for _, want := range []string{"Company baseline", "DoNotEnforce", `effect = "Deny"`, "SystemAssigned (principal p-1)"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("detail view does not contain %q:\n%s", want, view)
+		}
+	}
+
+	press(t, m, tea.KeyDown)
+	if !m.DetailOpen || m.Cursor != 0 {
+		t.Fatal("arrow keys should scroll the pane, not move the list")
+	}
+	press(t, m, tea.KeyEsc)
+	if m.DetailOpen {
+		t.Fatal("Esc should close the detail pane")
+	}
+	if cmd := press(t, m, tea.KeyTab); cmd != nil {
+		t.Fatal("cached details should not be reloaded")
+	}
+}
+
+func TestDefinitionDetailPane(t *testing.T) {
+	m := populatedModel()
+	client := m.azureClient.(*fakeAzureClient)
+	client.defDetails = azure.DefinitionDetails{Category: "Storage", Effect: "Deny", PolicyRule: "{\n  \"then\": {}\n}"}
+	m.Step = StepSelectDefinitions
+	m.Cursor = 1
+
+	cmd := press(t, m, tea.KeyTab)
+	updateWith(t, m, cmd())
+	if m.DetailKey != "/definitions/b" {
+		t.Fatalf("detail key = %q", m.DetailKey)
+	}
+	view := m.View()
+	for _, want := range []string{"Second", "Storage", "Deny", `"then"`} {
+		if !strings.Contains(view, want) {
+			t.Errorf("definition view does not contain %q:\n%s", want, view)
+		}
+	}
+	press(t, m, tea.KeyTab)
+	if m.DetailOpen {
+		t.Fatal("Tab should close the detail pane")
+	}
+
+	client.err = errors.New("forbidden")
+	m.Cursor = 0
+	cmd = press(t, m, tea.KeyTab)
+	updateWith(t, m, cmd())
+	assertStep(t, m, StepSelectDefinitions)
+	if !strings.Contains(m.View(), "forbidden") {
+		t.Fatal("detail errors should be shown in the pane")
+	}
+}
+
+func TestRenderAssignmentDetailsDefaults(t *testing.T) {
+	got := renderAssignmentDetails(azure.PolicyAssignment{Name: "a"}, azure.AssignmentDetails{}, true, nil)
+	for _, want := range []string{"Enforcement mode: Default", "Identity: None", "none"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("details do not contain %q:\n%s", want, got)
+		}
+	}
+}
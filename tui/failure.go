@@ -0,0 +1,74 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// copyToClipboard is replaced in tests.
+var copyToClipboard = clipboard.WriteAll
+
+// canGoBack reports whether the error step can return to where the failed
+// load was started. The first load has nowhere to return to.
+func (m *Model) canGoBack() bool {
+	return isLoading(m.FailedStep) && !isLoading(m.loadFrom)
+}
+
+// retry re-issues the failed load.
+func (m *Model) retry() tea.Cmd {
+	if !isLoading(m.FailedStep) || m.lastLoad == nil {
+		return nil
+	}
+	m.Err = nil
+	return m.load(m.FailedStep, m.lastLoad)
+}
+
+// backFromError returns to the step the failed load was started from, with
+// its selections intact.
+func (m *Model) backFromError() {
+	if !m.canGoBack() {
+		return
+	}
+	m.Err = nil
+	m.Step = m.loadFrom
+	m.Status = "" // Help text is in the view
+}
+
+// copyError copies the full error message, including the az error output,
+// to the clipboard.
+func (m *Model) copyError() {
+	if m.Err == nil {
+		return
+	}
+	if err := copyToClipboard(m.Err.Error()); err != nil {
+		m.Status = "Unable to copy the error: " + err.Error()
+		return
+	}
+	m.Status = "Error copied to clipboard."
+}
+
+// errorView renders the error with a hint for known causes and the
+// recovery actions.
+func (m *Model) errorView(b *strings.Builder) {
+	kind := azure.Classify(m.Err)
+	if kind != azure.FailureUnknown {
+		b.WriteString(errorStyle.Render(kind.String()) + "\n\n")
+	}
+	b.WriteString(errorStyle.Render("Error: ") + fmt.Sprintf("%v\n\n", m.Err))
+	if hint := kind.Hint(); hint != "" {
+		b.WriteString(labelStyle.Render("Hint: ") + hint + "\n\n")
+	}
+	var actions []string
+	if isLoading(m.FailedStep) {
+		actions = append(actions, keyHint(m.Keys.Retry, "retry"))
+	}
+	if m.canGoBack() {
+		actions = append(actions, keyHint(m.Keys.Back, "go back"))
+	}
+	actions = append(actions, keyHint(m.Keys.CopyError, "copy error"), keyHint(m.Keys.Quit, "exit"))
+	b.WriteString(strings.Join(actions, ", ") + "\n")
+}
@@ -0,0 +1,96 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func unauthorized() error {
+	return &azure.CommandError{Stderr: "ERROR: (AuthorizationFailed) no access", Err: errors.New("exit status 1")}
+}
+
+func TestRetryAndBackAfterFailedLoad(t *testing.T) {
+	m := populatedModel()
+	client := m.azureClient.(*fakeAzureClient)
+	client.assignments = m.Assignments
+	client.definitions = m.AssignmentDefinitions
+	m.Step = StepSelectSubscription
+	m.SelectedSubscription = -1
+
+	client.err = unauthorized()
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepError)
+	if m.FailedStep != StepLoadingAssignments {
+		t.Fatalf("failed step = %v", m.FailedStep)
+	}
+	view := m.View()
+	for _, want := range []string{"Not authorized", "Hint:", "r retry", "Backspace go back", "c copy error"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("error view missing %q:\n%s", want, view)
+		}
+	}
+
+	client.err = nil
+	cmd := keyRune(t, m, 'r')
+	assertStep(t, m, StepLoadingAssignments)
+	runCmd(t, m, cmd)
+	assertStep(t, m, StepSelectAssignment)
+
+	// Going back returns to the assignment list with the subscription kept.
+	m.Cursor = 0
+	client.err = unauthorized()
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepError)
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectAssignment)
+	if m.Err != nil || m.SelectedSubscription != 0 || m.Cursor != 0 {
+		t.Fatalf("back left err %v, subscription %d, cursor %d", m.Err, m.SelectedSubscription, m.Cursor)
+	}
+}
+
+func TestFirstLoadCannotGoBack(t *testing.T) {
+	client := &fakeAzureClient{err: errors.New("az not found")}
+	m := NewModel(context.Background(), client, nil)
+	runCmd(t, m, m.Init())
+	assertStep(t, m, StepError)
+	if strings.Contains(m.View(), "go back") || strings.Contains(m.View(), "Hint:") {
+		t.Fatalf("error view offers going back or a hint:\n%s", m.View())
+	}
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepError)
+
+	client.err = nil
+	client.subscriptions = []azure.Subscription{{ID: "sub", Name: "Sub"}}
+	runCmd(t, m, keyRune(t, m, 'r'))
+	assertStep(t, m, StepSelectSubscription)
+}
+
+func TestCopyError(t *testing.T) {
+	var copied string
+	var copyErr error
+	original := copyToClipboard
+	t.Cleanup(func() { copyToClipboard = original })
+	copyToClipboard = func(text string) error {
+		copied = text
+		return copyErr
+	}
+
+	m := populatedModel()
+	m.Step = StepCreating
+	m.Fail(unauthorized())
+	keyRune(t, m, 'c')
+	if copied != unauthorized().Error() || m.Status != "Error copied to clipboard." {
+		t.Fatalf("copied %q, status %q", copied, m.Status)
+	}
+	copyErr = errors.New("no clipboard")
+	keyRune(t, m, 'c')
+	if !strings.Contains(m.Status, "no clipboard") {
+		t.Fatalf("status = %q", m.Status)
+	}
+	assertStep(t, m, StepError)
+}
@@ -0,0 +1,325 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// filterItem is an entry of a filtered list. Label is displayed and
+// highlighted; Keys are matched as well, so that items can be found by ID.
+type filterItem struct {
+	Index    int // index into the caller's slice
+	Label    string
+	Keys     []string
+	Disabled bool // e.g. blocked; the cursor prefers enabled matches
+}
+
+// filterMatch is an item matching the query together with the positions of
+// the matched runes in its label.
+type filterMatch struct {
+	Index     int
+	Score     int
+	Positions []int
+	Disabled  bool
+}
+
+// filterList narrows a list to the items matching a fuzzy query. It only
+// holds the query and whether it has input focus; callers pass the current
+// items to Filter so the result always reflects the loaded data.
+type filterList struct {
+	Query   string
+	Focused bool
+}
+
+// HandleKey edits the query: printable keys are appended, Backspace deletes
+// the last rune and Esc clears it. It reports whether the key was consumed;
+// Backspace and Esc on an empty query are not.
+func (l *filterList) HandleKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyRunes:
+		l.Query += string(msg.Runes)
+		return true
+	case tea.KeySpace:
+		l.Query += " "
+		return true
+	case tea.KeyBackspace:
+		if l.Query == "" {
+			return false
+		}
+		runes := []rune(l.Query)
+		l.Query = string(runes[:len(runes)-1])
+		return true
+	case tea.KeyEsc:
+		if l.Query == "" {
+			return false
+		}
+		l.Query = ""
+		return true
+	}
+	return false
+}
+
+// Reset clears the query and removes the input focus.
+func (l *filterList) Reset() {
+	l.Query = ""
+	l.Focused = false
+}
+
+// Filter returns the items matching the query, best match first. Items
+// with equal scores keep their order. An empty query matches every item.
+func (l filterList) Filter(items []filterItem) filterResult {
+	query := []rune(strings.ToLower(strings.TrimSpace(l.Query)))
+	result := make(filterResult, 0, len(items))
+	for _, item := range items {
+		if len(query) == 0 {
+			result = append(result, filterMatch{Index: item.Index, Disabled: item.Disabled})
+			continue
+		}
+		score, positions, ok := fuzzyMatch(query, item.Label)
+		for _, key := range item.Keys {
+			// Key matches rank below label matches and highlight nothing.
+			if keyScore, _, keyOK := fuzzyMatch(query, key); keyOK && (!ok || keyScore-keyPenalty > score) {
+				score, positions, ok = keyScore-keyPenalty, nil, true
+			}
+		}
+		if ok {
+			result = append(result, filterMatch{Index: item.Index, Score: score, Positions: positions, Disabled: item.Disabled})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Score > result[j].Score
+	})
+	return result
+}
+
+// Scores used by fuzzyMatch.
+const (
+	matchScore       = 16
+	boundaryBonus    = 8
+	consecutiveBonus = 12
+	prefixBonus      = 10
+	keyPenalty       = 10
+)
+
+// fuzzyMatch matches the lowercased query runes as a subsequence of text.
+// Consecutive runes, word starts and a match at the start of text score
+// higher, gaps lower. It returns the best scoring rune positions.
+func fuzzyMatch(query []rune, text string) (int, []int, bool) {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Lowercasing changed the length; match on the original runes.
+		lower = runes
+	}
+	best, found := 0, false
+	var bestPositions []int
+	for start := range lower {
+		if lower[start] != query[0] {
+			continue
+		}
+		positions := []int{start}
+		for i, q := 1, 1; q < len(query) && i+start < len(lower); i++ {
+			if lower[start+i] == query[q] {
+				positions = append(positions, start+i)
+				q++
+			}
+		}
+		if len(positions) < len(query) {
+			break // later starts cannot match either
+		}
+		if score := scorePositions(runes, positions); !found || score > best {
+			best, bestPositions, found = score, positions, true
+		}
+	}
+	return best, bestPositions, found
+}
+
+func scorePositions(runes []rune, positions []int) int {
+	score := 0
+	for i, pos := range positions {
+		score += matchScore
+		if isWordStart(runes, pos) {
+			score += boundaryBonus
+		}
+		if i > 0 {
+			if gap := pos - positions[i-1] - 1; gap == 0 {
+				score += consecutiveBonus
+			} else {
+				score -= gap
+			}
+		}
+	}
+	if positions[0] == 0 {
+		score += prefixBonus
+	}
+	return score
+}
+
+func isWordStart(runes []rune, pos int) bool {
+	if pos == 0 {
+		return true
+	}
+	prev, cur := runes[pos-1], runes[pos]
+	return !unicode.IsLetter(prev) && !unicode.IsDigit(prev) || unicode.IsLower(prev) && unicode.IsUpper(cur)
+}
+
+// filterResult is the ordered list of matches of a filtered list. Cursors
+// are item indices, so they stay valid when the query changes.
+type filterResult []filterMatch
+
+// unfiltered returns a result listing n items in order, for lists without
+// a search.
+func unfiltered(n int) filterResult {
+	result := make(filterResult, n)
+	for i := range result {
+		result[i].Index = i
+	}
+	return result
+}
+
+// Position returns the row of the item with the given index, or -1 if it
+// is filtered out.
+func (r filterResult) Position(index int) int {
+	for pos, match := range r {
+		if match.Index == index {
+			return pos
+		}
+	}
+	return -1
+}
+
+// Contains reports whether the item with the given index is listed.
+func (r filterResult) Contains(index int) bool {
+	return r.Position(index) >= 0
+}
+
+// First returns the index of the best enabled match, the best match if all
+// are disabled, or -1 if nothing matches.
+func (r filterResult) First() int {
+	for _, match := range r {
+		if !match.Disabled {
+			return match.Index
+		}
+	}
+	if len(r) > 0 {
+		return r[0].Index
+	}
+	return -1
+}
+
+// Move returns the index of the item delta rows away from index, stopping
+// at the ends of the list. A filtered out index moves to the first match.
+func (r filterResult) Move(index, delta int) int {
+	pos := r.Position(index)
+	if pos < 0 {
+		if first := r.First(); first >= 0 {
+			return first
+		}
+		return index
+	}
+	pos = min(max(pos+delta, 0), len(r)-1)
+	return r[pos].Index
+}
+
+// Page returns the matches shown in a window of height rows around index
+// together with the 0-based row of the first of them.
+func (r filterResult) Page(index, height int) (filterResult, int) {
+	pos := max(r.Position(index), 0)
+	start, end := visibleRange(pos, len(r), height)
+	return r[start:end], start
+}
+
+// footer describes the shown part of the list, e.g. "Showing 1-15 of 20
+// (filtered from 80)".
+func (r filterResult) footer(start, shown, total int, noun string) string {
+	if len(r) == 0 && total > 0 {
+		return fmt.Sprintf("No matches among %d%s", total, noun)
+	}
+	text := fmt.Sprintf("Showing %d-%d of %d%s", start+1, start+shown, len(r), noun)
+	if len(r) < total {
+		text += fmt.Sprintf(" (filtered from %d)", total)
+	}
+	return text
+}
+
+// highlightStyle marks matched runes within a list label.
+var highlightStyle = lipgloss.NewStyle().Underline(true)
+
+// highlight renders text in base style with the runes at positions
+// underlined on top of it.
+func highlight(text string, positions []int, base lipgloss.Style) string {
+	if len(positions) == 0 {
+		return base.Render(text)
+	}
+	matched := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		matched[pos] = true
+	}
+	marked := base.Inherit(highlightStyle)
+	var b strings.Builder
+	var run []rune
+	runMatched := false
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		if runMatched {
+			b.WriteString(marked.Render(string(run)))
+		} else {
+			b.WriteString(base.Render(string(run)))
+		}
+		run = run[:0]
+	}
+	for i, r := range []rune(text) {
+		if matched[i] != runMatched {
+			flush()
+			runMatched = matched[i]
+		}
+		run = append(run, r)
+	}
+	flush()
+	return b.String()
+}
+
+// listRow renders a list line with prefix and suffix in base style and the
+// label's matched runes highlighted. A width above 0 truncates the label,
+// and the suffix if the label would get too short, to fit the line.
+func listRow(prefix, label, suffix string, positions []int, base lipgloss.Style, width int) string {
+	if width > 0 {
+		room := width - lipgloss.Width(prefix) - lipgloss.Width(suffix)
+		if room < minLabelWidth {
+			room = min(minLabelWidth, lipgloss.Width(label))
+			suffix = truncate(suffix, width-lipgloss.Width(prefix)-room)
+		}
+		if cut := truncate(label, room); cut != label {
+			// The ellipsis replaces the last shown rune.
+			last := len([]rune(cut)) - 1
+			var shown []int
+			for _, pos := range positions {
+				if pos < last {
+					shown = append(shown, pos)
+				}
+			}
+			label, positions = cut, shown
+		}
+	}
+	return base.Render(prefix) + highlight(label, positions, base) + base.Render(suffix)
+}
+
+// searchHints renders the search query line, if any, followed by the key
+// hints of a filtered list step: searching while the search has focus,
+// idle otherwise.
+func searchHints(l filterList, searching, idle string) string {
+	switch {
+	case l.Focused:
+		return "Search: " + searchStyle.Render(l.Query+"_") + "\n" + searching
+	case l.Query != "":
+		return "Search: " + searchStyle.Render(l.Query) + "\n" + idle
+	}
+	return idle
+}
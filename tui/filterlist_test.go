@@ -0,0 +1,118 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query     string
+		text      string
+		ok        bool
+		positions []int
+	}{
+		{"kv", "Key Vault", true, []int{0, 4}},
+		{"vault", "Key Vault", true, []int{4, 5, 6, 7, 8}},
+		{"tls", "Require TLS for storage", true, []int{8, 9, 10}},
+		{"xyz", "Key Vault", false, nil},
+		{"ab", "ba", false, nil},
+	}
+	for _, tt := range tests {
+		_, positions, ok := fuzzyMatch([]rune(tt.query), tt.text)
+		if ok != tt.ok || !reflect.DeepEqual(positions, tt.positions) {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, %v; want %v, %v", tt.query, tt.text, positions, ok, tt.positions, tt.ok)
+		}
+	}
+}
+
+func TestFilterRanking(t *testing.T) {
+	items := []filterItem{
+		{Index: 0, Label: "Audit storage accounts"},
+		{Index: 1, Label: "Storage accounts should restrict network access"},
+		{Index: 2, Label: "Disk encryption", Keys: []string{"storage-disk"}},
+		{Index: 3, Label: "Key Vault"},
+	}
+	result := filterList{Query: "storage"}.Filter(items)
+	var order []int
+	for _, match := range result {
+		order = append(order, match.Index)
+	}
+	if !reflect.DeepEqual(order, []int{1, 0, 2}) {
+		t.Fatalf("ranking = %v", order)
+	}
+	if all := (filterList{}).Filter(items); len(all) != len(items) || all[3].Index != 3 {
+		t.Fatalf("empty query result = %#v", all)
+	}
+}
+
+func TestFilterResultNavigation(t *testing.T) {
+	r := filterResult{{Index: 4, Disabled: true}, {Index: 2}, {Index: 7}}
+	if r.First() != 2 || r.Position(7) != 2 || r.Contains(1) {
+		t.Fatalf("First/Position/Contains = %d, %d, %v", r.First(), r.Position(7), r.Contains(1))
+	}
+	if got := r.Move(2, 1); got != 7 {
+		t.Fatalf("Move down = %d", got)
+	}
+	if got := r.Move(7, 1); got != 7 {
+		t.Fatalf("Move past end = %d", got)
+	}
+	if got := r.Move(2, -5); got != 4 {
+		t.Fatalf("Move past start = %d", got)
+	}
+	if got := r.Move(9, 1); got != 2 {
+		t.Fatalf("Move from filtered out index = %d", got)
+	}
+	if got := (filterResult{}).Move(3, 1); got != 3 {
+		t.Fatalf("Move in empty result = %d", got)
+	}
+	if got := r.footer(0, 3, 10, ""); got != "Showing 1-3 of 3 (filtered from 10)" {
+		t.Fatalf("footer = %q", got)
+	}
+	if got := (filterResult{}).footer(0, 0, 10, " groups"); got != "No matches among 10 groups" {
+		t.Fatalf("empty footer = %q", got)
+	}
+}
+
+func TestFilterListHandleKey(t *testing.T) {
+	var l filterList
+	for _, msg := range []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune("Qé")},
+		{Type: tea.KeySpace},
+		{Type: tea.KeyRunes, Runes: []rune(".")},
+	} {
+		if !l.HandleKey(msg) {
+			t.Fatalf("HandleKey(%v) was not consumed", msg)
+		}
+	}
+	if l.Query != "Qé ." {
+		t.Fatalf("query = %q", l.Query)
+	}
+	l.HandleKey(tea.KeyMsg{Type: tea.KeyBackspace})
+	if l.Query != "Qé " {
+		t.Fatalf("query after backspace = %q", l.Query)
+	}
+	if !l.HandleKey(tea.KeyMsg{Type: tea.KeyEsc}) || l.Query != "" {
+		t.Fatal("esc did not clear the query")
+	}
+	if l.HandleKey(tea.KeyMsg{Type: tea.KeyBackspace}) || l.HandleKey(tea.KeyMsg{Type: tea.KeyEsc}) || l.HandleKey(tea.KeyMsg{Type: tea.KeyEnter}) {
+		t.Fatal("keys on an empty query should not be consumed")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	if got := highlight("Key Vault", []int{0, 4}, lipgloss.NewStyle()); got != "Key Vault" {
+		// Styles are not rendered without a terminal, so only the text remains.
+		t.Fatalf("highlight() = %q", got)
+	}
+	m := populatedModel()
+	m.Step = StepSelectSubscription
+	m.SubscriptionFilter.Query = "nomatch"
+	if got := m.View(); !strings.Contains(got, "No matches among 1") || !strings.Contains(got, "Search: nomatch") {
+		t.Fatalf("filtered view = %q", got)
+	}
+}
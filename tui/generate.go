@@ -0,0 +1,99 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/iac"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type iacWrittenMsg struct {
+	format iac.Format
+	path   string
+	err    error
+}
+
+// writeIaCCmd renders the exemption in the format and writes it to a file
+// in the working directory named after the exemption.
+func writeIaCCmd(format iac.Format, spec azure.ExemptionSpec) tea.Cmd {
+	return func() tea.Msg {
+		exemption := spec.Exemption(time.Now())
+		code, err := iac.Render(format, exemption)
+		if err != nil {
+			return iacWrittenMsg{format: format, err: err}
+		}
+		path := exemption.Name + format.Extension()
+		if err := os.WriteFile(path, []byte(code), 0o644); err != nil {
+			return iacWrittenMsg{format: format, err: fmt.Errorf("unable to write %s: %w", path, err)}
+		}
+		return iacWrittenMsg{format: format, path: path}
+	}
+}
+
+// handleGenerateKey handles the keys of the format choice for generating
+// infrastructure code instead of creating the exemption.
+func (m *Model) handleGenerateKey(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.Keys.Up):
+		if m.Cursor > 0 {
+			m.Cursor--
+		}
+	case key.Matches(msg, m.Keys.Down):
+		if m.Cursor < len(iac.Formats)-1 {
+			m.Cursor++
+		}
+	case key.Matches(msg, m.Keys.Back):
+		m.Step = StepConfirm
+		m.Status = "" // Help text is in the view
+	case key.Matches(msg, m.Keys.Select):
+		return writeIaCCmd(iac.Formats[m.Cursor], m.ExemptionSpec())
+	}
+	return nil
+}
+
+// iacWritten shows the written file. A format that cannot express the
+// exemption keeps the choice open for another one.
+func (m *Model) iacWritten(msg iacWrittenMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.Status = fmt.Sprintf("Unable to generate %s: %v", msg.format, msg.err)
+		return m, nil
+	}
+	m.IaCFormat = msg.format
+	m.OutputPath = msg.path
+	m.Step = StepDone
+	m.Status = "" // Help text is in the view
+	return m, nil
+}
+
+func (m *Model) generateView(b *strings.Builder) {
+	b.WriteString("Generate the exemption as code instead of creating it:\n\n")
+	for i, format := range iac.Formats {
+		cursor := " "
+		if i == m.Cursor {
+			cursor = ">"
+		}
+		line := fmt.Sprintf("%s %s", cursor, format)
+		if i == m.Cursor {
+			line = selectedStyle.Render(line)
+		}
+		fmt.Fprintf(b, "%s\n", line)
+	}
+	b.WriteString("\n" + dimStyle.Render("The file is written to the working directory and nothing is changed in Azure.") + "\n")
+	b.WriteString("\n" + m.navHint() + ", " + keyHint(m.Keys.Select, "generate") + ", " + keyHint(m.Keys.Back, "go back") + "\n")
+}
+
+func (m *Model) generatedView(b *strings.Builder) {
+	b.WriteString(successStyle.Render(m.IaCFormat.String()+" code generated!") + "\n\n")
+	b.WriteString(labelStyle.Render("File: ") + m.OutputPath + "\n")
+	b.WriteString(dimStyle.Render("The exemption is created when the code is deployed.") + "\n")
+	if m.RequestPath != "" {
+		b.WriteString("\n" + keyHint(m.Keys.Quit, "exit") + "\n")
+		return
+	}
+	b.WriteString("\n" + keyHint(m.Keys.Select, "create another exemption") + ", " + keyHint(m.Keys.Quit, "exit") + "\n")
+}
@@ -0,0 +1,54 @@
+package tui
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestGenerateCode(t *testing.T) {
+	t.Chdir(t.TempDir())
+	m := populatedModel()
+	m.Step = StepConfirm
+	if !strings.Contains(m.View(), "g generate code instead") {
+		t.Fatalf("confirm view:\n%s", m.View())
+	}
+	keyRune(t, m, 'g')
+	assertStep(t, m, StepGenerate)
+	if view := m.View(); !strings.Contains(view, "> Bicep") || !strings.Contains(view, "ARM template") || !strings.Contains(view, "Terraform") {
+		t.Fatalf("format view:\n%s", view)
+	}
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepConfirm)
+
+	keyRune(t, m, 'g')
+	press(t, m, tea.KeyDown)
+	press(t, m, tea.KeyDown)
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepDone)
+	if m.OutputPath != "Sub---Security.tf" || !strings.Contains(m.View(), "Terraform code generated!") {
+		t.Fatalf("output %q, view:\n%s", m.OutputPath, m.View())
+	}
+	data, err := os.ReadFile(m.OutputPath)
+	if err != nil || !strings.Contains(string(data), `resource "azurerm_subscription_policy_exemption"`) {
+		t.Fatalf("generated file = %v\n%s", err, data)
+	}
+	if client := m.azureClient.(*fakeAzureClient); client.created.Scope != "" {
+		t.Fatalf("exemption created: %+v", client.created)
+	}
+
+	// A format that cannot express the exemption keeps the choice open.
+	m = populatedModel()
+	location := selectorOption{Kind: selectorLocation, Value: "westeurope"}
+	m.SelectorOptions = []selectorOption{location}
+	m.SelectedSelectors[location] = true
+	m.Step = StepGenerate
+	m.Cursor = 2
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepGenerate)
+	if !strings.Contains(m.Status, "resource selectors") {
+		t.Fatalf("status = %q", m.Status)
+	}
+}
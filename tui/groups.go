@@ -0,0 +1,179 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ungroupedLabel is shown for initiative members that belong to no group.
+const ungroupedLabel = "Ungrouped"
+
+// definitionGroup is a row of the grouped definitions view: a policy
+// definition group (compliance control) and its visible members.
+type definitionGroup struct {
+	Key     string
+	Label   string
+	Members []int // indices into AssignmentDefinitions
+}
+
+// definitionGroups groups the visible assignment definitions by policy
+// definition group. A member in several groups appears in each of them.
+func (m *Model) definitionGroups() []definitionGroup {
+	byKey := make(map[string]*definitionGroup)
+	var groups []*definitionGroup
+	add := func(key, label string, i int) {
+		g, ok := byKey[key]
+		if !ok {
+			g = &definitionGroup{Key: key, Label: label}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.Members = append(g.Members, i)
+	}
+	for _, i := range m.visibleDefinitions() {
+		ref := m.AssignmentDefinitions[i]
+		if len(ref.Groups) == 0 {
+			add("", ungroupedLabel, i)
+			continue
+		}
+		for _, group := range ref.Groups {
+			add(strings.ToLower(group.Name), group.Label(), i)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		// Keep members without a group at the end of the list.
+		if (groups[i].Key == "") != (groups[j].Key == "") {
+			return groups[j].Key == ""
+		}
+		return strings.ToLower(groups[i].Label) < strings.ToLower(groups[j].Label)
+	})
+	result := make([]definitionGroup, len(groups))
+	for i, g := range groups {
+		result[i] = *g
+	}
+	return result
+}
+
+// selectableMembers returns the members of indices that are not blocked.
+func (m *Model) selectableMembers(indices []int) []int {
+	var selectable []int
+	for _, i := range indices {
+		if !m.IsDefinitionBlocked(m.AssignmentDefinitions[i].PolicyDefinitionID) {
+			selectable = append(selectable, i)
+		}
+	}
+	return selectable
+}
+
+// groupSelection reports how many selectable members of g are selected.
+func (m *Model) groupSelection(g definitionGroup) (selected, total int) {
+	for _, i := range m.selectableMembers(g.Members) {
+		total++
+		if m.SelectedDefinitionIDs[m.AssignmentDefinitions[i].ReferenceID] {
+			selected++
+		}
+	}
+	return selected, total
+}
+
+// toggleGroup selects every selectable member of g, or deselects them all
+// if they are already selected.
+func (m *Model) toggleGroup(g definitionGroup) {
+	selected, total := m.groupSelection(g)
+	if total == 0 {
+		m.Status = "All policy definitions in this group are blocked and cannot be exempted."
+		return
+	}
+	for _, i := range m.selectableMembers(g.Members) {
+		ref := m.AssignmentDefinitions[i]
+		if selected == total {
+			delete(m.SelectedDefinitionIDs, ref.ReferenceID)
+		} else {
+			m.SelectedDefinitionIDs[ref.ReferenceID] = true
+		}
+	}
+	m.Status = "" // Clear any previous status
+}
+
+// selectionChange is a bulk change to the selected definitions.
+type selectionChange int
+
+const (
+	selectAll selectionChange = iota
+	selectNone
+	invertSelection
+)
+
+// changeSelection applies a bulk selection change to all listed,
+// non-blocked definitions: in the grouped view, the members of the listed
+// groups, each once even if it belongs to several of them.
+func (m *Model) changeSelection(change selectionChange) {
+	var listed []int
+	if m.GroupedView {
+		groups := m.definitionGroups()
+		seen := make(map[int]bool)
+		for _, match := range m.groupMatches(groups) {
+			for _, i := range groups[match.Index].Members {
+				if !seen[i] {
+					seen[i] = true
+					listed = append(listed, i)
+				}
+			}
+		}
+	} else {
+		for _, match := range m.definitionMatches() {
+			listed = append(listed, match.Index)
+		}
+	}
+	for _, i := range m.selectableMembers(listed) {
+		ref := m.AssignmentDefinitions[i].ReferenceID
+		switch {
+		case change == selectAll, change == invertSelection && !m.SelectedDefinitionIDs[ref]:
+			m.SelectedDefinitionIDs[ref] = true
+		default:
+			delete(m.SelectedDefinitionIDs, ref)
+		}
+	}
+	m.Status = "" // Clear any previous status
+}
+
+// groupedDefinitionsView renders the definition groups matching the search
+// query with their selection state.
+func (m *Model) groupedDefinitionsView() string {
+	var b strings.Builder
+	groups := m.definitionGroups()
+	matches := m.groupMatches(groups)
+	page, start := matches.Page(m.Cursor, m.listHeight())
+	for _, match := range page {
+		g := groups[match.Index]
+		selected, total := m.groupSelection(g)
+		cursor := " "
+		if match.Index == m.Cursor {
+			cursor = ">"
+		}
+		marker := " "
+		switch {
+		case total == 0:
+			marker = "-" // Blocked indicator
+		case selected == total:
+			marker = "x"
+		case selected > 0:
+			marker = "~"
+		}
+		base := lipgloss.NewStyle()
+		suffix := fmt.Sprintf(" (%d/%d selected)", selected, total)
+		switch {
+		case total == 0:
+			base = dimStyle
+			suffix += " [blocked]"
+		case match.Index == m.Cursor:
+			base = selectedStyle
+		}
+		fmt.Fprintf(&b, "%s\n", listRow(fmt.Sprintf("%s [%s] ", cursor, marker), g.Label, suffix, match.Positions, base, m.rowWidth("")))
+	}
+	b.WriteString("\n" + dimStyle.Render(matches.footer(start, len(page), len(groups), " groups")) + "\n")
+	return b.String()
+}
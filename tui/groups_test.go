@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func groupedModel() *Model {
+	m := populatedModel()
+	iam := azure.PolicyDefinitionGroup{Name: "cis_1", DisplayName: "Identity and Access"}
+	net := azure.PolicyDefinitionGroup{Name: "cis_6", DisplayName: "Networking"}
+	m.AssignmentDefinitions = []azure.PolicyDefinitionRef{
+		{PolicyDefinitionID: "/definitions/mfa", ReferenceID: "mfa", DisplayName: "Require MFA", Effect: "Audit", Groups: []azure.PolicyDefinitionGroup{iam}},
+		{PolicyDefinitionID: "/definitions/owners", ReferenceID: "owners", DisplayName: "Limit owners", Effect: "Audit", Groups: []azure.PolicyDefinitionGroup{iam, net}},
+		{PolicyDefinitionID: "/definitions/nsg", ReferenceID: "nsg", DisplayName: "Restrict NSG", Effect: "Deny", Groups: []azure.PolicyDefinitionGroup{net}},
+		{PolicyDefinitionID: "/definitions/misc", ReferenceID: "misc", DisplayName: "Misc"},
+	}
+	m.Step = StepSelectDefinitions
+	m.PartialExemption = true
+	m.Cursor = 0
+	return m
+}
+
+func TestDefinitionGroups(t *testing.T) {
+	m := groupedModel()
+	groups := m.definitionGroups()
+	var labels []string
+	for _, g := range groups {
+		labels = append(labels, g.Label)
+	}
+	if strings.Join(labels, ",") != "Identity and Access,Networking,Ungrouped" {
+		t.Fatalf("group labels = %v", labels)
+	}
+	if len(groups[0].Members) != 2 || len(groups[1].Members) != 2 || len(groups[2].Members) != 1 {
+		t.Fatalf("group members = %#v", groups)
+	}
+
+	m.EffectFilter = "Deny"
+	if groups := m.definitionGroups(); len(groups) != 1 || groups[0].Label != "Networking" || len(groups[0].Members) != 1 {
+		t.Fatalf("filtered groups = %#v", groups)
+	}
+}
+
+func TestGroupedSelection(t *testing.T) {
+	m := groupedModel()
+	press(t, m, tea.KeyCtrlG)
+	if !m.GroupedView || !strings.Contains(m.View(), "Identity and Access (0/2 selected)") {
+		t.Fatalf("grouped view = %q", m.View())
+	}
+
+	press(t, m, tea.KeySpace)
+	if !m.SelectedDefinitionIDs["mfa"] || !m.SelectedDefinitionIDs["owners"] || len(m.SelectedDefinitionIDs) != 2 {
+		t.Fatalf("group selection = %v", m.SelectedDefinitionIDs)
+	}
+	if !strings.Contains(m.View(), "[~] Networking (1/2 selected)") {
+		t.Fatalf("partial group marker missing: %q", m.View())
+	}
+	press(t, m, tea.KeySpace)
+	if len(m.SelectedDefinitionIDs) != 0 {
+		t.Fatal("toggling a fully selected group should deselect it")
+	}
+
+	m.BlockedDefinitionIDs["/definitions/misc"] = true
+	press(t, m, tea.KeyDown)
+	press(t, m, tea.KeyDown)
+	press(t, m, tea.KeySpace)
+	if len(m.SelectedDefinitionIDs) != 0 || !strings.Contains(m.Status, "blocked") {
+		t.Fatal("blocked group was selectable")
+	}
+
+	keyRune(t, m, 'n')
+	keyRune(t, m, 'e')
+	if m.Cursor != 1 {
+		t.Fatalf("group search cursor = %d", m.Cursor)
+	}
+	if cmd := press(t, m, tea.KeyTab); cmd != nil || m.DetailOpen {
+		t.Fatal("details are not available for groups")
+	}
+
+	press(t, m, tea.KeyCtrlG)
+	if m.GroupedView || m.Cursor != 0 || m.DefinitionFilter.Query != "" {
+		t.Fatal("switching back to the list view did not reset the cursor and search")
+	}
+}
+
+func TestBulkSelection(t *testing.T) {
+	m := groupedModel()
+	m.BlockedDefinitionIDs["/definitions/misc"] = true
+	m.SelectedDefinitionIDs["mfa"] = true
+
+	press(t, m, tea.KeyCtrlR)
+	if m.SelectedDefinitionIDs["mfa"] || !m.SelectedDefinitionIDs["owners"] || !m.SelectedDefinitionIDs["nsg"] || m.SelectedDefinitionIDs["misc"] {
+		t.Fatalf("inverted selection = %v", m.SelectedDefinitionIDs)
+	}
+	press(t, m, tea.KeyCtrlN)
+	if len(m.SelectedDefinitionIDs) != 0 {
+		t.Fatalf("select none = %v", m.SelectedDefinitionIDs)
+	}
+	m.EffectFilter = "Audit"
+	press(t, m, tea.KeyCtrlA)
+	if len(m.SelectedDefinitionIDs) != 2 || m.SelectedDefinitionIDs["nsg"] {
+		t.Fatalf("select all should respect the effect filter: %v", m.SelectedDefinitionIDs)
+	}
+}
+
+func TestBulkSelectionInGroupedView(t *testing.T) {
+	m := groupedModel()
+	press(t, m, tea.KeyCtrlG)
+
+	// "net" matches the Networking group but none of the member names.
+	keyRune(t, m, 'n')
+	keyRune(t, m, 'e')
+	keyRune(t, m, 't')
+	press(t, m, tea.KeyCtrlA)
+	if len(m.SelectedDefinitionIDs) != 2 || !m.SelectedDefinitionIDs["owners"] || !m.SelectedDefinitionIDs["nsg"] {
+		t.Fatalf("select all of listed groups = %v", m.SelectedDefinitionIDs)
+	}
+
+	// A member of several listed groups is inverted once.
+	m.DefinitionFilter.Reset()
+	press(t, m, tea.KeyCtrlR)
+	if len(m.SelectedDefinitionIDs) != 2 || !m.SelectedDefinitionIDs["mfa"] || !m.SelectedDefinitionIDs["misc"] {
+		t.Fatalf("inverted selection of all groups = %v", m.SelectedDefinitionIDs)
+	}
+}
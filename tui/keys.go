@@ -0,0 +1,313 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// KeyMap holds the key bindings of the wizard. Text entry (the ticket,
+// requester and date inputs and the search of the list steps) takes the
+// printable keys, so bindings to single characters such as Quit's q only
+// work in the other steps.
+type KeyMap struct {
+	Up              key.Binding
+	Down            key.Binding
+	PageUp          key.Binding
+	PageDown        key.Binding
+	Home            key.Binding
+	End             key.Binding
+	Select          key.Binding
+	Toggle          key.Binding
+	Back            key.Binding
+	Search          key.Binding
+	ClearSearch     key.Binding
+	Details         key.Binding
+	EffectFilter    key.Binding
+	OriginFilter    key.Binding
+	GroupedView     key.Binding
+	SelectAll       key.Binding
+	SelectNone      key.Binding
+	InvertSelection key.Binding
+	Cancel          key.Binding
+	Generate        key.Binding
+	Retry           key.Binding
+	CopyError       key.Binding
+	Help            key.Binding
+	Quit            key.Binding
+	ForceQuit       key.Binding
+}
+
+// DefaultKeyMap returns the default key bindings.
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Up:              newBinding("move up", "up", "k"),
+		Down:            newBinding("move down", "down", "j"),
+		PageUp:          newBinding("page up", "pgup"),
+		PageDown:        newBinding("page down", "pgdown"),
+		Home:            newBinding("go to first", "home"),
+		End:             newBinding("go to last", "end"),
+		Select:          newBinding("select / continue", "enter"),
+		Toggle:          newBinding("toggle selection", " "),
+		Back:            newBinding("go back", "backspace"),
+		Search:          newBinding("search", "/"),
+		ClearSearch:     newBinding("clear search", "esc"),
+		Details:         newBinding("show details", "tab"),
+		EffectFilter:    newBinding("filter by effect", "ctrl+e"),
+		OriginFilter:    newBinding("filter by assigning scope", "ctrl+o"),
+		GroupedView:     newBinding("grouped / list view", "ctrl+g"),
+		SelectAll:       newBinding("select all", "ctrl+a"),
+		SelectNone:      newBinding("select none", "ctrl+n"),
+		InvertSelection: newBinding("invert selection", "ctrl+r"),
+		Cancel:          newBinding("cancel loading", "esc"),
+		Generate:        newBinding("generate infrastructure code", "g"),
+		Retry:           newBinding("retry after an error", "r"),
+		CopyError:       newBinding("copy the error", "c"),
+		Help:            newBinding("toggle help", "?", "f1"),
+		Quit:            newBinding("quit", "q"),
+		ForceQuit:       newBinding("quit, also while typing", "ctrl+c"),
+	}
+}
+
+// NewKeyMap returns the default key bindings with the keys of the named
+// actions replaced, as configured in config.Config.KeyBindings. Action
+// names are the snake_case field names, e.g. "select_all".
+func NewKeyMap(overrides map[string][]string) (KeyMap, error) {
+	km := DefaultKeyMap()
+	actions := km.actions()
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		binding, ok := actions[name]
+		if !ok {
+			return km, fmt.Errorf("unknown key binding action %q", name)
+		}
+		var keys []string
+		for _, k := range overrides[name] {
+			if k = strings.ToLower(strings.TrimSpace(k)); k == "space" {
+				k = " "
+			}
+			if k != "" {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			return km, fmt.Errorf("no keys given for key binding action %q", name)
+		}
+		binding.SetKeys(keys...)
+		binding.SetHelp(keysLabel(keys), binding.Help().Desc)
+	}
+	return km, nil
+}
+
+// actions returns the bindings by their configuration name.
+func (k *KeyMap) actions() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"up":               &k.Up,
+		"down":             &k.Down,
+		"page_up":          &k.PageUp,
+		"page_down":        &k.PageDown,
+		"home":             &k.Home,
+		"end":              &k.End,
+		"select":           &k.Select,
+		"toggle":           &k.Toggle,
+		"back":             &k.Back,
+		"search":           &k.Search,
+		"clear_search":     &k.ClearSearch,
+		"details":          &k.Details,
+		"effect_filter":    &k.EffectFilter,
+		"origin_filter":    &k.OriginFilter,
+		"grouped_view":     &k.GroupedView,
+		"select_all":       &k.SelectAll,
+		"select_none":      &k.SelectNone,
+		"invert_selection": &k.InvertSelection,
+		"cancel":           &k.Cancel,
+		"generate":         &k.Generate,
+		"retry":            &k.Retry,
+		"copy_error":       &k.CopyError,
+		"help":             &k.Help,
+		"quit":             &k.Quit,
+		"force_quit":       &k.ForceQuit,
+	}
+}
+
+// isText reports whether msg is a printable key that text entry takes.
+func isText(msg tea.KeyMsg) bool {
+	return msg.Type == tea.KeyRunes && !msg.Alt
+}
+
+// commandKeys returns the keys of b that are not printable characters and
+// so work while text entry has the keys.
+func commandKeys(b key.Binding) []string {
+	var keys []string
+	for _, k := range b.Keys() {
+		if len([]rune(k)) > 1 {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func newBinding(desc string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keysLabel(keys), desc))
+}
+
+// keyNames are the display names of special keys.
+var keyNames = map[string]string{
+	"up":        "↑",
+	"down":      "↓",
+	"left":      "←",
+	"right":     "→",
+	"enter":     "Enter",
+	"backspace": "Backspace",
+	"esc":       "Esc",
+	"tab":       "Tab",
+	" ":         "Space",
+	"pgup":      "PgUp",
+	"pgdown":    "PgDn",
+	"home":      "Home",
+	"end":       "End",
+	"f1":        "F1",
+}
+
+// keyLabel returns the display name of a key, e.g. "Ctrl+E" for "ctrl+e".
+func keyLabel(k string) string {
+	if name, ok := keyNames[k]; ok {
+		return name
+	}
+	for _, mod := range []string{"ctrl+", "alt+", "shift+"} {
+		if rest, ok := strings.CutPrefix(k, mod); ok {
+			label := keyLabel(rest)
+			if len(rest) == 1 {
+				label = strings.ToUpper(rest)
+			}
+			return strings.ToUpper(mod[:1]) + mod[1:] + label
+		}
+	}
+	return k
+}
+
+func keysLabel(keys []string) string {
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		labels[i] = keyLabel(k)
+	}
+	return strings.Join(labels, "/")
+}
+
+// keyHint formats a hint for the first key of a binding.
+func keyHint(b key.Binding, action string) string {
+	keys := b.Keys()
+	if len(keys) == 0 {
+		return ""
+	}
+	return formatHint(keyLabel(keys[0]), action)
+}
+
+// navHint formats the hint for moving through a list.
+func (m *Model) navHint() string {
+	up, down := m.Keys.Up.Keys(), m.Keys.Down.Keys()
+	if len(up) == 0 || len(down) == 0 {
+		return ""
+	}
+	return formatHint(keyLabel(up[0])+"/"+keyLabel(down[0]), "move")
+}
+
+// searchHint formats the hint for starting a search, e.g. "by name or ID".
+func (m *Model) searchHint(by string) string {
+	action := "to search"
+	if by != "" {
+		action += " " + by
+	}
+	return actionStyle.Render("type") + " or " + keyHint(m.Keys.Search, action)
+}
+
+// searchingHint formats the hints shown while a search has focus.
+func (m *Model) searchingHint() string {
+	return formatHint("Type", "to search") + ", " + m.navHint() + ", " + formatHint("Enter", "apply") + ", " + formatHint("Esc", "clear") + "\n"
+}
+
+// quitHint tells how to quit and open the help overlay. While typing,
+// only the keys that are not printable characters work.
+func (m *Model) quitHint() string {
+	if m.inputFocused() {
+		quit := append(commandKeys(m.Keys.Quit), m.Keys.ForceQuit.Keys()...)
+		hint := "Press " + keyStyle.Render(keysLabel(quit)) + " to quit at any time"
+		if keys := commandKeys(m.Keys.Help); len(keys) > 0 {
+			hint += ", " + keyStyle.Render(keysLabel(keys)) + " for help"
+		}
+		return hint + "."
+	}
+	return "Press " + keyStyle.Render(keysLabel(m.Keys.Quit.Keys())) + " to quit at any time, " + keyStyle.Render(keysLabel(m.Keys.Help.Keys())) + " for help."
+}
+
+// inputFocused reports whether printable keys go to a text input or the
+// search of a list, so that they must not trigger actions such as quitting.
+func (m *Model) inputFocused() bool {
+	switch m.Step {
+	case StepTicket, StepUsers, StepExpirationDate:
+		return true
+	}
+	return m.activeFilter() != nil
+}
+
+// helpGroups returns the bindings available in the current step, grouped
+// into columns for the help overlay.
+func (m *Model) helpGroups() [][]key.Binding {
+	k := m.Keys
+	general := []key.Binding{k.Help, k.Quit, k.ForceQuit}
+	paging := []key.Binding{k.PageUp, k.PageDown, k.Home, k.End}
+	switch m.Step {
+	case StepSelectSubscription:
+		if m.TreeView {
+			return [][]key.Binding{{k.Up, k.Down, k.Toggle, k.Select}, paging, {k.Search, k.ClearSearch, k.GroupedView}, general}
+		}
+		return [][]key.Binding{{k.Up, k.Down, k.Select}, paging, {k.Search, k.ClearSearch, k.GroupedView}, general}
+	case StepSelectAssignment:
+		return [][]key.Binding{{k.Up, k.Down, k.Select, k.Back}, paging, {k.Search, k.ClearSearch, k.Details, k.OriginFilter}, general}
+	case StepSelectDefinitions:
+		return [][]key.Binding{
+			{k.Up, k.Down, k.Toggle, k.Select, k.Back},
+			paging,
+			{k.Search, k.ClearSearch, k.Details, k.EffectFilter, k.GroupedView},
+			{k.SelectAll, k.SelectNone, k.InvertSelection},
+			general,
+		}
+	case StepSelectResourceGroup:
+		return [][]key.Binding{{k.Up, k.Down, k.Select, k.Back}, paging, {k.Search, k.ClearSearch}, general}
+	case StepSelectSelectors:
+		return [][]key.Binding{{k.Up, k.Down, k.Toggle, k.Select, k.Back}, paging, general}
+	case StepAssignmentScope, StepSelectorsChoice, StepExpirationChoice:
+		return [][]key.Binding{{k.Up, k.Down, k.Select, k.Back}, general}
+	case StepConfirm:
+		return [][]key.Binding{{k.Select, k.Generate, k.Back}, general}
+	case StepGenerate:
+		return [][]key.Binding{{k.Up, k.Down, k.Select, k.Back}, general}
+	case StepError:
+		return [][]key.Binding{{k.Retry, k.Back, k.CopyError}, general}
+	}
+	if isLoading(m.Step) {
+		return [][]key.Binding{{k.Cancel}, general}
+	}
+	return [][]key.Binding{general}
+}
+
+// helpView renders the help overlay.
+func (m *Model) helpView() string {
+	h := help.New()
+	h.Styles.FullKey = keyStyle
+	h.Styles.FullDesc = dimStyle
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Keyboard shortcuts") + "\n\n")
+	b.WriteString(h.FullHelpView(m.helpGroups()) + "\n\n")
+	b.WriteString(dimStyle.Render("In inputs and searchable lists, printable keys are entered as text; "+keysLabel(m.Keys.ForceQuit.Keys())+" quits.") + "\n")
+	b.WriteString("\n" + formatHint("Any key", "close help") + "\n")
+	return b.String()
+}
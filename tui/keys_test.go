@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// isQuit reports whether cmd is tea.Quit without running it, as other
+// commands such as the cursor blink would block.
+func isQuit(cmd tea.Cmd) bool {
+	return cmd != nil && reflect.ValueOf(cmd).Pointer() == reflect.ValueOf(tea.Quit).Pointer()
+}
+
+func TestQuitIsTypedWhileInputFocused(t *testing.T) {
+	m := populatedModel()
+	m.startTicket()
+	for _, r := range "q?" {
+		if cmd := keyRune(t, m, r); isQuit(cmd) {
+			t.Fatalf("%q quit while typing a ticket", r)
+		}
+	}
+	if got := m.TicketInput.Value(); got != "q?" || m.ShowHelp {
+		t.Fatalf("ticket input = %q, help %v", got, m.ShowHelp)
+	}
+	if !strings.Contains(m.View(), "Ctrl+C") {
+		t.Fatal("view does not tell how to quit while typing")
+	}
+	if !isQuit(updateWith(t, m, tea.KeyMsg{Type: tea.KeyCtrlC})) {
+		t.Fatal("ctrl+c did not quit while typing")
+	}
+}
+
+func TestSearchFocus(t *testing.T) {
+	m := populatedModel()
+	m.Step = StepSelectAssignment
+
+	keyRune(t, m, '/')
+	if !m.AssignmentFilter.Focused || m.AssignmentFilter.Query != "" {
+		t.Fatalf("/ did not focus the search: %+v", m.AssignmentFilter)
+	}
+	for _, r := range "sq" {
+		if cmd := keyRune(t, m, r); isQuit(cmd) {
+			t.Fatal("q quit while searching")
+		}
+	}
+	if m.AssignmentFilter.Query != "sq" {
+		t.Fatalf("search query = %q", m.AssignmentFilter.Query)
+	}
+
+	// Enter applies the search and returns the keys to the list.
+	press(t, m, tea.KeyBackspace)
+	press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepSelectAssignment)
+	if m.AssignmentFilter.Focused || m.AssignmentFilter.Query != "s" {
+		t.Fatalf("enter did not apply the search: %+v", m.AssignmentFilter)
+	}
+	if !strings.Contains(m.View(), "Ctrl+C") {
+		t.Fatal("view does not tell how to quit in a searchable list")
+	}
+	if !isQuit(updateWith(t, m, tea.KeyMsg{Type: tea.KeyCtrlC})) {
+		t.Fatal("ctrl+c did not quit in a searchable list")
+	}
+}
+
+func TestBoundKeysStartSearch(t *testing.T) {
+	m := populatedModel()
+	m.Step = StepSelectAssignment
+	m.Cursor = 0
+
+	// q, j, k and ? are bound, but an empty search takes them first.
+	for _, r := range "qjk?" {
+		if cmd := keyRune(t, m, r); isQuit(cmd) || m.ShowHelp {
+			t.Fatalf("%q was not typed into the search", r)
+		}
+	}
+	if !m.AssignmentFilter.Focused || m.AssignmentFilter.Query != "qjk?" {
+		t.Fatalf("search = %+v", m.AssignmentFilter)
+	}
+
+	// Outside the list steps the bindings still apply.
+	m.Step = StepConfirm
+	if !isQuit(keyRune(t, m, 'q')) {
+		t.Fatal("q did not quit outside a list")
+	}
+}
+
+func TestHelpOverlay(t *testing.T) {
+	m := populatedModel()
+	m.Step = StepSelectDefinitions
+
+	press(t, m, tea.KeyF1)
+	if !m.ShowHelp {
+		t.Fatal("F1 did not open the help")
+	}
+	view := m.View()
+	for _, want := range []string{"Keyboard shortcuts", "Ctrl+E", "filter by effect", "Ctrl+A", "select all", "toggle help"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("help view missing %q:\n%s", want, view)
+		}
+	}
+	if isQuit(keyRune(t, m, 'q')) || m.ShowHelp {
+		t.Fatal("a key did not just close the help")
+	}
+	assertStep(t, m, StepSelectDefinitions)
+
+	m.Step = StepConfirm
+	keyRune(t, m, '?')
+	if !m.ShowHelp {
+		t.Fatal("? did not open the help")
+	}
+}
+
+func TestNewKeyMap(t *testing.T) {
+	km, err := NewKeyMap(map[string][]string{"quit": {"ctrl+q"}, "toggle": {"space", "x"}})
+	if err != nil {
+		t.Fatalf("NewKeyMap() error = %v", err)
+	}
+	if got := km.Quit.Keys(); len(got) != 1 || got[0] != "ctrl+q" || km.Quit.Help().Key != "Ctrl+Q" {
+		t.Fatalf("quit binding = %v, %q", got, km.Quit.Help().Key)
+	}
+	if got := km.Toggle.Keys(); len(got) != 2 || got[0] != " " {
+		t.Fatalf("toggle binding = %q", got)
+	}
+	if got := km.Select.Keys(); len(got) != 1 || got[0] != "enter" {
+		t.Fatalf("select binding changed to %q", got)
+	}
+
+	m := populatedModel()
+	m.Keys = km
+	m.Step = StepSelectSubscription
+	if !isQuit(updateWith(t, m, tea.KeyMsg{Type: tea.KeyCtrlQ})) {
+		t.Fatal("rebound quit key did not quit")
+	}
+	if !strings.Contains(m.View(), "Ctrl+Q") {
+		t.Fatal("view does not show the rebound quit key")
+	}
+
+	for name, overrides := range map[string]map[string][]string{
+		"unknown action": {"launch": {"l"}},
+		"no keys":        {"quit": {" "}},
+	} {
+		if _, err := NewKeyMap(overrides); err == nil {
+			t.Errorf("NewKeyMap(%s) error = nil", name)
+		}
+	}
+}
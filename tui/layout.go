@@ -0,0 +1,183 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Layout sizes in terminal cells. Until the terminal size is known, lists
+// show defaultListHeight rows and lines are not truncated.
+const (
+	defaultListHeight = 15
+	minListHeight     = 3
+
+	// listChrome is the number of lines around a list: title, heading,
+	// footer, search, hints, status and quit hint.
+	listChrome = 16
+
+	// detailChrome is the number of lines around the detail pane.
+	detailChrome = 6
+
+	// minLabelWidth is kept for a list label before its suffix is cut.
+	minLabelWidth = 12
+
+	// twoPaneMinWidth is the terminal width from which the current
+	// selections are shown in a pane next to the list.
+	twoPaneMinWidth = 120
+	sidePaneWidth   = 44
+	paneGap         = 2
+)
+
+// sidePaneStyle separates the selections pane from the list.
+var sidePaneStyle = lipgloss.NewStyle().
+	Border(lipgloss.NormalBorder(), false, false, false, true).
+	BorderForeground(lipgloss.Color("240")).
+	PaddingLeft(1)
+
+// resize fits the lists and the detail pane to a new terminal size.
+func (m *Model) resize(width, height int) {
+	m.Width, m.Height = width, height
+	m.DetailView.Width = max(width, minLabelWidth)
+	m.DetailView.Height = max(height-detailChrome, minListHeight)
+}
+
+// listHeight returns the number of list rows that fit the terminal.
+func (m *Model) listHeight() int {
+	if m.Height == 0 {
+		return defaultListHeight
+	}
+	return max(m.Height-listChrome, minListHeight)
+}
+
+// twoPane reports whether the current step is shown next to the selections
+// pane. The confirmation and result screens already list everything.
+func (m *Model) twoPane() bool {
+	if m.Width < twoPaneMinWidth {
+		return false
+	}
+	switch m.Step {
+	case StepLoadingSubscriptions, StepConfirm, StepGenerate, StepCreating, StepDone, StepError:
+		return false
+	}
+	return true
+}
+
+// mainWidth returns the width available to the step view, or 0 while the
+// terminal size is unknown.
+func (m *Model) mainWidth() int {
+	if m.twoPane() {
+		return m.Width - sidePaneWidth - 1 - paneGap // 1 for the border
+	}
+	return m.Width
+}
+
+// rowWidth returns the width available to a list row followed by extra,
+// or 0 while the terminal size is unknown.
+func (m *Model) rowWidth(extra string) int {
+	if m.Width == 0 {
+		return 0
+	}
+	return max(m.mainWidth()-lipgloss.Width(extra), 1)
+}
+
+// truncate shortens s to width cells, ending it with an ellipsis if it was
+// cut.
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	return ansi.Truncate(s, width, "…")
+}
+
+// withSidePane renders the step view on the left and the selections pane
+// on the right.
+func (m *Model) withSidePane(main string) string {
+	left := lipgloss.NewStyle().Width(m.mainWidth()).MarginRight(paneGap).Render(strings.TrimSuffix(main, "\n"))
+	right := sidePaneStyle.Width(sidePaneWidth).Render(strings.TrimSuffix(m.sidePane(), "\n"))
+	return lipgloss.JoinHorizontal(lipgloss.Top, left, right) + "\n"
+}
+
+// sidePane lists the choices made so far and the highlighted list item.
+func (m *Model) sidePane() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Selections") + "\n\n")
+	var sub, assign, definitions, scope, resources string
+	if m.SelectedSubscription >= 0 && m.SelectedSubscription < len(m.Subscriptions) {
+		sub = m.Subscriptions[m.SelectedSubscription].Name
+	}
+	if m.SelectedAssignment >= 0 && m.SelectedAssignment < len(m.Assignments) {
+		assign = m.Assignments[m.SelectedAssignment].DisplayLabel()
+	}
+	// Steps are declared in wizard order.
+	switch {
+	case m.PartialExemption:
+		definitions = fmt.Sprintf("%d selected", len(m.SelectedDefinitionIDs))
+	case m.Step > StepSelectDefinitions:
+		definitions = "Entire assignment"
+	}
+	if m.SelectedResourceGroup >= 0 && m.SelectedResourceGroup < len(m.ResourceGroups) {
+		scope = m.ResourceGroups[m.SelectedResourceGroup].Name
+	}
+	if m.Step >= StepTicket || len(m.SelectedSelectors) > 0 {
+		resources = m.resourceSelectors().String()
+	}
+	if m.ManagementGroup != nil {
+		writeField(&b, "Management group", m.ManagementGroup.Label())
+	} else {
+		writeField(&b, "Subscription", sub)
+	}
+	writeField(&b, "Assignment", assign)
+	writeField(&b, "Definitions", definitions)
+	writeField(&b, "Scope", scope)
+	writeField(&b, "Resources", resources)
+	writeField(&b, "Ticket", m.Ticket)
+	writeField(&b, "Requesters", m.RequestUser)
+	m.writeHighlighted(&b)
+	return b.String()
+}
+
+// writeHighlighted describes the item under the cursor of a list step,
+// including its description if the details were loaded before.
+func (m *Model) writeHighlighted(b *strings.Builder) {
+	if !m.currentMatches().Contains(m.Cursor) {
+		return
+	}
+	var name, id, effect, description string
+	switch m.Step {
+	case StepSelectSubscription:
+		if m.TreeView {
+			entity := m.Hierarchy[m.Cursor].Entity
+			name, id = entity.Label(), entity.ID
+			break
+		}
+		sub := m.Subscriptions[m.Cursor]
+		name, id = sub.Name, sub.ID
+	case StepSelectAssignment:
+		assign := m.Assignments[m.Cursor]
+		name, id = assign.DisplayLabel(), assign.ID
+		description = m.AssignmentDetails[strings.ToLower(assign.ID)].Description
+	case StepSelectDefinitions:
+		if m.GroupedView {
+			return
+		}
+		ref := m.AssignmentDefinitions[m.Cursor]
+		name, id, effect = ref.DisplayName, ref.ReferenceID, effectLabel(ref.Effect)
+		description = m.DefinitionDetails[strings.ToLower(ref.PolicyDefinitionID)].Description
+	case StepSelectResourceGroup:
+		rg := m.ResourceGroups[m.Cursor]
+		name, id = rg.Name, rg.ID
+	default:
+		return
+	}
+	b.WriteString("\n" + titleStyle.Render("Highlighted") + "\n\n")
+	b.WriteString(name + "\n" + dimStyle.Render(id) + "\n")
+	if effect != "" {
+		writeField(b, "Effect", effect)
+	}
+	if description != "" {
+		b.WriteString("\n" + description + "\n")
+	}
+}
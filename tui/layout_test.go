@@ -0,0 +1,141 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func manySubscriptions(m *Model, n int) {
+	m.Subscriptions = nil
+	for i := range n {
+		m.Subscriptions = append(m.Subscriptions, azure.Subscription{ID: fmt.Sprintf("sub-%02d", i), Name: fmt.Sprintf("Subscription %02d", i)})
+	}
+	m.Step = StepSelectSubscription
+	m.SelectedSubscription = -1
+	m.Cursor = 0
+}
+
+func TestListHeightFollowsWindow(t *testing.T) {
+	m := populatedModel()
+	manySubscriptions(m, 40)
+	if !strings.Contains(m.View(), fmt.Sprintf("Showing 1-%d of 40", defaultListHeight)) {
+		t.Fatal("list without window size does not use the default height")
+	}
+
+	updateWith(t, m, tea.WindowSizeMsg{Width: 80, Height: listChrome + 5})
+	if !strings.Contains(m.View(), "Showing 1-5 of 40") {
+		t.Fatalf("list does not fit the window:\n%s", m.View())
+	}
+	updateWith(t, m, tea.WindowSizeMsg{Width: 80, Height: 4})
+	if !strings.Contains(m.View(), fmt.Sprintf("Showing 1-%d of 40", minListHeight)) {
+		t.Fatal("list is not kept at its minimum height")
+	}
+	if m.DetailView.Width != 80 || m.DetailView.Height != minListHeight {
+		t.Fatalf("detail view size = %dx%d", m.DetailView.Width, m.DetailView.Height)
+	}
+}
+
+func TestPageNavigation(t *testing.T) {
+	m := populatedModel()
+	manySubscriptions(m, 40)
+	updateWith(t, m, tea.WindowSizeMsg{Width: 80, Height: listChrome + 10})
+
+	press(t, m, tea.KeyPgDown)
+	if m.Cursor != 10 {
+		t.Fatalf("PgDn cursor = %d, want 10", m.Cursor)
+	}
+	press(t, m, tea.KeyPgUp)
+	press(t, m, tea.KeyPgUp)
+	if m.Cursor != 0 {
+		t.Fatalf("PgUp cursor = %d, want 0", m.Cursor)
+	}
+	press(t, m, tea.KeyEnd)
+	if m.Cursor != 39 {
+		t.Fatalf("End cursor = %d, want 39", m.Cursor)
+	}
+	press(t, m, tea.KeyHome)
+	if m.Cursor != 0 {
+		t.Fatalf("Home cursor = %d, want 0", m.Cursor)
+	}
+
+	// Paging stays within the search results.
+	for _, r := range "subscription 1" {
+		keyRune(t, m, r)
+	}
+	matches := m.subscriptionMatches()
+	press(t, m, tea.KeyEnd)
+	if want := matches[len(matches)-1].Index; m.Cursor != want {
+		t.Fatalf("End in search cursor = %d, want %d", m.Cursor, want)
+	}
+}
+
+func TestLongLabelsAreTruncated(t *testing.T) {
+	m := populatedModel()
+	m.Step = StepSelectAssignment
+	m.Assignments[0].DisplayName = strings.Repeat("Very long assignment name ", 10)
+	updateWith(t, m, tea.WindowSizeMsg{Width: 60, Height: 40})
+
+	view := m.View()
+	if !strings.Contains(view, "…") {
+		t.Fatalf("long assignment name was not truncated:\n%s", view)
+	}
+	for _, line := range strings.Split(view, "\n") {
+		if strings.HasPrefix(line, "> ") && lipgloss.Width(line) > 60 {
+			t.Fatalf("list row is %d cells wide: %q", lipgloss.Width(line), line)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"much too long", 8, "much to…"},
+		{"日本語のラベル", 7, "日本語…"},
+		{"anything", 0, ""},
+	} {
+		if got := truncate(tc.in, tc.width); got != tc.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tc.in, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestTwoPaneLayout(t *testing.T) {
+	m := populatedModel()
+	m.Step = StepSelectAssignment
+	m.Cursor = 0
+	m.SelectedSubscription = 0
+	m.SelectedAssignment = -1
+
+	updateWith(t, m, tea.WindowSizeMsg{Width: twoPaneMinWidth - 1, Height: 40})
+	if strings.Contains(m.View(), "Selections") {
+		t.Fatal("narrow terminal shows the selections pane")
+	}
+
+	updateWith(t, m, tea.WindowSizeMsg{Width: twoPaneMinWidth, Height: 40})
+	view := m.View()
+	for _, want := range []string{"Selections", "Subscription: Sub", "Highlighted", "/assignments/a"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("two-pane view missing %q:\n%s", want, view)
+		}
+	}
+	for _, line := range strings.Split(view, "\n") {
+		if w := lipgloss.Width(line); w > twoPaneMinWidth {
+			t.Fatalf("line is %d cells wide: %q", w, line)
+		}
+	}
+
+	m.Step = StepConfirm
+	if strings.Contains(m.View(), "Highlighted") {
+		t.Fatal("confirmation shows the selections pane")
+	}
+}
@@ -0,0 +1,110 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// errLoadCancelled is shown when the first load is cancelled, as there is
+// no previous step to return to.
+var errLoadCancelled = errors.New("cancelled while waiting for the Azure CLI")
+
+// loadResultMsg carries the result of the load identified by seq.
+type loadResultMsg struct {
+	seq int
+	msg tea.Msg
+}
+
+func newSpinner() spinner.Model {
+	return spinner.New(spinner.WithSpinner(spinner.Dot), spinner.WithStyle(loadingStyle))
+}
+
+// isLoading reports whether step waits for an az command.
+func isLoading(step Step) bool {
+	switch step {
+	case StepLoadingSubscriptions, StepLoadingHierarchy, StepLoadingAssignments, StepLoadingAssignmentDefinitions,
+		StepLoadingResourceGroups, StepLoadingResourceFacets, StepCheckingPermission, StepCreating:
+		return true
+	}
+	return false
+}
+
+// load enters a loading step and starts the command returned by start with
+// a context that is cancelled when the user cancels the load. It remembers
+// start and the step the load was started from, so that a failure can be
+// retried or left by going back. Loads started by another load or by a
+// retry keep the step of the first.
+func (m *Model) load(step Step, start func(context.Context) tea.Cmd) tea.Cmd {
+	if !isLoading(m.Step) && m.Step != StepError {
+		m.loadFrom = m.Step
+	}
+	m.stopLoad()
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.cancelLoad = cancel
+	m.loadSeq++
+	m.Step = step
+	m.Status = "" // Loading state shown in view
+	m.lastLoad = start
+	m.LoadStarted = time.Now()
+	// A new spinner ends the tick loop of the previous one.
+	m.Spinner = newSpinner()
+
+	seq, cmd := m.loadSeq, start(ctx)
+	return tea.Batch(func() tea.Msg {
+		return loadResultMsg{seq: seq, msg: cmd()}
+	}, m.Spinner.Tick)
+}
+
+// stopLoad releases the context of the running load, if any.
+func (m *Model) stopLoad() {
+	if m.cancelLoad != nil {
+		m.cancelLoad()
+		m.cancelLoad = nil
+	}
+}
+
+// finishLoad handles the result of a load. Results of cancelled or
+// replaced loads are dropped.
+func (m *Model) finishLoad(msg loadResultMsg) (tea.Model, tea.Cmd) {
+	if msg.seq != m.loadSeq || !isLoading(m.Step) {
+		return m, nil
+	}
+	if page, ok := msg.msg.(assignmentsLoadedMsg); ok && page.more != nil {
+		// The later pages keep arriving with the context of the load.
+		m.stopStream()
+		m.cancelStream, m.cancelLoad = m.cancelLoad, nil
+	}
+	m.stopLoad()
+	// Update, which handles the loadResultMsg, logs the step transition.
+	return m.update(msg.msg)
+}
+
+// cancel cancels the running load and returns to the step it was started
+// from. Cancelling the first load shows an error from where it can be
+// retried.
+func (m *Model) cancel() {
+	m.stopLoad()
+	m.loadSeq++
+	if isLoading(m.loadFrom) {
+		m.Fail(errLoadCancelled)
+		return
+	}
+	step := m.Step
+	m.Step = m.loadFrom
+	m.Status = "Cancelled."
+	if step == StepCreating {
+		m.Status = "Cancelled. The Azure CLI may have completed the request; check before trying again."
+	}
+}
+
+// loadingView renders the spinner with the elapsed time of the load.
+func (m *Model) loadingView(text string) string {
+	elapsed := time.Since(m.LoadStarted).Truncate(time.Second)
+	return m.Spinner.View() + " " + loadingStyle.Render(text) + dimStyle.Render(fmt.Sprintf(" (%s)", elapsed)) + "\n\n" +
+		keyHint(m.Keys.Cancel, "cancel") + "\n"
+}
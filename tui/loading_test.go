@@ -0,0 +1,95 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// blockingClient blocks loading initiative members until the context is
+// cancelled.
+type blockingClient struct {
+	*fakeAzureClient
+}
+
+func (c blockingClient) ListAssignmentDefinitions(ctx context.Context, _ azure.PolicyAssignment) ([]azure.PolicyDefinitionRef, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// loadCmd returns the load command of a batch started by Model.load.
+func loadCmd(t *testing.T, cmd tea.Cmd) tea.Cmd {
+	t.Helper()
+	batch, ok := cmd().(tea.BatchMsg)
+	if !ok || len(batch) == 0 {
+		t.Fatal("command is not a load batch")
+	}
+	return batch[0]
+}
+
+func TestCancelLoad(t *testing.T) {
+	m := populatedModel()
+	m.azureClient = blockingClient{&fakeAzureClient{}}
+	m.Step = StepSelectAssignment
+	m.SelectedAssignment = -1
+	m.Cursor = 0
+
+	load := loadCmd(t, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepLoadingAssignmentDefinitions)
+	if view := m.View(); !strings.Contains(view, "Loading assignment details...") || !strings.Contains(view, "Esc cancel") || !strings.Contains(view, "(0s)") {
+		t.Fatalf("loading view:\n%s", view)
+	}
+
+	result := make(chan tea.Msg)
+	go func() { result <- load() }()
+	press(t, m, tea.KeyEsc)
+	assertStep(t, m, StepSelectAssignment)
+	if m.Status != "Cancelled." || m.SelectedAssignment != 0 {
+		t.Fatalf("status %q, selected assignment %d", m.Status, m.SelectedAssignment)
+	}
+
+	// The cancelled az call returns and its result is dropped.
+	msg := (<-result).(loadResultMsg)
+	if inner := msg.msg.(assignmentDefinitionsLoadedMsg); !errors.Is(inner.err, context.Canceled) {
+		t.Fatalf("cancelled load error = %v", inner.err)
+	}
+	updateWith(t, m, msg)
+	assertStep(t, m, StepSelectAssignment)
+}
+
+func TestCancelFirstLoad(t *testing.T) {
+	client := &fakeAzureClient{subscriptions: []azure.Subscription{{ID: "sub", Name: "Sub"}}}
+	m := NewModel(context.Background(), client, nil)
+	batch := m.Init()().(tea.BatchMsg)
+	load := loadCmd(t, batch[0])
+	press(t, m, tea.KeyEsc)
+	assertStep(t, m, StepError)
+	if !errors.Is(m.Err, errLoadCancelled) {
+		t.Fatalf("error = %v", m.Err)
+	}
+	updateWith(t, m, load())
+	assertStep(t, m, StepError)
+
+	runCmd(t, m, keyRune(t, m, 'r'))
+	assertStep(t, m, StepSelectSubscription)
+}
+
+func TestSpinnerTicksWhileLoading(t *testing.T) {
+	m := populatedModel()
+	m.azureClient.(*fakeAzureClient).assignments = m.Assignments
+	m.Step = StepSelectSubscription
+	cmd := press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepLoadingAssignments)
+	if next := updateWith(t, m, m.Spinner.Tick()); next == nil {
+		t.Fatal("spinner stopped while loading")
+	}
+	runCmd(t, m, cmd)
+	assertStep(t, m, StepSelectAssignment)
+	if next := updateWith(t, m, m.Spinner.Tick()); next != nil {
+		t.Fatal("spinner kept ticking after loading")
+	}
+}
@@ -2,28 +2,39 @@ package tui
 
 import (
 	"context"
-	"sort"
+	"strings"
 
 	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/bundle"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-type azureClient interface {
-	ListSubscriptions(context.Context) ([]azure.Subscription, error)
-	ListAssignments(context.Context, string) ([]azure.PolicyAssignment, error)
-	ListAssignmentDefinitions(context.Context, azure.PolicyAssignment) ([]azure.PolicyDefinitionRef, error)
-	ListResourceGroups(context.Context, string) ([]azure.ResourceGroup, error)
-	CreateExemption(context.Context, string, string, string, azure.PolicyAssignment, []string, string, string, string) (string, error)
-}
-
 type subscriptionsLoadedMsg struct {
 	subscriptions []azure.Subscription
 	err           error
 }
 
+type identityLoadedMsg struct {
+	principal azure.Principal
+	err       error
+}
+
+type cloudLoadedMsg struct {
+	cloud azure.Cloud
+	err   error
+}
+
+type hierarchyLoadedMsg struct {
+	entities []azure.ManagementEntity
+	err      error
+}
+
 type assignmentsLoadedMsg struct {
 	assignments []azure.PolicyAssignment
 	err         error
+	// more receives the next page of streamed assignments; it is nil once
+	// all pages arrived.
+	more tea.Cmd
 }
 
 type assignmentDefinitionsLoadedMsg struct {
@@ -36,47 +47,220 @@ type resourceGroupsLoadedMsg struct {
 	err            error
 }
 
+type resourceFacetsLoadedMsg struct {
+	scope  string
+	facets azure.ResourceFacets
+	err    error
+}
+
+type complianceLoadedMsg struct {
+	scope   string
+	summary azure.ComplianceSummary
+	err     error
+}
+
+// scopeComplianceLoadedMsg carries the count of the confirmation
+// identified by seq.
+type scopeComplianceLoadedMsg struct {
+	seq   int
+	count int
+	err   error
+}
+
+type assignmentDetailsLoadedMsg struct {
+	key     string
+	details azure.AssignmentDetails
+	err     error
+}
+
+type definitionDetailsLoadedMsg struct {
+	key     string
+	details azure.DefinitionDetails
+	err     error
+}
+
+type permissionsLoadedMsg struct {
+	seq     int
+	scopes  []string
+	allowed map[string]bool
+	err     error
+}
+
+type permissionCheckedMsg struct {
+	scope   string
+	allowed bool
+	err     error
+}
+
 type exemptionCreatedMsg struct {
-	output string
+	exemption azure.Exemption
+	err       error
+}
+
+type requestWrittenMsg struct {
+	path   string
+	digest string
 	err    error
 }
 
-func fetchSubscriptionsCmd(ctx context.Context, client azureClient) tea.Cmd {
+func fetchSubscriptionsCmd(ctx context.Context, client wizardClient) tea.Cmd {
 	return func() tea.Msg {
 		subs, err := client.ListSubscriptions(ctx)
 		return subscriptionsLoadedMsg{subscriptions: subs, err: err}
 	}
 }
 
-func fetchAssignmentsCmd(ctx context.Context, client azureClient, sub azure.Subscription) tea.Cmd {
+func fetchIdentityCmd(ctx context.Context, client wizardClient) tea.Cmd {
 	return func() tea.Msg {
-		assignments, err := client.ListAssignments(ctx, sub.ShortID())
+		principal, err := client.CurrentPrincipal(ctx)
+		return identityLoadedMsg{principal: principal, err: err}
+	}
+}
+
+func fetchCloudCmd(ctx context.Context, client wizardClient) tea.Cmd {
+	return func() tea.Msg {
+		cloud, err := client.ActiveCloud(ctx)
+		return cloudLoadedMsg{cloud: cloud, err: err}
+	}
+}
+
+func fetchHierarchyCmd(ctx context.Context, client wizardClient) tea.Cmd {
+	return func() tea.Msg {
+		entities, err := client.ListManagementEntities(ctx)
+		return hierarchyLoadedMsg{entities: entities, err: err}
+	}
+}
+
+// fetchAssignmentsCmd returns the first page of the assignments of sub.
+// The later pages follow through the more command of each message.
+func fetchAssignmentsCmd(ctx context.Context, client wizardClient, sub azure.Subscription) tea.Cmd {
+	return func() tea.Msg {
+		pages := make(chan []azure.PolicyAssignment)
+		done := make(chan error, 1)
+		go func() {
+			done <- client.ListAssignmentPages(ctx, sub.ShortID(), func(page []azure.PolicyAssignment) {
+				select {
+				case pages <- page:
+				case <-ctx.Done():
+				}
+			})
+		}()
+		return nextAssignmentsPage(pages, done)()
+	}
+}
+
+// nextAssignmentsPage returns the command that waits for the next page, or
+// for the end of the pages.
+func nextAssignmentsPage(pages <-chan []azure.PolicyAssignment, done <-chan error) tea.Cmd {
+	var next tea.Cmd
+	next = func() tea.Msg {
+		select {
+		case page := <-pages:
+			return assignmentsLoadedMsg{assignments: page, more: next}
+		case err := <-done:
+			return assignmentsLoadedMsg{err: err}
+		}
+	}
+	return next
+}
+
+func fetchGroupAssignmentsCmd(ctx context.Context, client wizardClient, group azure.ManagementEntity) tea.Cmd {
+	return func() tea.Msg {
+		assignments, err := client.ListManagementGroupAssignments(ctx, group.Name)
 		return assignmentsLoadedMsg{assignments: assignments, err: err}
 	}
 }
 
-func fetchAssignmentDefinitionsCmd(ctx context.Context, client azureClient, assignment azure.PolicyAssignment) tea.Cmd {
+func fetchAssignmentDefinitionsCmd(ctx context.Context, client wizardClient, assignment azure.PolicyAssignment) tea.Cmd {
 	return func() tea.Msg {
 		definitions, err := client.ListAssignmentDefinitions(ctx, assignment)
 		return assignmentDefinitionsLoadedMsg{definitions: definitions, err: err}
 	}
 }
 
-func fetchResourceGroupsCmd(ctx context.Context, client azureClient, sub azure.Subscription) tea.Cmd {
+func fetchResourceGroupsCmd(ctx context.Context, client wizardClient, sub azure.Subscription) tea.Cmd {
 	return func() tea.Msg {
 		rgs, err := client.ListResourceGroups(ctx, sub.ShortID())
 		return resourceGroupsLoadedMsg{resourceGroups: rgs, err: err}
 	}
 }
 
-func createExemptionCmd(ctx context.Context, client azureClient, scope string, scopeName string, subscriptionName string, assignment azure.PolicyAssignment, selectedDefinitionIDs map[string]bool, ticket, users, expirationDate string) tea.Cmd {
+func fetchResourceFacetsCmd(ctx context.Context, client wizardClient, scope string) tea.Cmd {
+	return func() tea.Msg {
+		facets, err := client.ListResourceFacets(ctx, scope)
+		return resourceFacetsLoadedMsg{scope: scope, facets: facets, err: err}
+	}
+}
+
+func fetchComplianceCmd(ctx context.Context, client wizardClient, sub azure.Subscription) tea.Cmd {
+	return func() tea.Msg {
+		summary, err := client.SummarizeCompliance(ctx, sub.ShortID())
+		return complianceLoadedMsg{scope: sub.Scope(), summary: summary, err: err}
+	}
+}
+
+func fetchGroupComplianceCmd(ctx context.Context, client wizardClient, group azure.ManagementEntity) tea.Cmd {
 	return func() tea.Msg {
-		var refs []string
-		for ref := range selectedDefinitionIDs {
-			refs = append(refs, ref)
+		summary, err := client.SummarizeManagementGroupCompliance(ctx, group.Name)
+		return complianceLoadedMsg{scope: group.ID, summary: summary, err: err}
+	}
+}
+
+func fetchScopeComplianceCmd(ctx context.Context, client wizardClient, spec azure.ExemptionSpec, seq int) tea.Cmd {
+	return func() tea.Msg {
+		count, err := client.CountNonCompliant(ctx, spec.Scope, spec.Assignment.ID, spec.ReferenceIDs)
+		return scopeComplianceLoadedMsg{seq: seq, count: count, err: err}
+	}
+}
+
+func fetchAssignmentDetailsCmd(ctx context.Context, client wizardClient, assignment azure.PolicyAssignment) tea.Cmd {
+	return func() tea.Msg {
+		details, err := client.GetAssignmentDetails(ctx, assignment)
+		return assignmentDetailsLoadedMsg{key: strings.ToLower(assignment.ID), details: details, err: err}
+	}
+}
+
+func fetchDefinitionDetailsCmd(ctx context.Context, client wizardClient, definitionID string) tea.Cmd {
+	return func() tea.Msg {
+		details, err := client.GetDefinitionDetails(ctx, definitionID)
+		return definitionDetailsLoadedMsg{key: strings.ToLower(definitionID), details: details, err: err}
+	}
+}
+
+func fetchPermissionsCmd(ctx context.Context, client wizardClient, scopes []string, seq int) tea.Cmd {
+	return func() tea.Msg {
+		allowed, err := client.CheckPermissions(ctx, scopes, azure.ExemptionWriteAction)
+		return permissionsLoadedMsg{seq: seq, scopes: scopes, allowed: allowed, err: err}
+	}
+}
+
+func checkPermissionCmd(ctx context.Context, client wizardClient, scope string) tea.Cmd {
+	return func() tea.Msg {
+		allowed, err := client.CheckPermissions(ctx, []string{scope}, azure.ExemptionWriteAction)
+		if err != nil {
+			return permissionCheckedMsg{scope: scope, err: err}
+		}
+		return permissionCheckedMsg{scope: scope, allowed: allowed[scope]}
+	}
+}
+
+func createExemptionCmd(ctx context.Context, client wizardClient, spec azure.ExemptionSpec) tea.Cmd {
+	return func() tea.Msg {
+		exemption, err := client.CreateExemption(ctx, spec)
+		return exemptionCreatedMsg{exemption: exemption, err: err}
+	}
+}
+
+func writeRequestCmd(ctx context.Context, client wizardClient, path string, spec azure.ExemptionSpec, definitions []azure.PolicyDefinitionRef) tea.Cmd {
+	return func() tea.Msg {
+		requester, err := client.CurrentPrincipal(ctx)
+		if err != nil {
+			return requestWrittenMsg{err: err}
+		}
+		req := bundle.New(spec, requester, definitions)
+		if err := bundle.Write(path, req); err != nil {
+			return requestWrittenMsg{err: err}
 		}
-		sort.Strings(refs)
-		output, err := client.CreateExemption(ctx, scope, scopeName, subscriptionName, assignment, refs, ticket, users, expirationDate)
-		return exemptionCreatedMsg{output: output, err: err}
+		return requestWrittenMsg{path: path, digest: req.Digest()}
 	}
 }
@@ -3,10 +3,12 @@ package tui
 import (
 	"context"
 	"errors"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/bundle"
 )
 
 func TestFetchCommands(t *testing.T) {
@@ -36,6 +38,10 @@ func TestFetchCommands(t *testing.T) {
 	if !reflect.DeepEqual(rgs.resourceGroups, client.resourceGroups) || client.resourceGroupSubscription != "sub" {
 		t.Fatalf("resource groups message = %#v", rgs)
 	}
+	facets := fetchResourceFacetsCmd(ctx, client, "/subscriptions/sub")().(resourceFacetsLoadedMsg)
+	if facets.scope != "/subscriptions/sub" || client.facetScope != "/subscriptions/sub" || facets.err != nil {
+		t.Fatalf("resource facets message = %#v", facets)
+	}
 
 	client.err = wantErr
 	if msg := fetchSubscriptionsCmd(ctx, client)().(subscriptionsLoadedMsg); !errors.Is(msg.err, wantErr) {
@@ -43,38 +49,77 @@ func TestFetchCommands(t *testing.T) {
 	}
 }
 
+func TestComplianceCommands(t *testing.T) {
+	summary := azure.ComplianceSummary{Assignments: map[string]int{"a": 3}}
+	client := &fakeAzureClient{compliance: summary, nonCompliant: 7}
+	msg := fetchComplianceCmd(context.Background(), client, azure.Subscription{ID: "/subscriptions/sub"})().(complianceLoadedMsg)
+	if msg.scope != "/subscriptions/sub" || !reflect.DeepEqual(msg.summary, summary) || msg.err != nil {
+		t.Fatalf("compliance message = %#v", msg)
+	}
+	scope := fetchScopeComplianceCmd(context.Background(), client, azure.ExemptionSpec{Scope: "/subscriptions/sub/resourceGroups/rg"}, 3)().(scopeComplianceLoadedMsg)
+	if scope.count != 7 || scope.seq != 3 || scope.err != nil || client.complianceScope != "/subscriptions/sub/resourceGroups/rg" {
+		t.Fatalf("scope compliance message = %#v", scope)
+	}
+}
+
 func TestCreateExemptionCommand(t *testing.T) {
-	client := &fakeAzureClient{createOutput: "created"}
+	client := &fakeAzureClient{createdExemption: azure.Exemption{ID: "/exemptions/created"}}
 	assignment := azure.PolicyAssignment{ID: "assignment"}
-	msg := createExemptionCmd(context.Background(), client, "scope", "rg", "sub", assignment, map[string]bool{"z": true, "a": true}, "ticket", "users", "date")().(exemptionCreatedMsg)
-	if msg.output != "created" || msg.err != nil {
+	spec := azure.ExemptionSpec{Scope: "scope", ScopeName: "rg", SubscriptionName: "sub", Assignment: assignment, ReferenceIDs: []string{"a", "z"}, Ticket: "ticket", Users: "users", ExpirationDate: "date"}
+	msg := createExemptionCmd(context.Background(), client, spec)().(exemptionCreatedMsg)
+	if msg.exemption.ID != "/exemptions/created" || msg.err != nil {
 		t.Fatalf("created message = %#v", msg)
 	}
-	want := createCall{scope: "scope", scopeName: "rg", subscriptionName: "sub", assignment: assignment, refs: []string{"a", "z"}, ticket: "ticket", users: "users", expiration: "date"}
-	if !reflect.DeepEqual(client.created, want) {
-		t.Fatalf("CreateExemption call = %#v, want %#v", client.created, want)
+	if !reflect.DeepEqual(client.created, spec) {
+		t.Fatalf("CreateExemption call = %#v, want %#v", client.created, spec)
 	}
 }
 
-type createCall struct {
-	scope, scopeName, subscriptionName string
-	assignment                         azure.PolicyAssignment
-	refs                               []string
-	ticket, users, expiration          string
+func TestWriteRequestCommand(t *testing.T) {
+	client := &fakeAzureClient{principal: azure.Principal{ID: "requester", Name: "ada"}}
+	path := filepath.Join(t.TempDir(), "request.json")
+	spec := azure.ExemptionSpec{Scope: "/subscriptions/sub", Assignment: azure.PolicyAssignment{ID: "assignment"}, Ticket: "T", Users: "Ada"}
+	msg := writeRequestCmd(context.Background(), client, path, spec, nil)().(requestWrittenMsg)
+	if msg.err != nil || msg.path != path {
+		t.Fatalf("request message = %#v", msg)
+	}
+	req, err := bundle.Read(path)
+	if err != nil || req.Requester != client.principal || !reflect.DeepEqual(req.Exemption, spec) {
+		t.Fatalf("written request = %#v, %v", req, err)
+	}
+
+	client.err = errors.New("no account")
+	if msg := writeRequestCmd(context.Background(), client, path, spec, nil)().(requestWrittenMsg); msg.err == nil {
+		t.Fatal("principal lookup error was not reported")
+	}
 }
 
 type fakeAzureClient struct {
-	subscriptions  []azure.Subscription
-	assignments    []azure.PolicyAssignment
-	definitions    []azure.PolicyDefinitionRef
-	resourceGroups []azure.ResourceGroup
-	createOutput   string
-	err            error
+	subscriptions    []azure.Subscription
+	assignments      []azure.PolicyAssignment
+	assignmentPages  [][]azure.PolicyAssignment
+	definitions      []azure.PolicyDefinitionRef
+	resourceGroups   []azure.ResourceGroup
+	createdExemption azure.Exemption
+	principal        azure.Principal
+	compliance       azure.ComplianceSummary
+	nonCompliant     int
+	assignDetails    azure.AssignmentDetails
+	defDetails       azure.DefinitionDetails
+	facets           azure.ResourceFacets
+	denied           map[string]bool
+	cloud            azure.Cloud
+	entities         []azure.ManagementEntity
+	err              error
 
 	assignmentSubscription    string
+	assignmentGroup           string
 	definitionAssignment      azure.PolicyAssignment
 	resourceGroupSubscription string
-	created                   createCall
+	created                   azure.ExemptionSpec
+	complianceScope           string
+	facetScope                string
+	permissionScopes          []string
 }
 
 func (f *fakeAzureClient) ListSubscriptions(context.Context) ([]azure.Subscription, error) {
@@ -86,6 +131,23 @@ func (f *fakeAzureClient) ListAssignments(_ context.Context, subscription string
 	return f.assignments, f.err
 }
 
+func (f *fakeAzureClient) ListAssignmentPages(ctx context.Context, subscription string, page func([]azure.PolicyAssignment)) error {
+	assignments, err := f.ListAssignments(ctx, subscription)
+	if err != nil {
+		return err
+	}
+	if f.assignmentPages != nil {
+		for _, p := range f.assignmentPages {
+			page(p)
+		}
+		return nil
+	}
+	if len(assignments) > 0 {
+		page(assignments)
+	}
+	return nil
+}
+
 func (f *fakeAzureClient) ListAssignmentDefinitions(_ context.Context, assignment azure.PolicyAssignment) ([]azure.PolicyDefinitionRef, error) {
 	f.definitionAssignment = assignment
 	return f.definitions, f.err
@@ -96,7 +158,70 @@ func (f *fakeAzureClient) ListResourceGroups(_ context.Context, subscription str
 	return f.resourceGroups, f.err
 }
 
-func (f *fakeAzureClient) CreateExemption(_ context.Context, scope, scopeName, subscriptionName string, assignment azure.PolicyAssignment, refs []string, ticket, users, expiration string) (string, error) {
-	f.created = createCall{scope, scopeName, subscriptionName, assignment, refs, ticket, users, expiration}
-	return f.createOutput, f.err
+func (f *fakeAzureClient) ListResourceFacets(_ context.Context, scope string) (azure.ResourceFacets, error) {
+	f.facetScope = scope
+	return f.facets, f.err
+}
+
+func (f *fakeAzureClient) CreateExemption(_ context.Context, spec azure.ExemptionSpec) (azure.Exemption, error) {
+	f.created = spec
+	return f.createdExemption, f.err
+}
+
+func (f *fakeAzureClient) EnsureLogin(context.Context) error {
+	return f.err
+}
+
+func (f *fakeAzureClient) ListExemptions(context.Context, string) ([]azure.Exemption, error) {
+	return nil, f.err
+}
+
+func (f *fakeAzureClient) CurrentPrincipal(context.Context) (azure.Principal, error) {
+	return f.principal, f.err
+}
+
+func (f *fakeAzureClient) SummarizeCompliance(context.Context, string) (azure.ComplianceSummary, error) {
+	return f.compliance, f.err
+}
+
+func (f *fakeAzureClient) CountNonCompliant(_ context.Context, scope, _ string, _ []string) (int, error) {
+	f.complianceScope = scope
+	return f.nonCompliant, f.err
+}
+
+func (f *fakeAzureClient) GetAssignmentDetails(context.Context, azure.PolicyAssignment) (azure.AssignmentDetails, error) {
+	return f.assignDetails, f.err
+}
+
+func (f *fakeAzureClient) GetDefinitionDetails(context.Context, string) (azure.DefinitionDetails, error) {
+	return f.defDetails, f.err
+}
+
+func (f *fakeAzureClient) CheckPermissions(_ context.Context, scopes []string, _ string) (map[string]bool, error) {
+	f.permissionScopes = append(f.permissionScopes, scopes...)
+	if f.err != nil {
+		return nil, f.err
+	}
+	allowed := make(map[string]bool)
+	for _, scope := range scopes {
+		allowed[scope] = !f.denied[scope]
+	}
+	return allowed, nil
+}
+
+func (f *fakeAzureClient) ActiveCloud(context.Context) (azure.Cloud, error) {
+	return f.cloud, f.err
+}
+
+func (f *fakeAzureClient) ListManagementEntities(context.Context) ([]azure.ManagementEntity, error) {
+	return f.entities, f.err
+}
+
+func (f *fakeAzureClient) ListManagementGroupAssignments(_ context.Context, group string) ([]azure.PolicyAssignment, error) {
+	f.assignmentGroup = group
+	return f.assignments, f.err
+}
+
+func (f *fakeAzureClient) SummarizeManagementGroupCompliance(context.Context, string) (azure.ComplianceSummary, error) {
+	return f.compliance, f.err
 }
@@ -2,10 +2,17 @@ package tui
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/Lukas-Klein/azexempt/iac"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -14,6 +21,7 @@ type Step int
 const (
 	StepLoadingSubscriptions Step = iota
 	StepSelectSubscription
+	StepLoadingHierarchy
 	StepLoadingAssignments
 	StepSelectAssignment
 	StepLoadingAssignmentDefinitions
@@ -21,24 +29,90 @@ const (
 	StepSelectDefinitions
 	StepLoadingResourceGroups
 	StepSelectResourceGroup
+	StepSelectorsChoice
+	StepLoadingResourceFacets
+	StepSelectSelectors
+	StepCheckingPermission
 	StepTicket
 	StepUsers
 	StepExpirationChoice
 	StepExpirationDate
 	StepConfirm
+	StepGenerate
 	StepCreating
 	StepDone
 	StepError
 )
 
+var stepNames = [...]string{
+	StepLoadingSubscriptions:         "loading subscriptions",
+	StepSelectSubscription:           "select subscription",
+	StepLoadingHierarchy:             "loading hierarchy",
+	StepLoadingAssignments:           "loading assignments",
+	StepSelectAssignment:             "select assignment",
+	StepLoadingAssignmentDefinitions: "loading assignment definitions",
+	StepAssignmentScope:              "assignment scope",
+	StepSelectDefinitions:            "select definitions",
+	StepLoadingResourceGroups:        "loading resource groups",
+	StepSelectResourceGroup:          "select resource group",
+	StepSelectorsChoice:              "selectors choice",
+	StepLoadingResourceFacets:        "loading resource facets",
+	StepSelectSelectors:              "select selectors",
+	StepCheckingPermission:           "checking permission",
+	StepTicket:                       "ticket",
+	StepUsers:                        "users",
+	StepExpirationChoice:             "expiration choice",
+	StepExpirationDate:               "expiration date",
+	StepConfirm:                      "confirm",
+	StepGenerate:                     "generate",
+	StepCreating:                     "creating",
+	StepDone:                         "done",
+	StepError:                        "error",
+}
+
+func (s Step) String() string {
+	if s >= 0 && int(s) < len(stepNames) {
+		return stepNames[s]
+	}
+	return fmt.Sprintf("Step(%d)", int(s))
+}
+
+// wizardClient adds the Azure operations only the wizard needs, such as
+// paging, details and compliance counts, to azure.API. azure.Client and
+// the demo client implement it.
+type wizardClient interface {
+	azure.API
+	ActiveCloud(context.Context) (azure.Cloud, error)
+	ListResourceFacets(context.Context, string) (azure.ResourceFacets, error)
+	ListManagementEntities(context.Context) ([]azure.ManagementEntity, error)
+	ListAssignmentPages(context.Context, string, func([]azure.PolicyAssignment)) error
+	ListManagementGroupAssignments(context.Context, string) ([]azure.PolicyAssignment, error)
+	GetAssignmentDetails(context.Context, azure.PolicyAssignment) (azure.AssignmentDetails, error)
+	GetDefinitionDetails(context.Context, string) (azure.DefinitionDetails, error)
+	SummarizeCompliance(context.Context, string) (azure.ComplianceSummary, error)
+	SummarizeManagementGroupCompliance(context.Context, string) (azure.ComplianceSummary, error)
+	CountNonCompliant(context.Context, string, string, []string) (int, error)
+	CheckPermissions(context.Context, []string, string) (map[string]bool, error)
+}
+
+var _ wizardClient = (*azure.Client)(nil)
+
 type Model struct {
 	ctx         context.Context
-	azureClient azureClient
+	azureClient wizardClient
 
 	Step   Step
 	Status string
 	Err    error
 
+	// Identity is the signed-in Azure CLI account shown on the first
+	// screen. It is nil until loaded or if it could not be determined.
+	Identity *azure.Principal
+
+	// Cloud is the Azure cloud of the Azure CLI, shown in the header and
+	// used for portal links. It is empty until loaded.
+	Cloud azure.Cloud
+
 	Subscriptions         []azure.Subscription
 	Assignments           []azure.PolicyAssignment
 	AssignmentDefinitions []azure.PolicyDefinitionRef
@@ -50,6 +124,19 @@ type Model struct {
 	SelectedResourceGroup int
 	PartialExemption      bool
 
+	// TreeView lists the subscriptions in the management group hierarchy
+	// instead of a flat list; the cursor then indexes Hierarchy. Hierarchy
+	// holds the tree in depth-first order once loaded, and Expanded the
+	// lowercased IDs of the expanded management groups.
+	TreeView  bool
+	Hierarchy []hierarchyNode
+	Expanded  map[string]bool
+	entities  []azure.ManagementEntity
+
+	// ManagementGroup is the management group chosen in the tree view as
+	// the exemption scope instead of a subscription, or nil.
+	ManagementGroup *azure.ManagementEntity
+
 	TicketInput     textinput.Model
 	UserInput       textinput.Model
 	ExpirationInput textinput.Model
@@ -58,23 +145,139 @@ type Model struct {
 	RequestUser    string
 	ExpirationDate string
 
-	CreateOutput string
-
-	// SubscriptionSearch is the type-ahead search buffer for subscription selection
-	SubscriptionSearch string
+	// Created is the exemption created in Azure.
+	Created azure.Exemption
+	// OutputPath is the request file or infrastructure code file written
+	// instead of creating the exemption.
+	OutputPath string
+	// RequestDigest is the digest of the saved request file, which the
+	// requester publishes for the approver.
+	RequestDigest string
 
-	// AssignmentSearch is the type-ahead search buffer for policy assignment selection
-	AssignmentSearch string
-
-	// DefinitionSearch is the type-ahead search buffer for policy definition selection
-	DefinitionSearch string
+	// SubscriptionFilter, AssignmentFilter, DefinitionFilter and
+	// ResourceGroupFilter hold the search queries that narrow the lists.
+	SubscriptionFilter  filterList
+	AssignmentFilter    filterList
+	DefinitionFilter    filterList
+	ResourceGroupFilter filterList
 
 	// BlockedDefinitionIDs contains policy definition IDs that cannot be exempted.
 	// These definitions appear greyed out and are non-selectable in the UI.
 	BlockedDefinitionIDs map[string]bool
+
+	// Compliance holds the Policy Insights summary for the selected subscription.
+	// It is nil until loaded; ComplianceErr is set if loading failed.
+	Compliance    *azure.ComplianceSummary
+	ComplianceErr error
+
+	// ScopeNonCompliant is the number of non-compliant resources under the
+	// chosen scope, shown on the confirmation screen. It is -1 while unknown.
+	// scopeComplianceSeq identifies the latest count, so that counts of
+	// earlier confirmations are dropped.
+	ScopeNonCompliant  int
+	ScopeComplianceErr error
+	scopeComplianceSeq int
+
+	// OriginFilter restricts the assignments list to assignments assigned
+	// on this level of scope. ScopeUnknown shows all assignments.
+	OriginFilter azure.ScopeLevel
+
+	// EffectFilter restricts the definitions list to members with this
+	// effect. Empty shows all members.
+	EffectFilter string
+
+	// GroupedView lists initiative members by policy definition group
+	// (compliance control) so that a whole control can be selected at once.
+	GroupedView bool
+
+	// DetailOpen shows the detail pane for the highlighted assignment or
+	// initiative member identified by DetailKey (its lowercased ID).
+	DetailOpen bool
+	DetailKey  string
+	DetailView viewport.Model
+
+	// AssignmentDetails and DefinitionDetails cache loaded details by lowercased ID.
+	AssignmentDetails map[string]azure.AssignmentDetails
+	DefinitionDetails map[string]azure.DefinitionDetails
+	detailErrs        map[string]error
+
+	// SelectorOptions are the locations and resource types of the resources
+	// in SelectorScope, offered by the resource selectors step.
+	SelectorOptions []selectorOption
+	SelectorScope   string
+
+	// SelectedSelectors holds the chosen selector options. When empty the
+	// exemption applies to all resources in scope.
+	SelectedSelectors map[selectorOption]bool
+
+	// ExemptPermissions records by lowercased scope whether the signed-in
+	// account may create exemptions there. Scopes that were not checked, or
+	// could not be, are missing.
+	ExemptPermissions map[string]bool
+
+	// checkingPermissions holds the lowercased scopes being checked for the
+	// list marks. cancelPermissions cancels the checks; permissionsSeq
+	// identifies them so that results of cancelled checks are dropped.
+	checkingPermissions map[string]bool
+	permissionsCtx      context.Context
+	cancelPermissions   context.CancelFunc
+	permissionsSeq      int
+
+	// FailedStep is the step that failed when Step is StepError. A failed
+	// load is retried by starting lastLoad again; going back returns to
+	// loadFrom, the step the load was started from.
+	FailedStep Step
+	loadFrom   Step
+	lastLoad   func(context.Context) tea.Cmd
+
+	// Spinner and LoadStarted show the progress of the running load.
+	// cancelLoad cancels its context; loadSeq identifies it so that results
+	// of cancelled loads are dropped.
+	Spinner     spinner.Model
+	LoadStarted time.Time
+	cancelLoad  context.CancelFunc
+	loadSeq     int
+
+	// Width and Height are the terminal size in cells, 0 until the first
+	// tea.WindowSizeMsg. Lists and panes are sized to fit them.
+	Width  int
+	Height int
+
+	// Keys are the key bindings; ShowHelp shows the help overlay for them.
+	Keys     KeyMap
+	ShowHelp bool
+
+	// RequestPath, when set, makes the confirmation step write an approval
+	// request bundle to this path instead of creating the exemption.
+	RequestPath string
+
+	// IaCFormat is the infrastructure as code format the exemption was
+	// generated in instead of being created, empty otherwise.
+	IaCFormat iac.Format
+
+	// LoadingMore is set while later pages of the assignments are still
+	// arriving; they are merged into Assignments as they come. cancelStream
+	// stops them and streamSeq identifies the stream, so that pages of a
+	// stopped one are dropped.
+	LoadingMore  bool
+	cancelStream context.CancelFunc
+	streamSeq    int
+
+	// prefetchedGroups holds the resource groups loaded in the background
+	// when a subscription is chosen, by lowercased subscription scope.
+	// prefetchedDefinitions holds the members of initiative assignments
+	// loaded while the cursor rested on them, by lowercased assignment ID;
+	// idleSeq identifies the latest cursor move in the assignments list.
+	prefetchedGroups      map[string][]azure.ResourceGroup
+	prefetchedDefinitions map[string][]azure.PolicyDefinitionRef
+	idleSeq               int
+
+	// Logger receives the step transitions of the wizard. It discards them
+	// unless replaced.
+	Logger *slog.Logger
 }
 
-func NewModel(ctx context.Context, client azureClient, blockedDefinitionIDs map[string]bool) *Model {
+func NewModel(ctx context.Context, client wizardClient, blockedDefinitionIDs map[string]bool) *Model {
 	ticketInput := textinput.New()
 	ticketInput.Placeholder = "e.g. INC123456"
 	ticketInput.Prompt = "Ticket> "
@@ -104,16 +307,36 @@ func NewModel(ctx context.Context, client azureClient, blockedDefinitionIDs map[
 		SelectedSubscription:  -1,
 		SelectedAssignment:    -1,
 		SelectedResourceGroup: -1,
+		ScopeNonCompliant:     -1,
 		SelectedDefinitionIDs: make(map[string]bool),
+		SelectedSelectors:     make(map[selectorOption]bool),
+		ExemptPermissions:     make(map[string]bool),
+		checkingPermissions:   make(map[string]bool),
+		Expanded:              make(map[string]bool),
 		BlockedDefinitionIDs:  blockedDefinitionIDs,
 		TicketInput:           ticketInput,
 		UserInput:             userInput,
 		ExpirationInput:       expirationInput,
+		DetailView:            newDetailView(),
+		Spinner:               newSpinner(),
+		Keys:                  DefaultKeyMap(),
+		AssignmentDetails:     make(map[string]azure.AssignmentDetails),
+		DefinitionDetails:     make(map[string]azure.DefinitionDetails),
+		detailErrs:            make(map[string]error),
+		prefetchedGroups:      make(map[string][]azure.ResourceGroup),
+		prefetchedDefinitions: make(map[string][]azure.PolicyDefinitionRef),
+		Logger:                slog.New(slog.DiscardHandler),
 	}
 }
 
 func (m *Model) Init() tea.Cmd {
-	return fetchSubscriptionsCmd(m.ctx, m.azureClient)
+	return tea.Batch(
+		m.load(StepLoadingSubscriptions, func(ctx context.Context) tea.Cmd {
+			return fetchSubscriptionsCmd(ctx, m.azureClient)
+		}),
+		fetchIdentityCmd(m.ctx, m.azureClient),
+		fetchCloudCmd(m.ctx, m.azureClient),
+	)
 }
 
 func (m *Model) CurrentSubscription() azure.Subscription {
@@ -126,6 +349,25 @@ func (m *Model) CurrentSubscription() azure.Subscription {
 	return m.Subscriptions[0]
 }
 
+// targetScope returns the scope ID of the chosen management group or
+// subscription.
+func (m *Model) targetScope() string {
+	if m.ManagementGroup != nil {
+		return m.ManagementGroup.ID
+	}
+	return m.CurrentSubscription().Scope()
+}
+
+// targetLabel describes the chosen management group or subscription, e.g.
+// "subscription Production (0000-...)".
+func (m *Model) targetLabel() string {
+	if m.ManagementGroup != nil {
+		return fmt.Sprintf("management group %s (%s)", m.ManagementGroup.Label(), m.ManagementGroup.Name)
+	}
+	sub := m.CurrentSubscription()
+	return fmt.Sprintf("subscription %s (%s)", sub.Name, sub.ShortID())
+}
+
 func (m *Model) CurrentAssignment() azure.PolicyAssignment {
 	if m.SelectedAssignment >= 0 && m.SelectedAssignment < len(m.Assignments) {
 		return m.Assignments[m.SelectedAssignment]
@@ -136,34 +378,96 @@ func (m *Model) CurrentAssignment() azure.PolicyAssignment {
 	return m.Assignments[0]
 }
 
+// Fail shows err on the error step, from where the failed load can be
+// retried or left by going back.
 func (m *Model) Fail(err error) (tea.Model, tea.Cmd) {
 	m.Err = err
+	m.FailedStep = m.Step
 	m.Step = StepError
 	m.Status = ""
 	return m, nil
 }
 
+// ExemptionSpec builds the exemption described by the current selections.
+func (m *Model) ExemptionSpec() azure.ExemptionSpec {
+	spec := azure.ExemptionSpec{
+		SubscriptionName: m.CurrentSubscription().Name,
+		Assignment:       m.CurrentAssignment(),
+		Ticket:           m.Ticket,
+		Users:            m.RequestUser,
+		ExpirationDate:   m.ExpirationDate,
+		Selectors:        m.resourceSelectors(),
+	}
+	if m.ManagementGroup != nil {
+		spec.SubscriptionName = ""
+	}
+	if m.SelectedResourceGroup >= 0 && m.SelectedResourceGroup < len(m.ResourceGroups) {
+		rg := m.ResourceGroups[m.SelectedResourceGroup]
+		spec.Scope = rg.ID
+		spec.ScopeName = rg.Name
+	}
+	for ref := range m.SelectedDefinitionIDs {
+		spec.ReferenceIDs = append(spec.ReferenceIDs, ref)
+	}
+	sort.Strings(spec.ReferenceIDs)
+	return spec
+}
+
+// selectedDefinitions returns the initiative members chosen for a partial exemption.
+func (m *Model) selectedDefinitions() []azure.PolicyDefinitionRef {
+	var refs []azure.PolicyDefinitionRef
+	for _, ref := range m.AssignmentDefinitions {
+		if m.SelectedDefinitionIDs[ref.ReferenceID] {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
 // Reset resets the model to start a new exemption creation flow
 func (m *Model) Reset() tea.Cmd {
+	m.stopLoad()
+	m.stopStream()
+	m.stopPermissions()
 	m.Step = StepLoadingSubscriptions
+	m.loadFrom = StepLoadingSubscriptions // Nothing to go back to
 	m.Status = ""
 	m.Err = nil
 	m.Cursor = 0
 	m.SelectedSubscription = -1
 	m.SelectedAssignment = -1
 	m.SelectedResourceGroup = -1
+	m.ManagementGroup = nil
 	m.Assignments = nil
 	m.AssignmentDefinitions = nil
 	m.ResourceGroups = nil
 	m.SelectedDefinitionIDs = make(map[string]bool)
 	m.PartialExemption = false
+	m.SelectorOptions = nil
+	m.SelectorScope = ""
+	m.SelectedSelectors = make(map[selectorOption]bool)
+	m.ExemptPermissions = make(map[string]bool)
+	m.prefetchedGroups = make(map[string][]azure.ResourceGroup)
+	m.prefetchedDefinitions = make(map[string][]azure.PolicyDefinitionRef)
 	m.Ticket = ""
 	m.RequestUser = ""
 	m.ExpirationDate = ""
-	m.CreateOutput = ""
-	m.SubscriptionSearch = ""
-	m.AssignmentSearch = ""
-	m.DefinitionSearch = ""
+	m.Created = azure.Exemption{}
+	m.OutputPath = ""
+	m.RequestDigest = ""
+	m.IaCFormat = ""
+	m.Compliance = nil
+	m.ComplianceErr = nil
+	m.ScopeNonCompliant = -1
+	m.ScopeComplianceErr = nil
+	m.closeDetails()
+	m.EffectFilter = ""
+	m.OriginFilter = azure.ScopeUnknown
+	m.GroupedView = false
+	m.SubscriptionFilter.Reset()
+	m.AssignmentFilter.Reset()
+	m.DefinitionFilter.Reset()
+	m.ResourceGroupFilter.Reset()
 
 	m.TicketInput.SetValue("")
 	m.TicketInput.Blur()
@@ -172,7 +476,9 @@ func (m *Model) Reset() tea.Cmd {
 	m.ExpirationInput.SetValue("")
 	m.ExpirationInput.Blur()
 
-	return fetchSubscriptionsCmd(m.ctx, m.azureClient)
+	return m.load(StepLoadingSubscriptions, func(ctx context.Context) tea.Cmd {
+		return fetchSubscriptionsCmd(ctx, m.azureClient)
+	})
 }
 
 // IsDefinitionBlocked returns true if the given policy definition ID is blocked from exemption.
@@ -181,32 +487,147 @@ func (m *Model) IsDefinitionBlocked(policyDefinitionID string) bool {
 	return m.BlockedDefinitionIDs[strings.ToLower(policyDefinitionID)]
 }
 
-// firstAssignmentMatch returns the index of the first non-blocked assignment whose
-// display label contains the (case-insensitive) query, or -1 if none matches.
-func (m *Model) firstAssignmentMatch(query string) int {
-	q := strings.ToLower(query)
+// subscriptionMatches returns the subscriptions matching the search query,
+// by name or subscription ID.
+func (m *Model) subscriptionMatches() filterResult {
+	items := make([]filterItem, len(m.Subscriptions))
+	for i, sub := range m.Subscriptions {
+		items[i] = filterItem{Index: i, Label: sub.Name, Keys: []string{sub.ShortID()}}
+	}
+	return m.SubscriptionFilter.Filter(items)
+}
+
+// assignmentMatches returns the assignments that pass the origin filter and
+// match the search query, by display name, name or ID.
+func (m *Model) assignmentMatches() filterResult {
+	var items []filterItem
 	for i, assign := range m.Assignments {
-		if m.IsDefinitionBlocked(assign.PolicyDefinitionID) {
+		if level, _ := assign.Origin(); m.OriginFilter != azure.ScopeUnknown && level != m.OriginFilter {
 			continue
 		}
-		if strings.Contains(strings.ToLower(assign.DisplayLabel()), q) {
-			return i
+		items = append(items, filterItem{
+			Index:    i,
+			Label:    assign.DisplayLabel(),
+			Keys:     []string{assign.Name, assign.ID},
+			Disabled: m.IsDefinitionBlocked(assign.PolicyDefinitionID),
+		})
+	}
+	return m.AssignmentFilter.Filter(items)
+}
+
+// definitionMatches returns the assignment definitions that pass the effect
+// filter and match the search query, by display name, reference ID or
+// policy definition ID.
+func (m *Model) definitionMatches() filterResult {
+	var items []filterItem
+	for _, i := range m.visibleDefinitions() {
+		ref := m.AssignmentDefinitions[i]
+		items = append(items, filterItem{
+			Index:    i,
+			Label:    ref.DisplayName,
+			Keys:     []string{ref.ReferenceID, ref.PolicyDefinitionID},
+			Disabled: m.IsDefinitionBlocked(ref.PolicyDefinitionID),
+		})
+	}
+	return m.DefinitionFilter.Filter(items)
+}
+
+// groupMatches returns the definition groups matching the search query, by
+// label or group name.
+func (m *Model) groupMatches(groups []definitionGroup) filterResult {
+	items := make([]filterItem, len(groups))
+	for i, g := range groups {
+		items[i] = filterItem{Index: i, Label: g.Label, Keys: []string{g.Key}}
+	}
+	return m.DefinitionFilter.Filter(items)
+}
+
+// resourceGroupMatches returns the scope options matching the search query,
+// by name or ID.
+func (m *Model) resourceGroupMatches() filterResult {
+	items := make([]filterItem, len(m.ResourceGroups))
+	for i, rg := range m.ResourceGroups {
+		items[i] = filterItem{Index: i, Label: rg.Name, Keys: []string{rg.ID}}
+	}
+	return m.ResourceGroupFilter.Filter(items)
+}
+
+// definitionVisible reports whether the assignment definition at index i
+// passes the effect filter.
+func (m *Model) definitionVisible(i int) bool {
+	return m.EffectFilter == "" || strings.EqualFold(m.AssignmentDefinitions[i].Effect, m.EffectFilter)
+}
+
+// visibleDefinitions returns the indices of the assignment definitions that
+// pass the effect filter.
+func (m *Model) visibleDefinitions() []int {
+	var indices []int
+	for i := range m.AssignmentDefinitions {
+		if m.definitionVisible(i) {
+			indices = append(indices, i)
 		}
 	}
-	return -1
+	return indices
 }
 
-// firstDefinitionMatch returns the index of the first non-blocked assignment definition
-// whose display name contains the (case-insensitive) query, or -1 if none matches.
-func (m *Model) firstDefinitionMatch(query string) int {
-	q := strings.ToLower(query)
-	for i, ref := range m.AssignmentDefinitions {
-		if m.IsDefinitionBlocked(ref.PolicyDefinitionID) {
+// definitionEffects returns the distinct effects of the assignment
+// definitions in alphabetical order. Members with an unknown effect are not included.
+func (m *Model) definitionEffects() []string {
+	seen := make(map[string]bool)
+	var effects []string
+	for _, ref := range m.AssignmentDefinitions {
+		if ref.Effect != "" && !seen[ref.Effect] {
+			seen[ref.Effect] = true
+			effects = append(effects, ref.Effect)
+		}
+	}
+	sort.Strings(effects)
+	return effects
+}
+
+// cycleEffectFilter switches to the next effect filter, wrapping around to
+// showing all members, and keeps the cursor on a listed definition.
+func (m *Model) cycleEffectFilter() {
+	effects := m.definitionEffects()
+	next := ""
+	if m.EffectFilter == "" {
+		if len(effects) > 0 {
+			next = effects[0]
+		}
+	} else {
+		for i, effect := range effects {
+			if effect == m.EffectFilter && i+1 < len(effects) {
+				next = effects[i+1]
+			}
+		}
+	}
+	m.EffectFilter = next
+	if matches := m.definitionMatches(); !matches.Contains(m.Cursor) && len(matches) > 0 {
+		m.Cursor = matches.First()
+	}
+}
+
+// exemptedDenyDefinitions returns the Deny members covered by the exemption:
+// the selected ones for a partial exemption, otherwise all of them. For an
+// assignment of a single policy it is the policy itself, once the
+// assignment details with its effect are loaded.
+func (m *Model) exemptedDenyDefinitions() []azure.PolicyDefinitionRef {
+	if len(m.AssignmentDefinitions) == 0 {
+		assign := m.CurrentAssignment()
+		details := m.AssignmentDetails[strings.ToLower(assign.ID)]
+		if !azure.IsDenyEffect(details.Effect) {
+			return nil
+		}
+		return []azure.PolicyDefinitionRef{{PolicyDefinitionID: assign.PolicyDefinitionID, DisplayName: assign.DisplayLabel(), Effect: details.Effect}}
+	}
+	var refs []azure.PolicyDefinitionRef
+	for _, ref := range m.AssignmentDefinitions {
+		if m.PartialExemption && !m.SelectedDefinitionIDs[ref.ReferenceID] {
 			continue
 		}
-		if strings.Contains(strings.ToLower(ref.DisplayName), q) {
-			return i
+		if azure.IsDenyEffect(ref.Effect) {
+			refs = append(refs, ref)
 		}
 	}
-	return -1
+	return refs
 }
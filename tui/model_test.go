@@ -51,8 +51,9 @@ func TestFailAndReset(t *testing.T) {
 	m.ResourceGroups = []azure.ResourceGroup{{Name: "rg"}}
 	m.SelectedDefinitionIDs["r"] = true
 	m.PartialExemption = true
-	m.Ticket, m.RequestUser, m.ExpirationDate, m.CreateOutput = "T", "U", "D", "O"
-	m.SubscriptionSearch, m.AssignmentSearch, m.DefinitionSearch = "s", "a", "d"
+	m.Ticket, m.RequestUser, m.ExpirationDate, m.OutputPath = "T", "U", "D", "O"
+	m.Created = azure.Exemption{ID: "/exemptions/e"}
+	m.SubscriptionFilter.Query, m.AssignmentFilter.Query, m.DefinitionFilter.Query, m.ResourceGroupFilter.Query = "s", "a", "d", "r"
 	m.TicketInput.SetValue("T")
 	m.UserInput.SetValue("U")
 	m.ExpirationInput.SetValue("D")
@@ -70,9 +71,12 @@ func TestFailAndReset(t *testing.T) {
 	if m.Assignments != nil || m.AssignmentDefinitions != nil || m.ResourceGroups != nil || m.PartialExemption || len(m.SelectedDefinitionIDs) != 0 {
 		t.Fatal("Reset() did not clear Azure selections")
 	}
-	if m.Ticket != "" || m.RequestUser != "" || m.ExpirationDate != "" || m.CreateOutput != "" || m.TicketInput.Value() != "" || m.UserInput.Value() != "" || m.ExpirationInput.Value() != "" {
+	if m.Ticket != "" || m.RequestUser != "" || m.ExpirationDate != "" || m.OutputPath != "" || m.Created.ID != "" || m.TicketInput.Value() != "" || m.UserInput.Value() != "" || m.ExpirationInput.Value() != "" {
 		t.Fatal("Reset() did not clear form values")
 	}
+	if m.SubscriptionFilter.Query != "" || m.AssignmentFilter.Query != "" || m.DefinitionFilter.Query != "" || m.ResourceGroupFilter.Query != "" {
+		t.Fatal("Reset() did not clear search queries")
+	}
 	if !reflect.DeepEqual(m.BlockedDefinitionIDs, blocked) || len(m.Subscriptions) != 1 {
 		t.Fatal("Reset() should retain configuration and cached subscriptions")
 	}
@@ -86,18 +90,26 @@ func TestBlockedAndSearchHelpers(t *testing.T) {
 	m.Assignments = []azure.PolicyAssignment{
 		{DisplayName: "Blocked match", PolicyDefinitionID: "/definitions/blocked"},
 		{DisplayName: "Allowed Match", PolicyDefinitionID: "/definitions/allowed"},
+		{DisplayName: "Other", Name: "match-by-name", PolicyDefinitionID: "/definitions/other"},
+	}
+	m.AssignmentFilter.Query = "MATCH"
+	matches := m.assignmentMatches()
+	if got := matches.First(); got != 1 {
+		t.Fatalf("first assignment match = %d", got)
 	}
-	if got := m.firstAssignmentMatch("MATCH"); got != 1 {
-		t.Fatalf("firstAssignmentMatch() = %d", got)
+	if len(matches) != 3 || matches[2].Index != 2 || matches[2].Positions != nil {
+		t.Fatalf("name match should rank last without highlight: %#v", matches)
 	}
-	if got := m.firstAssignmentMatch("missing"); got != -1 {
+	m.AssignmentFilter.Query = "missing"
+	if got := m.assignmentMatches().First(); got != -1 {
 		t.Fatalf("missing assignment match = %d", got)
 	}
 	m.AssignmentDefinitions = []azure.PolicyDefinitionRef{
 		{DisplayName: "Blocked", PolicyDefinitionID: "/definitions/blocked"},
 		{DisplayName: "Allowed", PolicyDefinitionID: "/definitions/allowed"},
 	}
-	if got := m.firstDefinitionMatch("ed"); got != 1 {
-		t.Fatalf("firstDefinitionMatch() = %d", got)
+	m.DefinitionFilter.Query = "ed"
+	if got := m.definitionMatches().First(); got != 1 {
+		t.Fatalf("first definition match = %d", got)
 	}
 }
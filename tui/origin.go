@@ -0,0 +1,69 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+)
+
+// assignmentOrigins returns the levels of scope the loaded assignments are
+// assigned on, from the top of the hierarchy down.
+func (m *Model) assignmentOrigins() []azure.ScopeLevel {
+	present := make(map[azure.ScopeLevel]bool)
+	for _, assign := range m.Assignments {
+		level, _ := assign.Origin()
+		present[level] = true
+	}
+	var levels []azure.ScopeLevel
+	for _, level := range append(azure.ScopeLevels, azure.ScopeUnknown) {
+		if present[level] {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// cycleOriginFilter switches to the next level of assigning scope, wrapping
+// around to showing all assignments, and keeps the cursor on a listed
+// assignment. With a single origin there is nothing to filter.
+func (m *Model) cycleOriginFilter() {
+	levels := m.assignmentOrigins()
+	if len(levels) < 2 {
+		m.OriginFilter = azure.ScopeUnknown
+		m.Status = "All assignments are assigned on the same level of scope."
+		return
+	}
+	next := levels[0]
+	if m.OriginFilter != azure.ScopeUnknown {
+		next = azure.ScopeUnknown
+		for i, level := range levels {
+			if level == m.OriginFilter && i+1 < len(levels) && levels[i+1] != azure.ScopeUnknown {
+				next = levels[i+1]
+			}
+		}
+	}
+	m.OriginFilter = next
+	m.Status = "" // Filter is shown in the view
+	if matches := m.assignmentMatches(); !matches.Contains(m.Cursor) && len(matches) > 0 {
+		m.Cursor = matches.First()
+	}
+}
+
+// assignmentScopeLimit returns the scope of the selected assignment when it
+// is assigned below the subscription, as an exemption can only be created
+// on or beneath the scope of its assignment. It returns "" otherwise.
+func (m *Model) assignmentScopeLimit() string {
+	if m.SelectedAssignment < 0 {
+		return ""
+	}
+	return m.CurrentAssignment().ScopeLimit()
+}
+
+// originLabel describes the scope an assignment is assigned on.
+func originLabel(assign azure.PolicyAssignment) string {
+	level, name := assign.Origin()
+	if level == azure.ScopeUnknown {
+		return ""
+	}
+	return " · " + strings.ToLower(level.String()) + " " + name
+}
@@ -0,0 +1,86 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func originModel() *Model {
+	m := populatedModel()
+	m.Assignments = []azure.PolicyAssignment{
+		{ID: "/assignments/mg", DisplayName: "Baseline", Scope: "/providers/Microsoft.Management/managementGroups/contoso"},
+		{ID: "/assignments/rg", DisplayName: "Data rules", Scope: "/subscriptions/sub/resourceGroups/data"},
+		{ID: "/assignments/sub", DisplayName: "Tagging", Scope: "/subscriptions/sub"},
+	}
+	m.Step = StepSelectAssignment
+	m.SelectedAssignment = -1
+	m.Cursor = 0
+	return m
+}
+
+func TestOriginFilter(t *testing.T) {
+	m := originModel()
+	view := m.View()
+	for _, want := range []string{"Baseline (mg) · management group contoso", "Data rules (rg) · resource group data", "Tagging (sub) · subscription sub", "Ctrl+O filter by assigning scope"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("view is missing %q:\n%s", want, view)
+		}
+	}
+
+	for _, want := range []azure.ScopeLevel{azure.ScopeManagementGroup, azure.ScopeSubscription, azure.ScopeResourceGroup, azure.ScopeUnknown} {
+		press(t, m, tea.KeyCtrlO)
+		if m.OriginFilter != want {
+			t.Fatalf("origin filter = %v, want %v", m.OriginFilter, want)
+		}
+	}
+
+	press(t, m, tea.KeyCtrlO)
+	press(t, m, tea.KeyCtrlO)
+	if matches := m.assignmentMatches(); len(matches) != 1 || m.Cursor != 2 {
+		t.Fatalf("subscription origin matches %v, cursor %d", matches, m.Cursor)
+	}
+	if view := m.View(); !strings.Contains(view, "Assigned on: Subscription (1 of 3 assignments)") || strings.Contains(view, "Baseline") {
+		t.Fatalf("filtered view:\n%s", view)
+	}
+
+	// A new subscription shows all of its assignments again.
+	updateWith(t, m, assignmentsLoadedMsg{assignments: m.Assignments})
+	if m.OriginFilter != azure.ScopeUnknown {
+		t.Fatalf("origin filter kept: %v", m.OriginFilter)
+	}
+}
+
+func TestScopeWithinAssignment(t *testing.T) {
+	rgs := []azure.ResourceGroup{
+		{ID: "/subscriptions/sub/resourceGroups/app", Name: "app"},
+		{ID: "/subscriptions/sub/resourceGroups/data", Name: "data"},
+	}
+
+	m := originModel()
+	m.SelectedAssignment = 1
+	updateWith(t, m, resourceGroupsLoadedMsg{resourceGroups: rgs})
+	assertStep(t, m, StepSelectResourceGroup)
+	if len(m.ResourceGroups) != 1 || m.ResourceGroups[0].Name != "data" {
+		t.Fatalf("scopes = %v", m.ResourceGroups)
+	}
+	if view := m.View(); !strings.Contains(view, "assigned on resource group data") {
+		t.Fatalf("scope view:\n%s", view)
+	}
+
+	// An assignment on a single resource can only be exempted there.
+	m.Assignments[1].Scope = "/subscriptions/sub/resourceGroups/data/providers/Microsoft.Storage/storageAccounts/logs"
+	updateWith(t, m, resourceGroupsLoadedMsg{resourceGroups: rgs})
+	if len(m.ResourceGroups) != 1 || m.ResourceGroups[0].Name != "logs" || m.ResourceGroups[0].ID != m.Assignments[1].Scope {
+		t.Fatalf("resource scopes = %v", m.ResourceGroups)
+	}
+
+	// Assignments on a subscription or above allow every scope.
+	m.SelectedAssignment = 0
+	updateWith(t, m, resourceGroupsLoadedMsg{resourceGroups: rgs})
+	if len(m.ResourceGroups) != 3 {
+		t.Fatalf("scopes = %v", m.ResourceGroups)
+	}
+}
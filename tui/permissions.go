@@ -0,0 +1,153 @@
+package tui
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// canExempt reports whether the signed-in account may create exemptions on
+// scope, and whether that is known. A permission on the subscription also
+// holds for its resource groups.
+func (m *Model) canExempt(scope string) (allowed, known bool) {
+	scope = strings.ToLower(scope)
+	if allowed, known = m.ExemptPermissions[scope]; known {
+		return allowed, known
+	}
+	for checked, ok := range m.ExemptPermissions {
+		if ok && strings.HasPrefix(scope, checked+"/") {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// fetchPermissions checks in the background whether exemptions may be
+// created on the scopes whose permission is neither known nor being
+// checked, to mark them in the lists. Saving a request needs no
+// permission, so nothing is checked.
+func (m *Model) fetchPermissions(scopes []string) tea.Cmd {
+	if m.RequestPath != "" {
+		return nil
+	}
+	var unknown []string
+	for _, scope := range scopes {
+		if _, known := m.canExempt(scope); !known && !m.checkingPermissions[strings.ToLower(scope)] {
+			unknown = append(unknown, scope)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if m.cancelPermissions == nil {
+		m.permissionsCtx, m.cancelPermissions = context.WithCancel(m.ctx)
+	}
+	for _, scope := range unknown {
+		m.checkingPermissions[strings.ToLower(scope)] = true
+	}
+	return fetchPermissionsCmd(m.permissionsCtx, m.azureClient, unknown, m.permissionsSeq)
+}
+
+// checkVisiblePermissions checks the permission of the scopes on the shown
+// page of the subscription or scope list, so that a tenant with hundreds
+// of subscriptions is checked a page at a time. Leaving the lists cancels
+// the checks still running.
+func (m *Model) checkVisiblePermissions() tea.Cmd {
+	var scopes []string
+	switch m.Step {
+	case StepSelectSubscription:
+		if m.TreeView {
+			page, _ := m.treeMatches().Page(m.Cursor, m.listHeight())
+			for _, match := range page {
+				node := m.Hierarchy[match.Index]
+				if node.isGroup() {
+					scopes = append(scopes, node.Entity.ID)
+				} else {
+					scopes = append(scopes, m.Subscriptions[node.Subscription].Scope())
+				}
+			}
+			break
+		}
+		page, _ := m.subscriptionMatches().Page(m.Cursor, m.listHeight())
+		for _, match := range page {
+			scopes = append(scopes, m.Subscriptions[match.Index].Scope())
+		}
+	case StepSelectResourceGroup:
+		page, _ := m.resourceGroupMatches().Page(m.Cursor, m.listHeight())
+		for _, match := range page {
+			scopes = append(scopes, m.ResourceGroups[match.Index].ID)
+		}
+	default:
+		m.stopPermissions()
+		return nil
+	}
+	return m.fetchPermissions(scopes)
+}
+
+// stopPermissions cancels the running permission checks. Their results
+// are dropped.
+func (m *Model) stopPermissions() {
+	if m.cancelPermissions != nil {
+		m.cancelPermissions()
+		m.cancelPermissions = nil
+	}
+	m.permissionsSeq++
+	m.checkingPermissions = make(map[string]bool)
+}
+
+// permissionsLoaded records the checked permissions. They only mark list
+// items; unchecked scopes are checked again before the ticket step.
+func (m *Model) permissionsLoaded(msg permissionsLoadedMsg) (tea.Model, tea.Cmd) {
+	if msg.seq != m.permissionsSeq {
+		return m, nil
+	}
+	for _, scope := range msg.scopes {
+		delete(m.checkingPermissions, strings.ToLower(scope))
+	}
+	for scope, allowed := range msg.allowed {
+		m.ExemptPermissions[strings.ToLower(scope)] = allowed
+	}
+	return m, nil
+}
+
+// permissionLabel marks a list item whose scope the signed-in account may
+// not create exemptions on.
+func (m *Model) permissionLabel(scope string) string {
+	if allowed, known := m.canExempt(scope); known && !allowed {
+		return " [no exemption permission]"
+	}
+	return ""
+}
+
+// checkPermission continues to the ticket step once the signed-in account
+// may create exemptions on the chosen scope, so that a missing role shows
+// up before the details are entered rather than when creating.
+func (m *Model) checkPermission() tea.Cmd {
+	scope := m.ResourceGroups[m.SelectedResourceGroup].ID
+	if allowed, known := m.canExempt(scope); m.RequestPath != "" || (known && allowed) {
+		m.startTicket()
+		return nil
+	}
+	return m.load(StepCheckingPermission, func(ctx context.Context) tea.Cmd {
+		return checkPermissionCmd(ctx, m.azureClient, scope)
+	})
+}
+
+// permissionChecked handles the result of the permission preflight. When
+// the permission could not be checked the wizard continues, as creating
+// the exemption may still succeed.
+func (m *Model) permissionChecked(msg permissionCheckedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.startTicket()
+		m.Status = "Unable to check your permission to create exemptions: " + msg.err.Error()
+		return m, nil
+	}
+	m.ExemptPermissions[strings.ToLower(msg.scope)] = msg.allowed
+	if !msg.allowed {
+		return m.Fail(&azure.PermissionError{Scope: msg.scope, Action: azure.ExemptionWriteAction})
+	}
+	m.startTicket()
+	return m, nil
+}
@@ -0,0 +1,146 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPermissionMarks(t *testing.T) {
+	client := &fakeAzureClient{denied: map[string]bool{"/subscriptions/locked": true, "/subscriptions/open/resourceGroups/locked": true}}
+	m := NewModel(context.Background(), client, nil)
+	runCmd(t, m, updateWith(t, m, subscriptionsLoadedMsg{subscriptions: []azure.Subscription{
+		{ID: "/subscriptions/locked", Name: "Locked"},
+		{ID: "/subscriptions/open", Name: "Open"},
+	}}))
+	view := m.View()
+	if !strings.Contains(view, "Locked (locked) [no exemption permission]") || strings.Contains(view, "Open (open) [no") {
+		t.Fatalf("subscription marks:\n%s", view)
+	}
+
+	// Resource groups of a subscription with the permission are not checked.
+	m.SelectedSubscription = 1
+	client.permissionScopes = nil
+	if cmd := updateWith(t, m, resourceGroupsLoadedMsg{resourceGroups: []azure.ResourceGroup{{ID: "/subscriptions/open/resourceGroups/app", Name: "app"}}}); cmd != nil {
+		t.Fatal("permissions inherited from the subscription were checked again")
+	}
+	if allowed, known := m.canExempt("/subscriptions/open/resourceGroups/app"); !allowed || !known {
+		t.Fatal("resource group does not inherit the subscription permission")
+	}
+
+	// Otherwise each resource group is checked.
+	m.SelectedSubscription = 0
+	m.ExemptPermissions = map[string]bool{"/subscriptions/open": false}
+	runCmd(t, m, updateWith(t, m, resourceGroupsLoadedMsg{resourceGroups: []azure.ResourceGroup{
+		{ID: "/subscriptions/open/resourceGroups/app", Name: "app"},
+		{ID: "/subscriptions/open/resourceGroups/locked", Name: "locked"},
+	}}))
+	if len(client.permissionScopes) != 3 {
+		t.Fatalf("checked scopes = %v", client.permissionScopes)
+	}
+	if view := m.View(); !strings.Contains(view, "locked [no exemption permission]") || strings.Contains(view, "app [no") {
+		t.Fatalf("resource group marks:\n%s", view)
+	}
+}
+
+func TestPermissionsCheckedByPage(t *testing.T) {
+	client := &fakeAzureClient{}
+	m := NewModel(context.Background(), client, nil)
+	m.Height = listChrome + 5
+	subs := make([]azure.Subscription, 40)
+	for i := range subs {
+		subs[i] = azure.Subscription{ID: fmt.Sprintf("/subscriptions/sub%02d", i), Name: fmt.Sprintf("Sub %02d", i)}
+	}
+	runCmd(t, m, updateWith(t, m, subscriptionsLoadedMsg{subscriptions: subs}))
+	if len(client.permissionScopes) != 5 || client.permissionScopes[0] != "/subscriptions/sub00" {
+		t.Fatalf("checked scopes = %v", client.permissionScopes)
+	}
+
+	// Paging checks the newly shown subscriptions only.
+	runCmd(t, m, press(t, m, tea.KeyPgDown))
+	checked := make(map[string]bool)
+	for _, scope := range client.permissionScopes {
+		if checked[scope] {
+			t.Fatalf("%s checked twice", scope)
+		}
+		checked[scope] = true
+	}
+	if len(checked) <= 5 || len(checked) > 10 || !checked["/subscriptions/sub05"] {
+		t.Fatalf("checked scopes = %v", client.permissionScopes)
+	}
+	if cmd := press(t, m, tea.KeyPgUp); cmd != nil {
+		if _, ok := cmd().(permissionsLoadedMsg); ok {
+			t.Fatal("known permissions were checked again")
+		}
+	}
+
+	// Leaving the list cancels the running checks and drops their results.
+	cmd := press(t, m, tea.KeyEnd)
+	var pending string
+	for scope := range m.checkingPermissions {
+		pending = scope
+	}
+	if pending == "" {
+		t.Fatal("no check is running")
+	}
+	ctx := m.permissionsCtx
+	m.Step = StepSelectAssignment
+	press(t, m, tea.KeyDown)
+	if ctx.Err() == nil {
+		t.Fatal("leaving the list did not cancel the checks")
+	}
+	runCmd(t, m, cmd)
+	if _, known := m.canExempt(pending); known {
+		t.Fatal("result of a cancelled check was kept")
+	}
+}
+
+func TestPermissionPreflight(t *testing.T) {
+	m := populatedModel()
+	client := m.azureClient.(*fakeAzureClient)
+	client.denied = map[string]bool{"/subscriptions/sub": true}
+	m.Step = StepSelectorsChoice
+	m.Cursor = 0
+
+	cmd := press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepCheckingPermission)
+	runCmd(t, m, cmd)
+	assertStep(t, m, StepError)
+	var permErr *azure.PermissionError
+	if !errors.As(m.Err, &permErr) || permErr.Scope != "/subscriptions/sub" || permErr.Action != azure.ExemptionWriteAction {
+		t.Fatalf("error = %v", m.Err)
+	}
+	if view := m.View(); !strings.Contains(view, "Not authorized") || !strings.Contains(view, "Resource Policy Contributor") {
+		t.Fatalf("error view:\n%s", view)
+	}
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectorsChoice)
+
+	// A failed check does not block the wizard.
+	client.err = errors.New("permissions API unavailable")
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepTicket)
+	if !strings.Contains(m.Status, "permissions API unavailable") {
+		t.Fatalf("status = %q", m.Status)
+	}
+}
+
+func TestPermissionsSkippedForRequests(t *testing.T) {
+	m := populatedModel()
+	m.RequestPath = "request.json"
+	m.azureClient.(*fakeAzureClient).denied = map[string]bool{"/subscriptions/sub": true}
+	if cmd := m.fetchPermissions([]string{"/subscriptions/sub"}); cmd != nil {
+		t.Fatal("permissions were checked for a request")
+	}
+	m.Step = StepSelectorsChoice
+	m.Cursor = 0
+	if cmd := press(t, m, tea.KeyEnter); cmd != nil {
+		t.Fatal("preflight ran for a request")
+	}
+	assertStep(t, m, StepTicket)
+}
@@ -0,0 +1,150 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// definitionPrefetchDelay is how long the cursor rests on an initiative
+// assignment before its members are loaded in the background.
+const definitionPrefetchDelay = 400 * time.Millisecond
+
+// assignmentPageMsg carries a later page of the assignments stream
+// identified by seq.
+type assignmentPageMsg struct {
+	seq  int
+	page assignmentsLoadedMsg
+}
+
+// assignmentIdleMsg is sent when the cursor rested on an assignment for
+// definitionPrefetchDelay after the cursor move identified by seq.
+type assignmentIdleMsg struct {
+	seq int
+}
+
+type definitionsPrefetchedMsg struct {
+	key    string
+	loaded assignmentDefinitionsLoadedMsg
+}
+
+type resourceGroupsPrefetchedMsg struct {
+	scope  string
+	loaded resourceGroupsLoadedMsg
+}
+
+// streamAssignments starts reading the later pages of the assignments
+// through more, which is nil when there are none.
+func (m *Model) streamAssignments(more tea.Cmd) tea.Cmd {
+	if more == nil {
+		m.stopStream()
+		return nil
+	}
+	m.LoadingMore = true
+	return m.nextAssignmentPage(more)
+}
+
+func (m *Model) nextAssignmentPage(more tea.Cmd) tea.Cmd {
+	seq := m.streamSeq
+	return func() tea.Msg {
+		return assignmentPageMsg{seq: seq, page: more().(assignmentsLoadedMsg)}
+	}
+}
+
+// stopStream stops reading assignment pages, if any are still arriving.
+func (m *Model) stopStream() {
+	if m.cancelStream != nil {
+		m.cancelStream()
+		m.cancelStream = nil
+	}
+	m.streamSeq++
+	m.LoadingMore = false
+}
+
+// assignmentPage merges a later page into the assignments. The cursor and
+// the chosen assignment stay on the same assignments. A failed page keeps
+// the assignments loaded so far.
+func (m *Model) assignmentPage(msg assignmentPageMsg) (tea.Model, tea.Cmd) {
+	if msg.seq != m.streamSeq {
+		return m, nil
+	}
+	page := msg.page
+	if page.err != nil || page.more == nil {
+		m.stopStream()
+		if page.err != nil {
+			m.Status = fmt.Sprintf("Not all policy assignments could be loaded: %v", page.err)
+		}
+		return m, nil
+	}
+
+	highlighted := m.highlightedAssignment()
+	chosen := ""
+	if m.SelectedAssignment >= 0 {
+		chosen = m.CurrentAssignment().ID
+	}
+	m.Assignments = append(m.Assignments, page.assignments...)
+	azure.SortAssignments(m.Assignments)
+	for i, assign := range m.Assignments {
+		if highlighted != "" && assign.ID == highlighted {
+			m.Cursor = i
+		}
+		if chosen != "" && assign.ID == chosen {
+			m.SelectedAssignment = i
+		}
+	}
+	return m, m.nextAssignmentPage(page.more)
+}
+
+// highlightedAssignment returns the ID of the assignment under the cursor
+// in the assignments step, or "" in other steps.
+func (m *Model) highlightedAssignment() string {
+	if m.Step != StepSelectAssignment || m.Cursor < 0 || m.Cursor >= len(m.Assignments) {
+		return ""
+	}
+	return m.Assignments[m.Cursor].ID
+}
+
+// prefetchAfterIdle starts waiting for the cursor to rest on the
+// highlighted assignment. Waits of earlier cursor moves are dropped.
+func (m *Model) prefetchAfterIdle() tea.Cmd {
+	m.idleSeq++
+	seq := m.idleSeq
+	return tea.Tick(definitionPrefetchDelay, func(time.Time) tea.Msg {
+		return assignmentIdleMsg{seq: seq}
+	})
+}
+
+// prefetchDefinitions loads the members of the highlighted initiative
+// assignment once the cursor rested on it, so that choosing it needs no
+// load.
+func (m *Model) prefetchDefinitions(msg assignmentIdleMsg) tea.Cmd {
+	if msg.seq != m.idleSeq || m.Step != StepSelectAssignment || !m.assignmentMatches().Contains(m.Cursor) {
+		return nil
+	}
+	assign := m.Assignments[m.Cursor]
+	key := strings.ToLower(assign.ID)
+	if _, ok := m.prefetchedDefinitions[key]; ok || m.IsDefinitionBlocked(assign.PolicyDefinitionID) ||
+		!strings.Contains(strings.ToLower(assign.PolicyDefinitionID), "policysetdefinitions") {
+		return nil
+	}
+	cmd := fetchAssignmentDefinitionsCmd(m.ctx, m.azureClient, assign)
+	return func() tea.Msg {
+		return definitionsPrefetchedMsg{key: key, loaded: cmd().(assignmentDefinitionsLoadedMsg)}
+	}
+}
+
+// prefetchResourceGroups loads the resource groups of sub in the
+// background while its assignments are chosen.
+func (m *Model) prefetchResourceGroups(sub azure.Subscription) tea.Cmd {
+	scope := strings.ToLower(sub.Scope())
+	if _, ok := m.prefetchedGroups[scope]; ok {
+		return nil
+	}
+	cmd := fetchResourceGroupsCmd(m.ctx, m.azureClient, sub)
+	return func() tea.Msg {
+		return resourceGroupsPrefetchedMsg{scope: scope, loaded: cmd().(resourceGroupsLoadedMsg)}
+	}
+}
@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func assignmentNames(m *Model) string {
+	var names []string
+	for _, a := range m.Assignments {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestAssignmentPagesStreamIntoTheList(t *testing.T) {
+	client := &fakeAzureClient{assignmentPages: [][]azure.PolicyAssignment{
+		{{ID: "/assignments/zulu", Name: "zulu", DisplayName: "Zulu"}, {ID: "/assignments/mike", Name: "mike", DisplayName: "Mike"}},
+		{{ID: "/assignments/alpha", Name: "alpha", DisplayName: "Alpha"}},
+	}}
+	m := NewModel(context.Background(), client, nil)
+	m.Subscriptions = []azure.Subscription{{ID: "/subscriptions/sub-1", Name: "Production"}}
+	m.SelectedSubscription = 0
+
+	first := fetchAssignmentsCmd(context.Background(), client, m.CurrentSubscription())().(assignmentsLoadedMsg)
+	updateWith(t, m, first)
+	assertStep(t, m, StepSelectAssignment)
+	if assignmentNames(m) != "mike,zulu" || !m.LoadingMore || !strings.Contains(m.View(), "Loading more assignments") {
+		t.Fatalf("first page = %s, loading more %v", assignmentNames(m), m.LoadingMore)
+	}
+
+	// The cursor stays on the highlighted assignment as pages arrive.
+	press(t, m, tea.KeyDown)
+	runCmd(t, m, m.nextAssignmentPage(first.more))
+	if assignmentNames(m) != "alpha,mike,zulu" || m.Cursor != 2 || !m.LoadingMore {
+		t.Fatalf("second page = %s, cursor %d", assignmentNames(m), m.Cursor)
+	}
+	runCmd(t, m, m.nextAssignmentPage(first.more))
+	if m.LoadingMore || m.cancelStream != nil {
+		t.Fatal("stream did not end after the last page")
+	}
+
+	// Pages of a stopped stream are dropped; a failed page keeps the list.
+	seq := m.streamSeq
+	m.LoadingMore = true
+	updateWith(t, m, assignmentPageMsg{seq: seq - 1, page: assignmentsLoadedMsg{assignments: []azure.PolicyAssignment{{ID: "/assignments/old"}}, more: first.more}})
+	updateWith(t, m, assignmentPageMsg{seq: seq, page: assignmentsLoadedMsg{err: errors.New("throttled")}})
+	if len(m.Assignments) != 3 || m.LoadingMore || !strings.Contains(m.Status, "throttled") {
+		t.Fatalf("after failed page: %s, loading more %v, status %q", assignmentNames(m), m.LoadingMore, m.Status)
+	}
+}
+
+func TestDefinitionsPrefetchedAfterIdle(t *testing.T) {
+	m := populatedModel()
+	client := m.azureClient.(*fakeAzureClient)
+	client.definitions = m.AssignmentDefinitions
+	m.Assignments = []azure.PolicyAssignment{
+		{ID: "/assignments/a", DisplayName: "Baseline", PolicyDefinitionID: "/providers/Microsoft.Authorization/policySetDefinitions/set"},
+		{ID: "/assignments/b", DisplayName: "Tags", PolicyDefinitionID: "/providers/Microsoft.Authorization/policyDefinitions/tags"},
+	}
+	m.Step = StepSelectAssignment
+	m.SelectedAssignment = -1
+
+	// Moving the cursor restarts the wait; single policies are not loaded.
+	seq := m.idleSeq
+	press(t, m, tea.KeyDown)
+	if m.idleSeq == seq {
+		t.Fatal("cursor move did not start a wait")
+	}
+	if cmd := updateWith(t, m, assignmentIdleMsg{seq: m.idleSeq}); cmd != nil {
+		t.Fatal("single policy was prefetched")
+	}
+	press(t, m, tea.KeyUp)
+	if cmd := updateWith(t, m, assignmentIdleMsg{seq: m.idleSeq - 1}); cmd != nil {
+		t.Fatal("stale wait started a prefetch")
+	}
+	runCmd(t, m, updateWith(t, m, assignmentIdleMsg{seq: m.idleSeq}))
+	if client.definitionAssignment.ID != "/assignments/a" || len(m.prefetchedDefinitions["/assignments/a"]) != 2 {
+		t.Fatalf("prefetched = %v", m.prefetchedDefinitions)
+	}
+
+	// Choosing the assignment needs no load.
+	client.err = errors.New("definitions were loaded again")
+	press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepAssignmentScope)
+	if len(m.AssignmentDefinitions) != 2 || m.SelectedAssignment != 0 {
+		t.Fatalf("definitions = %v, selected %d", m.AssignmentDefinitions, m.SelectedAssignment)
+	}
+}
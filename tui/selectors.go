@@ -0,0 +1,116 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	selectorLocation     = "Location"
+	selectorResourceType = "Resource type"
+)
+
+// selectorOption is a location or resource type that the exemption can be
+// limited to.
+type selectorOption struct {
+	Kind  string
+	Value string
+}
+
+func newSelectorOptions(facets azure.ResourceFacets) []selectorOption {
+	options := make([]selectorOption, 0, len(facets.Locations)+len(facets.ResourceTypes))
+	for _, loc := range facets.Locations {
+		options = append(options, selectorOption{Kind: selectorLocation, Value: loc})
+	}
+	for _, typ := range facets.ResourceTypes {
+		options = append(options, selectorOption{Kind: selectorResourceType, Value: typ})
+	}
+	return options
+}
+
+// resourceSelectors returns the chosen selectors in option order.
+func (m *Model) resourceSelectors() azure.ResourceSelectors {
+	var selectors azure.ResourceSelectors
+	for _, opt := range m.SelectorOptions {
+		if !m.SelectedSelectors[opt] {
+			continue
+		}
+		switch opt.Kind {
+		case selectorLocation:
+			selectors.Locations = append(selectors.Locations, opt.Value)
+		case selectorResourceType:
+			selectors.ResourceTypes = append(selectors.ResourceTypes, opt.Value)
+		}
+	}
+	return selectors
+}
+
+// chooseSelectors continues from the scope step to the selectors choice.
+func (m *Model) chooseSelectors() {
+	scope := m.ResourceGroups[m.SelectedResourceGroup].ID
+	if !strings.EqualFold(scope, m.SelectorScope) {
+		m.SelectorOptions = nil
+		m.SelectorScope = ""
+		m.SelectedSelectors = make(map[selectorOption]bool)
+	}
+	m.Step = StepSelectorsChoice
+	m.Cursor = 0
+	if len(m.SelectedSelectors) > 0 {
+		m.Cursor = 1
+	}
+	m.Status = "" // Help text is in the view
+}
+
+// restrictResources shows the selector picker, loading the locations and
+// resource types of the chosen scope first if needed.
+func (m *Model) restrictResources() tea.Cmd {
+	scope := m.ResourceGroups[m.SelectedResourceGroup].ID
+	if m.SelectorScope == scope && m.SelectorOptions != nil {
+		m.Step = StepSelectSelectors
+		m.Cursor = 0
+		m.Status = "" // Help text is in the view
+		return nil
+	}
+	return m.load(StepLoadingResourceFacets, func(ctx context.Context) tea.Cmd {
+		return fetchResourceFacetsCmd(ctx, m.azureClient, scope)
+	})
+}
+
+// startTicket continues to the ticket step.
+func (m *Model) startTicket() {
+	m.Step = StepTicket
+	m.TicketInput.SetValue("")
+	m.TicketInput.Focus()
+	m.Status = "" // Help text is in the view
+}
+
+func (m *Model) selectorsView(b *strings.Builder) {
+	b.WriteString("Limit the exemption to resources in these locations or of these types:\n\n")
+	start, end := visibleRange(m.Cursor, len(m.SelectorOptions), m.listHeight())
+	for i := start; i < end; i++ {
+		opt := m.SelectorOptions[i]
+		cursor := " "
+		if i == m.Cursor {
+			cursor = ">"
+		}
+		marker := " "
+		if m.SelectedSelectors[opt] {
+			marker = "x"
+		}
+		line := fmt.Sprintf("%s [%s] %-14s %s", cursor, marker, opt.Kind, opt.Value)
+		if width := m.rowWidth(""); width > 0 {
+			line = truncate(line, width)
+		}
+		if i == m.Cursor {
+			line = selectedStyle.Render(line)
+		}
+		fmt.Fprintf(b, "%s\n", line)
+	}
+	b.WriteString("\n" + dimStyle.Render(fmt.Sprintf("Showing %d-%d of %d", start+1, end, len(m.SelectorOptions))) + "\n")
+	b.WriteString(dimStyle.Render("Locations and resource types are combined: a resource must match both lists when both are set.") + "\n")
+	b.WriteString(m.navHint() + ", " + keyHint(m.Keys.Toggle, "toggle") + ", " + keyHint(m.Keys.Select, "continue") + ", " + keyHint(m.Keys.Back, "go back") + "\n")
+}
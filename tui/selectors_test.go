@@ -0,0 +1,77 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestResourceSelectorsFlow(t *testing.T) {
+	m := populatedModel()
+	client := m.azureClient.(*fakeAzureClient)
+	client.facets = azure.ResourceFacets{Locations: []string{"westeurope"}, ResourceTypes: []string{"Microsoft.Storage/storageAccounts"}}
+	m.Step = StepSelectResourceGroup
+	m.Cursor = 0
+	press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepSelectorsChoice)
+
+	press(t, m, tea.KeyDown)
+	cmd := press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepLoadingResourceFacets)
+	runCmd(t, m, cmd)
+	assertStep(t, m, StepSelectSelectors)
+	if client.facetScope != "/subscriptions/sub" || len(m.SelectorOptions) != 2 {
+		t.Fatalf("selector options = %#v for %q", m.SelectorOptions, client.facetScope)
+	}
+
+	press(t, m, tea.KeyEnter)
+	if !strings.Contains(m.Status, "at least one") {
+		t.Fatalf("empty selector validation = %q", m.Status)
+	}
+	press(t, m, tea.KeyDown)
+	press(t, m, tea.KeySpace)
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepTicket)
+	want := azure.ResourceSelectors{ResourceTypes: []string{"Microsoft.Storage/storageAccounts"}}
+	if got := m.ExemptionSpec().Selectors; !reflect.DeepEqual(got, want) {
+		t.Fatalf("selectors = %#v, want %#v", got, want)
+	}
+
+	// Going back keeps the loaded options and selection.
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectSelectors)
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectorsChoice)
+	if cmd := press(t, m, tea.KeyEnter); cmd != nil || m.Step != StepSelectSelectors {
+		t.Fatalf("cached options were reloaded, step = %d", m.Step)
+	}
+
+	m.Step = StepConfirm
+	if got := m.View(); !strings.Contains(got, "resource types: Microsoft.Storage/storageAccounts") {
+		t.Fatalf("confirm view = %q", got)
+	}
+
+	// Choosing all resources clears the selection.
+	m.Step = StepSelectorsChoice
+	m.Cursor = 0
+	press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepTicket)
+	if !m.ExemptionSpec().Selectors.IsEmpty() {
+		t.Fatal("selectors were not cleared")
+	}
+}
+
+func TestResourceSelectorsWithoutResources(t *testing.T) {
+	m := populatedModel()
+	m.Step = StepSelectorsChoice
+	m.Cursor = 1
+	cmd := press(t, m, tea.KeyEnter)
+	runCmd(t, m, cmd)
+	assertStep(t, m, StepSelectorsChoice)
+	if !strings.Contains(m.Status, "No resources") {
+		t.Fatalf("status = %q", m.Status)
+	}
+}
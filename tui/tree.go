@@ -0,0 +1,335 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// hierarchyNode is a row of the management group tree: a management group
+// or a subscription leaf.
+type hierarchyNode struct {
+	Entity azure.ManagementEntity
+	Depth  int
+	Parent int // index of the parent node, -1 at the top
+	// Subscription is the index into Subscriptions of a subscription leaf,
+	// -1 for management groups.
+	Subscription int
+	// Count is the number of subscriptions beneath a management group.
+	Count int
+}
+
+func (n hierarchyNode) isGroup() bool {
+	return n.Subscription < 0
+}
+
+// buildHierarchy arranges the management entities into a tree in
+// depth-first order, management groups before subscriptions and each by
+// name. Only subscriptions in subs become leaves; those missing from the
+// hierarchy are listed at the top level so that none is lost.
+func buildHierarchy(entities []azure.ManagementEntity, subs []azure.Subscription) []hierarchyNode {
+	subIndex := make(map[string]int, len(subs))
+	for i, sub := range subs {
+		subIndex[strings.ToLower(sub.ShortID())] = i
+	}
+	groups := make(map[string]bool)
+	for _, e := range entities {
+		if !e.IsSubscription() {
+			groups[strings.ToLower(e.ID)] = true
+		}
+	}
+	children := make(map[string][]azure.ManagementEntity)
+	placed := make(map[int]bool)
+	for _, e := range entities {
+		if e.IsSubscription() {
+			i, ok := subIndex[strings.ToLower(e.Name)]
+			if !ok {
+				continue
+			}
+			placed[i] = true
+		}
+		parent := strings.ToLower(e.ParentID)
+		if !groups[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], e)
+	}
+	for i, sub := range subs {
+		if !placed[i] {
+			children[""] = append(children[""], azure.ManagementEntity{ID: sub.Scope(), Name: sub.ShortID(), DisplayName: sub.Name, Type: "/subscriptions"})
+		}
+	}
+
+	var nodes []hierarchyNode
+	var add func(parent string, parentIndex, depth int) int
+	add = func(parent string, parentIndex, depth int) int {
+		list := children[parent]
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].IsSubscription() != list[j].IsSubscription() {
+				return !list[i].IsSubscription()
+			}
+			return strings.ToLower(list[i].Label()) < strings.ToLower(list[j].Label())
+		})
+		count := 0
+		for _, e := range list {
+			node := hierarchyNode{Entity: e, Depth: depth, Parent: parentIndex, Subscription: -1}
+			if e.IsSubscription() {
+				node.Subscription = subIndex[strings.ToLower(e.Name)]
+				nodes = append(nodes, node)
+				count++
+				continue
+			}
+			index := len(nodes)
+			nodes = append(nodes, node)
+			nodes[index].Count = add(strings.ToLower(e.ID), index, depth+1)
+			count += nodes[index].Count
+		}
+		return count
+	}
+	add("", -1, 0)
+	return nodes
+}
+
+// nodeVisible reports whether all management groups above node i are
+// expanded.
+func (m *Model) nodeVisible(i int) bool {
+	for p := m.Hierarchy[i].Parent; p >= 0; p = m.Hierarchy[p].Parent {
+		if !m.Expanded[strings.ToLower(m.Hierarchy[p].Entity.ID)] {
+			return false
+		}
+	}
+	return true
+}
+
+// treeMatches returns the rows of the tree view in tree order. Without a
+// search these are the nodes below expanded groups. A search covers the
+// whole tree and lists the matching nodes with their management groups,
+// which are marked disabled so that the cursor prefers the matches.
+func (m *Model) treeMatches() filterResult {
+	if strings.TrimSpace(m.SubscriptionFilter.Query) == "" {
+		var result filterResult
+		for i := range m.Hierarchy {
+			if m.nodeVisible(i) {
+				result = append(result, filterMatch{Index: i})
+			}
+		}
+		return result
+	}
+	items := make([]filterItem, len(m.Hierarchy))
+	for i, node := range m.Hierarchy {
+		items[i] = filterItem{Index: i, Label: node.Entity.Label(), Keys: []string{node.Entity.Name}}
+	}
+	found := make(map[int]filterMatch)
+	shown := make([]bool, len(m.Hierarchy))
+	for _, match := range m.SubscriptionFilter.Filter(items) {
+		found[match.Index] = match
+		for i := match.Index; i >= 0 && !shown[i]; i = m.Hierarchy[i].Parent {
+			shown[i] = true
+		}
+	}
+	var result filterResult
+	for i := range m.Hierarchy {
+		if !shown[i] {
+			continue
+		}
+		match, ok := found[i]
+		if !ok {
+			match = filterMatch{Index: i, Disabled: true}
+		}
+		result = append(result, match)
+	}
+	return result
+}
+
+// treeCursor returns the tree node of the chosen management group or of
+// subscription i, expanding the groups above it, or 0 if there is none.
+func (m *Model) treeCursor(sub int) int {
+	for i, node := range m.Hierarchy {
+		found := sub >= 0 && node.Subscription == sub
+		if m.ManagementGroup != nil {
+			found = strings.EqualFold(node.Entity.ID, m.ManagementGroup.ID)
+		}
+		if found {
+			for p := node.Parent; p >= 0; p = m.Hierarchy[p].Parent {
+				m.Expanded[strings.ToLower(m.Hierarchy[p].Entity.ID)] = true
+			}
+			return i
+		}
+	}
+	return 0
+}
+
+// toggleTreeView switches between the flat subscription list and the
+// management group tree, keeping the cursor on the same subscription. The
+// hierarchy is loaded the first time the tree is shown.
+func (m *Model) toggleTreeView() tea.Cmd {
+	m.Status = "" // Help text is in the view
+	if m.TreeView {
+		m.TreeView = false
+		node := m.Hierarchy[m.Cursor]
+		m.Cursor = max(node.Subscription, 0)
+		if matches := m.subscriptionMatches(); !matches.Contains(m.Cursor) && len(matches) > 0 {
+			m.Cursor = matches.First()
+		}
+		return nil
+	}
+	if m.entities == nil {
+		return m.load(StepLoadingHierarchy, func(ctx context.Context) tea.Cmd {
+			return fetchHierarchyCmd(ctx, m.azureClient)
+		})
+	}
+	m.showTree()
+	return nil
+}
+
+// showTree switches to the tree view with the cursor on the subscription
+// under the cursor of the flat list.
+func (m *Model) showTree() {
+	m.TreeView = true
+	m.Cursor = m.treeCursor(m.Cursor)
+	if matches := m.treeMatches(); !matches.Contains(m.Cursor) && len(matches) > 0 {
+		m.Cursor = matches.First()
+	}
+}
+
+// hierarchyLoaded builds the tree from the loaded management entities with
+// the top level groups expanded. The shown management groups are checked
+// for the exemption permission in the background, like subscriptions.
+func (m *Model) hierarchyLoaded(msg hierarchyLoadedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		return m.Fail(msg.err)
+	}
+	m.Step = StepSelectSubscription
+	m.Cursor = max(m.Cursor, 0)
+	if len(msg.entities) == 0 {
+		m.Status = "No management groups are visible to the signed-in account."
+		return m, nil
+	}
+	m.entities = msg.entities
+	m.Hierarchy = buildHierarchy(m.entities, m.Subscriptions)
+	for _, node := range m.Hierarchy {
+		if node.isGroup() && node.Parent < 0 {
+			m.Expanded[strings.ToLower(node.Entity.ID)] = true
+		}
+	}
+	m.showTree()
+	return m, m.checkVisiblePermissions()
+}
+
+// handleTreeKey handles the keys of the subscription step in the tree view.
+func (m *Model) handleTreeKey(msg tea.KeyMsg) tea.Cmd {
+	matches := m.treeMatches()
+	if m.navigate(msg, matches) {
+		return nil
+	}
+	switch {
+	case key.Matches(msg, m.Keys.GroupedView):
+		return m.toggleTreeView()
+	case key.Matches(msg, m.Keys.Toggle):
+		if !matches.Contains(m.Cursor) || !m.Hierarchy[m.Cursor].isGroup() {
+			return nil
+		}
+		id := strings.ToLower(m.Hierarchy[m.Cursor].Entity.ID)
+		m.Expanded[id] = !m.Expanded[id]
+	case key.Matches(msg, m.Keys.Select):
+		if !matches.Contains(m.Cursor) {
+			return nil
+		}
+		node := m.Hierarchy[m.Cursor]
+		if !node.isGroup() {
+			return m.chooseSubscription(node.Subscription)
+		}
+		return m.chooseManagementGroup(node.Entity)
+	}
+	return nil
+}
+
+// chooseManagementGroup continues with the management group as the scope
+// of the exemption and loads the assignments that apply to it.
+func (m *Model) chooseManagementGroup(group azure.ManagementEntity) tea.Cmd {
+	m.ManagementGroup = &group
+	m.SelectedSubscription = -1
+	m.SubscriptionFilter.Reset()
+	m.Compliance = nil
+	m.ComplianceErr = nil
+	return tea.Batch(
+		m.load(StepLoadingAssignments, func(ctx context.Context) tea.Cmd {
+			return fetchGroupAssignmentsCmd(ctx, m.azureClient, group)
+		}),
+		fetchGroupComplianceCmd(m.ctx, m.azureClient, group),
+	)
+}
+
+// backToSubscriptions returns to the subscription step with the cursor on
+// the subscription or management group chosen before.
+func (m *Model) backToSubscriptions() {
+	m.stopStream()
+	m.Step = StepSelectSubscription
+	if m.TreeView {
+		m.Cursor = m.treeCursor(m.SelectedSubscription)
+	} else {
+		m.Cursor = max(m.SelectedSubscription, 0)
+	}
+	m.SelectedSubscription = -1
+	m.ManagementGroup = nil
+	m.Status = "" // Help text is in the view
+}
+
+// treeView renders the management group tree with the rows matching the
+// search query.
+func (m *Model) treeView(b *strings.Builder) {
+	matches := m.treeMatches()
+	page, start := matches.Page(m.Cursor, m.listHeight())
+	for _, match := range page {
+		node := m.Hierarchy[match.Index]
+		cursor := " "
+		if match.Index == m.Cursor {
+			cursor = ">"
+		}
+		marker := " "
+		if !node.isGroup() && node.Subscription == m.SelectedSubscription {
+			marker = "x"
+		}
+		branch := "  "
+		suffix := fmt.Sprintf(" (%s)", node.Entity.Name)
+		if node.isGroup() {
+			branch = "▸ "
+			if m.Expanded[strings.ToLower(node.Entity.ID)] || m.SubscriptionFilter.Query != "" {
+				branch = "▾ "
+			}
+			suffix = fmt.Sprintf(" (%d subscriptions)", node.Count)
+			if node.Count == 1 {
+				suffix = " (1 subscription)"
+			}
+		}
+		base := lipgloss.NewStyle()
+		switch {
+		case match.Index == m.Cursor:
+			base = selectedStyle
+		case match.Disabled:
+			base = dimStyle // Shown as the path to a match
+		}
+		prefix := fmt.Sprintf("%s [%s] %s%s", cursor, marker, strings.Repeat("  ", node.Depth), branch)
+		fmt.Fprintf(b, "%s\n", listRow(prefix, node.Entity.Label(), suffix+m.permissionLabel(node.Entity.ID), match.Positions, base, m.rowWidth("")))
+	}
+	groups := 0
+	for _, node := range m.Hierarchy {
+		if node.isGroup() {
+			groups++
+		}
+	}
+	footer := fmt.Sprintf("No matches among %d management groups and %d subscriptions", groups, len(m.Hierarchy)-groups)
+	if len(matches) > 0 {
+		footer = fmt.Sprintf("Showing %d-%d of %d rows · %d management groups, %d subscriptions", start+1, start+len(page), len(matches), groups, len(m.Hierarchy)-groups)
+	}
+	b.WriteString("\n" + dimStyle.Render(footer) + "\n")
+	searching := m.searchingHint()
+	idle := m.navHint() + ", " + keyHint(m.Keys.Toggle, "expand/collapse") + ", " + m.searchHint("across the tree") + ", " + keyHint(m.Keys.Select, "select") + ", " + keyHint(m.Keys.GroupedView, "list view") + "\n"
+	b.WriteString(searchHints(m.SubscriptionFilter, searching, idle))
+}
@@ -0,0 +1,142 @@
+package tui
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	rootGroup = "/providers/Microsoft.Management/managementGroups/root"
+	corpGroup = "/providers/Microsoft.Management/managementGroups/corp"
+)
+
+func treeEntities() []azure.ManagementEntity {
+	return []azure.ManagementEntity{
+		{ID: "/subscriptions/prod", Name: "prod", DisplayName: "Production", Type: "/subscriptions", ParentID: corpGroup},
+		{ID: corpGroup, Name: "corp", DisplayName: "Corp", Type: "Microsoft.Management/managementGroups", ParentID: rootGroup},
+		{ID: rootGroup, Name: "root", DisplayName: "Tenant Root Group", Type: "Microsoft.Management/managementGroups"},
+		{ID: "/subscriptions/dev", Name: "dev", DisplayName: "Development", Type: "/subscriptions", ParentID: rootGroup},
+		{ID: "/subscriptions/hidden", Name: "hidden", DisplayName: "No access", Type: "/subscriptions", ParentID: rootGroup},
+	}
+}
+
+func treeModel(t *testing.T) (*Model, *fakeAzureClient) {
+	t.Helper()
+	client := &fakeAzureClient{entities: treeEntities()}
+	m := NewModel(context.Background(), client, nil)
+	updateWith(t, m, subscriptionsLoadedMsg{subscriptions: []azure.Subscription{
+		{ID: "/subscriptions/dev", Name: "Development"},
+		{ID: "/subscriptions/prod", Name: "Production"},
+		{ID: "/subscriptions/lone", Name: "Lone"},
+	}})
+	return m, client
+}
+
+func TestBuildHierarchy(t *testing.T) {
+	m, _ := treeModel(t)
+	nodes := buildHierarchy(treeEntities(), m.Subscriptions)
+	var rows []string
+	for _, node := range nodes {
+		rows = append(rows, strings.Repeat(" ", node.Depth)+node.Entity.Label())
+	}
+	want := []string{"Tenant Root Group", " Corp", "  Production", " Development", "Lone"}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("tree rows = %q, want %q", rows, want)
+	}
+	if nodes[0].Count != 2 || nodes[1].Count != 1 || nodes[2].Subscription != 1 || nodes[2].Parent != 1 || nodes[4].Subscription != 2 {
+		t.Fatalf("nodes = %+v", nodes)
+	}
+}
+
+func TestTreeView(t *testing.T) {
+	m, _ := treeModel(t)
+	m.Cursor = 1 // Production
+	cmd := press(t, m, tea.KeyCtrlG)
+	assertStep(t, m, StepLoadingHierarchy)
+	runCmd(t, m, cmd)
+	assertStep(t, m, StepSelectSubscription)
+	if !m.TreeView || m.Cursor != 2 {
+		t.Fatalf("tree view %v, cursor %d", m.TreeView, m.Cursor)
+	}
+	view := m.View()
+	for _, want := range []string{"▾ Tenant Root Group (2 subscriptions)", "▾ Corp (1 subscription)", "Production (prod)", "Showing 1-5 of 5 rows · 2 management groups, 3 subscriptions", "Ctrl+G list view"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("tree view is missing %q:\n%s", want, view)
+		}
+	}
+
+	// Collapsing a group hides the nodes beneath it.
+	m.Cursor = 1
+	press(t, m, tea.KeySpace)
+	if matches := m.treeMatches(); len(matches) != 4 || strings.Contains(m.View(), "Production") {
+		t.Fatalf("collapsed tree rows = %v", matches)
+	}
+
+	// A search covers collapsed groups and shows the path to the matches.
+	for _, r := range "prod" {
+		keyRune(t, m, r)
+	}
+	matches := m.treeMatches()
+	if len(matches) != 3 || !matches[0].Disabled || !matches[1].Disabled || m.Cursor != 2 {
+		t.Fatalf("search rows = %+v, cursor %d", matches, m.Cursor)
+	}
+
+	// Selecting a leaf continues with its subscription, and going back
+	// returns to it in the tree.
+	press(t, m, tea.KeyEnter) // Applies the search
+	press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepLoadingAssignments)
+	if m.SelectedSubscription != 1 || m.ManagementGroup != nil {
+		t.Fatalf("selected subscription %d, management group %v", m.SelectedSubscription, m.ManagementGroup)
+	}
+	m.Step = StepSelectAssignment
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectSubscription)
+	if m.Cursor != 2 || !m.nodeVisible(2) {
+		t.Fatalf("cursor %d after going back", m.Cursor)
+	}
+
+	press(t, m, tea.KeyCtrlG)
+	if m.TreeView || m.Cursor != 1 {
+		t.Fatalf("list view %v, cursor %d", !m.TreeView, m.Cursor)
+	}
+}
+
+func TestManagementGroupScope(t *testing.T) {
+	m, client := treeModel(t)
+	client.assignments = []azure.PolicyAssignment{{ID: "/assignments/a", DisplayName: "Baseline", Scope: rootGroup}}
+	runCmd(t, m, press(t, m, tea.KeyCtrlG))
+	m.Cursor = 1 // Corp
+
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepSelectAssignment)
+	if client.assignmentGroup != "corp" || m.ManagementGroup == nil || !strings.Contains(m.View(), "Policy assignments for management group Corp (corp)") {
+		t.Fatalf("assignments for group %q:\n%s", client.assignmentGroup, m.View())
+	}
+
+	// The management group is the scope; resource groups and selectors
+	// are skipped.
+	m.ExemptPermissions[strings.ToLower(corpGroup)] = true
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepTicket)
+	spec := m.ExemptionSpec()
+	if spec.Scope != corpGroup || spec.ScopeName != "Corp" || spec.SubscriptionName != "" {
+		t.Fatalf("exemption spec = %+v", spec)
+	}
+	if view := m.sidePane(); !strings.Contains(view, "Management group") {
+		t.Fatalf("side pane:\n%s", view)
+	}
+
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectAssignment)
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectSubscription)
+	if m.ManagementGroup != nil || m.Cursor != 1 {
+		t.Fatalf("management group %v, cursor %d", m.ManagementGroup, m.Cursor)
+	}
+}
@@ -1,23 +1,72 @@
 package tui
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/Lukas-Klein/azexempt/azure"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	from := m.Step
+	model, cmd := m.update(msg)
+	if m.Step != from {
+		if m.Step == StepError {
+			m.Logger.Warn("step failed", "step", m.FailedStep.String(), "error", m.Err)
+		} else {
+			m.Logger.Debug("step", "from", from.String(), "to", m.Step.String())
+		}
+	}
+	return model, cmd
+}
+
+func (m *Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.resize(msg.Width, msg.Height)
+		return m, m.checkVisiblePermissions()
+
+	case spinner.TickMsg:
+		if !isLoading(m.Step) {
+			return m, nil // Ends the tick loop
+		}
+		var cmd tea.Cmd
+		m.Spinner, cmd = m.Spinner.Update(msg)
+		return m, cmd
+
+	case loadResultMsg:
+		return m.finishLoad(msg)
+
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
+		if key.Matches(msg, m.Keys.ForceQuit) {
 			return m, tea.Quit
 		}
-		return m, m.handleKey(msg)
+		if m.ShowHelp {
+			// Any other key closes the help overlay.
+			m.ShowHelp = false
+			return m, nil
+		}
+		if !m.inputFocused() || !isText(msg) {
+			switch {
+			case key.Matches(msg, m.Keys.Quit):
+				return m, tea.Quit
+			case key.Matches(msg, m.Keys.Help):
+				m.ShowHelp = true
+				return m, nil
+			}
+		}
+		highlighted := m.highlightedAssignment()
+		cmd := m.handleKey(msg)
+		if m.Step == StepSelectAssignment && m.highlightedAssignment() != highlighted {
+			cmd = tea.Batch(cmd, m.prefetchAfterIdle())
+		}
+		return m, tea.Batch(cmd, m.checkVisiblePermissions())
 
 	case subscriptionsLoadedMsg:
 		if msg.err != nil {
@@ -29,172 +78,215 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Subscriptions = msg.subscriptions
 		m.Cursor = 0
 		m.SelectedSubscription = -1
+		if m.entities != nil {
+			m.Hierarchy = buildHierarchy(m.entities, m.Subscriptions)
+		}
 		m.Step = StepSelectSubscription
 		m.Status = "" // Help text is in the view
+		return m, m.checkVisiblePermissions()
+
+	case identityLoadedMsg:
+		// The identity is informational; failures only hide it.
+		if msg.err == nil {
+			m.Identity = &msg.principal
+		}
+		return m, nil
+
+	case cloudLoadedMsg:
+		if msg.err == nil {
+			m.Cloud = msg.cloud
+		}
 		return m, nil
 
+	case hierarchyLoadedMsg:
+		return m.hierarchyLoaded(msg)
+
 	case assignmentsLoadedMsg:
 		if msg.err != nil {
 			return m.Fail(msg.err)
 		}
 		if len(msg.assignments) == 0 {
-			sub := m.CurrentSubscription()
-			return m.Fail(fmt.Errorf("no policy assignments were returned for subscription %s (%s)", sub.Name, sub.ShortID()))
+			return m.Fail(fmt.Errorf("no policy assignments were returned for %s", m.targetLabel()))
 		}
 		m.Assignments = msg.assignments
+		azure.SortAssignments(m.Assignments)
 		m.SelectedAssignment = -1
 		m.AssignmentDefinitions = nil
 		m.SelectedDefinitionIDs = make(map[string]bool)
 		m.PartialExemption = false
-		m.AssignmentSearch = ""
+		m.AssignmentFilter.Reset()
+		m.OriginFilter = azure.ScopeUnknown
 		m.Cursor = 0
 		m.Step = StepSelectAssignment
 		m.Status = "" // Help text is in the view
-		return m, nil
+		return m, tea.Batch(m.streamAssignments(msg.more), m.prefetchAfterIdle())
+
+	case assignmentPageMsg:
+		return m.assignmentPage(msg)
+
+	case assignmentIdleMsg:
+		return m, m.prefetchDefinitions(msg)
 
 	case assignmentDefinitionsLoadedMsg:
+		return m, m.assignmentDefinitionsLoaded(msg)
+
+	case definitionsPrefetchedMsg:
+		// Failed prefetches are not kept; the load on Enter reports them.
+		if msg.loaded.err == nil {
+			m.prefetchedDefinitions[msg.key] = msg.loaded.definitions
+		}
+		return m, nil
+
+	case resourceGroupsLoadedMsg:
+		return m, m.resourceGroupsLoaded(msg)
+
+	case resourceGroupsPrefetchedMsg:
+		if msg.loaded.err == nil {
+			m.prefetchedGroups[msg.scope] = msg.loaded.resourceGroups
+		}
+		return m, nil
+
+	case resourceFacetsLoadedMsg:
+		if m.Step != StepLoadingResourceFacets {
+			return m, nil
+		}
 		if msg.err != nil {
 			return m.Fail(msg.err)
 		}
-		m.AssignmentDefinitions = msg.definitions
-		m.SelectedDefinitionIDs = make(map[string]bool)
-		m.PartialExemption = false
-		if len(msg.definitions) > 1 {
-			m.Step = StepAssignmentScope
+		m.SelectorOptions = newSelectorOptions(msg.facets)
+		m.SelectorScope = msg.scope
+		if len(m.SelectorOptions) == 0 {
+			m.Step = StepSelectorsChoice
 			m.Cursor = 0
-			m.Status = "" // Help text is in the view
+			m.Status = "No resources found in this scope to select from."
+			return m, nil
+		}
+		m.Step = StepSelectSelectors
+		m.Cursor = 0
+		m.Status = "" // Help text is in the view
+		return m, nil
+
+	case complianceLoadedMsg:
+		// Compliance data is informational; failures only hide the counts.
+		if !strings.EqualFold(msg.scope, m.targetScope()) {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.ComplianceErr = msg.err
+			return m, nil
+		}
+		m.Compliance = &msg.summary
+		return m, nil
+
+	case scopeComplianceLoadedMsg:
+		// A count for a scope, assignment or definitions left since is stale.
+		if msg.seq != m.scopeComplianceSeq {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.ScopeComplianceErr = msg.err
+			return m, nil
+		}
+		m.ScopeNonCompliant = msg.count
+		return m, nil
+
+	case assignmentDetailsLoadedMsg:
+		// Details are informational; failures are shown inside the pane.
+		if msg.err != nil {
+			m.detailErrs[msg.key] = msg.err
 		} else {
-			m.PartialExemption = false
-			m.Step = StepLoadingResourceGroups
-			m.Status = "" // Loading state shown in view
-			return m, fetchResourceGroupsCmd(m.ctx, m.azureClient, m.CurrentSubscription())
+			m.AssignmentDetails[msg.key] = msg.details
+		}
+		if m.DetailOpen && m.DetailKey == msg.key {
+			m.refreshDetails()
 		}
 		return m, nil
 
-	case resourceGroupsLoadedMsg:
+	case definitionDetailsLoadedMsg:
 		if msg.err != nil {
-			return m.Fail(msg.err)
+			m.detailErrs[msg.key] = msg.err
+		} else {
+			m.DefinitionDetails[msg.key] = msg.details
 		}
-		// Prepend "Entire Subscription" option
-		sub := m.CurrentSubscription()
-		entireSub := azure.ResourceGroup{
-			Name: "Entire Subscription",
-			ID:   sub.Scope(),
+		if m.DetailOpen && m.DetailKey == msg.key {
+			m.refreshDetails()
 		}
-		m.ResourceGroups = append([]azure.ResourceGroup{entireSub}, msg.resourceGroups...)
-		m.SelectedResourceGroup = -1
-		m.Cursor = 0
-		m.Step = StepSelectResourceGroup
-		m.Status = "" // Help text is in the view
 		return m, nil
 
+	case permissionsLoadedMsg:
+		return m.permissionsLoaded(msg)
+
+	case permissionCheckedMsg:
+		return m.permissionChecked(msg)
+
 	case exemptionCreatedMsg:
 		if msg.err != nil {
 			return m.Fail(msg.err)
 		}
-		m.CreateOutput = msg.output
+		m.Created = msg.exemption
+		m.Step = StepDone
+		m.Status = "" // Help text is in the view
+		return m, nil
+
+	case requestWrittenMsg:
+		if msg.err != nil {
+			return m.Fail(msg.err)
+		}
+		m.OutputPath = msg.path
+		m.RequestDigest = msg.digest
 		m.Step = StepDone
 		m.Status = "" // Help text is in the view
 		return m, nil
+
+	case iacWrittenMsg:
+		return m.iacWritten(msg)
 	}
 
 	return m, nil
 }
 
 func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	if m.DetailOpen {
+		return m.handleDetailKey(msg)
+	}
+	if m.handleFilterKey(msg) {
+		return nil
+	}
+
 	switch m.Step {
 	case StepSelectSubscription:
-		switch msg.String() {
-		case "up", "k":
-			if m.Cursor > 0 {
-				m.Cursor--
-			}
-		case "down", "j":
-			if m.Cursor < len(m.Subscriptions)-1 {
-				m.Cursor++
-			}
-		case "enter":
-			if len(m.Subscriptions) == 0 {
+		if m.TreeView {
+			return m.handleTreeKey(msg)
+		}
+		matches := m.subscriptionMatches()
+		if m.navigate(msg, matches) {
+			return nil
+		}
+		switch {
+		case key.Matches(msg, m.Keys.Select):
+			if !matches.Contains(m.Cursor) {
 				return nil
 			}
-			m.SelectedSubscription = m.Cursor
-			m.SubscriptionSearch = ""
-			m.Step = StepLoadingAssignments
-			m.Status = "" // Loading state shown in view
-			return fetchAssignmentsCmd(m.ctx, m.azureClient, m.CurrentSubscription())
-		case "backspace":
-			// Delete the last character from the search buffer
-			if len(m.SubscriptionSearch) > 0 {
-				m.SubscriptionSearch = m.SubscriptionSearch[:len(m.SubscriptionSearch)-1]
-				if m.SubscriptionSearch == "" {
-					m.Status = "" // Help text is in the view
-				} else {
-					// Re-search with the updated query
-					searchLower := strings.ToLower(m.SubscriptionSearch)
-					for i, sub := range m.Subscriptions {
-						if strings.Contains(strings.ToLower(sub.Name), searchLower) {
-							m.Cursor = i
-							break
-						}
-					}
-				}
-			}
-		case "esc":
-			m.SubscriptionSearch = ""
-			m.Status = "" // Help text is in the view
-		default:
-			// Handle type-ahead search for subscriptions
-			key := msg.String()
-			if isSearchKey(key) {
-				m.SubscriptionSearch += key
-				// Find and select the subscription that matches the search
-				searchLower := strings.ToLower(m.SubscriptionSearch)
-				for i, sub := range m.Subscriptions {
-					if strings.Contains(strings.ToLower(sub.Name), searchLower) {
-						m.Cursor = i
-						break
-					}
-				}
-				m.Status = "" // Search query is shown in the view
-			}
+			return m.chooseSubscription(m.Cursor)
+		case key.Matches(msg, m.Keys.GroupedView):
+			return m.toggleTreeView()
 		}
 
 	case StepSelectAssignment:
-		switch msg.String() {
-		case "up", "k":
-			if m.Cursor > 0 {
-				m.Cursor--
-			}
-		case "down", "j":
-			if m.Cursor < len(m.Assignments)-1 {
-				m.Cursor++
-			}
-		case "backspace":
-			if m.AssignmentSearch != "" {
-				// Delete the last character from the search buffer and re-jump
-				m.AssignmentSearch = m.AssignmentSearch[:len(m.AssignmentSearch)-1]
-				if m.AssignmentSearch != "" {
-					if idx := m.firstAssignmentMatch(m.AssignmentSearch); idx >= 0 {
-						m.Cursor = idx
-					}
-				}
-				m.Status = "" // Search query is shown in the view
+		matches := m.assignmentMatches()
+		if m.navigate(msg, matches) {
+			return nil
+		}
+		switch {
+		case key.Matches(msg, m.Keys.Details):
+			if !matches.Contains(m.Cursor) {
 				return nil
 			}
-			// Empty search: go back to subscription selection
-			m.Step = StepSelectSubscription
-			m.Cursor = m.SelectedSubscription
-			if m.Cursor < 0 {
-				m.Cursor = 0
-			}
-			m.SelectedSubscription = -1
-			m.Status = "" // Help text is in the view
-			return nil
-		case "esc":
-			m.AssignmentSearch = ""
-			m.Status = "" // Help text is in the view
-		case "enter":
-			if len(m.Assignments) == 0 {
+			return m.openDetails()
+		case key.Matches(msg, m.Keys.OriginFilter):
+			m.cycleOriginFilter()
+		case key.Matches(msg, m.Keys.Select):
+			if !matches.Contains(m.Cursor) {
 				return nil
 			}
 			// Check if the assignment's policy definition is blocked
@@ -204,33 +296,29 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 				return nil
 			}
 			m.SelectedAssignment = m.Cursor
-			m.AssignmentSearch = ""
-			m.Step = StepLoadingAssignmentDefinitions
-			m.Status = "" // Loading state shown in view
-			return fetchAssignmentDefinitionsCmd(m.ctx, m.azureClient, m.CurrentAssignment())
-		default:
-			// Handle type-ahead search for assignments
-			key := msg.String()
-			if isSearchKey(key) {
-				m.AssignmentSearch += key
-				if idx := m.firstAssignmentMatch(m.AssignmentSearch); idx >= 0 {
-					m.Cursor = idx
-				}
-				m.Status = "" // Search query is shown in the view
-			}
+			m.AssignmentFilter.Reset()
+			if definitions, ok := m.prefetchedDefinitions[strings.ToLower(assign.ID)]; ok {
+				return m.assignmentDefinitionsLoaded(assignmentDefinitionsLoadedMsg{definitions: definitions})
+			}
+			return m.load(StepLoadingAssignmentDefinitions, func(ctx context.Context) tea.Cmd {
+				return fetchAssignmentDefinitionsCmd(ctx, m.azureClient, m.CurrentAssignment())
+			})
+		case key.Matches(msg, m.Keys.Back):
+			m.backToSubscriptions()
+			return nil
 		}
 
 	case StepAssignmentScope:
-		switch msg.String() {
-		case "up", "k":
+		switch {
+		case key.Matches(msg, m.Keys.Up):
 			if m.Cursor > 0 {
 				m.Cursor--
 			}
-		case "down", "j":
+		case key.Matches(msg, m.Keys.Down):
 			if m.Cursor < 1 {
 				m.Cursor++
 			}
-		case "backspace":
+		case key.Matches(msg, m.Keys.Back):
 			// Go back to assignment selection
 			m.Step = StepSelectAssignment
 			m.Cursor = m.SelectedAssignment
@@ -240,54 +328,65 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 			m.SelectedAssignment = -1
 			m.Status = "" // Help text is in the view
 			return nil
-		case "enter":
+		case key.Matches(msg, m.Keys.Select):
 			if m.Cursor == 0 {
 				m.PartialExemption = false
-				m.Step = StepLoadingResourceGroups
-				m.Status = "" // Loading state shown in view
-				return fetchResourceGroupsCmd(m.ctx, m.azureClient, m.CurrentSubscription())
+				return m.chooseScope()
 			}
 			m.PartialExemption = true
 			m.Step = StepSelectDefinitions
-			m.DefinitionSearch = ""
+			m.DefinitionFilter.Reset()
+			m.EffectFilter = ""
+			m.GroupedView = false
 			m.Cursor = 0
 			m.Status = "" // Help text is in the view
 			return nil
 		}
 
 	case StepSelectDefinitions:
-		switch msg.String() {
-		case "up", "k":
-			if m.Cursor > 0 {
-				m.Cursor--
-			}
-		case "down", "j":
-			if m.Cursor < len(m.AssignmentDefinitions)-1 {
-				m.Cursor++
+		var groups []definitionGroup
+		var matches filterResult
+		if m.GroupedView {
+			groups = m.definitionGroups()
+			matches = m.groupMatches(groups)
+		} else {
+			matches = m.definitionMatches()
+		}
+		if m.navigate(msg, matches) {
+			return nil
+		}
+		switch {
+		case key.Matches(msg, m.Keys.EffectFilter):
+			m.cycleEffectFilter()
+			if m.GroupedView {
+				m.Cursor = max(m.groupMatches(m.definitionGroups()).First(), 0)
+			}
+			m.Status = "" // Filter is shown in the view
+		case key.Matches(msg, m.Keys.GroupedView):
+			m.GroupedView = !m.GroupedView
+			m.DefinitionFilter.Reset()
+			m.Cursor = 0
+			if first := m.definitionMatches().First(); !m.GroupedView && first >= 0 {
+				m.Cursor = first
+			}
+			m.Status = "" // View mode is shown in the view
+		case key.Matches(msg, m.Keys.SelectAll):
+			m.changeSelection(selectAll)
+		case key.Matches(msg, m.Keys.SelectNone):
+			m.changeSelection(selectNone)
+		case key.Matches(msg, m.Keys.InvertSelection):
+			m.changeSelection(invertSelection)
+		case key.Matches(msg, m.Keys.Details):
+			if m.GroupedView || !matches.Contains(m.Cursor) {
+				return nil
 			}
-		case "backspace":
-			if m.DefinitionSearch != "" {
-				// Delete the last character from the search buffer and re-jump
-				m.DefinitionSearch = m.DefinitionSearch[:len(m.DefinitionSearch)-1]
-				if m.DefinitionSearch != "" {
-					if idx := m.firstDefinitionMatch(m.DefinitionSearch); idx >= 0 {
-						m.Cursor = idx
-					}
-				}
-				m.Status = "" // Search query is shown in the view
+			return m.openDetails()
+		case key.Matches(msg, m.Keys.Toggle):
+			if !matches.Contains(m.Cursor) {
 				return nil
 			}
-			// Empty search: go back to assignment scope selection
-			m.Step = StepAssignmentScope
-			m.Cursor = 1 // "Exempt specific definitions" was selected
-			m.SelectedDefinitionIDs = make(map[string]bool)
-			m.Status = "" // Help text is in the view
-			return nil
-		case "esc":
-			m.DefinitionSearch = ""
-			m.Status = "" // Help text is in the view
-		case " ":
-			if len(m.AssignmentDefinitions) == 0 {
+			if m.GroupedView {
+				m.toggleGroup(groups[m.Cursor])
 				return nil
 			}
 			ref := m.AssignmentDefinitions[m.Cursor]
@@ -302,7 +401,7 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 				m.SelectedDefinitionIDs[ref.ReferenceID] = true
 			}
 			m.Status = "" // Clear any previous status
-		case "enter":
+		case key.Matches(msg, m.Keys.Select):
 			if len(m.AssignmentDefinitions) == 0 {
 				return nil
 			}
@@ -310,76 +409,110 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 				m.Status = "Select at least one definition or go back."
 				return nil
 			}
-			m.DefinitionSearch = ""
-			m.Step = StepLoadingResourceGroups
-			m.Status = "" // Loading state shown in view
-			return fetchResourceGroupsCmd(m.ctx, m.azureClient, m.CurrentSubscription())
-		default:
-			// Handle type-ahead search for definitions.
-			// Space is reserved for toggling, so it is excluded from the search whitelist.
-			key := msg.String()
-			if isSearchKey(key) && key != " " {
-				m.DefinitionSearch += key
-				if idx := m.firstDefinitionMatch(m.DefinitionSearch); idx >= 0 {
-					m.Cursor = idx
-				}
-				m.Status = "" // Search query is shown in the view
-			}
+			m.DefinitionFilter.Reset()
+			return m.chooseScope()
+		case key.Matches(msg, m.Keys.Back):
+			// Go back to assignment scope selection
+			m.Step = StepAssignmentScope
+			m.Cursor = 1 // "Exempt specific definitions" was selected
+			m.SelectedDefinitionIDs = make(map[string]bool)
+			m.Status = "" // Help text is in the view
+			return nil
 		}
 
 	case StepSelectResourceGroup:
-		switch msg.String() {
-		case "up", "k":
+		matches := m.resourceGroupMatches()
+		if m.navigate(msg, matches) {
+			return nil
+		}
+		switch {
+		case key.Matches(msg, m.Keys.Back):
+			m.backBeforeScope()
+			return nil
+		case key.Matches(msg, m.Keys.Select):
+			if !matches.Contains(m.Cursor) {
+				return nil
+			}
+			m.SelectedResourceGroup = m.Cursor
+			m.ResourceGroupFilter.Reset()
+			m.chooseSelectors()
+			return nil
+		}
+
+	case StepSelectorsChoice:
+		switch {
+		case key.Matches(msg, m.Keys.Up):
 			if m.Cursor > 0 {
 				m.Cursor--
 			}
-		case "down", "j":
-			if m.Cursor < len(m.ResourceGroups)-1 {
+		case key.Matches(msg, m.Keys.Down):
+			if m.Cursor < 1 {
 				m.Cursor++
 			}
-		case "backspace":
-			// Go back to the appropriate step
-			if m.PartialExemption {
-				m.Step = StepSelectDefinitions
-				m.DefinitionSearch = ""
-				m.Cursor = 0
-				m.Status = "" // Help text is in the view
-			} else if len(m.AssignmentDefinitions) > 1 {
-				m.Step = StepAssignmentScope
+		case key.Matches(msg, m.Keys.Back):
+			// Go back to scope selection
+			m.Step = StepSelectResourceGroup
+			m.Cursor = m.SelectedResourceGroup
+			if m.Cursor < 0 {
 				m.Cursor = 0
-				m.Status = "" // Help text is in the view
-			} else {
-				m.Step = StepSelectAssignment
-				m.Cursor = m.SelectedAssignment
-				if m.Cursor < 0 {
-					m.Cursor = 0
-				}
-				m.SelectedAssignment = -1
-				m.Status = "" // Help text is in the view
 			}
+			m.SelectedResourceGroup = -1
+			m.Status = "" // Help text is in the view
 			return nil
-		case "enter":
-			if len(m.ResourceGroups) == 0 {
+		case key.Matches(msg, m.Keys.Select):
+			if m.Cursor == 0 {
+				// All resources in scope
+				m.SelectedSelectors = make(map[selectorOption]bool)
+				return m.checkPermission()
+			}
+			return m.restrictResources()
+		}
+
+	case StepSelectSelectors:
+		if m.navigate(msg, unfiltered(len(m.SelectorOptions))) {
+			return nil
+		}
+		switch {
+		case key.Matches(msg, m.Keys.Toggle):
+			if m.Cursor >= len(m.SelectorOptions) {
 				return nil
 			}
-			m.SelectedResourceGroup = m.Cursor
-			m.Step = StepTicket
-			m.TicketInput.SetValue("")
-			m.TicketInput.Focus()
+			opt := m.SelectorOptions[m.Cursor]
+			if m.SelectedSelectors[opt] {
+				delete(m.SelectedSelectors, opt)
+			} else {
+				m.SelectedSelectors[opt] = true
+			}
+			m.Status = "" // Clear any previous status
+		case key.Matches(msg, m.Keys.Back):
+			m.Step = StepSelectorsChoice
+			m.Cursor = 1  // "Only specific locations or resource types" was selected
 			m.Status = "" // Help text is in the view
 			return nil
+		case key.Matches(msg, m.Keys.Select):
+			if len(m.SelectedSelectors) == 0 {
+				m.Status = "Select at least one location or resource type or go back."
+				return nil
+			}
+			return m.checkPermission()
 		}
 
 	case StepTicket:
 		// Check for backspace when input is empty to go back
 		if msg.Type == tea.KeyBackspace && m.TicketInput.Value() == "" {
-			m.Step = StepSelectResourceGroup
-			m.Cursor = m.SelectedResourceGroup
-			if m.Cursor < 0 {
+			m.TicketInput.Blur()
+			if m.ManagementGroup != nil {
+				m.backBeforeScope()
+				return nil
+			}
+			if len(m.SelectedSelectors) > 0 {
+				m.Step = StepSelectSelectors
 				m.Cursor = 0
+				m.Status = "" // Help text is in the view
+				return nil
 			}
-			m.SelectedResourceGroup = -1
-			m.TicketInput.Blur()
+			m.Step = StepSelectorsChoice
+			m.Cursor = 0
 			m.Status = "" // Help text is in the view
 			return nil
 		}
@@ -429,35 +562,33 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 		return textCmd
 
 	case StepExpirationChoice:
-		switch msg.String() {
-		case "up", "k":
+		switch {
+		case key.Matches(msg, m.Keys.Up):
 			if m.Cursor > 0 {
 				m.Cursor--
 			}
-		case "down", "j":
+		case key.Matches(msg, m.Keys.Down):
 			if m.Cursor < 1 {
 				m.Cursor++
 			}
-		case "backspace":
+		case key.Matches(msg, m.Keys.Back):
 			// Go back to users step
 			m.Step = StepUsers
 			m.UserInput.SetValue(m.RequestUser)
 			m.UserInput.Focus()
 			m.Status = "" // Help text is in the view
 			return nil
-		case "enter":
+		case key.Matches(msg, m.Keys.Select):
 			if m.Cursor == 0 {
 				// Unlimited
 				m.ExpirationDate = ""
-				m.Step = StepConfirm
-				m.Status = "" // Help text is in the view
-			} else {
-				// Set Date
-				m.Step = StepExpirationDate
-				m.ExpirationInput.SetValue(time.Now().AddDate(0, 0, 30).Format("2006-01-02"))
-				m.ExpirationInput.Focus()
-				m.Status = "" // Help text is in the view
+				return m.confirm()
 			}
+			// Set Date
+			m.Step = StepExpirationDate
+			m.ExpirationInput.SetValue(time.Now().AddDate(0, 0, 30).Format("2006-01-02"))
+			m.ExpirationInput.Focus()
+			m.Status = "" // Help text is in the view
 			return nil
 		}
 
@@ -485,16 +616,14 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 				return textCmd
 			}
 			m.ExpirationDate = value
-			m.Step = StepConfirm
 			m.ExpirationInput.Blur()
-			m.Status = "" // Help text is in the view
-			return textCmd
+			return tea.Batch(textCmd, m.confirm())
 		}
 		return textCmd
 
 	case StepConfirm:
-		switch msg.String() {
-		case "backspace":
+		switch {
+		case key.Matches(msg, m.Keys.Back):
 			// Go back to the expiration choice step
 			m.Step = StepExpirationChoice
 			if m.ExpirationDate == "" {
@@ -504,24 +633,45 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 			}
 			m.Status = "" // Help text is in the view
 			return nil
-		case "enter":
-			if m.SelectedAssignment < 0 || m.Ticket == "" || m.RequestUser == "" || m.SelectedSubscription < 0 || m.SelectedResourceGroup < 0 {
+		case key.Matches(msg, m.Keys.Select):
+			if m.SelectedAssignment < 0 || m.Ticket == "" || m.RequestUser == "" || (m.SelectedSubscription < 0 && m.ManagementGroup == nil) || m.SelectedResourceGroup < 0 {
 				m.Status = "Missing information. Use q to abort."
 				return nil
 			}
-			m.Step = StepCreating
-			assign := m.CurrentAssignment()
-			rg := m.ResourceGroups[m.SelectedResourceGroup]
-			sub := m.CurrentSubscription()
-			m.Status = "" // Loading state shown in view
-			return createExemptionCmd(m.ctx, m.azureClient, rg.ID, rg.Name, sub.Name, assign, m.SelectedDefinitionIDs, m.Ticket, m.RequestUser, m.ExpirationDate)
+			if m.RequestPath != "" {
+				return m.load(StepCreating, func(ctx context.Context) tea.Cmd {
+					return writeRequestCmd(ctx, m.azureClient, m.RequestPath, m.ExemptionSpec(), m.selectedDefinitions())
+				})
+			}
+			return m.load(StepCreating, func(ctx context.Context) tea.Cmd {
+				return createExemptionCmd(ctx, m.azureClient, m.ExemptionSpec())
+			})
+		case key.Matches(msg, m.Keys.Generate):
+			m.Step = StepGenerate
+			m.Cursor = 0
+			m.Status = "" // Help text is in the view
 		}
 
-	case StepError, StepLoadingAssignmentDefinitions, StepLoadingAssignments, StepLoadingSubscriptions, StepLoadingResourceGroups, StepCreating:
-		// No interactive keys beyond quit for these states.
+	case StepGenerate:
+		return m.handleGenerateKey(msg)
+
+	case StepError:
+		switch {
+		case key.Matches(msg, m.Keys.Retry):
+			return m.retry()
+		case key.Matches(msg, m.Keys.Back):
+			m.backFromError()
+		case key.Matches(msg, m.Keys.CopyError):
+			m.copyError()
+		}
+	case StepLoadingAssignmentDefinitions, StepLoadingAssignments, StepLoadingSubscriptions, StepLoadingHierarchy, StepLoadingResourceGroups, StepLoadingResourceFacets, StepCheckingPermission, StepCreating:
+		if key.Matches(msg, m.Keys.Cancel) {
+			m.cancel()
+		}
 	case StepDone:
-		// Allow creating a new exemption by pressing Enter
-		if msg.Type == tea.KeyEnter {
+		// Allow creating a new exemption by pressing Enter. A saved request
+		// is not reset, as another run would overwrite the request file.
+		if key.Matches(msg, m.Keys.Select) && m.RequestPath == "" {
 			return m.Reset()
 		}
 	}
@@ -529,17 +679,238 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 	return nil
 }
 
-// isSearchKey reports whether a key press should be appended to a type-ahead
-// search buffer. Only single printable characters in the whitelist
-// [a-zA-Z0-9 _-] are accepted; this mirrors the characters allowed when
-// searching subscriptions.
-func isSearchKey(key string) bool {
-	if len(key) != 1 {
+// chooseSubscription continues with subscription i and loads its
+// assignments.
+func (m *Model) chooseSubscription(i int) tea.Cmd {
+	m.SelectedSubscription = i
+	m.ManagementGroup = nil
+	m.SubscriptionFilter.Reset()
+	m.Compliance = nil
+	m.ComplianceErr = nil
+	sub := m.CurrentSubscription()
+	return tea.Batch(
+		m.load(StepLoadingAssignments, func(ctx context.Context) tea.Cmd {
+			return fetchAssignmentsCmd(ctx, m.azureClient, sub)
+		}),
+		fetchComplianceCmd(m.ctx, m.azureClient, sub),
+		m.prefetchResourceGroups(sub),
+	)
+}
+
+// assignmentDefinitionsLoaded continues with the members of the chosen
+// assignment: the choice between the entire initiative and some of its
+// members, or, for a single policy, the scope.
+func (m *Model) assignmentDefinitionsLoaded(msg assignmentDefinitionsLoadedMsg) tea.Cmd {
+	if msg.err != nil {
+		m.Fail(msg.err)
+		return nil
+	}
+	m.AssignmentDefinitions = msg.definitions
+	m.SelectedDefinitionIDs = make(map[string]bool)
+	m.PartialExemption = false
+	if len(msg.definitions) > 1 {
+		m.Step = StepAssignmentScope
+		m.Cursor = 0
+		m.Status = "" // Help text is in the view
+		return nil
+	}
+	return m.chooseScope()
+}
+
+// resourceGroupsLoaded lists the resource groups of the subscription as
+// scopes, after the entire subscription.
+func (m *Model) resourceGroupsLoaded(msg resourceGroupsLoadedMsg) tea.Cmd {
+	if msg.err != nil {
+		m.Fail(msg.err)
+		return nil
+	}
+	// Prepend "Entire Subscription" option
+	sub := m.CurrentSubscription()
+	entireSub := azure.ResourceGroup{
+		Name: "Entire Subscription",
+		ID:   sub.Scope(),
+	}
+	m.ResourceGroups = append([]azure.ResourceGroup{entireSub}, msg.resourceGroups...)
+	if limit := m.assignmentScopeLimit(); limit != "" {
+		m.ResourceGroups = azure.ScopesWithin(m.ResourceGroups, limit)
+	}
+	m.SelectedResourceGroup = -1
+	m.ResourceGroupFilter.Reset()
+	m.Cursor = 0
+	m.Step = StepSelectResourceGroup
+	m.Status = "" // Help text is in the view
+	return m.checkVisiblePermissions()
+}
+
+// chooseScope continues to the scope step. A management group is the only
+// scope within itself, so it is taken as chosen and the resource selectors,
+// which are picked from the resources of a subscription, are skipped.
+func (m *Model) chooseScope() tea.Cmd {
+	if m.ManagementGroup != nil {
+		m.ResourceGroups = []azure.ResourceGroup{{Name: m.ManagementGroup.Label(), ID: m.ManagementGroup.ID}}
+		m.SelectedResourceGroup = 0
+		m.SelectedSelectors = make(map[selectorOption]bool)
+		return m.checkPermission()
+	}
+	if rgs, ok := m.prefetchedGroups[strings.ToLower(m.CurrentSubscription().Scope())]; ok {
+		return m.resourceGroupsLoaded(resourceGroupsLoadedMsg{resourceGroups: rgs})
+	}
+	return m.load(StepLoadingResourceGroups, func(ctx context.Context) tea.Cmd {
+		return fetchResourceGroupsCmd(ctx, m.azureClient, m.CurrentSubscription())
+	})
+}
+
+// backBeforeScope returns to the step before the scope step: the definitions
+// of a partial exemption, the choice between an entire initiative and some
+// of its members, or the assignments.
+func (m *Model) backBeforeScope() {
+	m.Status = "" // Help text is in the view
+	switch {
+	case m.PartialExemption:
+		m.Step = StepSelectDefinitions
+		m.DefinitionFilter.Reset()
+		m.Cursor = 0
+	case len(m.AssignmentDefinitions) > 1:
+		m.Step = StepAssignmentScope
+		m.Cursor = 0
+	default:
+		m.Step = StepSelectAssignment
+		m.Cursor = max(m.SelectedAssignment, 0)
+		m.SelectedAssignment = -1
+	}
+}
+
+// confirm moves to the confirmation step and starts counting the
+// non-compliant resources that fall under the chosen scope.
+func (m *Model) confirm() tea.Cmd {
+	m.Step = StepConfirm
+	m.Status = "" // Help text is in the view
+	m.ScopeNonCompliant = -1
+	m.ScopeComplianceErr = nil
+	m.scopeComplianceSeq++
+	cmd := fetchScopeComplianceCmd(m.ctx, m.azureClient, m.ExemptionSpec(), m.scopeComplianceSeq)
+	// The effect of a single policy comes with the assignment details.
+	assign := m.CurrentAssignment()
+	if _, ok := m.AssignmentDetails[strings.ToLower(assign.ID)]; len(m.AssignmentDefinitions) == 0 && !ok {
+		cmd = tea.Batch(cmd, fetchAssignmentDetailsCmd(m.ctx, m.azureClient, assign))
+	}
+	return cmd
+}
+
+// navigate moves the cursor through the listed matches for the Up, Down,
+// PageUp, PageDown, Home and End bindings and reports whether msg was one
+// of them. A page is the number of rows the list shows.
+func (m *Model) navigate(msg tea.KeyMsg, matches filterResult) bool {
+	var delta int
+	switch {
+	case key.Matches(msg, m.Keys.Up):
+		delta = -1
+	case key.Matches(msg, m.Keys.Down):
+		delta = 1
+	case key.Matches(msg, m.Keys.PageUp):
+		delta = -m.listHeight()
+	case key.Matches(msg, m.Keys.PageDown):
+		delta = m.listHeight()
+	case key.Matches(msg, m.Keys.Home):
+		delta = -len(matches)
+	case key.Matches(msg, m.Keys.End):
+		delta = len(matches)
+	default:
 		return false
 	}
-	c := key[0]
-	return (c >= 'a' && c <= 'z') ||
-		(c >= 'A' && c <= 'Z') ||
-		(c >= '0' && c <= '9') ||
-		c == ' ' || c == '-' || c == '_'
+	m.Cursor = matches.Move(m.Cursor, delta)
+	return true
+}
+
+// activeFilter returns the search filter of the current list step, or nil
+// if the step has no searchable list.
+func (m *Model) activeFilter() *filterList {
+	switch m.Step {
+	case StepSelectSubscription:
+		return &m.SubscriptionFilter
+	case StepSelectAssignment:
+		return &m.AssignmentFilter
+	case StepSelectDefinitions:
+		return &m.DefinitionFilter
+	case StepSelectResourceGroup:
+		return &m.ResourceGroupFilter
+	}
+	return nil
+}
+
+// currentMatches returns the listed items of the current list step.
+func (m *Model) currentMatches() filterResult {
+	switch m.Step {
+	case StepSelectSubscription:
+		if m.TreeView {
+			return m.treeMatches()
+		}
+		return m.subscriptionMatches()
+	case StepSelectAssignment:
+		return m.assignmentMatches()
+	case StepSelectDefinitions:
+		if m.GroupedView {
+			return m.groupMatches(m.definitionGroups())
+		}
+		return m.definitionMatches()
+	case StepSelectResourceGroup:
+		return m.resourceGroupMatches()
+	}
+	return nil
+}
+
+// handleFilterKey handles keys for the search of a list step and reports
+// whether the key was consumed. While the search has focus, printable keys
+// are typed into it, Enter applies it and Esc clears it; other keys such as
+// the arrow keys still reach the list. Without focus, the Search binding or
+// typing a printable key focuses the search, even if the key is bound, so
+// that a query can start with q or j.
+func (m *Model) handleFilterKey(msg tea.KeyMsg) bool {
+	f := m.activeFilter()
+	if f == nil {
+		return false
+	}
+	if f.Focused {
+		switch msg.Type {
+		case tea.KeyEnter:
+			f.Focused = false
+			m.Status = "" // Search query is shown in the view
+			return true
+		case tea.KeyBackspace:
+			if f.Query == "" {
+				f.Focused = false
+				return true
+			}
+		case tea.KeyEsc:
+			f.Reset()
+			return true
+		}
+		return m.updateFilter(f, msg)
+	}
+	switch {
+	case key.Matches(msg, m.Keys.Search):
+		f.Focused = true
+		m.Status = "" // Search query is shown in the view
+		return true
+	case key.Matches(msg, m.Keys.ClearSearch) && f.Query != "":
+		f.Reset()
+		return true
+	case isText(msg):
+		f.Focused = true
+		return m.updateFilter(f, msg)
+	}
+	return false
+}
+
+// updateFilter passes msg to the search filter and moves the cursor to the
+// best match when the query changed. It reports whether the key was consumed.
+func (m *Model) updateFilter(f *filterList, msg tea.KeyMsg) bool {
+	if !f.HandleKey(msg) {
+		return false
+	}
+	if first := m.currentMatches().First(); first >= 0 {
+		m.Cursor = first
+	}
+	m.Status = "" // Search query is shown in the view
+	return true
 }
@@ -1,8 +1,10 @@
 package tui
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"log/slog"
 	"strings"
 	"testing"
 
@@ -20,52 +22,89 @@ func TestCompletePartialExemptionFlow(t *testing.T) {
 			{PolicyDefinitionID: "/definitions/one", ReferenceID: "ref-one", DisplayName: "First"},
 			{PolicyDefinitionID: "/definitions/two", ReferenceID: "ref-two", DisplayName: "Second"},
 		},
-		resourceGroups: []azure.ResourceGroup{{ID: "/subscriptions/sub-1/resourceGroups/app", Name: "app"}},
-		createOutput:   `{"created":true}`,
+		resourceGroups:   []azure.ResourceGroup{{ID: "/subscriptions/sub-1/resourceGroups/app", Name: "app"}},
+		createdExemption: azure.Exemption{ID: "/subscriptions/sub-1/resourceGroups/app/providers/Microsoft.Authorization/policyExemptions/ex"},
+		nonCompliant:     4,
 	}
 	m := NewModel(context.Background(), client, nil)
 
-	updateWith(t, m, m.Init()())
+	runCmd(t, m, m.Init())
 	assertStep(t, m, StepSelectSubscription)
-	cmd := key(t, m, tea.KeyEnter)
+	cmd := press(t, m, tea.KeyEnter)
 	assertStep(t, m, StepLoadingAssignments)
-	updateWith(t, m, cmd())
+	runCmd(t, m, cmd)
 	assertStep(t, m, StepSelectAssignment)
-	cmd = key(t, m, tea.KeyEnter)
-	updateWith(t, m, cmd())
+	if m.Compliance == nil {
+		t.Fatal("compliance summary was not loaded with the assignments")
+	}
+	cmd = press(t, m, tea.KeyEnter)
+	runCmd(t, m, cmd)
 	assertStep(t, m, StepAssignmentScope)
 
-	key(t, m, tea.KeyDown)
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyDown)
+	press(t, m, tea.KeyEnter)
 	assertStep(t, m, StepSelectDefinitions)
-	key(t, m, tea.KeySpace)
+	press(t, m, tea.KeySpace)
 	if !m.SelectedDefinitionIDs["ref-one"] {
 		t.Fatal("definition was not selected")
 	}
-	cmd = key(t, m, tea.KeyEnter)
-	updateWith(t, m, cmd())
+	// The resource groups were prefetched with the assignments.
+	cmd = press(t, m, tea.KeyEnter)
 	assertStep(t, m, StepSelectResourceGroup)
+	runCmd(t, m, cmd)
 	if len(m.ResourceGroups) != 2 || m.ResourceGroups[0].Name != "Entire Subscription" {
 		t.Fatalf("resource groups = %#v", m.ResourceGroups)
 	}
 
-	key(t, m, tea.KeyDown)
-	key(t, m, tea.KeyEnter)
+	// The permissions of the listed scopes are known, so none is checked.
+	press(t, m, tea.KeyDown)
+	press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepSelectorsChoice)
+	press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepTicket)
 	m.TicketInput.SetValue(" INC123 ")
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyEnter)
 	m.UserInput.SetValue(" Ada, Linus ")
-	key(t, m, tea.KeyEnter)
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyEnter)
+	runCmd(t, m, press(t, m, tea.KeyEnter))
 	assertStep(t, m, StepConfirm)
-	cmd = key(t, m, tea.KeyEnter)
+	if m.ScopeNonCompliant != client.nonCompliant || client.complianceScope != "/subscriptions/sub-1/resourceGroups/app" {
+		t.Fatalf("scope compliance = %d for %q", m.ScopeNonCompliant, client.complianceScope)
+	}
+	cmd = press(t, m, tea.KeyEnter)
 	assertStep(t, m, StepCreating)
-	updateWith(t, m, cmd())
+	runCmd(t, m, cmd)
 	assertStep(t, m, StepDone)
-	if m.CreateOutput != client.createOutput || client.created.scopeName != "app" || client.created.ticket != "INC123" || client.created.users != "Ada, Linus" || len(client.created.refs) != 1 || client.created.refs[0] != "ref-one" {
-		t.Fatalf("create result/call = %q, %#v", m.CreateOutput, client.created)
+	if m.Created.ID != client.createdExemption.ID || client.created.ScopeName != "app" || client.created.Ticket != "INC123" || client.created.Users != "Ada, Linus" || len(client.created.ReferenceIDs) != 1 || client.created.ReferenceIDs[0] != "ref-one" {
+		t.Fatalf("create result/call = %+v, %#v", m.Created, client.created)
 	}
 }
 
+func TestRequestModeSavesBundle(t *testing.T) {
+	m := populatedModel()
+	m.RequestPath = "request.json"
+	m.Step = StepConfirm
+	cmd := press(t, m, tea.KeyEnter)
+	assertStep(t, m, StepCreating)
+	if cmd == nil {
+		t.Fatal("confirm should return a write command")
+	}
+	if !strings.Contains(m.View(), "Saving exemption request") {
+		t.Fatal("request mode should show saving state")
+	}
+	updateWith(t, m, requestWrittenMsg{path: "request.json"})
+	assertStep(t, m, StepDone)
+	if !strings.Contains(m.View(), "azexempt approve request.json") {
+		t.Fatalf("done view = %q", m.View())
+	}
+	if press(t, m, tea.KeyEnter); m.Step != StepDone {
+		t.Fatal("Enter must not restart the wizard in request mode")
+	}
+
+	updateWith(t, m, requestWrittenMsg{err: errors.New("disk full")})
+	assertStep(t, m, StepError)
+}
+
 func TestLoadedMessageBranches(t *testing.T) {
 	tests := []struct {
 		name string
@@ -80,7 +119,7 @@ func TestLoadedMessageBranches(t *testing.T) {
 		{"definition error", assignmentDefinitionsLoadedMsg{err: errors.New("defs")}, StepError, "defs"},
 		{"resource group error", resourceGroupsLoadedMsg{err: errors.New("groups")}, StepError, "groups"},
 		{"create error", exemptionCreatedMsg{err: errors.New("create")}, StepError, "create"},
-		{"create success", exemptionCreatedMsg{output: "ok"}, StepDone, ""},
+		{"create success", exemptionCreatedMsg{exemption: azure.Exemption{Name: "ok"}}, StepDone, ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -101,11 +140,111 @@ func TestLoadedMessageBranches(t *testing.T) {
 	}
 }
 
+func TestComplianceMessages(t *testing.T) {
+	m := populatedModel()
+	m.Step = StepSelectAssignment
+	updateWith(t, m, complianceLoadedMsg{scope: "/subscriptions/other", summary: azure.ComplianceSummary{}})
+	if m.Compliance != nil {
+		t.Fatal("compliance for another subscription was applied")
+	}
+	updateWith(t, m, complianceLoadedMsg{scope: "/subscriptions/sub", err: errors.New("insights down")})
+	assertStep(t, m, StepSelectAssignment)
+	if m.ComplianceErr == nil || !strings.Contains(m.View(), "insights down") {
+		t.Fatal("compliance error should be shown without failing")
+	}
+	updateWith(t, m, complianceLoadedMsg{scope: "/subscriptions/sub", summary: azure.ComplianceSummary{Assignments: map[string]int{"/assignments/a": 5}}})
+	if m.Compliance == nil || !strings.Contains(m.View(), "5 non-compliant") {
+		t.Fatalf("assignment view = %q", m.View())
+	}
+
+	m.confirm()
+	stale := m.scopeComplianceSeq
+	m.confirm()
+	if !strings.Contains(m.View(), "loading...") {
+		t.Fatal("confirm view should show pending scope count")
+	}
+	// The count of a confirmation left since is dropped.
+	updateWith(t, m, scopeComplianceLoadedMsg{seq: stale, count: 3})
+	if m.ScopeNonCompliant != -1 {
+		t.Fatalf("stale scope count = %d", m.ScopeNonCompliant)
+	}
+	updateWith(t, m, scopeComplianceLoadedMsg{seq: m.scopeComplianceSeq, count: 9})
+	if m.ScopeNonCompliant != 9 || !strings.Contains(m.View(), "9") {
+		t.Fatal("scope count was not shown")
+	}
+	updateWith(t, m, scopeComplianceLoadedMsg{seq: m.scopeComplianceSeq, err: errors.New("denied")})
+	assertStep(t, m, StepConfirm)
+	if !strings.Contains(m.View(), "unavailable") {
+		t.Fatal("scope count error should be shown without failing")
+	}
+}
+
+func TestEffectFilterAndDenyWarning(t *testing.T) {
+	m := populatedModel()
+	m.AssignmentDefinitions = []azure.PolicyDefinitionRef{
+		{PolicyDefinitionID: "/definitions/a", ReferenceID: "ref-a", DisplayName: "Audit logs", Effect: "Audit"},
+		{PolicyDefinitionID: "/definitions/b", ReferenceID: "ref-b", DisplayName: "Block public IPs", Effect: "Deny"},
+		{PolicyDefinitionID: "/definitions/c", ReferenceID: "ref-c", DisplayName: "Unknown"},
+		{PolicyDefinitionID: "/definitions/d", ReferenceID: "ref-d", DisplayName: "Deny HTTP", Effect: "Deny"},
+	}
+	m.Step = StepSelectDefinitions
+	m.Cursor = 0
+
+	press(t, m, tea.KeyCtrlE)
+	if m.EffectFilter != "Audit" || m.Cursor != 0 {
+		t.Fatalf("first filter = %q, cursor %d", m.EffectFilter, m.Cursor)
+	}
+	press(t, m, tea.KeyCtrlE)
+	if m.EffectFilter != "Deny" || m.Cursor != 1 {
+		t.Fatalf("second filter = %q, cursor %d", m.EffectFilter, m.Cursor)
+	}
+	view := m.View()
+	if strings.Contains(view, "Audit logs") || !strings.Contains(view, "Deny HTTP") || !strings.Contains(view, "2 of 4 definitions") {
+		t.Fatalf("filtered view = %q", view)
+	}
+	press(t, m, tea.KeyDown)
+	if m.Cursor != 3 {
+		t.Fatalf("cursor should skip hidden definitions, got %d", m.Cursor)
+	}
+	press(t, m, tea.KeyDown)
+	if m.Cursor != 3 {
+		t.Fatal("cursor moved past the last visible definition")
+	}
+	press(t, m, tea.KeyUp)
+	press(t, m, tea.KeySpace)
+	press(t, m, tea.KeyCtrlE)
+	if m.EffectFilter != "" {
+		t.Fatalf("filter should wrap to all, got %q", m.EffectFilter)
+	}
+
+	m.PartialExemption = true
+	m.Step = StepConfirm
+	if view := m.View(); !strings.Contains(view, "1 Deny policies are exempted") || !strings.Contains(view, "Block public IPs") {
+		t.Fatalf("confirm view = %q", view)
+	}
+	m.PartialExemption = false
+	if view := m.View(); !strings.Contains(view, "2 Deny policies") {
+		t.Fatalf("entire assignment confirm view = %q", view)
+	}
+	m.AssignmentDefinitions = nil
+	if strings.Contains(m.View(), "Deny policies") {
+		t.Fatal("warning shown without Deny definitions")
+	}
+
+	// A single policy is warned about with the effect of its assignment.
+	client := m.azureClient.(*fakeAzureClient)
+	client.assignDetails = azure.AssignmentDetails{Effect: "Deny"}
+	runCmd(t, m, m.confirm())
+	if view := m.View(); !strings.Contains(view, "1 Deny policies") || !strings.Contains(view, m.CurrentAssignment().DisplayLabel()) {
+		t.Fatalf("single policy confirm view = %q", view)
+	}
+}
+
 func TestBlockedSelectionAndValidation(t *testing.T) {
 	m := populatedModel()
 	m.BlockedDefinitionIDs[strings.ToLower(m.Assignments[0].PolicyDefinitionID)] = true
 	m.Step = StepSelectAssignment
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyEnter)
 	if m.Step != StepSelectAssignment || !strings.Contains(m.Status, "blocked") {
 		t.Fatal("blocked assignment was selectable")
 	}
@@ -114,12 +253,12 @@ func TestBlockedSelectionAndValidation(t *testing.T) {
 	m.Cursor = 0
 	m.Status = ""
 	m.BlockedDefinitionIDs[strings.ToLower(m.AssignmentDefinitions[0].PolicyDefinitionID)] = true
-	key(t, m, tea.KeySpace)
+	press(t, m, tea.KeySpace)
 	if len(m.SelectedDefinitionIDs) != 0 || !strings.Contains(m.Status, "blocked") {
 		t.Fatal("blocked definition was selectable")
 	}
 	m.BlockedDefinitionIDs = map[string]bool{}
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyEnter)
 	if !strings.Contains(m.Status, "at least one") {
 		t.Fatalf("empty definition validation = %q", m.Status)
 	}
@@ -127,27 +266,27 @@ func TestBlockedSelectionAndValidation(t *testing.T) {
 	m.Step = StepTicket
 	m.TicketInput.Focus()
 	m.TicketInput.SetValue("   ")
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyEnter)
 	if !strings.Contains(m.Status, "ticket") {
 		t.Fatalf("ticket validation = %q", m.Status)
 	}
 	m.Step = StepUsers
 	m.UserInput.Focus()
 	m.UserInput.SetValue(" ")
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyEnter)
 	if !strings.Contains(m.Status, "requester") {
 		t.Fatalf("user validation = %q", m.Status)
 	}
 	m.Step = StepExpirationDate
 	m.ExpirationInput.Focus()
 	m.ExpirationInput.SetValue("invalid")
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyEnter)
 	if !strings.Contains(m.Status, "Invalid date") {
 		t.Fatalf("date validation = %q", m.Status)
 	}
 	m.Step = StepConfirm
 	m.SelectedAssignment = -1
-	key(t, m, tea.KeyEnter)
+	press(t, m, tea.KeyEnter)
 	if !strings.Contains(m.Status, "Missing information") {
 		t.Fatalf("confirmation validation = %q", m.Status)
 	}
@@ -156,80 +295,123 @@ func TestBlockedSelectionAndValidation(t *testing.T) {
 func TestNavigationAndSearch(t *testing.T) {
 	m := populatedModel()
 	m.Step = StepSelectSubscription
-	m.Subscriptions = append(m.Subscriptions, azure.Subscription{Name: "Zeta"})
+	m.Subscriptions = append(m.Subscriptions, azure.Subscription{ID: "/subscriptions/0000-zeta", Name: "Zeta"})
 	keyRune(t, m, 'z')
-	if m.Cursor != 1 || m.SubscriptionSearch != "z" {
-		t.Fatalf("subscription search = %d, %q", m.Cursor, m.SubscriptionSearch)
+	if m.Cursor != 1 || m.SubscriptionFilter.Query != "z" || len(m.subscriptionMatches()) != 1 {
+		t.Fatalf("subscription search = %d, %q", m.Cursor, m.SubscriptionFilter.Query)
 	}
-	key(t, m, tea.KeyBackspace)
-	if m.SubscriptionSearch != "" {
+	press(t, m, tea.KeyBackspace)
+	if m.SubscriptionFilter.Query != "" || len(m.subscriptionMatches()) != 2 {
 		t.Fatal("subscription search did not delete")
 	}
+	// Subscriptions can be found by ID.
+	for _, r := range "0000" {
+		keyRune(t, m, r)
+	}
+	if m.Cursor != 1 {
+		t.Fatalf("subscription ID search cursor = %d", m.Cursor)
+	}
+	press(t, m, tea.KeyEsc)
+	if m.SubscriptionFilter.Query != "" {
+		t.Fatal("esc did not clear the subscription search")
+	}
 
 	m.Step = StepSelectAssignment
 	m.SelectedSubscription = 0
-	m.AssignmentSearch = "sec"
-	key(t, m, tea.KeyBackspace)
-	if m.AssignmentSearch != "se" {
+	m.AssignmentFilter = filterList{Query: "sec", Focused: true}
+	press(t, m, tea.KeyBackspace)
+	if m.AssignmentFilter.Query != "se" {
 		t.Fatal("assignment search did not delete")
 	}
-	m.AssignmentSearch = ""
-	key(t, m, tea.KeyBackspace)
+	m.AssignmentFilter = filterList{Query: "missing"}
+	if cmd := press(t, m, tea.KeyEnter); cmd != nil || m.Step != StepSelectAssignment {
+		t.Fatal("enter selected an assignment that is filtered out")
+	}
+	m.AssignmentFilter.Query = ""
+	press(t, m, tea.KeyBackspace)
 	assertStep(t, m, StepSelectSubscription)
 
 	m.Step = StepSelectDefinitions
-	m.DefinitionSearch = "fir"
-	key(t, m, tea.KeyBackspace)
-	if m.DefinitionSearch != "fi" {
+	m.DefinitionFilter = filterList{Query: "fir", Focused: true}
+	press(t, m, tea.KeyBackspace)
+	if m.DefinitionFilter.Query != "fi" {
 		t.Fatal("definition search did not delete")
 	}
-	m.DefinitionSearch = ""
+	m.DefinitionFilter.Reset()
 	m.SelectedDefinitionIDs["ref"] = true
-	key(t, m, tea.KeyBackspace)
+	press(t, m, tea.KeyBackspace)
 	assertStep(t, m, StepAssignmentScope)
 	if len(m.SelectedDefinitionIDs) != 0 || m.Cursor != 1 {
 		t.Fatal("definition back navigation did not reset selection")
 	}
 
+	m.Step = StepSelectResourceGroup
+	m.ResourceGroups = append(m.ResourceGroups, azure.ResourceGroup{ID: "/subscriptions/sub/resourceGroups/app", Name: "app"})
+	m.Cursor = 0
+	keyRune(t, m, 'p')
+	keyRune(t, m, 'p')
+	if m.Cursor != 1 || len(m.resourceGroupMatches()) != 1 {
+		t.Fatalf("resource group search cursor = %d", m.Cursor)
+	}
+	press(t, m, tea.KeyBackspace)
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectResourceGroup)
+	// Backspace on the empty search leaves it instead of going back.
+	press(t, m, tea.KeyBackspace)
+	assertStep(t, m, StepSelectResourceGroup)
+	if m.ResourceGroupFilter.Focused {
+		t.Fatal("backspace on an empty search kept the focus")
+	}
+
 	m.Step = StepSelectResourceGroup
 	m.PartialExemption = true
-	key(t, m, tea.KeyBackspace)
+	press(t, m, tea.KeyBackspace)
 	assertStep(t, m, StepSelectDefinitions)
 	m.Step = StepSelectResourceGroup
 	m.PartialExemption = false
-	key(t, m, tea.KeyBackspace)
+	press(t, m, tea.KeyBackspace)
 	assertStep(t, m, StepAssignmentScope)
 
 	m.Step = StepExpirationChoice
 	m.RequestUser = "Ada"
-	key(t, m, tea.KeyBackspace)
+	press(t, m, tea.KeyBackspace)
 	assertStep(t, m, StepUsers)
 	if m.UserInput.Value() != "Ada" {
 		t.Fatal("user input was not restored")
 	}
 	m.Step = StepConfirm
 	m.ExpirationDate = "2030-01-01"
-	key(t, m, tea.KeyBackspace)
+	press(t, m, tea.KeyBackspace)
 	if m.Step != StepExpirationChoice || m.Cursor != 1 {
 		t.Fatal("dated confirmation back navigation is wrong")
 	}
 }
 
-func TestQuitAndSearchKey(t *testing.T) {
+func TestQuit(t *testing.T) {
 	m := populatedModel()
 	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
 	if cmd == nil {
 		t.Fatal("ctrl+c should return quit command")
 	}
-	for _, key := range []string{"a", "Z", "0", " ", "-", "_"} {
-		if !isSearchKey(key) {
-			t.Errorf("isSearchKey(%q) = false", key)
-		}
+}
+
+func TestStepTransitionsAreLogged(t *testing.T) {
+	client := &fakeAzureClient{subscriptions: []azure.Subscription{{ID: "/subscriptions/sub-1", Name: "Production"}}}
+	m := NewModel(context.Background(), client, nil)
+	var buf bytes.Buffer
+	m.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	runCmd(t, m, m.Init())
+	assertStep(t, m, StepSelectSubscription)
+	if n := strings.Count(buf.String(), `msg=step from="loading subscriptions" to="select subscription"`); n != 1 {
+		t.Fatalf("transition logged %d times:\n%s", n, buf.String())
 	}
-	for _, key := range []string{"", "ab", ".", "é", "enter"} {
-		if isSearchKey(key) {
-			t.Errorf("isSearchKey(%q) = true", key)
-		}
+
+	client.err = errors.New("service failure")
+	runCmd(t, m, press(t, m, tea.KeyEnter))
+	assertStep(t, m, StepError)
+	if n := strings.Count(buf.String(), `level=WARN msg="step failed" step="loading assignments" error="service failure`); n != 1 {
+		t.Fatalf("failure logged %d times:\n%s", n, buf.String())
 	}
 }
 
@@ -247,7 +429,7 @@ func populatedModel() *Model {
 	return m
 }
 
-func key(t *testing.T, m *Model, typ tea.KeyType) tea.Cmd {
+func press(t *testing.T, m *Model, typ tea.KeyType) tea.Cmd {
 	t.Helper()
 	return updateWith(t, m, tea.KeyMsg{Type: typ})
 }
@@ -257,6 +439,23 @@ func keyRune(t *testing.T, m *Model, r rune) tea.Cmd {
 	return updateWith(t, m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
 }
 
+// runCmd executes cmd, including every command of a batch, and feeds the
+// resulting messages to the model.
+func runCmd(t *testing.T, m *Model, cmd tea.Cmd) {
+	t.Helper()
+	if cmd == nil {
+		return
+	}
+	msg := cmd()
+	if batch, ok := msg.(tea.BatchMsg); ok {
+		for _, c := range batch {
+			runCmd(t, m, c)
+		}
+		return
+	}
+	updateWith(t, m, msg)
+}
+
 func updateWith(t *testing.T, m *Model, msg tea.Msg) tea.Cmd {
 	t.Helper()
 	model, cmd := m.Update(msg)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Lukas-Klein/azexempt/azure"
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -30,6 +31,9 @@ var (
 	// Style for error messages
 	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true)
 
+	// Style for warnings such as non-compliant resource counts
+	warningStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+
 	// Style for dim/secondary text
 	dimStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
 
@@ -40,8 +44,6 @@ var (
 	loadingStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("117")).Italic(true)
 )
 
-const maxVisibleSubscriptions = 15
-
 // Helper function to format instruction hints
 func formatHint(keys string, action string) string {
 	return keyStyle.Render(keys) + " " + action
@@ -49,81 +51,137 @@ func formatHint(keys string, action string) string {
 
 func (m *Model) View() string {
 	var b strings.Builder
-	b.WriteString(titleStyle.Render("Azure Policy Exemption CLI") + "\n\n")
+	b.WriteString(titleStyle.Render("Azure Policy Exemption CLI"))
+	if m.Cloud.Name != "" {
+		b.WriteString(dimStyle.Render(" · " + m.Cloud.Name))
+	}
+	b.WriteString("\n\n")
+
+	if m.ShowHelp {
+		b.WriteString(m.helpView())
+		return b.String()
+	}
+
+	if m.DetailOpen {
+		b.WriteString(m.detailsView())
+		return b.String()
+	}
+
+	var body strings.Builder
+	m.stepView(&body)
+	if m.twoPane() {
+		b.WriteString(m.withSidePane(body.String()))
+	} else {
+		b.WriteString(body.String())
+	}
+
+	if m.Status != "" {
+		b.WriteString("\n" + errorStyle.Render(m.Status) + "\n")
+	}
 
+	// Add global quit hint for steps that don't already show it
+	if m.Step != StepDone && m.Step != StepError && m.Step != StepConfirm {
+		b.WriteString("\n" + dimStyle.Render(m.quitHint()) + "\n")
+	}
+
+	return b.String()
+}
+
+// stepView renders the prompt, list or form of the current step.
+func (m *Model) stepView(b *strings.Builder) {
 	switch m.Step {
 	case StepLoadingSubscriptions:
-		b.WriteString(loadingStyle.Render("Retrieving subscriptions via Azure CLI...") + "\n")
+		b.WriteString(m.loadingView("Retrieving subscriptions via Azure CLI..."))
 
 	case StepSelectSubscription:
+		if m.Identity != nil {
+			b.WriteString(dimStyle.Render(identityLabel(*m.Identity)) + "\n\n")
+		}
+		if m.TreeView {
+			b.WriteString("Select the subscription or management group for the exemption:\n\n")
+			m.treeView(b)
+			break
+		}
 		b.WriteString("Select the subscription for the exemption:\n\n")
-		start, end := visibleRange(m.Cursor, len(m.Subscriptions), maxVisibleSubscriptions)
-		for i := start; i < end; i++ {
-			sub := m.Subscriptions[i]
+		matches := m.subscriptionMatches()
+		page, start := matches.Page(m.Cursor, m.listHeight())
+		for _, match := range page {
+			sub := m.Subscriptions[match.Index]
 			cursor := " "
-			if i == m.Cursor {
+			if match.Index == m.Cursor {
 				cursor = ">"
 			}
 			marker := " "
-			if i == m.SelectedSubscription {
+			if match.Index == m.SelectedSubscription {
 				marker = "x"
 			}
-			line := fmt.Sprintf("%s [%s] %s (%s)", cursor, marker, sub.Name, sub.ShortID())
-			if i == m.Cursor {
-				line = selectedStyle.Render(line)
+			base := lipgloss.NewStyle()
+			if match.Index == m.Cursor {
+				base = selectedStyle
 			}
-			fmt.Fprintf(&b, "%s\n", line)
-		}
-		b.WriteString("\n" + dimStyle.Render(fmt.Sprintf("Showing %d-%d of %d", start+1, end, len(m.Subscriptions))) + "\n")
-		if m.SubscriptionSearch != "" {
-			b.WriteString("Search: " + searchStyle.Render(m.SubscriptionSearch) + "\n")
-			b.WriteString(formatHint("Type", "to search") + ", " + formatHint("Esc", "to clear") + ", " + formatHint("Enter", "to select") + "\n")
-		} else {
-			b.WriteString(formatHint("↑/↓", "move") + ", " + actionStyle.Render("type to search") + ", " + formatHint("Enter", "select") + "\n")
+			fmt.Fprintf(b, "%s\n", listRow(fmt.Sprintf("%s [%s] ", cursor, marker), sub.Name, fmt.Sprintf(" (%s)", sub.ShortID())+m.permissionLabel(sub.Scope()), match.Positions, base, m.rowWidth("")))
 		}
+		b.WriteString("\n" + dimStyle.Render(matches.footer(start, len(page), len(m.Subscriptions), "")) + "\n")
+		searching := m.searchingHint()
+		idle := m.navHint() + ", " + m.searchHint("by name or ID") + ", " + keyHint(m.Keys.Select, "select") + ", " + keyHint(m.Keys.GroupedView, "management group tree") + "\n"
+		b.WriteString(searchHints(m.SubscriptionFilter, searching, idle))
+
+	case StepLoadingHierarchy:
+		b.WriteString(m.loadingView("Loading the management group hierarchy..."))
 
 	case StepLoadingAssignments:
-		b.WriteString(loadingStyle.Render("Loading policy assignments for the selected subscription...") + "\n")
+		if m.ManagementGroup != nil {
+			b.WriteString(m.loadingView("Loading policy assignments for the selected management group..."))
+			break
+		}
+		b.WriteString(m.loadingView("Loading policy assignments for the selected subscription..."))
 
 	case StepSelectAssignment:
-		sub := m.CurrentSubscription()
-		fmt.Fprintf(&b, "Policy assignments for subscription %s (%s):\n\n", sub.Name, sub.ShortID())
-		start, end := visibleRange(m.Cursor, len(m.Assignments), maxVisibleSubscriptions)
-		for i := start; i < end; i++ {
-			assign := m.Assignments[i]
+		fmt.Fprintf(b, "Policy assignments for %s:\n\n", m.targetLabel())
+		matches := m.assignmentMatches()
+		page, start := matches.Page(m.Cursor, m.listHeight())
+		for _, match := range page {
+			assign := m.Assignments[match.Index]
 			isBlocked := m.IsDefinitionBlocked(assign.PolicyDefinitionID)
 			cursor := " "
-			if i == m.Cursor {
+			if match.Index == m.Cursor {
 				cursor = ">"
 			}
 			marker := " "
 			if isBlocked {
 				marker = "-" // Blocked indicator
-			} else if i == m.SelectedAssignment {
+			} else if match.Index == m.SelectedAssignment {
 				marker = "x"
 			}
-			var line string
+			base := lipgloss.NewStyle()
+			suffix := fmt.Sprintf(" (%s)", assign.ShortID())
 			if isBlocked {
-				line = fmt.Sprintf("%s [%s] %s (%s) [blocked]", cursor, marker, assign.DisplayLabel(), assign.ShortID())
-				line = dimStyle.Render(line)
-			} else {
-				line = fmt.Sprintf("%s [%s] %s (%s)", cursor, marker, assign.DisplayLabel(), assign.ShortID())
-				if i == m.Cursor {
-					line = selectedStyle.Render(line)
-				}
+				base = dimStyle
+				suffix += " [blocked]"
+			} else if match.Index == m.Cursor {
+				base = selectedStyle
+			}
+			extra := dimStyle.Render(originLabel(assign))
+			if m.Compliance != nil {
+				extra += complianceLabel(m.Compliance.AssignmentCount(assign.ID))
 			}
-			fmt.Fprintf(&b, "%s\n", line)
+			line := listRow(fmt.Sprintf("%s [%s] ", cursor, marker), assign.DisplayLabel(), suffix, match.Positions, base, m.rowWidth(extra))
+			fmt.Fprintf(b, "%s\n", line+extra)
 		}
-		b.WriteString("\n" + dimStyle.Render(fmt.Sprintf("Showing %d-%d of %d", start+1, end, len(m.Assignments))) + "\n")
-		if m.AssignmentSearch != "" {
-			b.WriteString("Search: " + searchStyle.Render(m.AssignmentSearch) + "\n")
-			b.WriteString(formatHint("Type", "to search") + ", " + formatHint("Esc", "to clear") + ", " + formatHint("Enter", "select") + ", " + formatHint("Backspace", "delete") + "\n")
-		} else {
-			b.WriteString(formatHint("↑/↓", "move") + ", " + actionStyle.Render("type to search") + ", " + formatHint("Enter", "select") + ", " + formatHint("Backspace", "go back") + "\n")
+		b.WriteString("\n" + dimStyle.Render(matches.footer(start, len(page), len(m.Assignments), "")) + "\n")
+		if m.LoadingMore {
+			b.WriteString(loadingStyle.Render("Loading more assignments...") + "\n")
+		}
+		if m.OriginFilter != azure.ScopeUnknown {
+			b.WriteString("Assigned on: " + searchStyle.Render(m.OriginFilter.String()) + dimStyle.Render(fmt.Sprintf(" (%d of %d assignments)", len(matches), len(m.Assignments))) + "\n")
 		}
+		b.WriteString(m.complianceStatus())
+		searching := m.searchingHint()
+		idle := m.navHint() + ", " + m.searchHint("by name or ID") + ", " + keyHint(m.Keys.Select, "select") + ", " + keyHint(m.Keys.Details, "details") + ", " + keyHint(m.Keys.OriginFilter, "filter by assigning scope") + ", " + keyHint(m.Keys.Back, "go back") + "\n"
+		b.WriteString(searchHints(m.AssignmentFilter, searching, idle))
 
 	case StepLoadingAssignmentDefinitions:
-		b.WriteString(loadingStyle.Render("Loading assignment details...") + "\n")
+		b.WriteString(m.loadingView("Loading assignment details..."))
 
 	case StepAssignmentScope:
 		b.WriteString("This assignment contains multiple policy definitions.\n\n")
@@ -137,79 +195,97 @@ func (m *Model) View() string {
 			if i == m.Cursor {
 				line = selectedStyle.Render(line)
 			}
-			fmt.Fprintf(&b, "%s\n", line)
+			fmt.Fprintf(b, "%s\n", line)
 		}
-		b.WriteString("\n" + formatHint("↑/↓", "move") + ", " + formatHint("Enter", "choose") + ", " + formatHint("Backspace", "go back") + "\n")
+		b.WriteString("\n" + m.navHint() + ", " + keyHint(m.Keys.Select, "choose") + ", " + keyHint(m.Keys.Back, "go back") + "\n")
 
 	case StepSelectDefinitions:
 		b.WriteString("Select the policy definitions to exempt:\n\n")
-		start, end := visibleRange(m.Cursor, len(m.AssignmentDefinitions), maxVisibleSubscriptions)
-		for i := start; i < end; i++ {
-			ref := m.AssignmentDefinitions[i]
-			isBlocked := m.IsDefinitionBlocked(ref.PolicyDefinitionID)
-			cursor := " "
-			if i == m.Cursor {
-				cursor = ">"
-			}
-			marker := " "
-			if isBlocked {
-				marker = "-" // Blocked indicator
-			} else if m.SelectedDefinitionIDs[ref.ReferenceID] {
-				marker = "x"
-			}
-			var line string
-			if isBlocked {
-				line = fmt.Sprintf("%s [%s] %s (%s) [blocked]", cursor, marker, ref.DisplayName, ref.ReferenceID)
-				line = dimStyle.Render(line)
-			} else {
-				line = fmt.Sprintf("%s [%s] %s (%s)", cursor, marker, ref.DisplayName, ref.ReferenceID)
-				if i == m.Cursor {
-					line = selectedStyle.Render(line)
-				}
-			}
-			fmt.Fprintf(&b, "%s\n", line)
-		}
-		b.WriteString("\n" + dimStyle.Render(fmt.Sprintf("Showing %d-%d of %d", start+1, end, len(m.AssignmentDefinitions))) + "\n")
-		if m.DefinitionSearch != "" {
-			b.WriteString("Search: " + searchStyle.Render(m.DefinitionSearch) + "\n")
-			b.WriteString(formatHint("Type", "to search") + ", " + formatHint("Esc", "to clear") + ", " + formatHint("Space", "toggle") + ", " + formatHint("Enter", "continue") + "\n")
+		visible := m.visibleDefinitions()
+		if m.GroupedView {
+			b.WriteString(m.groupedDefinitionsView())
 		} else {
-			b.WriteString(formatHint("↑/↓", "move") + ", " + actionStyle.Render("type to search") + ", " + formatHint("Space", "toggle") + ", " + formatHint("Enter", "continue") + ", " + formatHint("Backspace", "go back") + "\n")
+			m.writeDefinitionList(b)
 		}
+		if m.EffectFilter != "" {
+			b.WriteString("Effect: " + searchStyle.Render(m.EffectFilter) + dimStyle.Render(fmt.Sprintf(" (%d of %d definitions)", len(visible), len(m.AssignmentDefinitions))) + "\n")
+		}
+		b.WriteString(m.complianceStatus())
+		b.WriteString(dimStyle.Render(fmt.Sprintf("%d selected", len(m.SelectedDefinitionIDs))) + "\n")
+		searching := m.searchingHint()
+		idle := m.navHint() + ", " + m.searchHint("by name or ID") + ", " + keyHint(m.Keys.Toggle, "toggle") + ", " + keyHint(m.Keys.Select, "continue") + ", " + keyHint(m.Keys.Details, "details") + ", " + keyHint(m.Keys.EffectFilter, "filter by effect") + ", " + keyHint(m.Keys.Back, "go back") + "\n"
+		b.WriteString(searchHints(m.DefinitionFilter, searching, idle))
+		view := "grouped view"
+		if m.GroupedView {
+			view = "list view"
+		}
+		b.WriteString(keyHint(m.Keys.GroupedView, view) + ", " + keyHint(m.Keys.SelectAll, "select all") + ", " + keyHint(m.Keys.SelectNone, "select none") + ", " + keyHint(m.Keys.InvertSelection, "invert selection") + "\n")
 
 	case StepLoadingResourceGroups:
-		b.WriteString(loadingStyle.Render("Loading resource groups...") + "\n")
+		b.WriteString(m.loadingView("Loading resource groups..."))
 
 	case StepSelectResourceGroup:
 		b.WriteString("Select the scope for the exemption:\n\n")
-		start, end := visibleRange(m.Cursor, len(m.ResourceGroups), maxVisibleSubscriptions)
-		for i := start; i < end; i++ {
-			rg := m.ResourceGroups[i]
+		if limit := m.assignmentScopeLimit(); limit != "" {
+			level, name := azure.ParseScope(limit)
+			b.WriteString(dimStyle.Render(fmt.Sprintf("The assignment is assigned on %s %s; the exemption must be within it.", strings.ToLower(level.String()), name)) + "\n\n")
+		}
+		matches := m.resourceGroupMatches()
+		page, start := matches.Page(m.Cursor, m.listHeight())
+		for _, match := range page {
+			rg := m.ResourceGroups[match.Index]
 			cursor := " "
-			if i == m.Cursor {
+			if match.Index == m.Cursor {
 				cursor = ">"
 			}
 			marker := " "
-			if i == m.SelectedResourceGroup {
+			if match.Index == m.SelectedResourceGroup {
 				marker = "x"
 			}
-			line := fmt.Sprintf("%s [%s] %s", cursor, marker, rg.Name)
+			base := lipgloss.NewStyle()
+			if match.Index == m.Cursor {
+				base = selectedStyle
+			}
+			fmt.Fprintf(b, "%s\n", listRow(fmt.Sprintf("%s [%s] ", cursor, marker), rg.Name, m.permissionLabel(rg.ID), match.Positions, base, m.rowWidth("")))
+		}
+		b.WriteString("\n" + dimStyle.Render(matches.footer(start, len(page), len(m.ResourceGroups), "")) + "\n")
+		searching := m.searchingHint()
+		idle := m.navHint() + ", " + m.searchHint("") + ", " + keyHint(m.Keys.Select, "select") + ", " + keyHint(m.Keys.Back, "go back") + "\n"
+		b.WriteString(searchHints(m.ResourceGroupFilter, searching, idle))
+
+	case StepSelectorsChoice:
+		b.WriteString("Which resources in " + m.ResourceGroups[m.SelectedResourceGroup].Name + " should the exemption apply to?\n\n")
+		options := []string{"All resources in scope", "Only specific locations or resource types"}
+		for i, opt := range options {
+			cursor := " "
+			if i == m.Cursor {
+				cursor = ">"
+			}
+			line := fmt.Sprintf("%s %s", cursor, opt)
 			if i == m.Cursor {
 				line = selectedStyle.Render(line)
 			}
-			fmt.Fprintf(&b, "%s\n", line)
+			fmt.Fprintf(b, "%s\n", line)
 		}
-		b.WriteString("\n" + dimStyle.Render(fmt.Sprintf("Showing %d-%d of %d", start+1, end, len(m.ResourceGroups))) + "\n")
-		b.WriteString(formatHint("↑/↓", "move") + ", " + formatHint("Enter", "select") + ", " + formatHint("Backspace", "go back") + "\n")
+		b.WriteString("\n" + m.navHint() + ", " + keyHint(m.Keys.Select, "choose") + ", " + keyHint(m.Keys.Back, "go back") + "\n")
+
+	case StepLoadingResourceFacets:
+		b.WriteString(m.loadingView("Loading locations and resource types..."))
+
+	case StepSelectSelectors:
+		m.selectorsView(b)
+
+	case StepCheckingPermission:
+		b.WriteString(m.loadingView("Checking your permission to create exemptions on the chosen scope..."))
 
 	case StepTicket:
 		assign := m.CurrentAssignment()
-		fmt.Fprintf(&b, labelStyle.Render("Assignment: ")+"%s\n\n", assign.DisplayLabel())
+		fmt.Fprintf(b, labelStyle.Render("Assignment: ")+"%s\n\n", assign.DisplayLabel())
 		if m.PartialExemption && len(m.SelectedDefinitionIDs) > 0 {
 			b.WriteString(labelStyle.Render("Definitions selected:") + "\n")
 			for _, ref := range m.AssignmentDefinitions {
 				if m.SelectedDefinitionIDs[ref.ReferenceID] {
-					fmt.Fprintf(&b, "  • %s\n", ref.DisplayName)
+					fmt.Fprintf(b, "  • %s\n", ref.DisplayName)
 				}
 			}
 			b.WriteString("\n")
@@ -238,9 +314,9 @@ func (m *Model) View() string {
 			if i == m.Cursor {
 				line = selectedStyle.Render(line)
 			}
-			fmt.Fprintf(&b, "%s\n", line)
+			fmt.Fprintf(b, "%s\n", line)
 		}
-		b.WriteString("\n" + formatHint("↑/↓", "move") + ", " + formatHint("Enter", "choose") + ", " + formatHint("Backspace", "go back") + "\n")
+		b.WriteString("\n" + m.navHint() + ", " + keyHint(m.Keys.Select, "choose") + ", " + keyHint(m.Keys.Back, "go back") + "\n")
 
 	case StepExpirationDate:
 		b.WriteString("Enter the expiration date (YYYY-MM-DD):\n\n")
@@ -252,19 +328,32 @@ func (m *Model) View() string {
 		sub := m.CurrentSubscription()
 		assign := m.CurrentAssignment()
 		rg := m.ResourceGroups[m.SelectedResourceGroup]
-		b.WriteString(labelStyle.Render("Subscription: ") + fmt.Sprintf("%s (%s)\n", sub.Name, sub.ShortID()))
+		if m.ManagementGroup != nil {
+			b.WriteString(labelStyle.Render("Management group: ") + fmt.Sprintf("%s (%s)\n", m.ManagementGroup.Label(), m.ManagementGroup.Name))
+		} else {
+			b.WriteString(labelStyle.Render("Subscription: ") + fmt.Sprintf("%s (%s)\n", sub.Name, sub.ShortID()))
+		}
 		b.WriteString(labelStyle.Render("Scope: ") + rg.Name + "\n")
+		b.WriteString(labelStyle.Render("Resources: ") + m.resourceSelectors().String() + "\n")
 		b.WriteString(labelStyle.Render("Assignment: ") + assign.DisplayLabel() + "\n")
 		if m.PartialExemption && len(m.SelectedDefinitionIDs) > 0 {
 			b.WriteString(labelStyle.Render("Definitions:") + "\n")
 			for _, ref := range m.AssignmentDefinitions {
 				if m.SelectedDefinitionIDs[ref.ReferenceID] {
-					fmt.Fprintf(&b, "  • %s\n", ref.DisplayName)
+					fmt.Fprintf(b, "  • %s\n", ref.DisplayName)
 				}
 			}
 		} else {
 			b.WriteString(labelStyle.Render("Definitions: ") + "Entire assignment\n")
 		}
+		if deny := m.exemptedDenyDefinitions(); len(deny) > 0 {
+			b.WriteString("\n" + errorStyle.Render(fmt.Sprintf("Warning: %d Deny policies are exempted. Resources that they currently block can be deployed:", len(deny))) + "\n")
+			for _, ref := range deny {
+				fmt.Fprintf(b, "  ! %s\n", ref.DisplayName)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(labelStyle.Render("Non-compliant resources in scope: ") + m.scopeComplianceText() + "\n")
 		b.WriteString(labelStyle.Render("Ticket: ") + m.Ticket + "\n")
 		b.WriteString(labelStyle.Render("Requesters: ") + m.RequestUser + "\n")
 		if m.ExpirationDate != "" {
@@ -272,36 +361,158 @@ func (m *Model) View() string {
 		} else {
 			b.WriteString(labelStyle.Render("Expires on: ") + "Unlimited\n")
 		}
-		b.WriteString("\n" + formatHint("Enter", "create exemption") + ", " + formatHint("Backspace", "go back") + ", " + formatHint("q", "abort") + "\n")
+		action := "create exemption"
+		if m.RequestPath != "" {
+			action = "save request for approval"
+		}
+		b.WriteString("\n" + keyHint(m.Keys.Select, action) + ", " + keyHint(m.Keys.Generate, "generate code instead") + ", " + keyHint(m.Keys.Back, "go back") + ", " + keyHint(m.Keys.Quit, "abort") + "\n")
+
+	case StepGenerate:
+		m.generateView(b)
 
 	case StepCreating:
-		b.WriteString(loadingStyle.Render("Creating policy exemption via Azure CLI...") + "\n")
+		if m.RequestPath != "" {
+			b.WriteString(m.loadingView("Saving exemption request..."))
+		} else {
+			b.WriteString(m.loadingView("Creating policy exemption via Azure CLI..."))
+		}
 
 	case StepDone:
+		if m.IaCFormat != "" {
+			m.generatedView(b)
+			break
+		}
+		if m.RequestPath != "" {
+			b.WriteString(successStyle.Render("Exemption request saved!") + "\n\n")
+			b.WriteString(labelStyle.Render("Request file: ") + m.OutputPath + "\n")
+			b.WriteString(labelStyle.Render("Digest: ") + m.RequestDigest + "\n")
+			b.WriteString(dimStyle.Render("A different person must run 'azexempt approve "+m.OutputPath+"' to create the exemption.") + "\n")
+			b.WriteString(dimStyle.Render("Post the digest in ticket "+m.Ticket+" from your own account, so that the approver can check who raised the request.") + "\n")
+			b.WriteString("\n" + keyHint(m.Keys.Quit, "exit") + "\n")
+			break
+		}
 		b.WriteString(successStyle.Render("Exemption created successfully!") + "\n\n")
-		b.WriteString(dimStyle.Render("Azure CLI response:") + "\n\n")
-		if m.CreateOutput == "" {
-			b.WriteString(dimStyle.Render("No output returned.") + "\n")
-		} else {
-			b.WriteString(m.CreateOutput + "\n")
+		b.WriteString(labelStyle.Render("Name: ") + m.Created.Label() + "\n")
+		b.WriteString(labelStyle.Render("ID: ") + m.Created.ID + "\n")
+		expires := "never"
+		if m.Created.ExpiresOn != "" {
+			expires = m.Created.ExpiresOn
+		}
+		b.WriteString(labelStyle.Render("Expires: ") + expires + "\n")
+		if link := m.Cloud.PortalLink(m.Created.ID); link != "" {
+			b.WriteString("\n" + labelStyle.Render("Azure portal: ") + link + "\n")
 		}
-		b.WriteString("\n" + formatHint("Enter", "create another exemption") + ", " + formatHint("q", "exit") + "\n")
+		b.WriteString("\n" + keyHint(m.Keys.Select, "create another exemption") + ", " + keyHint(m.Keys.Quit, "exit") + "\n")
 
 	case StepError:
-		b.WriteString(errorStyle.Render("Error: ") + fmt.Sprintf("%v\n\n", m.Err))
-		b.WriteString(formatHint("q", "exit") + "\n")
+		m.errorView(b)
 	}
+}
 
-	if m.Status != "" {
-		b.WriteString("\n" + errorStyle.Render(m.Status) + "\n")
+// writeDefinitionList renders the visible initiative members with their
+// effect and compliance columns.
+func (m *Model) writeDefinitionList(b *strings.Builder) {
+	matches := m.definitionMatches()
+	page, start := matches.Page(m.Cursor, m.listHeight())
+	for _, match := range page {
+		ref := m.AssignmentDefinitions[match.Index]
+		isBlocked := m.IsDefinitionBlocked(ref.PolicyDefinitionID)
+		cursor := " "
+		if match.Index == m.Cursor {
+			cursor = ">"
+		}
+		marker := " "
+		if isBlocked {
+			marker = "-" // Blocked indicator
+		} else if m.SelectedDefinitionIDs[ref.ReferenceID] {
+			marker = "x"
+		}
+		base := lipgloss.NewStyle()
+		effect := effectStyle(ref.Effect).Render(fmt.Sprintf("%-17s", effectLabel(ref.Effect)))
+		suffix := fmt.Sprintf(" (%s)", ref.ReferenceID)
+		if isBlocked {
+			base = dimStyle
+			effect = dimStyle.Render(fmt.Sprintf("%-17s", effectLabel(ref.Effect)))
+			suffix += " [blocked]"
+		} else if match.Index == m.Cursor {
+			base = selectedStyle
+		}
+		lead := base.Render(fmt.Sprintf("%s [%s] ", cursor, marker)) + effect
+		compliance := ""
+		if m.Compliance != nil {
+			compliance = complianceLabel(m.Compliance.DefinitionCount(m.CurrentAssignment().ID, ref.ReferenceID))
+		}
+		line := lead + listRow(" ", ref.DisplayName, suffix, match.Positions, base, m.rowWidth(lead+compliance))
+		fmt.Fprintf(b, "%s\n", line+compliance)
 	}
+	b.WriteString("\n" + dimStyle.Render(matches.footer(start, len(page), len(m.visibleDefinitions()), "")) + "\n")
+}
 
-	// Add global quit hint for steps that don't already show it
-	if m.Step != StepDone && m.Step != StepError && m.Step != StepConfirm {
-		b.WriteString("\n" + dimStyle.Render("Press "+keyStyle.Render("q")+" to quit at any time.") + "\n")
+// effectLabel returns the effect column text; unknown effects show as "?".
+func effectLabel(effect string) string {
+	if effect == "" {
+		return "?"
 	}
+	return effect
+}
 
-	return b.String()
+// effectStyle highlights effects by impact: blocking effects in red,
+// remediating effects in orange and disabled or unknown ones dimmed.
+func effectStyle(effect string) lipgloss.Style {
+	switch azure.NormalizeEffect(effect) {
+	case "Deny", "DenyAction":
+		return errorStyle
+	case "DeployIfNotExists", "Modify", "Append":
+		return warningStyle
+	case "Disabled", "":
+		return dimStyle
+	}
+	return lipgloss.NewStyle()
+}
+
+// identityLabel describes the signed-in account.
+func identityLabel(p azure.Principal) string {
+	label := "Signed in as " + p.Label()
+	if kind := p.Kind(); kind != "" {
+		label += " · " + kind
+	}
+	return label
+}
+
+// complianceLabel renders a non-compliant resource count as a list suffix.
+// Items without Policy Insights data get no suffix.
+func complianceLabel(count int, ok bool) string {
+	if !ok {
+		return ""
+	}
+	if count == 0 {
+		return dimStyle.Render(" · compliant")
+	}
+	return warningStyle.Render(fmt.Sprintf(" · %d non-compliant", count))
+}
+
+// complianceStatus reports the loading state of the Policy Insights summary.
+func (m *Model) complianceStatus() string {
+	switch {
+	case m.ComplianceErr != nil:
+		return dimStyle.Render("Compliance data unavailable: "+m.ComplianceErr.Error()) + "\n"
+	case m.Compliance == nil:
+		return loadingStyle.Render("Loading compliance data...") + "\n"
+	}
+	return ""
+}
+
+// scopeComplianceText describes how many non-compliant resources the exemption covers.
+func (m *Model) scopeComplianceText() string {
+	switch {
+	case m.ScopeComplianceErr != nil:
+		return dimStyle.Render("unavailable")
+	case m.ScopeNonCompliant < 0:
+		return loadingStyle.Render("loading...")
+	case m.ScopeNonCompliant == 0:
+		return "0"
+	}
+	return warningStyle.Render(fmt.Sprintf("%d", m.ScopeNonCompliant))
 }
 
 func visibleRange(cursor, total, limit int) (start, end int) {
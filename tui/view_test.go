@@ -4,13 +4,15 @@ import (
 	"errors"
 	"strings"
 	"testing"
+
+	"github.com/Lukas-Klein/azexempt/azure"
 )
 
 func TestViewEveryStep(t *testing.T) {
 	m := populatedModel()
 	m.PartialExemption = true
 	m.SelectedDefinitionIDs["ref-a"] = true
-	m.CreateOutput = "created output"
+	m.Created = azure.Exemption{ID: "/exemptions/created", Name: "created", ExpiresOn: "2030-01-31T23:59:59Z"}
 	m.Err = errors.New("failed")
 	tests := []struct {
 		step Step
@@ -18,6 +20,7 @@ func TestViewEveryStep(t *testing.T) {
 	}{
 		{StepLoadingSubscriptions, "Retrieving subscriptions"},
 		{StepSelectSubscription, "Select the subscription"},
+		{StepLoadingHierarchy, "Loading the management group hierarchy"},
 		{StepLoadingAssignments, "Loading policy assignments"},
 		{StepSelectAssignment, "Policy assignments for subscription"},
 		{StepLoadingAssignmentDefinitions, "Loading assignment details"},
@@ -25,13 +28,17 @@ func TestViewEveryStep(t *testing.T) {
 		{StepSelectDefinitions, "Select the policy definitions"},
 		{StepLoadingResourceGroups, "Loading resource groups"},
 		{StepSelectResourceGroup, "Select the scope"},
+		{StepSelectorsChoice, "Only specific locations"},
+		{StepLoadingResourceFacets, "Loading locations"},
+		{StepSelectSelectors, "Limit the exemption"},
+		{StepCheckingPermission, "Checking your permission"},
 		{StepTicket, "tracking ticket"},
 		{StepUsers, "Who is requesting"},
 		{StepExpirationChoice, "set an expiration date"},
 		{StepExpirationDate, "Enter the expiration date"},
 		{StepConfirm, "Review Exemption Details"},
 		{StepCreating, "Creating policy exemption"},
-		{StepDone, "created output"},
+		{StepDone, "2030-01-31T23:59:59Z"},
 		{StepError, "failed"},
 	}
 	for _, tt := range tests {
@@ -42,9 +49,9 @@ func TestViewEveryStep(t *testing.T) {
 	}
 
 	m.Step = StepDone
-	m.CreateOutput = ""
-	if got := m.View(); !strings.Contains(got, "No output returned") {
-		t.Fatalf("empty done view = %q", got)
+	m.Created.ExpiresOn = ""
+	if got := m.View(); !strings.Contains(got, "Expires: never") {
+		t.Fatalf("unlimited done view = %q", got)
 	}
 	m.Step = StepSelectAssignment
 	m.BlockedDefinitionIDs[strings.ToLower(m.Assignments[0].PolicyDefinitionID)] = true
@@ -57,6 +64,33 @@ func TestViewEveryStep(t *testing.T) {
 	}
 }
 
+func TestIdentityView(t *testing.T) {
+	m := populatedModel()
+	m.azureClient.(*fakeAzureClient).principal = azure.Principal{ID: "object-id", Name: "app-id", Type: "servicePrincipal"}
+	m.Step = StepSelectSubscription
+	if got := m.View(); strings.Contains(got, "Signed in as") {
+		t.Fatalf("identity shown before it was loaded:\n%s", got)
+	}
+	runCmd(t, m, fetchIdentityCmd(m.ctx, m.azureClient))
+	if got := m.View(); !strings.Contains(got, "Signed in as app-id (object-id) · service principal") {
+		t.Fatalf("identity view:\n%s", got)
+	}
+}
+
+func TestCloudView(t *testing.T) {
+	m := populatedModel()
+	m.azureClient.(*fakeAzureClient).cloud = azure.Cloud{Name: "AzureUSGovernment", PortalURL: "https://portal.azure.us"}
+	runCmd(t, m, fetchCloudCmd(m.ctx, m.azureClient))
+	m.Step = StepDone
+	m.Created = azure.Exemption{ID: "/subscriptions/sub/providers/Microsoft.Authorization/policyExemptions/ex"}
+	got := m.View()
+	for _, want := range []string{"Azure Policy Exemption CLI · AzureUSGovernment", "https://portal.azure.us/#@/resource/subscriptions/sub/providers/Microsoft.Authorization/policyExemptions/ex"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("view does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
 func TestVisibleRange(t *testing.T) {
 	tests := []struct {
 		cursor, total, limit int
@@ -77,6 +111,18 @@ func TestVisibleRange(t *testing.T) {
 	}
 }
 
+func TestComplianceLabel(t *testing.T) {
+	if got := complianceLabel(0, false); got != "" {
+		t.Fatalf("unknown count label = %q", got)
+	}
+	if got := complianceLabel(0, true); !strings.Contains(got, "compliant") {
+		t.Fatalf("compliant label = %q", got)
+	}
+	if got := complianceLabel(12, true); !strings.Contains(got, "12 non-compliant") {
+		t.Fatalf("non-compliant label = %q", got)
+	}
+}
+
 func TestFormatHint(t *testing.T) {
 	got := formatHint("Enter", "select")
 	if !strings.Contains(got, "Enter") || !strings.Contains(got, "select") {